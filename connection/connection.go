@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/Dongxiem/fastnet/eventloop"
@@ -26,12 +27,19 @@ type CallBack interface {
 
 // Connection：TCP 连接结构体
 type Connection struct {
+	id        int64
 	fd        int
 	connected atomic.Bool
 	outBuffer *ringbuffer.RingBuffer 	// 写 buffer
 	inBuffer  *ringbuffer.RingBuffer 	// 读 buffer
 	callBack  CallBack					// 回调方法
-	loop      *eventloop.EventLoop		// 循环调度
+	loop      *eventloop.EventLoop		// 循环调度，只在所属的 loop 中修改
+	loopMu    sync.RWMutex
+
+	taskMu        sync.Mutex
+	tasks         []func()				// QueueInLoop 提交的任务，迁移 loop 时保持顺序
+	taskScheduled bool
+	addrMu    sync.RWMutex				// 保护 peerAddr 与 proxyHeader，它们在解析 PROXY protocol 头部时被修改
 	peerAddr  string
 	ctx       interface{}
 	KeyValueContext
@@ -41,14 +49,31 @@ type Connection struct {
 	timingWheel *timingwheel.TimingWheel
 
 	protocol Protocol					// 使用协议
+
+	closeAfterFlush bool				// 写 buffer 发送完之后关闭连接，只在 loop 中访问
+
+	proxyPending  bool					// 等待 PROXY protocol 头部，只在 loop 中访问
+	proxyHeader   *ProxyHeader
+	proxyTimer    *timingwheel.Timer
+	onProxyHeader func(c *Connection)
+
+	hookMu     sync.Mutex
+	closeHooks []func(c *Connection)	// 连接关闭时的回调
+	moveHooks  []func(c *Connection, to *eventloop.EventLoop)	// 连接迁移时的回调
+	drainHooks []func(c *Connection)	// 写 buffer 发送完毕时的回调
+	closed     bool
 }
 
 // ErrConnectionClosed：生成新错误连接已关闭
 var ErrConnectionClosed = errors.New("connection closed")
 
+// nextID：连接 ID 生成器
+var nextID atomic.Int64
+
 // New：创建 Connection
 func New(fd int, loop *eventloop.EventLoop, sa unix.Sockaddr, protocol Protocol, tw *timingwheel.TimingWheel, idleTime time.Duration, callBack CallBack) *Connection {
 	conn := &Connection{
+		id:          nextID.Add(1),
 		fd:          fd,
 		peerAddr:    sockAddrToString(sa),
 		outBuffer:   pool.Get(),
@@ -83,6 +108,167 @@ func (c *Connection) closeTimeoutConn() func() {
 	}
 }
 
+// RunAfter：使用连接所属的 timingWheel 执行延时任务，f 在定时器协程中执行
+func (c *Connection) RunAfter(d time.Duration, f func()) *timingwheel.Timer {
+	return c.timingWheel.AfterFunc(d, f)
+}
+
+// ID：获取连接唯一 ID
+func (c *Connection) ID() int64 {
+	return c.id
+}
+
+// Loop：获取连接所属的事件循环
+func (c *Connection) Loop() *eventloop.EventLoop {
+	c.loopMu.RLock()
+	defer c.loopMu.RUnlock()
+	return c.loop
+}
+
+// QueueInLoop：在连接所属的 loop 中按提交顺序执行 f
+// 如果 f 执行之前连接已经迁移到其他 loop，则转到新的 loop 中执行
+func (c *Connection) QueueInLoop(f func()) {
+	c.taskMu.Lock()
+	c.tasks = append(c.tasks, f)
+	if c.taskScheduled {
+		c.taskMu.Unlock()
+		return
+	}
+	c.taskScheduled = true
+	c.taskMu.Unlock()
+
+	c.scheduleTasks()
+}
+
+// scheduleTasks：在连接当前所属的 loop 中执行 runTasks，同一时间只有一个 runTasks 等待执行
+func (c *Connection) scheduleTasks() {
+	loop := c.Loop()
+	loop.QueueInLoop(func() {
+		c.runTasks(loop)
+	})
+}
+
+// runTasks：在 loop 中依次执行任务，连接迁移之后剩余的任务转到新的 loop 中执行
+func (c *Connection) runTasks(loop *eventloop.EventLoop) {
+	for {
+		// 只有所属的 loop 会修改 c.loop，所以这里的判断不会过期
+		if c.Loop() != loop {
+			c.scheduleTasks()
+			return
+		}
+
+		c.taskMu.Lock()
+		if len(c.tasks) == 0 {
+			c.taskScheduled = false
+			c.taskMu.Unlock()
+			return
+		}
+		f := c.tasks[0]
+		c.tasks[0] = nil
+		c.tasks = c.tasks[1:]
+		c.taskMu.Unlock()
+
+		f()
+	}
+}
+
+// MoveTo：将连接迁移到另一个 loop，读写 buffer 中的数据保留
+// 迁移在原 loop 中异步进行，之前和之后通过 QueueInLoop 提交的任务都按顺序在新的 loop 中执行
+func (c *Connection) MoveTo(loop *eventloop.EventLoop) error {
+	if !c.connected.Get() {
+		return ErrConnectionClosed
+	}
+	c.QueueInLoop(func() {
+		c.moveInLoop(loop)
+	})
+	return nil
+}
+
+// moveInLoop：在原 loop 中注销 fd，然后在新的 loop 中重新注册
+func (c *Connection) moveInLoop(to *eventloop.EventLoop) {
+	from := c.loop
+	if !c.connected.Get() || to == from {
+		return
+	}
+
+	// 注销之后原 loop 不再处理该 fd 的事件，已经取出的事件也会因为找不到 socket 而忽略
+	from.DeleteFdInLoop(c.fd)
+	// 切换之前执行迁移回调，此时连接不会被其他 loop 关闭
+	c.runMoveHooks(to)
+
+	c.loopMu.Lock()
+	c.loop = to
+	c.loopMu.Unlock()
+
+	// 在注册之前执行的任务只会写入 buffer 或者关闭连接，epoll 为水平触发，未读取的数据在注册之后继续通知
+	to.QueueInLoop(func() {
+		if !c.connected.Get() {
+			return
+		}
+		if err := to.AddSocketAndEnableRead(c.fd, c); err != nil {
+			log.Error("[MoveTo]", c.PeerAddr(), err)
+			c.handleClose(c.fd)
+			return
+		}
+		if c.outBuffer.Length() > 0 {
+			_ = to.EnableReadWrite(c.fd)
+		}
+	})
+}
+
+// AddCloseHook：注册连接关闭时的回调，回调在 loop 中 OnClose 之后执行
+// 如果连接已经关闭，则立即执行 f
+func (c *Connection) AddCloseHook(f func(c *Connection)) {
+	c.hookMu.Lock()
+	if c.closed {
+		c.hookMu.Unlock()
+		f(c)
+		return
+	}
+	c.closeHooks = append(c.closeHooks, f)
+	c.hookMu.Unlock()
+}
+
+// AddMoveHook：注册连接迁移时的回调，回调在原 loop 中执行，此时 c.Loop() 仍然为原 loop
+func (c *Connection) AddMoveHook(f func(c *Connection, to *eventloop.EventLoop)) {
+	c.hookMu.Lock()
+	if !c.closed {
+		c.moveHooks = append(c.moveHooks, f)
+	}
+	c.hookMu.Unlock()
+}
+
+// AddDrainHook：注册写 buffer 中积压的数据全部发送完毕时的回调，回调在 loop 中执行
+func (c *Connection) AddDrainHook(f func(c *Connection)) {
+	c.hookMu.Lock()
+	if !c.closed {
+		c.drainHooks = append(c.drainHooks, f)
+	}
+	c.hookMu.Unlock()
+}
+
+// runDrainHooks：执行所有写 buffer 发送完毕回调
+func (c *Connection) runDrainHooks() {
+	c.hookMu.Lock()
+	hooks := c.drainHooks
+	c.hookMu.Unlock()
+
+	for _, f := range hooks {
+		f(c)
+	}
+}
+
+// runMoveHooks：执行所有连接迁移回调
+func (c *Connection) runMoveHooks(to *eventloop.EventLoop) {
+	c.hookMu.Lock()
+	hooks := c.moveHooks
+	c.hookMu.Unlock()
+
+	for _, f := range hooks {
+		f(c, to)
+	}
+}
+
 // Context：获取 Context
 func (c *Connection) Context() interface{} {
 	return c.ctx
@@ -93,11 +279,66 @@ func (c *Connection) SetContext(ctx interface{}) {
 	c.ctx = ctx
 }
 
-// PeerAddr：获取客户端地址信息
+// PeerAddr：获取客户端地址信息，开启 PROXY protocol 时为头部中的真实客户端地址
 func (c *Connection) PeerAddr() string {
+	c.addrMu.RLock()
+	defer c.addrMu.RUnlock()
 	return c.peerAddr
 }
 
+// ProxyHeader：获取 PROXY protocol 头部，没有开启时为 nil
+func (c *Connection) ProxyHeader() *ProxyHeader {
+	c.addrMu.RLock()
+	defer c.addrMu.RUnlock()
+	return c.proxyHeader
+}
+
+// ExpectProxyHeader：内部使用，在加入 loop 之前调用，之后读取的数据先解析 PROXY protocol 头部
+// 解析成功之后调用 onReady，超时或者头部不合法时关闭连接，此时不会调用 OnClose
+func (c *Connection) ExpectProxyHeader(timeout time.Duration, onReady func(c *Connection)) {
+	c.proxyPending = true
+	c.onProxyHeader = onReady
+	c.proxyTimer = c.timingWheel.AfterFunc(timeout, func() {
+		c.QueueInLoop(func() {
+			if c.proxyPending && c.connected.Get() {
+				log.Error("[proxy]", c.peerAddr, ErrProxyHeaderTimeout)
+				c.handleClose(c.fd)
+			}
+		})
+	})
+}
+
+// readProxyHeader：从 inBuffer 中解析 PROXY protocol 头部，返回之后是否可以继续处理数据
+func (c *Connection) readProxyHeader(fd int) bool {
+	first, end := c.inBuffer.PeekAll()
+	data := make([]byte, 0, len(first)+len(end))
+	data = append(append(data, first...), end...)
+
+	h, n, err := parseProxyHeader(data)
+	if err != nil {
+		log.Error("[proxy]", c.peerAddr, err)
+		c.handleClose(fd)
+		return false
+	}
+	if n == 0 {
+		return false
+	}
+
+	c.inBuffer.Retrieve(n)
+	c.proxyPending = false
+	c.proxyTimer.Stop()
+	c.addrMu.Lock()
+	c.proxyHeader = h
+	if h.Source != nil {
+		c.peerAddr = h.Source.String()
+	}
+	c.addrMu.Unlock()
+	if c.onProxyHeader != nil {
+		c.onProxyHeader(c)
+	}
+	return c.connected.Get()
+}
+
 // Connected：测试是否已连接
 func (c *Connection) Connected() bool {
 	return c.connected.Get()
@@ -111,7 +352,7 @@ func (c *Connection) Send(buffer []byte) error {
 	}
 
 	// 循环调用 sendInLoop 方法
-	c.loop.QueueInLoop(func() {
+	c.QueueInLoop(func() {
 		// 进行协议打包封装之后再发送
 		c.sendInLoop(c.protocol.Packet(c, buffer))
 	})
@@ -125,12 +366,46 @@ func (c *Connection) Close() error {
 		return ErrConnectionClosed
 	}
 	// 进去循环 loop中调用关闭函数
-	c.loop.QueueInLoop(func() {
+	c.QueueInLoop(func() {
 		c.handleClose(c.fd)
 	})
 	return nil
 }
 
+// CloseAfterFlush：写 buffer 中的数据全部发送之后再关闭连接
+func (c *Connection) CloseAfterFlush() error {
+	if !c.connected.Get() {
+		return ErrConnectionClosed
+	}
+	c.QueueInLoop(func() {
+		if !c.connected.Get() {
+			return
+		}
+		if c.outBuffer.Length() == 0 {
+			c.handleClose(c.fd)
+			return
+		}
+		c.closeAfterFlush = true
+	})
+	return nil
+}
+
+// SendInLoop：内部使用，必须在 loop 中调用，发送已经经过协议封装的数据
+func (c *Connection) SendInLoop(data []byte) {
+	if !c.connected.Get() {
+		return
+	}
+	c.sendInLoop(data)
+}
+
+// OutBufferLength：内部使用，必须在 loop 中调用，返回写 buffer 中待发送的数据长度
+func (c *Connection) OutBufferLength() int {
+	if !c.connected.Get() {
+		return 0
+	}
+	return c.outBuffer.Length()
+}
+
 // ShutdownWrite：关闭可写端，等待读取完接收缓冲区所有数据
 func (c *Connection) ShutdownWrite() error {
 	c.connected.Set(false)
@@ -193,10 +468,20 @@ func (c *Connection) handleRead(fd int) {
 		return
 	}
 
+	data := buf[:n]
+	if c.proxyPending {
+		// 在交给 Protocol 之前先解析 PROXY protocol 头部
+		_, _ = c.inBuffer.Write(data)
+		if !c.readProxyHeader(fd) || c.inBuffer.Length() == 0 {
+			return
+		}
+		data = nil
+	}
+
 	if c.inBuffer.Length() == 0 {
 		// 1. 如果 inBuffer 为空
-		// 通过 ringbuffer.NewWithData 传入 buf[:n] 创建一个新的 buffer
-		buffer := ringbuffer.NewWithData(buf[:n])
+		// 通过 ringbuffer.NewWithData 传入 data 创建一个新的 buffer
+		buffer := ringbuffer.NewWithData(data)
 		// 使用 handlerProtocol 进行解析得到 out
 		out := c.handlerProtocol(buffer)
 		// 如果此时 buffer 长度不为 0，则获取其内容并写入到 inBuffer 中
@@ -212,7 +497,7 @@ func (c *Connection) handleRead(fd int) {
 		pbytes.Put(out)
 	} else {
 		// 2. 如果 inBuffer 不为空，则写入到 inBuffer 中
-		_, _ = c.inBuffer.Write(buf[:n])
+		_, _ = c.inBuffer.Write(data)
 		out := c.handlerProtocol(c.inBuffer)
 		if len(out) != 0 {
 			c.sendInLoop(out)
@@ -255,9 +540,14 @@ func (c *Connection) handleWrite(fd int) {
 
 	// 处理完了之后，通知 fd 可读
 	if c.outBuffer.Length() == 0 {
+		if c.closeAfterFlush {
+			c.handleClose(fd)
+			return
+		}
 		if err := c.loop.EnableRead(fd); err != nil {
 			log.Error("[EnableRead]", err)
 		}
+		c.runDrainHooks()
 	}
 }
 
@@ -267,17 +557,41 @@ func (c *Connection) handleClose(fd int) {
 		c.connected.Set(false)
 		c.loop.DeleteFdInLoop(fd)
 
-		// 关闭事件会调用 OnClose
-		c.callBack.OnClose(c)
+		// 关闭事件会调用 OnClose，没有收到 PROXY protocol 头部的连接没有调用过 OnConnect，也不调用 OnClose
+		if !c.proxyPending {
+			c.callBack.OnClose(c)
+		}
+		if c.proxyTimer != nil {
+			c.proxyTimer.Stop()
+		}
+		c.runCloseHooks()
 		if err := unix.Close(fd); err != nil {
 			log.Error("[close fd]", err)
 		}
 
+		// pool 不会清空 buffer，未处理的数据不能留给下一个连接
+		c.inBuffer.RetrieveAll()
+		c.outBuffer.RetrieveAll()
 		pool.Put(c.inBuffer)
 		pool.Put(c.outBuffer)
 	}
 }
 
+// runCloseHooks：执行所有连接关闭回调
+func (c *Connection) runCloseHooks() {
+	c.hookMu.Lock()
+	hooks := c.closeHooks
+	c.closeHooks = nil
+	c.moveHooks = nil
+	c.drainHooks = nil
+	c.closed = true
+	c.hookMu.Unlock()
+
+	for _, f := range hooks {
+		f(c)
+	}
+}
+
 // sendInLoop：送入循环，data 为经过协议处理过后的数据
 func (c *Connection) sendInLoop(data []byte) {
 	if c.outBuffer.Length() > 0 {
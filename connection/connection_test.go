@@ -0,0 +1,41 @@
+package connection
+
+import (
+	"testing"
+
+	"github.com/Dongxiem/fastnet/eventloop"
+	"golang.org/x/sys/unix"
+)
+
+type closeCallback struct{}
+
+func (closeCallback) OnMessage(c *Connection, ctx interface{}, data []byte) []byte { return nil }
+
+func (closeCallback) OnClose(c *Connection) {}
+
+func TestConnection_CloseResetsBuffers(t *testing.T) {
+	fds, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_STREAM, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unix.Close(fds[1])
+	loop, err := eventloop.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer loop.Stop()
+
+	c := New(fds[0], loop, nil, &DefaultProtocol{}, nil, 0, closeCallback{})
+	if err = loop.AddSocketAndEnableRead(fds[0], c); err != nil {
+		t.Fatal(err)
+	}
+	in, out := c.inBuffer, c.outBuffer
+	_, _ = in.Write([]byte("partial"))
+	_, _ = out.Write([]byte("pending"))
+
+	// buffer 归还给 pool 之前需要清空
+	c.handleClose(c.fd)
+	if in.Length() != 0 || out.Length() != 0 {
+		t.Fatalf("buffers should be empty, got %d %d", in.Length(), out.Length())
+	}
+}
@@ -0,0 +1,149 @@
+package connection
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/Dongxiem/fastnet/eventloop"
+	"github.com/Dongxiem/fastnet/tool/ringbuffer"
+	"golang.org/x/sys/unix"
+)
+
+// lineProtocol：以 \n 分隔消息，不完整的消息留在 buffer 中
+type lineProtocol struct{}
+
+func (lineProtocol) UnPacket(c *Connection, buffer *ringbuffer.RingBuffer) (interface{}, []byte) {
+	first, end := buffer.PeekAll()
+	data := append(append([]byte(nil), first...), end...)
+	i := bytes.IndexByte(data, '\n')
+	if i < 0 {
+		return nil, nil
+	}
+	buffer.Retrieve(i + 1)
+	return nil, data[:i]
+}
+
+func (lineProtocol) Packet(c *Connection, data []byte) []byte {
+	return data
+}
+
+type moveCallback struct {
+	messages chan string
+}
+
+func (cb *moveCallback) OnMessage(c *Connection, ctx interface{}, data []byte) []byte {
+	cb.messages <- string(data)
+	return nil
+}
+
+func (cb *moveCallback) OnClose(c *Connection) {}
+
+func newLoop(t *testing.T) *eventloop.EventLoop {
+	loop, err := eventloop.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	go loop.RunLoop()
+	t.Cleanup(func() {
+		_ = loop.Stop()
+	})
+	return loop
+}
+
+// inLoop：在连接所属的 loop 中执行 f 并等待完成
+func inLoop(c *Connection, f func()) {
+	done := make(chan struct{})
+	c.QueueInLoop(func() {
+		f()
+		close(done)
+	})
+	<-done
+}
+
+func TestConnection_MoveTo(t *testing.T) {
+	fds, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_STREAM, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = unix.SetNonblock(fds[0], true)
+	_ = unix.SetsockoptTimeval(fds[1], unix.SOL_SOCKET, unix.SO_RCVTIMEO, &unix.Timeval{Sec: 2})
+	defer unix.Close(fds[1])
+
+	from, to := newLoop(t), newLoop(t)
+	cb := &moveCallback{messages: make(chan string, 4)}
+	c := New(fds[0], from, nil, lineProtocol{}, nil, 0, cb)
+	if err = from.AddSocketAndEnableRead(fds[0], c); err != nil {
+		t.Fatal(err)
+	}
+
+	// 读 buffer 中留下不完整的消息
+	_, _ = unix.Write(fds[1], []byte("hel"))
+	inLoop(c, func() {
+		c.handleRead(c.fd)
+	})
+
+	// 写 buffer 中有待发送的数据时迁移，迁移前后提交的任务按顺序在新的 loop 中执行
+	var loops []*eventloop.EventLoop
+	block := make(chan struct{})
+	from.QueueInLoop(func() {
+		<-block
+		_, _ = c.outBuffer.Write([]byte("a"))
+	})
+	if err = c.Send([]byte("b")); err != nil {
+		t.Fatal(err)
+	}
+	if err = c.MoveTo(to); err != nil {
+		t.Fatal(err)
+	}
+	_ = c.Send([]byte("c"))
+	c.QueueInLoop(func() {
+		loops = append(loops, c.loop)
+	})
+	close(block)
+
+	var got []byte
+	buf := make([]byte, 16)
+	for len(got) < 3 {
+		n, err := unix.Read(fds[1], buf)
+		if err != nil {
+			t.Fatalf("got %q, %v", got, err)
+		}
+		got = append(got, buf[:n]...)
+	}
+	if string(got) != "abc" {
+		t.Fatalf("got %q", got)
+	}
+
+	inLoop(c, func() {
+		if len(loops) != 1 || loops[0] != to || c.Loop() != to {
+			t.Error("tasks should run in the new loop")
+		}
+	})
+
+	// 读 buffer 中的数据保留
+	_, _ = unix.Write(fds[1], []byte("lo\n"))
+	inLoop(c, func() {
+		c.handleRead(c.fd)
+	})
+	select {
+	case msg := <-cb.messages:
+		if msg != "hello" {
+			t.Fatalf("got %q", msg)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("message lost after move")
+	}
+
+	// 迁移到当前 loop 没有任何效果，关闭之后不能再迁移
+	if err = c.MoveTo(to); err != nil {
+		t.Fatal(err)
+	}
+	_ = c.Close()
+	if n, err := unix.Read(fds[1], buf); n != 0 || err != nil {
+		t.Fatalf("connection should be closed, got %d %v", n, err)
+	}
+	if err = c.MoveTo(from); err != ErrConnectionClosed {
+		t.Fatalf("got %v", err)
+	}
+}
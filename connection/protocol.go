@@ -1,6 +1,7 @@
 package connection
 
 import (
+	"github.com/Dongxiem/fastnet/log"
 	"github.com/Dongxiem/fastnet/tool/ringbuffer"
 )
 
@@ -28,3 +29,26 @@ func (d *DefaultProtocol) UnPacket(c *Connection, buffer *ringbuffer.RingBuffer)
 func (d *DefaultProtocol) Packet(c *Connection, data []byte) []byte {
 	return data
 }
+
+// ErrorHandler：Protocol 拆包出错时的回调，回调之后连接会被关闭
+type ErrorHandler func(c *Connection, err error)
+
+// LogError：返回使用 tag 记录日志的 ErrorHandler，作为插件中 OnError 的默认值
+func LogError(tag string) ErrorHandler {
+	return func(c *Connection, err error) {
+		if c == nil {
+			log.Error(tag, err)
+			return
+		}
+		log.Error(tag, c.PeerAddr(), err)
+	}
+}
+
+// CloseOnError：丢弃 buffer 中已经接收的数据，回调 onError 并关闭连接
+func CloseOnError(c *Connection, buffer *ringbuffer.RingBuffer, onError ErrorHandler, err error) {
+	buffer.RetrieveAll()
+	onError(c, err)
+	if c != nil {
+		_ = c.Close()
+	}
+}
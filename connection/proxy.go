@@ -0,0 +1,260 @@
+package connection
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"net"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrInvalidProxyHeader：PROXY protocol 头部不合法
+	ErrInvalidProxyHeader = errors.New("connection: invalid PROXY protocol header")
+	// ErrProxyHeaderTimeout：超时之前没有收到完整的 PROXY protocol 头部
+	ErrProxyHeaderTimeout = errors.New("connection: PROXY protocol header timeout")
+)
+
+var (
+	proxyV1Prefix    = []byte("PROXY ")
+	proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+)
+
+const (
+	proxyV1MaxLen    = 107 // v1 头部包括 CRLF 的最大长度
+	proxyV2HeaderLen = 16  // v2 签名、版本与命令、地址族、长度
+)
+
+// ProxyCommand：v2 头部中的命令，v1 头部总是 ProxyCommandProxy
+type ProxyCommand uint8
+
+const (
+	// ProxyCommandLocal：代理自身发起的连接（例如健康检查），没有地址信息
+	ProxyCommandLocal ProxyCommand = 0x0
+	// ProxyCommandProxy：代理转发的连接
+	ProxyCommandProxy ProxyCommand = 0x1
+)
+
+// v2 头部中预定义的 TLV 类型
+// See https://www.haproxy.org/download/2.3/doc/proxy-protocol.txt
+const (
+	ProxyTLVALPN      = 0x01
+	ProxyTLVAuthority = 0x02
+	ProxyTLVCRC32C    = 0x03
+	ProxyTLVNoop      = 0x04
+	ProxyTLVUniqueID  = 0x05
+	ProxyTLVSSL       = 0x20
+	ProxyTLVNetNS     = 0x30
+)
+
+// ProxyTLV：v2 头部中的扩展字段
+type ProxyTLV struct {
+	Type  uint8
+	Value []byte
+}
+
+// ProxyHeader：PROXY protocol 头部
+type ProxyHeader struct {
+	Version     int // 1 或 2
+	Command     ProxyCommand
+	Source      net.Addr // 真实的客户端地址，LOCAL 命令或者 UNKNOWN 地址族时为 nil
+	Destination net.Addr // 客户端连接的代理地址，LOCAL 命令或者 UNKNOWN 地址族时为 nil
+	TLVs        []ProxyTLV
+}
+
+// TLV：返回第一个指定类型的 TLV
+func (h *ProxyHeader) TLV(t uint8) ([]byte, bool) {
+	for _, tlv := range h.TLVs {
+		if tlv.Type == t {
+			return tlv.Value, true
+		}
+	}
+	return nil, false
+}
+
+// parseProxyHeader：解析 v1 或者 v2 头部，返回头部与消耗的字节数，数据不完整时 n 为 0
+func parseProxyHeader(data []byte) (h *ProxyHeader, n int, err error) {
+	switch {
+	case bytes.HasPrefix(data, proxyV2Signature):
+		return parseProxyV2(data)
+	case bytes.HasPrefix(data, proxyV1Prefix):
+		return parseProxyV1(data)
+	case bytes.HasPrefix(proxyV2Signature, data) || bytes.HasPrefix(proxyV1Prefix, data):
+		return nil, 0, nil
+	default:
+		return nil, 0, ErrInvalidProxyHeader
+	}
+}
+
+// parseProxyV1：PROXY TCP4 192.168.0.1 192.168.0.11 56324 443\r\n
+func parseProxyV1(data []byte) (*ProxyHeader, int, error) {
+	i := bytes.Index(data, []byte("\r\n"))
+	if i < 0 {
+		if len(data) >= proxyV1MaxLen {
+			return nil, 0, ErrInvalidProxyHeader
+		}
+		return nil, 0, nil
+	}
+	if i+2 > proxyV1MaxLen {
+		return nil, 0, ErrInvalidProxyHeader
+	}
+
+	h := &ProxyHeader{Version: 1, Command: ProxyCommandProxy}
+	fields := strings.Split(string(data[:i]), " ")
+	if len(fields) < 2 {
+		return nil, 0, ErrInvalidProxyHeader
+	}
+	switch fields[1] {
+	case "UNKNOWN":
+		// 之后的内容直接忽略
+		return h, i + 2, nil
+	case "TCP4", "TCP6":
+	default:
+		return nil, 0, ErrInvalidProxyHeader
+	}
+	if len(fields) != 6 {
+		return nil, 0, ErrInvalidProxyHeader
+	}
+
+	v4 := fields[1] == "TCP4"
+	src, err1 := parseProxyV1Addr(fields[2], fields[4], v4)
+	dst, err2 := parseProxyV1Addr(fields[3], fields[5], v4)
+	if err1 != nil || err2 != nil {
+		return nil, 0, ErrInvalidProxyHeader
+	}
+	h.Source, h.Destination = src, dst
+	return h, i + 2, nil
+}
+
+func parseProxyV1Addr(host, port string, v4 bool) (*net.TCPAddr, error) {
+	ip := net.ParseIP(host)
+	if ip == nil || v4 != (ip.To4() != nil && !strings.Contains(host, ":")) {
+		return nil, ErrInvalidProxyHeader
+	}
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return nil, ErrInvalidProxyHeader
+	}
+	return &net.TCPAddr{IP: ip, Port: int(p)}, nil
+}
+
+// parseProxyV2：二进制头部，地址之后为 TLV
+func parseProxyV2(data []byte) (*ProxyHeader, int, error) {
+	if len(data) < proxyV2HeaderLen {
+		return nil, 0, nil
+	}
+	n := proxyV2HeaderLen + int(binary.BigEndian.Uint16(data[14:]))
+	if len(data) < n {
+		return nil, 0, nil
+	}
+
+	if data[12]>>4 != 2 {
+		return nil, 0, ErrInvalidProxyHeader
+	}
+	h := &ProxyHeader{Version: 2, Command: ProxyCommand(data[12] & 0xf)}
+	if h.Command != ProxyCommandLocal && h.Command != ProxyCommandProxy {
+		return nil, 0, ErrInvalidProxyHeader
+	}
+
+	payload := data[proxyV2HeaderLen:n]
+	family, transport := data[13]>>4, data[13]&0xf
+	var addrLen int
+	switch family {
+	case 0x0: // AF_UNSPEC
+	case 0x1: // AF_INET
+		addrLen = 12
+	case 0x2: // AF_INET6
+		addrLen = 36
+	case 0x3: // AF_UNIX
+		addrLen = 216
+	default:
+		return nil, 0, ErrInvalidProxyHeader
+	}
+	if len(payload) < addrLen || transport > 0x2 {
+		return nil, 0, ErrInvalidProxyHeader
+	}
+
+	// LOCAL 命令忽略地址信息
+	if h.Command == ProxyCommandProxy && transport != 0x0 {
+		h.Source, h.Destination = parseProxyV2Addr(family, transport, payload[:addrLen])
+	}
+
+	tlvs, crcOffset, err := parseProxyTLVs(payload[addrLen:])
+	if err != nil {
+		return nil, 0, err
+	}
+	if crcOffset >= 0 && !validProxyChecksum(data[:n], proxyV2HeaderLen+addrLen+crcOffset) {
+		return nil, 0, ErrInvalidProxyHeader
+	}
+	h.TLVs = tlvs
+	return h, n, nil
+}
+
+func parseProxyV2Addr(family, transport byte, b []byte) (src, dst net.Addr) {
+	var srcIP, dstIP net.IP
+	var ports []byte
+	switch family {
+	case 0x1:
+		srcIP, dstIP, ports = net.IP(b[0:4]), net.IP(b[4:8]), b[8:12]
+	case 0x2:
+		srcIP, dstIP, ports = net.IP(b[0:16]), net.IP(b[16:32]), b[32:36]
+	case 0x3:
+		network := "unix"
+		if transport == 0x2 {
+			network = "unixgram"
+		}
+		return &net.UnixAddr{Name: cString(b[:108]), Net: network}, &net.UnixAddr{Name: cString(b[108:]), Net: network}
+	default:
+		return nil, nil
+	}
+
+	srcPort := int(binary.BigEndian.Uint16(ports))
+	dstPort := int(binary.BigEndian.Uint16(ports[2:]))
+	if transport == 0x2 {
+		return &net.UDPAddr{IP: srcIP, Port: srcPort}, &net.UDPAddr{IP: dstIP, Port: dstPort}
+	}
+	return &net.TCPAddr{IP: srcIP, Port: srcPort}, &net.TCPAddr{IP: dstIP, Port: dstPort}
+}
+
+// parseProxyTLVs：1 字节类型、2 字节长度与值，同时返回 CRC32C 值的偏移，没有时为 -1
+func parseProxyTLVs(b []byte) (tlvs []ProxyTLV, crcOffset int, err error) {
+	crcOffset = -1
+	for off := 0; off < len(b); {
+		if len(b)-off < 3 {
+			return nil, 0, ErrInvalidProxyHeader
+		}
+		n := 3 + int(binary.BigEndian.Uint16(b[off+1:]))
+		if len(b)-off < n {
+			return nil, 0, ErrInvalidProxyHeader
+		}
+		if b[off] == ProxyTLVCRC32C {
+			if n != 7 {
+				return nil, 0, ErrInvalidProxyHeader
+			}
+			crcOffset = off + 3
+		}
+		tlvs = append(tlvs, ProxyTLV{Type: b[off], Value: append([]byte(nil), b[off+3:off+n]...)})
+		off += n
+	}
+	return tlvs, crcOffset, nil
+}
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// validProxyChecksum：CRC32C 覆盖整个头部，计算时校验和字段为 0
+func validProxyChecksum(header []byte, offset int) bool {
+	sum := binary.BigEndian.Uint32(header[offset:])
+	zeroed := append([]byte(nil), header...)
+	copy(zeroed[offset:offset+4], []byte{0, 0, 0, 0})
+	return crc32.Checksum(zeroed, castagnoli) == sum
+}
+
+// cString：去掉结尾的 NUL
+func cString(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	return string(b)
+}
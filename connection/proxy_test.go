@@ -0,0 +1,238 @@
+package connection
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"testing"
+	"time"
+
+	"github.com/Dongxiem/fastnet/eventloop"
+	"github.com/RussellLuo/timingwheel"
+	"golang.org/x/sys/unix"
+)
+
+// proxyV2：构造 v2 头部，crc 为 true 时在最后追加正确的 CRC32C TLV
+func proxyV2(verCmd, fam byte, addr []byte, crc bool, tlvs ...ProxyTLV) []byte {
+	payload := append([]byte(nil), addr...)
+	for _, tlv := range tlvs {
+		payload = append(payload, tlv.Type, byte(len(tlv.Value)>>8), byte(len(tlv.Value)))
+		payload = append(payload, tlv.Value...)
+	}
+	if crc {
+		payload = append(payload, ProxyTLVCRC32C, 0, 4, 0, 0, 0, 0)
+	}
+	h := append(append([]byte(nil), proxyV2Signature...), verCmd, fam, byte(len(payload)>>8), byte(len(payload)))
+	h = append(h, payload...)
+	if crc {
+		binary.BigEndian.PutUint32(h[len(h)-4:], crc32.Checksum(h, crc32.MakeTable(crc32.Castagnoli)))
+	}
+	return h
+}
+
+func TestParseProxyHeader(t *testing.T) {
+	inet4 := []byte{10, 0, 0, 1, 10, 0, 0, 2, 0x1f, 0x90, 0x01, 0xbb}
+	inet6 := make([]byte, 36)
+	inet6[15], inet6[31], inet6[33], inet6[35] = 1, 2, 53, 53
+	unixAddr := make([]byte, 216)
+	copy(unixAddr, "/tmp/src.sock")
+	copy(unixAddr[108:], "/tmp/dst.sock")
+	badCRC := proxyV2(0x21, 0x11, inet4, true)
+	badCRC[len(badCRC)-1]++
+
+	tests := []struct {
+		name     string
+		in       []byte
+		n        int // 0 时为数据不完整
+		err      bool
+		src, dst string
+		tlvs     int
+	}{
+		{name: "v1 tcp4", in: []byte("PROXY TCP4 192.168.0.1 192.168.0.11 56324 443\r\nGET"), n: 47,
+			src: "192.168.0.1:56324", dst: "192.168.0.11:443"},
+		{name: "v1 tcp6", in: []byte("PROXY TCP6 ::1 2001:db8::1 1 2\r\n"), n: 32, src: "[::1]:1", dst: "[2001:db8::1]:2"},
+		{name: "v1 unknown", in: []byte("PROXY UNKNOWN ffff::1 ffff::2 1 2\r\n"), n: 35},
+		{name: "v1 partial", in: []byte("PROXY TCP4 192.168.0.1")},
+		{name: "v1 prefix", in: []byte("PRO")},
+		{name: "v1 family mismatch", in: []byte("PROXY TCP4 ::1 ::2 1 2\r\n"), err: true},
+		{name: "v1 bad port", in: []byte("PROXY TCP4 1.1.1.1 2.2.2.2 1 65536\r\n"), err: true},
+		{name: "v1 missing field", in: []byte("PROXY TCP4 1.1.1.1 2.2.2.2 1\r\n"), err: true},
+		{name: "v1 too long", in: append([]byte("PROXY UNKNOWN "), make([]byte, 100)...), err: true},
+		{name: "v2 tcp4", in: proxyV2(0x21, 0x11, inet4, true, ProxyTLV{ProxyTLVAuthority, []byte("example.com")}),
+			n: 16 + 12 + 14 + 7, src: "10.0.0.1:8080", dst: "10.0.0.2:443", tlvs: 2},
+		{name: "v2 udp6", in: proxyV2(0x21, 0x22, inet6, false), n: 16 + 36, src: "[::1]:53", dst: "[::2]:53"},
+		{name: "v2 unix", in: proxyV2(0x21, 0x31, unixAddr, false), n: 16 + 216, src: "/tmp/src.sock", dst: "/tmp/dst.sock"},
+		{name: "v2 local", in: proxyV2(0x20, 0x11, inet4, false), n: 16 + 12},
+		{name: "v2 partial", in: proxyV2(0x21, 0x11, inet4, false)[:20]},
+		{name: "v2 signature prefix", in: proxyV2Signature[:5]},
+		{name: "v2 bad version", in: proxyV2(0x11, 0x11, inet4, false), err: true},
+		{name: "v2 bad command", in: proxyV2(0x22, 0x11, inet4, false), err: true},
+		{name: "v2 short address", in: proxyV2(0x21, 0x21, inet4, false), err: true},
+		{name: "v2 truncated tlv", in: proxyV2(0x21, 0x11, append(inet4, ProxyTLVNoop, 0, 9), false), err: true},
+		{name: "v2 bad crc", in: badCRC, err: true},
+		{name: "not proxy", in: []byte("GET / HTTP/1.1\r\n"), err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, n, err := parseProxyHeader(tt.in)
+			if (err != nil) != tt.err || n != tt.n {
+				t.Fatalf("got %d %v", n, err)
+			}
+			if tt.n == 0 {
+				return
+			}
+			if tt.src == "" {
+				if h.Source != nil || h.Destination != nil {
+					t.Fatalf("got %v %v", h.Source, h.Destination)
+				}
+			} else if h.Source.String() != tt.src || h.Destination.String() != tt.dst {
+				t.Fatalf("got %v %v", h.Source, h.Destination)
+			}
+			if len(h.TLVs) != tt.tlvs {
+				t.Fatalf("got %v", h.TLVs)
+			}
+		})
+	}
+
+	h, _, _ := parseProxyHeader(tests[9].in)
+	if v, ok := h.TLV(ProxyTLVAuthority); !ok || string(v) != "example.com" || h.Version != 2 || h.Command != ProxyCommandProxy {
+		t.Fatalf("got %+v", h)
+	}
+}
+
+type proxyCallback struct {
+	connected chan string
+	messages  chan string
+	closed    chan struct{}
+}
+
+func (cb *proxyCallback) OnMessage(c *Connection, ctx interface{}, data []byte) []byte {
+	cb.messages <- string(data)
+	return nil
+}
+
+func (cb *proxyCallback) OnClose(c *Connection) {
+	close(cb.closed)
+}
+
+// newProxyConn：创建 socketpair 上等待 PROXY protocol 头部的连接，返回连接与对端的 fd
+func newProxyConn(t *testing.T, timeout time.Duration) (*Connection, int, *proxyCallback) {
+	fds, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_STREAM, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = unix.SetNonblock(fds[0], true)
+	_ = unix.SetsockoptTimeval(fds[1], unix.SOL_SOCKET, unix.SO_RCVTIMEO, &unix.Timeval{Sec: 2})
+
+	loop, err := eventloop.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	go loop.RunLoop()
+	tw := timingwheel.NewTimingWheel(time.Millisecond, 20)
+	tw.Start()
+	t.Cleanup(func() {
+		tw.Stop()
+		_ = loop.Stop()
+		_ = unix.Close(fds[1])
+	})
+
+	cb := &proxyCallback{connected: make(chan string, 1), messages: make(chan string, 4), closed: make(chan struct{})}
+	c := New(fds[0], loop, nil, &DefaultProtocol{}, tw, 0, cb)
+	c.ExpectProxyHeader(timeout, func(c *Connection) {
+		cb.connected <- c.PeerAddr()
+	})
+	if err = loop.AddSocketAndEnableRead(fds[0], c); err != nil {
+		t.Fatal(err)
+	}
+	return c, fds[1], cb
+}
+
+func TestConnection_ProxyHeader(t *testing.T) {
+	c, fd, cb := newProxyConn(t, time.Minute)
+
+	// 头部分两次到达，之后的数据交给 Protocol
+	header := "PROXY TCP4 203.0.113.7 10.0.0.1 40000 80\r\n"
+	_, _ = unix.Write(fd, []byte(header[:20]))
+	c.handleRead(c.fd)
+	if c.ProxyHeader() != nil || len(cb.connected) != 0 {
+		t.Fatal("header should not be ready")
+	}
+	_, _ = unix.Write(fd, []byte(header[20:]+"hello"))
+	c.handleRead(c.fd)
+
+	if addr := <-cb.connected; addr != "203.0.113.7:40000" || c.PeerAddr() != addr {
+		t.Fatalf("got %s", addr)
+	}
+	if dst := c.ProxyHeader().Destination.String(); dst != "10.0.0.1:80" {
+		t.Fatalf("got %s", dst)
+	}
+	if msg := <-cb.messages; msg != "hello" {
+		t.Fatalf("got %q", msg)
+	}
+	_, _ = unix.Write(fd, []byte("world"))
+	c.handleRead(c.fd)
+	if msg := <-cb.messages; msg != "world" {
+		t.Fatalf("got %q", msg)
+	}
+}
+
+func TestConnection_ProxyHeaderError(t *testing.T) {
+	// 头部不合法时关闭连接，不调用 OnConnect 与 OnClose
+	c, fd, cb := newProxyConn(t, time.Minute)
+	_, _ = unix.Write(fd, []byte("GET / HTTP/1.1\r\n\r\n"))
+	c.handleRead(c.fd)
+	if n, err := unix.Read(fd, make([]byte, 8)); n != 0 || err != nil {
+		t.Fatalf("connection should be closed, got %d %v", n, err)
+	}
+	if c.Connected() || len(cb.connected) != 0 || len(cb.messages) != 0 {
+		t.Fatal("callbacks should not be called")
+	}
+	select {
+	case <-cb.closed:
+		t.Fatal("OnClose should not be called")
+	default:
+	}
+
+	// 超时之前没有收到头部
+	start := time.Now()
+	_, fd, cb = newProxyConn(t, 30*time.Millisecond)
+	if n, err := unix.Read(fd, make([]byte, 8)); n != 0 || err != nil || time.Since(start) < 20*time.Millisecond {
+		t.Fatalf("connection should be closed after timeout, got %d %v after %v", n, err, time.Since(start))
+	}
+	select {
+	case <-cb.closed:
+		t.Fatal("OnClose should not be called")
+	default:
+	}
+}
+
+func TestConnection_ProxyHeaderConcurrentPeerAddr(t *testing.T) {
+	c, fd, cb := newProxyConn(t, time.Minute)
+
+	// 其他协程读取地址的同时在 loop 中解析头部
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				_ = c.PeerAddr()
+				_ = c.ProxyHeader()
+			}
+		}
+	}()
+
+	_, _ = unix.Write(fd, []byte("PROXY TCP4 203.0.113.7 10.0.0.1 40000 80\r\n"))
+	inLoop(c, func() {
+		c.handleRead(c.fd)
+	})
+	close(stop)
+	<-done
+
+	if addr := <-cb.connected; addr != "203.0.113.7:40000" || c.ProxyHeader() == nil {
+		t.Fatalf("got %s", addr)
+	}
+}
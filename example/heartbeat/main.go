@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/Dongxiem/fastnet"
+	"github.com/Dongxiem/fastnet/connection"
+	"github.com/Dongxiem/fastnet/plugins/heartbeat"
+)
+
+type example struct{}
+
+func (s *example) OnConnect(c *connection.Connection) {
+	log.Println(" OnConnect ： ", c.PeerAddr())
+}
+
+func (s *example) OnMessage(c *connection.Connection, ctx interface{}, data []byte) (out []byte) {
+	// pong 不会到达这里
+	log.Println("OnMessage:", string(data))
+	out = data
+	return
+}
+
+func (s *example) OnClose(c *connection.Connection) {
+	log.Println("OnClose")
+}
+
+func main() {
+	var port int
+	var loops int
+
+	flag.IntVar(&port, "port", 1833, "server port")
+	flag.IntVar(&loops, "loops", -1, "num loops")
+	flag.Parse()
+
+	// 静默 5s 发送 ping，连续 2 个 ping 没有回应则关闭连接
+	p := heartbeat.New(&connection.DefaultProtocol{},
+		heartbeat.Interval(5*time.Second),
+		heartbeat.MaxMissed(2),
+		heartbeat.Ping([]byte("ping\n")),
+		heartbeat.MatchPong(func(ctx interface{}, data []byte) bool {
+			return bytes.Equal(bytes.TrimSpace(data), []byte("pong"))
+		}))
+
+	s, err := fastnet.NewServer(heartbeat.NewHandlerWrap(p, new(example)),
+		fastnet.Network("tcp"),
+		fastnet.Address(":"+strconv.Itoa(port)),
+		fastnet.NumLoops(loops),
+		fastnet.Protocol(p))
+	if err != nil {
+		panic(err)
+	}
+
+	s.Start()
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"flag"
+	"strconv"
+	"time"
+
+	"github.com/Dongxiem/fastnet"
+	"github.com/Dongxiem/fastnet/connection"
+	"github.com/Dongxiem/fastnet/plugins/http"
+)
+
+func main() {
+	var port int
+	var loops int
+
+	flag.IntVar(&port, "port", 1833, "server port")
+	flag.IntVar(&loops, "loops", -1, "num loops")
+	flag.Parse()
+
+	// 注册路由
+	router := http.NewRouter()
+	router.GET("/health", func(c *connection.Connection, req *http.Request) *http.Response {
+		return http.Text(200, "ok")
+	})
+	router.POST("/echo", func(c *connection.Connection, req *http.Request) *http.Response {
+		return http.NewResponse(200, req.Body)
+	})
+	// SSE 事件流，每 15s 发送一次 keepalive
+	router.GET("/events", http.SSE(15*time.Second, func(s *http.Stream) {
+		_ = s.Send(&http.Event{ID: "1", Event: "hello", Data: []byte("last id: " + s.LastEventID())})
+	}))
+
+	s, err := fastnet.NewServer(http.NewHandlerWrap(router),
+		fastnet.Network("tcp"),
+		fastnet.Address(":"+strconv.Itoa(port)),
+		fastnet.NumLoops(loops),
+		fastnet.Protocol(http.New()))
+	if err != nil {
+		panic(err)
+	}
+
+	s.Start()
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"flag"
+	"strconv"
+	"sync"
+
+	"github.com/Dongxiem/fastnet"
+	"github.com/Dongxiem/fastnet/connection"
+	"github.com/Dongxiem/fastnet/plugins/mqtt"
+)
+
+// 定义 example 类型，实现一个只支持精确匹配与 QoS 0 转发的简单 broker
+type example struct {
+	mu   sync.RWMutex
+	subs map[string]map[*connection.Connection]struct{}
+}
+
+func (s *example) OnConnect(c *connection.Connection) {}
+
+func (s *example) OnMessage(c *connection.Connection, ctx interface{}, data []byte) (out []byte) {
+	session := mqtt.GetSession(c)
+
+	switch p := ctx.(type) {
+	case *mqtt.Subscribe:
+		ack := &mqtt.SubAck{PacketID: p.PacketID}
+		s.mu.Lock()
+		for _, sub := range p.Subscriptions {
+			if s.subs[sub.Topic] == nil {
+				s.subs[sub.Topic] = make(map[*connection.Connection]struct{})
+			}
+			s.subs[sub.Topic][c] = struct{}{}
+			ack.ReasonCodes = append(ack.ReasonCodes, mqtt.Success)
+		}
+		s.mu.Unlock()
+		return ack.Encode(session.Version)
+
+	case *mqtt.Unsubscribe:
+		ack := &mqtt.UnsubAck{PacketID: p.PacketID}
+		s.mu.Lock()
+		for _, topic := range p.Topics {
+			delete(s.subs[topic], c)
+			ack.ReasonCodes = append(ack.ReasonCodes, mqtt.Success)
+		}
+		s.mu.Unlock()
+		return ack.Encode(session.Version)
+
+	case *mqtt.Publish:
+		s.publish(p.Topic, p.Payload)
+	}
+	return
+}
+
+func (s *example) OnClose(c *connection.Connection) {
+	s.mu.Lock()
+	for _, conns := range s.subs {
+		delete(conns, c)
+	}
+	s.mu.Unlock()
+
+	// 连接异常断开，发布遗嘱消息
+	if session := mqtt.GetSession(c); session != nil && session.Will != nil {
+		s.publish(session.Will.Topic, session.Will.Payload)
+	}
+}
+
+func (s *example) publish(topic string, payload []byte) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for c := range s.subs[topic] {
+		_ = mqtt.Send(c, &mqtt.Publish{Topic: topic, Payload: payload})
+	}
+}
+
+func main() {
+	var port int
+	var loops int
+
+	flag.IntVar(&port, "port", 1883, "server port")
+	flag.IntVar(&loops, "loops", -1, "num loops")
+	flag.Parse()
+
+	handler := &example{subs: make(map[string]map[*connection.Connection]struct{})}
+	p := mqtt.New(mqtt.MaxKeepAlive(300))
+	s, err := fastnet.NewServer(mqtt.NewHandlerWrap(p, handler),
+		fastnet.Network("tcp"),
+		fastnet.Address(":"+strconv.Itoa(port)),
+		fastnet.NumLoops(loops),
+		fastnet.Protocol(p))
+	if err != nil {
+		panic(err)
+	}
+
+	s.Start()
+}
@@ -38,7 +38,7 @@ func main() {
 			if err != nil {
 				panic(err)
 			}
-			buffer = protobuf.PackMessage("msg1", data)
+			buffer = protobuf.PackMessage(proto.MessageName(msg), data)
 		case 1:
 			msg := &pb.Msg2{
 				Name:  name,
@@ -50,7 +50,7 @@ func main() {
 			if err != nil {
 				panic(err)
 			}
-			buffer = protobuf.PackMessage("msg2", data)
+			buffer = protobuf.PackMessage(proto.MessageName(msg), data)
 		}
 
 		_, err := conn.Write(buffer)
@@ -12,32 +12,25 @@ import (
 	"github.com/golang/protobuf/proto"
 )
 
-type example struct{}
-
-func (s *example) OnConnect(c *connection.Connection) {
-	log.Println(" OnConnect ： ", c.PeerAddr())
+type example struct {
+	*protobuf.Router
 }
-func (s *example) OnMessage(c *connection.Connection, ctx interface{}, data []byte) (out []byte) {
-	msgType := ctx.(string)
 
-	switch msgType {
-	case "msg1":
-		msg := &pb.Msg1{}
-		if err := proto.Unmarshal(data, msg); err != nil {
-			log.Println(err)
-		}
-		log.Println(msgType, msg)
-	case "msg2":
-		msg := &pb.Msg2{}
-		if err := proto.Unmarshal(data, msg); err != nil {
-			log.Println(err)
-		}
-		log.Println(msgType, msg)
-	default:
-		log.Println("unknown msg type")
-	}
+func newExample() *example {
+	s := &example{Router: protobuf.NewRouter()}
+	s.Handle("proto.Msg1", func(c *connection.Connection, msg proto.Message) proto.Message {
+		log.Println("proto.Msg1", msg)
+		return &pb.Response{Content: "msg1 " + msg.(*pb.Msg1).Name}
+	})
+	s.Handle("proto.Msg2", func(c *connection.Connection, msg proto.Message) proto.Message {
+		log.Println("proto.Msg2", msg)
+		return nil
+	})
+	return s
+}
 
-	return
+func (s *example) OnConnect(c *connection.Connection) {
+	log.Println(" OnConnect ： ", c.PeerAddr())
 }
 
 func (s *example) OnClose(c *connection.Connection) {
@@ -45,7 +38,7 @@ func (s *example) OnClose(c *connection.Connection) {
 }
 
 func main() {
-	handler := new(example)
+	handler := newExample()
 	var port int
 	var loops int
 
@@ -57,7 +50,7 @@ func main() {
 		fastnet.Network("tcp"),
 		fastnet.Address(":"+strconv.Itoa(port)),
 		fastnet.NumLoops(loops),
-		fastnet.Protocol(&protobuf.Protocol{}))
+		fastnet.Protocol(protobuf.New()))
 	if err != nil {
 		panic(err)
 	}
@@ -1,21 +1,15 @@
 package main
 
 import (
-	"container/list"
 	"log"
-	"sync"
 	"time"
 
 	"github.com/Dongxiem/fastnet"
 	"github.com/Dongxiem/fastnet/connection"
 )
 
-const clientsKey = "demo_push_message_key"
-
 // Server example
 type Server struct {
-	conn   *list.List
-	mu     sync.RWMutex
 	server *fastnet.Server
 }
 
@@ -23,7 +17,6 @@ type Server struct {
 func New(ip, port string) (*Server, error) {
 	var err error
 	s := new(Server)
-	s.conn = list.New()
 	s.server, err = fastnet.NewServer(s,
 		fastnet.Address(ip+":"+port))
 	if err != nil {
@@ -46,27 +39,12 @@ func (s *Server) Stop() {
 
 // RunPush push message
 func (s *Server) RunPush() {
-	var next *list.Element
-
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-
-	for e := s.conn.Front(); e != nil; e = next {
-		next = e.Next()
-
-		c := e.Value.(*connection.Connection)
-		_ = c.Send([]byte("hello\n"))
-	}
+	s.server.Broadcast([]byte("hello\n"))
 }
 
 // OnConnect callback
 func (s *Server) OnConnect(c *connection.Connection) {
-	log.Println(" OnConnect ： ", c.PeerAddr())
-
-	s.mu.Lock()
-	e := s.conn.PushBack(c)
-	s.mu.Unlock()
-	c.Set(clientsKey, e)
+	log.Println(" OnConnect ： ", c.PeerAddr(), c.ID())
 }
 
 // OnMessage callback
@@ -79,15 +57,6 @@ func (s *Server) OnMessage(c *connection.Connection, ctx interface{}, data []byt
 // OnClose callback
 func (s *Server) OnClose(c *connection.Connection) {
 	log.Println("OnClose")
-	v, ok := c.Get(clientsKey)
-	if !ok {
-		log.Println("OnClose : get key fail")
-		return
-	}
-
-	s.mu.Lock()
-	s.conn.Remove(v.(*list.Element))
-	s.mu.Unlock()
 }
 
 func main() {
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"flag"
+	"strconv"
+	"sync"
+
+	"github.com/Dongxiem/fastnet"
+	"github.com/Dongxiem/fastnet/connection"
+	"github.com/Dongxiem/fastnet/plugins/redis"
+)
+
+// 定义 example 类型，实现一个简单的内存 KV，可以用 redis-cli 测试
+type example struct {
+	mu sync.RWMutex
+	kv map[string][]byte
+}
+
+func (s *example) OnConnect(c *connection.Connection) {}
+
+func (s *example) OnMessage(c *connection.Connection, ctx interface{}, data []byte) (out []byte) {
+	name, args, ok := ctx.(*redis.Value).Command()
+	if !ok {
+		return redis.AppendError(out, "ERR invalid command")
+	}
+
+	switch name {
+	case "ping":
+		if len(args) > 0 {
+			return redis.AppendBulk(out, args[0])
+		}
+		return redis.AppendSimpleString(out, "PONG")
+	case "set":
+		if len(args) != 2 {
+			return redis.AppendError(out, "ERR wrong number of arguments for 'set' command")
+		}
+		s.mu.Lock()
+		s.kv[string(args[0])] = args[1]
+		s.mu.Unlock()
+		return redis.AppendSimpleString(out, "OK")
+	case "get":
+		if len(args) != 1 {
+			return redis.AppendError(out, "ERR wrong number of arguments for 'get' command")
+		}
+		s.mu.RLock()
+		v, ok := s.kv[string(args[0])]
+		s.mu.RUnlock()
+		if !ok {
+			return redis.AppendNullBulk(out)
+		}
+		return redis.AppendBulk(out, v)
+	default:
+		return redis.AppendError(out, "ERR unknown command '"+name+"'")
+	}
+}
+
+func (s *example) OnClose(c *connection.Connection) {}
+
+func main() {
+	var port int
+	var loops int
+
+	flag.IntVar(&port, "port", 6379, "server port")
+	flag.IntVar(&loops, "loops", -1, "num loops")
+	flag.Parse()
+
+	handler := &example{kv: make(map[string][]byte)}
+	s, err := fastnet.NewServer(handler,
+		fastnet.Network("tcp"),
+		fastnet.Address(":"+strconv.Itoa(port)),
+		fastnet.NumLoops(loops),
+		fastnet.Protocol(redis.New()))
+	if err != nil {
+		panic(err)
+	}
+
+	s.Start()
+}
@@ -2,17 +2,16 @@ package main
 
 import (
 	"bytes"
-	"io"
 	"math/rand"
 	"testing"
 	"time"
 
 	"github.com/Dongxiem/fastnet"
 	"github.com/Dongxiem/fastnet/connection"
+	"github.com/Dongxiem/fastnet/plugins/websocket"
 	"github.com/Dongxiem/fastnet/plugins/websocket/ws"
 	"github.com/Dongxiem/fastnet/plugins/websocket/ws/util"
 	"github.com/Dongxiem/fastnet/tool/sync"
-	"golang.org/x/net/websocket"
 )
 
 type wsExample struct{}
@@ -27,27 +26,13 @@ func (s *wsExample) OnMessage(c *connection.Connection, data []byte) (messageTyp
 	case 0:
 		out = data
 	case 1:
-		msg, err := util.PackData(ws.MessageText, data)
-		if err != nil {
+		if err := websocket.GetWSConn(c).WriteMessage(ws.MessageText, data); err != nil {
 			panic(err)
 		}
-		if err := c.Send(msg); err != nil {
-			msg, err := util.PackCloseData(err.Error())
-			if err != nil {
-				panic(err)
-			}
-			if e := c.Send(msg); e != nil {
-				panic(e)
-			}
-		}
 	case 2:
-		msg, err := util.PackCloseData("close")
-		if err != nil {
+		if err := websocket.GetWSConn(c).CloseWithCode(ws.StatusNormalClosure, "close"); err != nil {
 			panic(err)
 		}
-		if e := c.Send(msg); e != nil {
-			panic(e)
-		}
 	}
 	return
 }
@@ -84,36 +69,58 @@ func TestWebSocketServer_Start(t *testing.T) {
 	s.Start()
 }
 
-func startWebSocketClient(addr string) {
-	rand.Seed(time.Now().UnixNano())
-	addr = "ws://localhost" + addr
-	c, err := websocket.Dial(addr, "", addr)
+// wsClient：客户端发送随机数据，并检查服务端的回显
+type wsClient struct {
+	done     chan struct{}
+	deadline time.Time
+	last     []byte
+}
+
+func (w *wsClient) OnConnect(c *connection.Connection) {
+	w.send(c)
+}
+
+func (w *wsClient) OnMessage(c *connection.Connection, data []byte) (messageType ws.MessageType, out []byte) {
+	if !bytes.Equal(data, w.last) {
+		panic("mismatch")
+	}
+	if time.Now().After(w.deadline) {
+		_ = c.Close()
+		return
+	}
+	w.send(c)
+	return
+}
+
+func (w *wsClient) OnClose(c *connection.Connection) {
+	close(w.done)
+}
+
+func (w *wsClient) send(c *connection.Connection) {
+	const letters = "abcdefghijklmnopqrstuvwxyz0123456789"
+	w.last = make([]byte, rand.Int()%(1024*3)+1)
+	for i := range w.last {
+		w.last[i] = letters[rand.Intn(len(letters))]
+	}
+	msg, err := util.PackData(ws.MessageText, w.last)
 	if err != nil {
 		panic(err)
 	}
-	defer c.Close()
+	_ = c.Send(msg)
+}
+
+func startWebSocketClient(addr string) {
 	duration := time.Duration((rand.Float64()*2+1)*float64(time.Second)) / 8
-	start := time.Now()
-	for time.Since(start) < duration {
-		sz := rand.Int()%(1024*3) + 1
-		data := make([]byte, sz)
-		if _, err := rand.Read(data); err != nil {
-			panic(err)
-		}
-		if n, err := c.Write(data); err != nil || n != len(data) {
-			panic(err)
-		}
+	handler := &wsClient{done: make(chan struct{}), deadline: time.Now().Add(duration)}
 
-		data2 := make([]byte, len(data))
-		if n, err := io.ReadFull(c, data2); err != nil || n != len(data) {
-			if err != io.EOF {
-				panic(err)
-			} else {
-				return
-			}
-		}
-		if !bytes.Equal(data, data2) {
-			panic("mismatch")
-		}
+	client, err := websocket.NewClient(handler, nil)
+	if err != nil {
+		panic(err)
+	}
+	defer client.Stop()
+
+	if _, err := client.Dial("localhost"+addr, "/"); err != nil {
+		panic(err)
 	}
+	<-handler.done
 }
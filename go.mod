@@ -10,4 +10,5 @@ require (
 	github.com/libp2p/go-reuseport v0.0.2
 	golang.org/x/net v0.0.0-20201224014010-6772e930b67b
 	golang.org/x/sys v0.0.0-20210113181707-4bcb84eeeb78
+	google.golang.org/protobuf v1.23.0
 )
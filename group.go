@@ -0,0 +1,199 @@
+package fastnet
+
+import (
+	"sync"
+
+	"github.com/Dongxiem/fastnet/connection"
+	"github.com/Dongxiem/fastnet/eventloop"
+)
+
+// groupShards：分组与成员关系的分片数
+const groupShards = 32
+
+// groupShard：按分组名分片，保护分组名到 registry 的映射
+// 加入已存在的分组只需要读锁，分组内的连接由 registry 按 work loop 分片
+type groupShard struct {
+	mu sync.RWMutex
+	m  map[string]*registry
+}
+
+// memberShard：按连接 ID 分片，记录每个连接加入的分组
+type memberShard struct {
+	mu sync.Mutex
+	m  map[int64]map[string]struct{}
+}
+
+// groups：连接分组管理，每个分组都是一个按 work loop 分片的 registry
+// 锁按分组名与连接 ID 分片，不同分组、不同连接的加入与退出不会竞争同一把锁
+// 加锁顺序总是先 memberShard 后 groupShard
+type groups struct {
+	loops   []*eventloop.EventLoop
+	shards  [groupShards]groupShard
+	members [groupShards]memberShard
+}
+
+// newGroups：创建分组管理
+func newGroups(loops []*eventloop.EventLoop) *groups {
+	g := &groups{loops: loops}
+	for i := range g.shards {
+		g.shards[i].m = make(map[string]*registry)
+		g.members[i].m = make(map[int64]map[string]struct{})
+	}
+	return g
+}
+
+// shard：分组名对应的分片，FNV-1a 哈希
+func (g *groups) shard(name string) *groupShard {
+	h := uint32(2166136261)
+	for i := 0; i < len(name); i++ {
+		h ^= uint32(name[i])
+		h *= 16777619
+	}
+	return &g.shards[h%groupShards]
+}
+
+// memberShard：连接对应的成员关系分片
+func (g *groups) memberShard(c *connection.Connection) *memberShard {
+	return &g.members[uint64(c.ID())%groupShards]
+}
+
+// join：将连接加入分组
+func (g *groups) join(name string, c *connection.Connection) error {
+	ms := g.memberShard(c)
+	ms.mu.Lock()
+	if err := g.put(name, c); err != nil {
+		ms.mu.Unlock()
+		return err
+	}
+
+	// 记录连接加入的分组，第一次加入分组时注册关闭回调
+	names, ok := ms.m[c.ID()]
+	if !ok {
+		names = make(map[string]struct{})
+		ms.m[c.ID()] = names
+	}
+	names[name] = struct{}{}
+	ms.mu.Unlock()
+
+	// 如果连接已经关闭，AddCloseHook 会立即执行回调，所以不能持有锁
+	if !ok {
+		c.AddCloseHook(g.leaveAll)
+		c.AddMoveHook(g.move)
+	}
+	return nil
+}
+
+// put：将连接放入分组的 registry，分组不存在时创建
+// 持有读锁时分组不会被删除，所以 registry.put 必须在锁内完成
+func (g *groups) put(name string, c *connection.Connection) error {
+	gs := g.shard(name)
+	gs.mu.RLock()
+	r, ok := gs.m[name]
+	if ok {
+		err := r.put(c)
+		gs.mu.RUnlock()
+		return err
+	}
+	gs.mu.RUnlock()
+
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	r, ok = gs.m[name]
+	if !ok {
+		r = newRegistry(g.loops)
+	}
+	if err := r.put(c); err != nil {
+		return err
+	}
+	gs.m[name] = r
+	return nil
+}
+
+// leave：将连接移出分组
+func (g *groups) leave(name string, c *connection.Connection) {
+	ms := g.memberShard(c)
+	ms.mu.Lock()
+	if names, ok := ms.m[c.ID()]; ok {
+		delete(names, name)
+	}
+	g.remove(name, c)
+	ms.mu.Unlock()
+}
+
+// leaveAll：将连接移出所有分组，连接关闭时调用
+func (g *groups) leaveAll(c *connection.Connection) {
+	ms := g.memberShard(c)
+	ms.mu.Lock()
+	for name := range ms.m[c.ID()] {
+		g.remove(name, c)
+	}
+	delete(ms.m, c.ID())
+	ms.mu.Unlock()
+}
+
+// move：连接迁移 loop 时移到每个分组中对应的分片
+func (g *groups) move(c *connection.Connection, to *eventloop.EventLoop) {
+	ms := g.memberShard(c)
+	ms.mu.Lock()
+	for name := range ms.m[c.ID()] {
+		gs := g.shard(name)
+		gs.mu.RLock()
+		if r, ok := gs.m[name]; ok {
+			r.move(c, to)
+		}
+		gs.mu.RUnlock()
+	}
+	ms.mu.Unlock()
+}
+
+// remove：从分组中移除连接，分组为空时删除分组
+func (g *groups) remove(name string, c *connection.Connection) {
+	gs := g.shard(name)
+	gs.mu.Lock()
+	if r, ok := gs.m[name]; ok {
+		r.remove(c)
+		if r.len() == 0 {
+			delete(gs.m, name)
+		}
+	}
+	gs.mu.Unlock()
+}
+
+// get：获取分组
+func (g *groups) get(name string) (*registry, bool) {
+	gs := g.shard(name)
+	gs.mu.RLock()
+	r, ok := gs.m[name]
+	gs.mu.RUnlock()
+	return r, ok
+}
+
+// Join：将连接加入分组，分组不存在时自动创建，连接关闭时自动退出所有分组
+// 连接不属于该 Server 的 work loop 时返回 ErrUnknownLoop
+func (s *Server) Join(group string, c *connection.Connection) error {
+	return s.groups.join(group, c)
+}
+
+// Leave：将连接移出分组，分组为空时自动删除
+func (s *Server) Leave(group string, c *connection.Connection) {
+	s.groups.leave(group, c)
+}
+
+// SendToGroup：向分组内所有连接发送数据
+// 与 Broadcast 相同，data 只封装一次，每个 loop 使用一次 QueueInLoop 进行发送
+func (s *Server) SendToGroup(group string, data []byte) {
+	r, ok := s.groups.get(group)
+	if !ok {
+		return
+	}
+	r.broadcast(s.opts.Protocol.Packet(nil, data))
+}
+
+// GroupMembers：返回分组内所有连接
+func (s *Server) GroupMembers(group string) []*connection.Connection {
+	r, ok := s.groups.get(group)
+	if !ok {
+		return nil
+	}
+	return r.all()
+}
@@ -0,0 +1,171 @@
+package fastnet
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Dongxiem/fastnet/connection"
+	"github.com/Dongxiem/fastnet/eventloop"
+)
+
+func TestGroups(t *testing.T) {
+	loops := make([]*eventloop.EventLoop, 2)
+	for i := range loops {
+		l, err := eventloop.New()
+		if err != nil {
+			t.Fatal(err)
+		}
+		loops[i] = l
+	}
+	g := newGroups(loops)
+
+	c1 := connection.New(-1, loops[0], nil, &connection.DefaultProtocol{}, nil, 0, nil)
+	c2 := connection.New(-1, loops[1], nil, &connection.DefaultProtocol{}, nil, 0, nil)
+
+	g.join("room1", c1)
+	g.join("room1", c2)
+	g.join("room2", c1)
+
+	r, ok := g.get("room1")
+	if !ok || r.len() != 2 {
+		t.Fatal("room1 should have 2 members")
+	}
+
+	g.leave("room1", c2)
+	if r.len() != 1 {
+		t.Fatalf("room1 should have 1 member, but %d", r.len())
+	}
+
+	g.leaveAll(c1)
+	if _, ok := g.get("room1"); ok {
+		t.Fatal("room1 should be removed")
+	}
+	if _, ok := g.get("room2"); ok {
+		t.Fatal("room2 should be removed")
+	}
+}
+
+func TestGroups_Concurrent(t *testing.T) {
+	loops := make([]*eventloop.EventLoop, 4)
+	for i := range loops {
+		l, err := eventloop.New()
+		if err != nil {
+			t.Fatal(err)
+		}
+		loops[i] = l
+	}
+	g := newGroups(loops)
+
+	// 每个 loop 上的连接同时加入公共分组与各自的分组，再退出一半
+	var wg sync.WaitGroup
+	for i, l := range loops {
+		wg.Add(1)
+		go func(i int, l *eventloop.EventLoop) {
+			defer wg.Done()
+			own := fmt.Sprintf("room%d", i)
+			for j := 0; j < 100; j++ {
+				c := connection.New(-1, l, nil, &connection.DefaultProtocol{}, nil, 0, nil)
+				if err := g.join("lobby", c); err != nil {
+					t.Error(err)
+					return
+				}
+				if err := g.join(own, c); err != nil {
+					t.Error(err)
+					return
+				}
+				if j%2 == 0 {
+					g.leave("lobby", c)
+					g.leaveAll(c)
+				}
+			}
+		}(i, l)
+	}
+	wg.Wait()
+
+	if r, ok := g.get("lobby"); !ok || r.len() != 200 {
+		t.Fatal("lobby should have 200 members")
+	}
+	for i := range loops {
+		if r, ok := g.get(fmt.Sprintf("room%d", i)); !ok || r.len() != 50 {
+			t.Fatalf("room%d should have 50 members", i)
+		}
+	}
+}
+
+func TestServer_SendToGroup(t *testing.T) {
+	loops := make([]*eventloop.EventLoop, 2)
+	for i := range loops {
+		l, err := eventloop.New()
+		if err != nil {
+			t.Fatal(err)
+		}
+		go l.RunLoop()
+		loops[i] = l
+	}
+	t.Cleanup(func() {
+		for _, l := range loops {
+			_ = l.Stop()
+		}
+	})
+	protocol := &countProtocol{}
+	s := &Server{opts: &Options{Protocol: protocol}, groups: newGroups(loops)}
+
+	conns := make([]*connection.Connection, 4)
+	peers := make([]int, 4)
+	for i := range conns {
+		conns[i], peers[i] = newPairConn(t, loops[i%2], protocol)
+	}
+	for _, c := range conns[:3] {
+		if err := s.Join("room", c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Join("lobby", conns[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	// 只有分组成员收到数据，data 只封装一次
+	s.SendToGroup("room", []byte("hi"))
+	s.SendToGroup("nobody", []byte("hi"))
+	for _, fd := range peers[:3] {
+		if got := readPeer(fd, time.Second); got != "#hi" {
+			t.Fatalf("expect #hi but got %q", got)
+		}
+	}
+	if got := readPeer(peers[3], 20*time.Millisecond); got != "" {
+		t.Fatalf("conns[3] is not a member, but got %q", got)
+	}
+	if n := protocol.packets.Get(); n != 1 {
+		t.Fatalf("Packet should be called once, but %d", n)
+	}
+
+	// 连接关闭时通过关闭回调自动退出所有分组
+	if err := conns[0].Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := readPeer(peers[0], time.Second); got != "" {
+		t.Fatalf("conns[0] should be closed, but got %q", got)
+	}
+	if n := len(s.GroupMembers("room")); n != 2 {
+		t.Fatalf("room should have 2 members, but %d", n)
+	}
+	if _, ok := s.groups.get("lobby"); ok {
+		t.Fatal("lobby should be removed")
+	}
+	s.SendToGroup("room", []byte("bye"))
+	for _, fd := range peers[1:3] {
+		if got := readPeer(fd, time.Second); got != "#bye" {
+			t.Fatalf("expect #bye but got %q", got)
+		}
+	}
+
+	// 已经关闭的连接加入分组时立即退出
+	if err := s.Join("late", conns[0]); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := s.groups.get("late"); ok {
+		t.Fatal("closed connection should not stay in a group")
+	}
+}
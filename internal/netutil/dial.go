@@ -0,0 +1,40 @@
+package netutil
+
+import (
+	"net"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// Dial：建立 TCP 连接并返回非阻塞的 fd，用于客户端模式创建 Connection，fd 由 Connection 负责关闭
+func Dial(addr string, timeout time.Duration) (fd int, sa unix.Sockaddr, err error) {
+	conn, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	raw, err := conn.(*net.TCPConn).SyscallConn()
+	if err != nil {
+		return
+	}
+	// 复制一个 fd，之后关闭 net.Conn 不会影响 fd
+	if e := raw.Control(func(s uintptr) {
+		fd, err = unix.Dup(int(s))
+	}); e != nil {
+		return 0, nil, e
+	}
+	if err != nil {
+		return
+	}
+
+	unix.CloseOnExec(fd)
+	if err = unix.SetNonblock(fd, true); err == nil {
+		sa, err = unix.Getpeername(fd)
+	}
+	if err != nil {
+		_ = unix.Close(fd)
+	}
+	return
+}
@@ -17,6 +17,9 @@ type Options struct {
 	wheelSize int64
 	IdleTime  time.Duration			// 最大空闲时间（秒）
 	Protocol  connection.Protocol	// 连接协议
+
+	ProxyProtocol      bool				// 连接开始时先读取 PROXY protocol v1/v2 头部
+	ProxyHeaderTimeout time.Duration	// 读取 PROXY protocol 头部的超时时间
 }
 
 // Option ...
@@ -49,6 +52,10 @@ func newOptions(opt ...Option) *Options {
 	if opts.Protocol == nil {
 		opts.Protocol = &connection.DefaultProtocol{}
 	}
+	// 默认 PROXY protocol 头部超时 5s
+	if opts.ProxyProtocol && opts.ProxyHeaderTimeout <= 0 {
+		opts.ProxyHeaderTimeout = 5 * time.Second
+	}
 
 	return &opts
 }
@@ -94,3 +101,12 @@ func IdleTime(t time.Duration) Option {
 		o.IdleTime = t
 	}
 }
+
+// ProxyProtocol：开启 PROXY protocol，timeout 为读取头部的超时时间
+// OnConnect 在头部解析之后调用，此时 PeerAddr 为真实的客户端地址
+func ProxyProtocol(timeout time.Duration) Option {
+	return func(o *Options) {
+		o.ProxyProtocol = true
+		o.ProxyHeaderTimeout = timeout
+	}
+}
@@ -0,0 +1,86 @@
+package delimiter
+
+import (
+	"github.com/Dongxiem/fastnet/connection"
+)
+
+// Options：分隔符拆包配置
+type Options struct {
+	Delimiter      []byte // 分隔符
+	MaxLength      int    // 一行数据的最大长度（不包含分隔符），超过则关闭连接
+	StripDelimiter bool   // 拆包结果是否去掉分隔符
+	StripCR        bool   // 分隔符为 "\n" 时，是否同时去掉行尾的 '\r'，用于兼容 "\r\n"
+	SkipEmpty      bool   // 是否跳过去掉分隔符之后为空的行
+
+	OnError connection.ErrorHandler // 拆包出错时的回调，之后连接会被关闭
+}
+
+// Option ...
+type Option func(*Options)
+
+// newOptions：返回一个新的 Options 配置
+func newOptions(opt ...Option) *Options {
+	// 默认按 "\n" 拆包，并去掉分隔符
+	opts := Options{
+		StripDelimiter: true,
+	}
+
+	for _, o := range opt {
+		o(&opts)
+	}
+	if len(opts.Delimiter) == 0 {
+		opts.Delimiter = []byte{'\n'}
+	}
+	// 默认最大 64K
+	if opts.MaxLength <= 0 {
+		opts.MaxLength = 64 * 1024
+	}
+	if opts.OnError == nil {
+		opts.OnError = connection.LogError("[delimiter]")
+	}
+
+	return &opts
+}
+
+// Delimiter：设置分隔符，例如 "\r\n" 或任意字节序列
+func Delimiter(d []byte) Option {
+	return func(o *Options) {
+		o.Delimiter = d
+	}
+}
+
+// Line：按行拆包，兼容 "\n" 与 "\r\n"
+func Line() Option {
+	return func(o *Options) {
+		o.Delimiter = []byte{'\n'}
+		o.StripCR = true
+	}
+}
+
+// MaxLength：一行数据的最大长度
+func MaxLength(n int) Option {
+	return func(o *Options) {
+		o.MaxLength = n
+	}
+}
+
+// StripDelimiter：拆包结果是否去掉分隔符
+func StripDelimiter(strip bool) Option {
+	return func(o *Options) {
+		o.StripDelimiter = strip
+	}
+}
+
+// SkipEmpty：跳过去掉分隔符之后为空的行，默认空行也作为一条消息
+func SkipEmpty(skip bool) Option {
+	return func(o *Options) {
+		o.SkipEmpty = skip
+	}
+}
+
+// OnError：拆包出错时的回调
+func OnError(f func(c *connection.Connection, err error)) Option {
+	return func(o *Options) {
+		o.OnError = f
+	}
+}
@@ -0,0 +1,77 @@
+package delimiter
+
+import (
+	"errors"
+
+	"github.com/Dongxiem/fastnet/connection"
+	"github.com/Dongxiem/fastnet/tool/ringbuffer"
+)
+
+var _ connection.Protocol = &Protocol{}
+
+// ErrLineTooLong：一行数据超过最大长度
+var ErrLineTooLong = errors.New("delimiter: line too long")
+
+// EmptyLine：空行的 ctx，ctx 与 out 同时为空表示没有完整的数据，所以空行使用 EmptyLine{} 作为 ctx
+type EmptyLine struct{}
+
+// Protocol：基于分隔符的拆包协议
+type Protocol struct {
+	opts *Options
+}
+
+// New：创建 delimiter Protocol
+func New(opts ...Option) *Protocol {
+	return &Protocol{opts: newOptions(opts...)}
+}
+
+// UnPacket：拆包，去掉分隔符之后为空的行返回的 ctx 为 EmptyLine{}，SkipEmpty 时直接跳过
+func (p *Protocol) UnPacket(c *connection.Connection, buffer *ringbuffer.RingBuffer) (ctx interface{}, out []byte) {
+	delimLen := len(p.opts.Delimiter)
+	for {
+		i := buffer.Index(p.opts.Delimiter)
+		if i < 0 {
+			// 没有找到分隔符，并且数据已经超过最大长度，不再继续缓存
+			if buffer.Length() > p.opts.MaxLength+delimLen-1 {
+				connection.CloseOnError(c, buffer, p.opts.OnError, ErrLineTooLong)
+			}
+			return
+		}
+		if i > p.opts.MaxLength {
+			connection.CloseOnError(c, buffer, p.opts.OnError, ErrLineTooLong)
+			return
+		}
+
+		if !p.opts.StripDelimiter {
+			out = make([]byte, i+delimLen)
+			_, _ = buffer.Read(out)
+			return
+		}
+
+		line := make([]byte, i)
+		_, _ = buffer.Read(line)
+		buffer.Retrieve(delimLen)
+		if p.opts.StripCR && len(line) > 0 && line[len(line)-1] == '\r' {
+			line = line[:len(line)-1]
+		}
+		if len(line) == 0 {
+			if p.opts.SkipEmpty {
+				continue
+			}
+			return EmptyLine{}, nil
+		}
+		out = line
+		return
+	}
+}
+
+// Packet：装包，StripDelimiter 时在 data 后面加上分隔符，否则直接返回
+func (p *Protocol) Packet(c *connection.Connection, data []byte) []byte {
+	if !p.opts.StripDelimiter {
+		return data
+	}
+	ret := make([]byte, len(data)+len(p.opts.Delimiter))
+	copy(ret, data)
+	copy(ret[len(data):], p.opts.Delimiter)
+	return ret
+}
@@ -0,0 +1,117 @@
+package delimiter
+
+import (
+	"testing"
+
+	"github.com/Dongxiem/fastnet/connection"
+	"github.com/Dongxiem/fastnet/eventloop"
+	"github.com/Dongxiem/fastnet/tool/ringbuffer"
+)
+
+func TestProtocol_UnPacket(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []Option
+		in   string
+		want []string
+		left int
+	}{
+		{
+			name: "default",
+			in:   "hello\nworld\npart",
+			want: []string{"hello", "world"},
+			left: 4,
+		},
+		{
+			name: "line",
+			opts: []Option{Line()},
+			in:   "hello\r\n\r\nworld\n\n",
+			want: []string{"hello", "", "world", ""},
+		},
+		{
+			name: "skip empty",
+			opts: []Option{Line(), SkipEmpty(true)},
+			in:   "hello\r\n\r\nworld\n\n",
+			want: []string{"hello", "world"},
+		},
+		{
+			name: "crlf keep delimiter",
+			opts: []Option{Delimiter([]byte("\r\n")), StripDelimiter(false)},
+			in:   "a\r\nb\r\n\r",
+			want: []string{"a\r\n", "b\r\n"},
+			left: 1,
+		},
+		{
+			name: "multi bytes",
+			opts: []Option{Delimiter([]byte("$$"))},
+			in:   "a$b$$c$$",
+			want: []string{"a$b", "c"},
+		},
+	}
+
+	for _, tt := range tests {
+		p := New(tt.opts...)
+		// 让数据在 ring buffer 中跨越尾部与头部
+		buffer := ringbuffer.New(16)
+		_, _ = buffer.Write(make([]byte, 10))
+		_, _ = buffer.Read(make([]byte, 10))
+		_, _ = buffer.WriteString(tt.in)
+
+		var got []string
+		for {
+			ctx, out := p.UnPacket(nil, buffer)
+			if ctx == nil && len(out) == 0 {
+				break
+			}
+			if _, ok := ctx.(EmptyLine); ok != (len(out) == 0) {
+				t.Fatalf("%s: ctx %v out %q", tt.name, ctx, out)
+			}
+			got = append(got, string(out))
+		}
+		if len(got) != len(tt.want) || buffer.Length() != tt.left {
+			t.Fatalf("%s: got %q left %d, want %q left %d", tt.name, got, buffer.Length(), tt.want, tt.left)
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Fatalf("%s: got %q, want %q", tt.name, got, tt.want)
+			}
+		}
+	}
+}
+
+func TestProtocol_LineTooLong(t *testing.T) {
+	loop, err := eventloop.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var reported error
+	p := New(Delimiter([]byte("\r\n")), MaxLength(4), OnError(func(c *connection.Connection, err error) {
+		reported = err
+	}))
+	c := connection.New(-1, loop, nil, p, nil, 0, nil)
+
+	buffer := ringbuffer.New(16)
+	_, _ = buffer.WriteString("abcd\r")
+	if _, out := p.UnPacket(c, buffer); len(out) != 0 || reported != nil {
+		t.Fatal("line should not be ready")
+	}
+
+	_, _ = buffer.WriteString("\nabcdef")
+	if _, out := p.UnPacket(c, buffer); string(out) != "abcd" {
+		t.Fatalf("out should be abcd, but %q", out)
+	}
+	if _, out := p.UnPacket(c, buffer); len(out) != 0 {
+		t.Fatal("line should be dropped")
+	}
+	if reported != ErrLineTooLong || buffer.Length() != 0 {
+		t.Fatalf("err should be ErrLineTooLong, but %v", reported)
+	}
+}
+
+func TestProtocol_Packet(t *testing.T) {
+	p := New(Delimiter([]byte("\r\n")))
+	if out := p.Packet(nil, []byte("hi")); string(out) != "hi\r\n" {
+		t.Fatalf("out should be hi\\r\\n, but %q", out)
+	}
+}
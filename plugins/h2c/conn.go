@@ -0,0 +1,461 @@
+package h2c
+
+import (
+	"bytes"
+	"encoding/binary"
+
+	"github.com/Dongxiem/fastnet/connection"
+	"github.com/Dongxiem/fastnet/log"
+	"github.com/Dongxiem/fastnet/tool/ringbuffer"
+	"golang.org/x/net/http2/hpack"
+)
+
+// connKey：连接上的 HTTP/2 状态
+const connKey = "fastnet_h2c_conn"
+
+// clientPreface：客户端连接序言
+var clientPreface = []byte("PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n")
+
+// connState：连接状态
+type connState int
+
+const (
+	stateInit     connState = iota // 等待连接序言或者 Upgrade 请求
+	statePreface                   // Upgrade 之后等待连接序言
+	stateSettings                  // 等待客户端的第一个 SETTINGS 帧
+	stateOpen
+	stateClosing // 已经发送 GOAWAY，之后收到的数据全部丢弃
+)
+
+// serverConn：一个连接上的 HTTP/2 状态，只在连接所属的 loop 中访问
+type serverConn struct {
+	c     *connection.Connection
+	opts  *Options
+	state connState
+
+	dec    *hpack.Decoder
+	enc    *hpack.Encoder
+	encBuf bytes.Buffer
+
+	// 对端的 SETTINGS
+	maxFrameSize      uint32
+	initialWindowSize int64
+
+	streams      map[uint32]*stream
+	lastStreamID uint32 // 客户端打开的最大流 ID
+	sendWindow   int64  // 连接级发送窗口
+	recvWindow   int64  // 连接级接收窗口
+	goAway       bool   // 收到对端的 GOAWAY，流全部结束之后关闭连接
+
+	// 等待 CONTINUATION 的头部块
+	headerStream    uint32
+	headerEndStream bool
+	headerBlock     []byte
+
+	ready []*Request // 已经完整接收，等待处理的请求
+	out   []byte     // 等待发送的帧
+}
+
+func newServerConn(c *connection.Connection, opts *Options) *serverConn {
+	sc := &serverConn{
+		c:                 c,
+		opts:              opts,
+		maxFrameSize:      defaultMaxFrameSize,
+		initialWindowSize: defaultInitialWindowSize,
+		streams:           make(map[uint32]*stream),
+		sendWindow:        defaultInitialWindowSize,
+		recvWindow:        defaultInitialWindowSize,
+	}
+	sc.dec = hpack.NewDecoder(defaultHeaderTableSize, nil)
+	sc.dec.SetMaxStringLength(int(opts.MaxHeaderListSize))
+	sc.enc = hpack.NewEncoder(&sc.encBuf)
+	return sc
+}
+
+// start：发送服务端的 SETTINGS
+func (sc *serverConn) start() {
+	settings := []Setting{
+		{SettingMaxConcurrentStreams, sc.opts.MaxConcurrentStreams},
+		{SettingMaxHeaderListSize, sc.opts.MaxHeaderListSize},
+	}
+	if sc.opts.InitialWindowSize != defaultInitialWindowSize {
+		settings = append(settings, Setting{SettingInitialWindowSize, sc.opts.InitialWindowSize})
+	}
+	if sc.opts.MaxFrameSize != defaultMaxFrameSize {
+		settings = append(settings, Setting{SettingMaxFrameSize, sc.opts.MaxFrameSize})
+	}
+	sc.out = appendSettings(sc.out, settings...)
+}
+
+// takeOut：取出等待发送的帧
+func (sc *serverConn) takeOut() []byte {
+	out := sc.out
+	sc.out = nil
+	return out
+}
+
+// readPreface：Upgrade 之后客户端仍然需要发送连接序言
+func (sc *serverConn) readPreface(buffer *ringbuffer.RingBuffer) (bool, error) {
+	if buffer.Length() < len(clientPreface) {
+		return false, nil
+	}
+	if !bytes.Equal(peek(buffer, len(clientPreface)), clientPreface) {
+		return false, ConnectionError(ErrCodeProtocol)
+	}
+	buffer.Retrieve(len(clientPreface))
+	sc.state = stateSettings
+	return true, nil
+}
+
+// readFrame：读取并处理一个完整的帧，在读取 payload 之前检查长度
+func (sc *serverConn) readFrame(buffer *ringbuffer.RingBuffer) (bool, error) {
+	if buffer.Length() < frameHeaderLen {
+		return false, nil
+	}
+	h := parseFrameHeader(peek(buffer, frameHeaderLen))
+	if h.Length > sc.opts.MaxFrameSize {
+		return false, ConnectionError(ErrCodeFrameSize)
+	}
+	if buffer.Length() < frameHeaderLen+int(h.Length) {
+		return false, nil
+	}
+	buffer.Retrieve(frameHeaderLen)
+	payload := make([]byte, h.Length)
+	_, _ = buffer.Read(payload)
+
+	return true, sc.processFrame(h, payload)
+}
+
+// processFrame：处理一个帧
+func (sc *serverConn) processFrame(h frameHeader, payload []byte) error {
+	// 头部块必须连续，中间不能有其他帧
+	if sc.headerStream != 0 && (h.Type != FrameContinuation || h.StreamID != sc.headerStream) {
+		return ConnectionError(ErrCodeProtocol)
+	}
+	// 连接序言之后的第一个帧必须是 SETTINGS
+	if sc.state == stateSettings {
+		if h.Type != FrameSettings || h.has(flagAck) {
+			return ConnectionError(ErrCodeProtocol)
+		}
+		sc.state = stateOpen
+	}
+
+	switch h.Type {
+	case FrameData:
+		return sc.processData(h, payload)
+	case FrameHeaders:
+		return sc.processHeaders(h, payload)
+	case FramePriority:
+		if h.StreamID == 0 {
+			return ConnectionError(ErrCodeProtocol)
+		}
+		if len(payload) != 5 {
+			return StreamError{StreamID: h.StreamID, Code: ErrCodeFrameSize}
+		}
+	case FrameRSTStream:
+		return sc.processRSTStream(h, payload)
+	case FrameSettings:
+		return sc.processSettings(h, payload)
+	case FramePushPromise:
+		// 客户端不能推送
+		return ConnectionError(ErrCodeProtocol)
+	case FramePing:
+		if h.StreamID != 0 {
+			return ConnectionError(ErrCodeProtocol)
+		}
+		if len(payload) != 8 {
+			return ConnectionError(ErrCodeFrameSize)
+		}
+		if !h.has(flagAck) {
+			sc.out = appendFrame(sc.out, FramePing, flagAck, 0, payload)
+		}
+	case FrameGoAway:
+		if h.StreamID != 0 {
+			return ConnectionError(ErrCodeProtocol)
+		}
+		if len(payload) < 8 {
+			return ConnectionError(ErrCodeFrameSize)
+		}
+		sc.goAway = true
+		sc.closeIfIdle()
+	case FrameWindowUpdate:
+		return sc.processWindowUpdate(h, payload)
+	case FrameContinuation:
+		if sc.headerStream == 0 {
+			return ConnectionError(ErrCodeProtocol)
+		}
+		return sc.appendHeaderBlock(h, payload)
+	}
+	// 未知类型的帧直接忽略
+	return nil
+}
+
+// processData：DATA 帧，整个帧（包括填充）都计入流量控制窗口
+func (sc *serverConn) processData(h frameHeader, payload []byte) error {
+	if h.StreamID == 0 {
+		return ConnectionError(ErrCodeProtocol)
+	}
+	n := int64(h.Length)
+	if n > sc.recvWindow {
+		return ConnectionError(ErrCodeFlowControl)
+	}
+	sc.recvWindow -= n
+	if sc.recvWindow < defaultInitialWindowSize/2 {
+		sc.out = appendUint32Frame(sc.out, FrameWindowUpdate, 0, uint32(defaultInitialWindowSize-sc.recvWindow))
+		sc.recvWindow = defaultInitialWindowSize
+	}
+
+	st := sc.streams[h.StreamID]
+	if st == nil || st.state != streamOpen {
+		if h.StreamID > sc.lastStreamID {
+			return ConnectionError(ErrCodeProtocol)
+		}
+		return StreamError{StreamID: h.StreamID, Code: ErrCodeStreamClosed}
+	}
+	if n > st.recvWindow {
+		return StreamError{StreamID: h.StreamID, Code: ErrCodeFlowControl}
+	}
+	st.recvWindow -= n
+
+	data, err := stripPadding(h, payload)
+	if err != nil {
+		return err
+	}
+	if len(st.body)+len(data) > sc.opts.MaxBodySize {
+		sc.reject(st, 413)
+		return nil
+	}
+	st.body = append(st.body, data...)
+	if h.has(flagEndStream) {
+		return sc.endStream(st)
+	}
+
+	initial := int64(sc.opts.InitialWindowSize)
+	if st.recvWindow < initial/2 {
+		sc.out = appendUint32Frame(sc.out, FrameWindowUpdate, st.id, uint32(initial-st.recvWindow))
+		st.recvWindow = initial
+	}
+	return nil
+}
+
+// processHeaders：HEADERS 帧，没有 END_HEADERS 时等待 CONTINUATION
+func (sc *serverConn) processHeaders(h frameHeader, payload []byte) error {
+	// 客户端只能使用奇数流 ID
+	if h.StreamID == 0 || h.StreamID%2 == 0 {
+		return ConnectionError(ErrCodeProtocol)
+	}
+	block, err := stripPadding(h, payload)
+	if err != nil {
+		return err
+	}
+	if h.has(flagPriority) {
+		if len(block) < 5 {
+			return ConnectionError(ErrCodeFrameSize)
+		}
+		block = block[5:]
+	}
+
+	sc.headerStream = h.StreamID
+	sc.headerEndStream = h.has(flagEndStream)
+	sc.headerBlock = sc.headerBlock[:0]
+	return sc.appendHeaderBlock(h, block)
+}
+
+// appendHeaderBlock：拼接头部块，收到 END_HEADERS 之后解码
+func (sc *serverConn) appendHeaderBlock(h frameHeader, block []byte) error {
+	if len(sc.headerBlock)+len(block) > int(sc.opts.MaxHeaderListSize) {
+		// 无法跳过头部块，否则 HPACK 状态会不一致
+		return ConnectionError(ErrCodeEnhanceYourCalm)
+	}
+	sc.headerBlock = append(sc.headerBlock, block...)
+	if !h.has(flagEndHeaders) {
+		return nil
+	}
+
+	id := sc.headerStream
+	sc.headerStream = 0
+	fields, err := sc.dec.DecodeFull(sc.headerBlock)
+	if err != nil {
+		return ConnectionError(ErrCodeCompression)
+	}
+
+	// 已经打开的流上的 HEADERS 为 trailer
+	if st := sc.streams[id]; st != nil {
+		if st.state != streamOpen {
+			return StreamError{StreamID: id, Code: ErrCodeStreamClosed}
+		}
+		if !sc.headerEndStream {
+			return StreamError{StreamID: id, Code: ErrCodeProtocol}
+		}
+		if st.req.Trailer, err = newTrailer(id, fields); err != nil {
+			return err
+		}
+		return sc.endStream(st)
+	}
+
+	// 新的流 ID 必须大于之前所有的流
+	if id <= sc.lastStreamID {
+		return ConnectionError(ErrCodeProtocol)
+	}
+	sc.lastStreamID = id
+	if sc.goAway || uint32(len(sc.streams)) >= sc.opts.MaxConcurrentStreams {
+		return StreamError{StreamID: id, Code: ErrCodeRefusedStream}
+	}
+
+	req, err := newRequest(id, fields)
+	if err != nil {
+		return err
+	}
+	st := sc.newStream(req)
+	if headerListSize(fields) > sc.opts.MaxHeaderListSize {
+		sc.reject(st, 431)
+		return nil
+	}
+	if sc.headerEndStream {
+		return sc.endStream(st)
+	}
+	return nil
+}
+
+// processRSTStream：对端取消流
+func (sc *serverConn) processRSTStream(h frameHeader, payload []byte) error {
+	if h.StreamID == 0 || h.StreamID > sc.lastStreamID {
+		return ConnectionError(ErrCodeProtocol)
+	}
+	if len(payload) != 4 {
+		return ConnectionError(ErrCodeFrameSize)
+	}
+	if st := sc.streams[h.StreamID]; st != nil {
+		sc.closeStream(st)
+	}
+	return nil
+}
+
+// processSettings：应用对端的 SETTINGS 并应答 ACK
+func (sc *serverConn) processSettings(h frameHeader, payload []byte) error {
+	if h.StreamID != 0 {
+		return ConnectionError(ErrCodeProtocol)
+	}
+	if h.has(flagAck) {
+		if len(payload) != 0 {
+			return ConnectionError(ErrCodeFrameSize)
+		}
+		return nil
+	}
+	settings, err := parseSettings(payload)
+	if err != nil {
+		return err
+	}
+	if err = sc.applySettings(settings); err != nil {
+		return err
+	}
+	sc.out = appendFrame(sc.out, FrameSettings, flagAck, 0, nil)
+	sc.flush()
+	return nil
+}
+
+// applySettings：INITIAL_WINDOW_SIZE 的变化会调整所有流的发送窗口
+func (sc *serverConn) applySettings(settings []Setting) error {
+	for _, s := range settings {
+		switch s.ID {
+		case SettingHeaderTableSize:
+			sc.enc.SetMaxDynamicTableSize(s.Val)
+		case SettingEnablePush:
+			if s.Val > 1 {
+				return ConnectionError(ErrCodeProtocol)
+			}
+		case SettingInitialWindowSize:
+			if s.Val > maxWindowSize {
+				return ConnectionError(ErrCodeFlowControl)
+			}
+			delta := int64(s.Val) - sc.initialWindowSize
+			for _, st := range sc.streams {
+				st.sendWindow += delta
+				if st.sendWindow > maxWindowSize {
+					return ConnectionError(ErrCodeFlowControl)
+				}
+			}
+			sc.initialWindowSize = int64(s.Val)
+		case SettingMaxFrameSize:
+			if s.Val < defaultMaxFrameSize || s.Val > maxFrameSizeLimit {
+				return ConnectionError(ErrCodeProtocol)
+			}
+			sc.maxFrameSize = s.Val
+		}
+	}
+	return nil
+}
+
+// processWindowUpdate：增大发送窗口，并继续发送等待窗口的数据
+func (sc *serverConn) processWindowUpdate(h frameHeader, payload []byte) error {
+	if len(payload) != 4 {
+		return ConnectionError(ErrCodeFrameSize)
+	}
+	inc := int64(binary.BigEndian.Uint32(payload) & (1<<31 - 1))
+
+	if h.StreamID == 0 {
+		if inc == 0 {
+			return ConnectionError(ErrCodeProtocol)
+		}
+		if sc.sendWindow += inc; sc.sendWindow > maxWindowSize {
+			return ConnectionError(ErrCodeFlowControl)
+		}
+		sc.flush()
+		return nil
+	}
+
+	st := sc.streams[h.StreamID]
+	if st == nil {
+		// 已经关闭的流上的 WINDOW_UPDATE 直接忽略
+		if h.StreamID > sc.lastStreamID {
+			return ConnectionError(ErrCodeProtocol)
+		}
+		return nil
+	}
+	if inc == 0 {
+		return StreamError{StreamID: h.StreamID, Code: ErrCodeProtocol}
+	}
+	if st.sendWindow += inc; st.sendWindow > maxWindowSize {
+		return StreamError{StreamID: h.StreamID, Code: ErrCodeFlowControl}
+	}
+	sc.flush()
+	return nil
+}
+
+// handleError：流错误发送 RST_STREAM，连接错误发送 GOAWAY 并在发送之后关闭连接
+func (sc *serverConn) handleError(err error) {
+	switch e := err.(type) {
+	case StreamError:
+		sc.out = appendUint32Frame(sc.out, FrameRSTStream, e.StreamID, uint32(e.Code))
+		if st := sc.streams[e.StreamID]; st != nil {
+			sc.closeStream(st)
+		}
+	case ConnectionError:
+		log.Error("[h2c]", sc.c.PeerAddr(), err)
+		sc.out = appendGoAway(sc.out, sc.lastStreamID, ErrCode(e))
+		sc.close()
+	}
+}
+
+// close：之后收到的数据全部丢弃，等待发送的帧发送之后关闭连接
+func (sc *serverConn) close() {
+	sc.state = stateClosing
+	sc.ready = nil
+	_ = sc.c.CloseAfterFlush()
+}
+
+// closeIfIdle：收到 GOAWAY 之后，所有流结束时关闭连接
+func (sc *serverConn) closeIfIdle() {
+	if sc.goAway && len(sc.streams) == 0 && sc.state != stateClosing {
+		sc.close()
+	}
+}
+
+// peek：拷贝 buffer 中前 n 个字节
+func peek(buffer *ringbuffer.RingBuffer, n int) []byte {
+	first, end := buffer.Peek(n)
+	ret := make([]byte, len(first)+len(end))
+	copy(ret, first)
+	copy(ret[len(first):], end)
+	return ret
+}
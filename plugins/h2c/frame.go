@@ -0,0 +1,205 @@
+package h2c
+
+import (
+	"encoding/binary"
+	"strconv"
+)
+
+// frameHeaderLen：帧头长度，24 位长度、8 位类型、8 位标志与 31 位流 ID
+const frameHeaderLen = 9
+
+// FrameType：帧类型
+// See https://tools.ietf.org/html/rfc7540#section-6
+type FrameType uint8
+
+const (
+	FrameData         FrameType = 0x0
+	FrameHeaders      FrameType = 0x1
+	FramePriority     FrameType = 0x2
+	FrameRSTStream    FrameType = 0x3
+	FrameSettings     FrameType = 0x4
+	FramePushPromise  FrameType = 0x5
+	FramePing         FrameType = 0x6
+	FrameGoAway       FrameType = 0x7
+	FrameWindowUpdate FrameType = 0x8
+	FrameContinuation FrameType = 0x9
+)
+
+// 帧标志
+const (
+	flagEndStream  = 0x1 // DATA、HEADERS
+	flagAck        = 0x1 // SETTINGS、PING
+	flagEndHeaders = 0x4 // HEADERS、CONTINUATION
+	flagPadded     = 0x8 // DATA、HEADERS
+	flagPriority   = 0x20
+)
+
+// ErrCode：RST_STREAM 与 GOAWAY 中的错误码
+// See https://tools.ietf.org/html/rfc7540#section-7
+type ErrCode uint32
+
+const (
+	ErrCodeNo                 ErrCode = 0x0
+	ErrCodeProtocol           ErrCode = 0x1
+	ErrCodeInternal           ErrCode = 0x2
+	ErrCodeFlowControl        ErrCode = 0x3
+	ErrCodeSettingsTimeout    ErrCode = 0x4
+	ErrCodeStreamClosed       ErrCode = 0x5
+	ErrCodeFrameSize          ErrCode = 0x6
+	ErrCodeRefusedStream      ErrCode = 0x7
+	ErrCodeCancel             ErrCode = 0x8
+	ErrCodeCompression        ErrCode = 0x9
+	ErrCodeConnect            ErrCode = 0xa
+	ErrCodeEnhanceYourCalm    ErrCode = 0xb
+	ErrCodeInadequateSecurity ErrCode = 0xc
+	ErrCodeHTTP11Required     ErrCode = 0xd
+)
+
+var errCodeName = map[ErrCode]string{
+	ErrCodeNo:                 "NO_ERROR",
+	ErrCodeProtocol:           "PROTOCOL_ERROR",
+	ErrCodeInternal:           "INTERNAL_ERROR",
+	ErrCodeFlowControl:        "FLOW_CONTROL_ERROR",
+	ErrCodeSettingsTimeout:    "SETTINGS_TIMEOUT",
+	ErrCodeStreamClosed:       "STREAM_CLOSED",
+	ErrCodeFrameSize:          "FRAME_SIZE_ERROR",
+	ErrCodeRefusedStream:      "REFUSED_STREAM",
+	ErrCodeCancel:             "CANCEL",
+	ErrCodeCompression:        "COMPRESSION_ERROR",
+	ErrCodeConnect:            "CONNECT_ERROR",
+	ErrCodeEnhanceYourCalm:    "ENHANCE_YOUR_CALM",
+	ErrCodeInadequateSecurity: "INADEQUATE_SECURITY",
+	ErrCodeHTTP11Required:     "HTTP_1_1_REQUIRED",
+}
+
+func (e ErrCode) String() string {
+	if name, ok := errCodeName[e]; ok {
+		return name
+	}
+	return "unknown error code 0x" + strconv.FormatUint(uint64(e), 16)
+}
+
+// ConnectionError：连接错误，发送 GOAWAY 之后关闭连接
+type ConnectionError ErrCode
+
+func (e ConnectionError) Error() string {
+	return "h2c: connection error: " + ErrCode(e).String()
+}
+
+// StreamError：流错误，发送 RST_STREAM 关闭流，连接继续使用
+type StreamError struct {
+	StreamID uint32
+	Code     ErrCode
+}
+
+func (e StreamError) Error() string {
+	return "h2c: stream " + strconv.FormatUint(uint64(e.StreamID), 10) + " error: " + e.Code.String()
+}
+
+// SettingID：SETTINGS 参数
+// See https://tools.ietf.org/html/rfc7540#section-6.5.2
+type SettingID uint16
+
+const (
+	SettingHeaderTableSize      SettingID = 0x1
+	SettingEnablePush           SettingID = 0x2
+	SettingMaxConcurrentStreams SettingID = 0x3
+	SettingInitialWindowSize    SettingID = 0x4
+	SettingMaxFrameSize         SettingID = 0x5
+	SettingMaxHeaderListSize    SettingID = 0x6
+)
+
+// Setting：一个 SETTINGS 参数
+type Setting struct {
+	ID  SettingID
+	Val uint32
+}
+
+const (
+	defaultMaxFrameSize      = 16384
+	maxFrameSizeLimit        = 1<<24 - 1
+	defaultInitialWindowSize = 65535
+	maxWindowSize            = 1<<31 - 1
+	defaultHeaderTableSize   = 4096
+)
+
+// frameHeader：帧头
+type frameHeader struct {
+	Length   uint32
+	Type     FrameType
+	Flags    uint8
+	StreamID uint32
+}
+
+func (h frameHeader) has(flag uint8) bool {
+	return h.Flags&flag != 0
+}
+
+// parseFrameHeader：解析 9 字节帧头，忽略流 ID 的保留位
+func parseFrameHeader(b []byte) frameHeader {
+	return frameHeader{
+		Length:   uint32(b[0])<<16 | uint32(b[1])<<8 | uint32(b[2]),
+		Type:     FrameType(b[3]),
+		Flags:    b[4],
+		StreamID: binary.BigEndian.Uint32(b[5:]) & (1<<31 - 1),
+	}
+}
+
+// appendFrame：写入帧头与 payload
+func appendFrame(dst []byte, t FrameType, flags uint8, streamID uint32, payload []byte) []byte {
+	n := len(payload)
+	dst = append(dst, byte(n>>16), byte(n>>8), byte(n), byte(t), flags,
+		byte(streamID>>24), byte(streamID>>16), byte(streamID>>8), byte(streamID))
+	return append(dst, payload...)
+}
+
+// appendSettings：写入 SETTINGS 帧
+func appendSettings(dst []byte, settings ...Setting) []byte {
+	payload := make([]byte, 0, 6*len(settings))
+	for _, s := range settings {
+		payload = append(payload, byte(s.ID>>8), byte(s.ID),
+			byte(s.Val>>24), byte(s.Val>>16), byte(s.Val>>8), byte(s.Val))
+	}
+	return appendFrame(dst, FrameSettings, 0, 0, payload)
+}
+
+// parseSettings：解析 SETTINGS payload，长度必须是 6 的倍数
+func parseSettings(payload []byte) ([]Setting, error) {
+	if len(payload)%6 != 0 {
+		return nil, ConnectionError(ErrCodeFrameSize)
+	}
+	settings := make([]Setting, 0, len(payload)/6)
+	for i := 0; i < len(payload); i += 6 {
+		settings = append(settings, Setting{
+			ID:  SettingID(binary.BigEndian.Uint16(payload[i:])),
+			Val: binary.BigEndian.Uint32(payload[i+2:]),
+		})
+	}
+	return settings, nil
+}
+
+// appendUint32Frame：写入 payload 为一个 32 位整数的帧，用于 RST_STREAM 与 WINDOW_UPDATE
+func appendUint32Frame(dst []byte, t FrameType, streamID uint32, v uint32) []byte {
+	var payload [4]byte
+	binary.BigEndian.PutUint32(payload[:], v)
+	return appendFrame(dst, t, 0, streamID, payload[:])
+}
+
+// appendGoAway：写入 GOAWAY 帧
+func appendGoAway(dst []byte, lastStreamID uint32, code ErrCode) []byte {
+	var payload [8]byte
+	binary.BigEndian.PutUint32(payload[:], lastStreamID)
+	binary.BigEndian.PutUint32(payload[4:], uint32(code))
+	return appendFrame(dst, FrameGoAway, 0, 0, payload[:])
+}
+
+// stripPadding：去掉 PADDED 标志对应的填充，填充长度不合法时为连接错误
+func stripPadding(h frameHeader, payload []byte) ([]byte, error) {
+	if !h.has(flagPadded) {
+		return payload, nil
+	}
+	if len(payload) == 0 || int(payload[0]) >= len(payload) {
+		return nil, ConnectionError(ErrCodeProtocol)
+	}
+	return payload[1 : len(payload)-int(payload[0])], nil
+}
@@ -0,0 +1,77 @@
+package h2c
+
+// Options：h2c 配置
+type Options struct {
+	MaxConcurrentStreams uint32 // 客户端同时打开的最大流数，超过的流会被 REFUSED_STREAM 拒绝
+	InitialWindowSize    uint32 // 每个流的初始接收窗口
+	MaxFrameSize         uint32 // 接收帧的最大 payload 长度
+	MaxHeaderListSize    uint32 // 解码之后请求头的最大字节数，也用于 Upgrade 请求
+	MaxBodySize          int    // 请求体的最大字节数
+}
+
+// Option ...
+type Option func(*Options)
+
+// newOptions：返回一个新的 Options 配置
+func newOptions(opt ...Option) *Options {
+	opts := Options{}
+
+	for _, o := range opt {
+		o(&opts)
+	}
+	if opts.MaxConcurrentStreams == 0 {
+		opts.MaxConcurrentStreams = 100
+	}
+	if opts.InitialWindowSize == 0 || opts.InitialWindowSize > maxWindowSize {
+		opts.InitialWindowSize = defaultInitialWindowSize
+	}
+	// 合法范围为 16K 到 16M-1
+	if opts.MaxFrameSize < defaultMaxFrameSize || opts.MaxFrameSize > maxFrameSizeLimit {
+		opts.MaxFrameSize = defaultMaxFrameSize
+	}
+	// 默认请求头最大 16K
+	if opts.MaxHeaderListSize == 0 {
+		opts.MaxHeaderListSize = 16 * 1024
+	}
+	// 默认请求体最大 4M
+	if opts.MaxBodySize <= 0 {
+		opts.MaxBodySize = 4 * 1024 * 1024
+	}
+
+	return &opts
+}
+
+// MaxConcurrentStreams：客户端同时打开的最大流数
+func MaxConcurrentStreams(n uint32) Option {
+	return func(o *Options) {
+		o.MaxConcurrentStreams = n
+	}
+}
+
+// InitialWindowSize：每个流的初始接收窗口
+func InitialWindowSize(n uint32) Option {
+	return func(o *Options) {
+		o.InitialWindowSize = n
+	}
+}
+
+// MaxFrameSize：接收帧的最大 payload 长度
+func MaxFrameSize(n uint32) Option {
+	return func(o *Options) {
+		o.MaxFrameSize = n
+	}
+}
+
+// MaxHeaderListSize：解码之后请求头的最大字节数
+func MaxHeaderListSize(n uint32) Option {
+	return func(o *Options) {
+		o.MaxHeaderListSize = n
+	}
+}
+
+// MaxBodySize：请求体的最大字节数
+func MaxBodySize(n int) Option {
+	return func(o *Options) {
+		o.MaxBodySize = n
+	}
+}
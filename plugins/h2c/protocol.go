@@ -0,0 +1,185 @@
+package h2c
+
+import (
+	"bytes"
+	"encoding/base64"
+	nethttp "net/http"
+	"strings"
+
+	"github.com/Dongxiem/fastnet/connection"
+	"github.com/Dongxiem/fastnet/plugins/http"
+	"github.com/Dongxiem/fastnet/tool/ringbuffer"
+)
+
+var _ connection.Protocol = &Protocol{}
+
+const (
+	upgradeResponse     = "HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: h2c\r\n\r\n"
+	upgradeRequired     = "HTTP/1.1 426 Upgrade Required\r\nConnection: Upgrade, close\r\nUpgrade: h2c\r\nContent-Length: 0\r\n\r\n"
+	badUpgradeRequest   = "HTTP/1.1 400 Bad Request\r\nConnection: close\r\nContent-Length: 0\r\n\r\n"
+	http2SettingsHeader = "Http2-Settings"
+)
+
+// Protocol：HTTP/2 cleartext 协议，支持 prior knowledge 与 HTTP/1.1 Upgrade 两种方式
+// See https://tools.ietf.org/html/rfc7540#section-3
+type Protocol struct {
+	opts *Options
+	http *http.Protocol
+}
+
+// New：创建 h2c Protocol
+func New(opts ...Option) *Protocol {
+	p := &Protocol{opts: newOptions(opts...)}
+	p.http = http.New(http.MaxHeaderSize(int(p.opts.MaxHeaderListSize)), http.MaxBodySize(p.opts.MaxBodySize))
+	return p
+}
+
+// UnPacket：拆包，返回的 ctx 为完整接收的 *Request，
+// out 为需要先于响应发送的帧，例如 SETTINGS ACK、PING ACK 与 WINDOW_UPDATE
+func (p *Protocol) UnPacket(c *connection.Connection, buffer *ringbuffer.RingBuffer) (ctx interface{}, out []byte) {
+	sc := p.serverConn(c)
+	for {
+		if len(sc.ready) > 0 {
+			req := sc.ready[0]
+			sc.ready = sc.ready[1:]
+			return req, sc.takeOut()
+		}
+		if sc.state == stateClosing {
+			buffer.RetrieveAll()
+			return nil, sc.takeOut()
+		}
+
+		var ok bool
+		var err error
+		switch sc.state {
+		case stateInit:
+			ok, err = p.readInit(sc, c, buffer)
+		case statePreface:
+			ok, err = sc.readPreface(buffer)
+		default:
+			ok, err = sc.readFrame(buffer)
+		}
+		if err != nil {
+			sc.handleError(err)
+			continue
+		}
+		if !ok {
+			return nil, sc.takeOut()
+		}
+	}
+}
+
+// Packet：直接返回，帧由 serverConn 完成编码
+func (p *Protocol) Packet(c *connection.Connection, data []byte) []byte {
+	return data
+}
+
+// serverConn：获取连接上的 HTTP/2 状态，不存在时创建
+func (p *Protocol) serverConn(c *connection.Connection) *serverConn {
+	if v, ok := c.Get(connKey); ok {
+		return v.(*serverConn)
+	}
+	sc := newServerConn(c, p.opts)
+	c.Set(connKey, sc)
+	return sc
+}
+
+// readInit：以连接序言开始为 prior knowledge，否则按 HTTP/1.1 Upgrade 请求解析
+func (p *Protocol) readInit(sc *serverConn, c *connection.Connection, buffer *ringbuffer.RingBuffer) (bool, error) {
+	n := buffer.Length()
+	if n > len(clientPreface) {
+		n = len(clientPreface)
+	}
+	if bytes.Equal(peek(buffer, n), clientPreface[:n]) {
+		if n < len(clientPreface) {
+			return false, nil
+		}
+		buffer.Retrieve(n)
+		sc.start()
+		sc.state = stateSettings
+		return true, nil
+	}
+
+	ctx, _ := p.http.UnPacket(c, buffer)
+	req, ok := ctx.(*http.Request)
+	if !ok {
+		return false, nil
+	}
+	p.upgrade(sc, req)
+	return true, nil
+}
+
+// upgrade：处理 HTTP/1.1 Upgrade 请求，Upgrade 请求本身作为流 1 上的请求
+// See https://tools.ietf.org/html/rfc7540#section-3.2
+func (p *Protocol) upgrade(sc *serverConn, req *http.Request) {
+	// 解析失败的请求没有 Method
+	if req.Method == "" {
+		sc.out = append(sc.out, badUpgradeRequest...)
+		sc.close()
+		return
+	}
+	if !headerContains(req.Header, "Upgrade", "h2c") || !headerContains(req.Header, "Connection", "upgrade") ||
+		!headerContains(req.Header, "Connection", http2SettingsHeader) {
+		sc.out = append(sc.out, upgradeRequired...)
+		sc.close()
+		return
+	}
+
+	values := req.Header[http2SettingsHeader]
+	var settings []Setting
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(firstValue(values), "="))
+	if err == nil {
+		settings, err = parseSettings(payload)
+	}
+	if err == nil {
+		err = sc.applySettings(settings)
+	}
+	if len(values) != 1 || err != nil {
+		sc.out = append(sc.out, badUpgradeRequest...)
+		sc.close()
+		return
+	}
+
+	sc.out = append(sc.out, upgradeResponse...)
+	sc.start()
+	sc.state = statePreface
+
+	header := make(nethttp.Header, len(req.Header))
+	for k, vs := range req.Header {
+		if k == "Host" || k == http2SettingsHeader || connectionHeaders[strings.ToLower(k)] {
+			continue
+		}
+		header[k] = vs
+	}
+	st := sc.newStream(&Request{
+		StreamID:  1,
+		Method:    req.Method,
+		Scheme:    "http",
+		Authority: req.Host(),
+		Path:      req.Path,
+		RawQuery:  req.RawQuery,
+		Header:    header,
+	})
+	sc.lastStreamID = 1
+	st.body = req.Body
+	_ = sc.endStream(st)
+}
+
+// headerContains：逗号分隔的请求头中是否包含 token，不区分大小写
+func headerContains(h nethttp.Header, key, token string) bool {
+	for _, v := range h[key] {
+		for _, s := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(s), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func firstValue(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
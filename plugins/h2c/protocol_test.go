@@ -0,0 +1,456 @@
+package h2c
+
+import (
+	"bytes"
+	"encoding/base64"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/Dongxiem/fastnet/connection"
+	"github.com/Dongxiem/fastnet/eventloop"
+	"github.com/Dongxiem/fastnet/tool/ringbuffer"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+	"golang.org/x/sys/unix"
+)
+
+// testClient：使用 x/net/http2 的 Framer 作为客户端，直接驱动 Protocol 与 HandlerWrap
+type testClient struct {
+	t      *testing.T
+	p      *Protocol
+	w      *HandlerWrap
+	c      *connection.Connection
+	fd     int
+	buffer *ringbuffer.RingBuffer
+
+	in     bytes.Buffer // 客户端写入的数据
+	fr     *http2.Framer
+	encBuf bytes.Buffer
+	enc    *hpack.Encoder
+
+	out bytes.Buffer // 服务端发送的数据
+	rfr *http2.Framer
+}
+
+func newTestClient(t *testing.T, handler HandlerFunc, opts ...Option) *testClient {
+	fds, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_STREAM, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = unix.SetNonblock(fds[0], true)
+	_ = unix.SetsockoptTimeval(fds[1], unix.SOL_SOCKET, unix.SO_RCVTIMEO, &unix.Timeval{Sec: 2})
+
+	loop, err := eventloop.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	go loop.RunLoop()
+	t.Cleanup(func() {
+		_ = loop.Stop()
+		_ = unix.Close(fds[1])
+	})
+
+	tc := &testClient{
+		t:      t,
+		p:      New(opts...),
+		w:      NewHandlerWrap(handler),
+		fd:     fds[1],
+		buffer: ringbuffer.New(0),
+	}
+	tc.c = connection.New(fds[0], loop, nil, tc.p, nil, 0, tc.w)
+	if err = loop.AddSocketAndEnableRead(fds[0], tc.c); err != nil {
+		t.Fatal(err)
+	}
+	tc.fr = http2.NewFramer(&tc.in, nil)
+	tc.fr.AllowIllegalWrites = true
+	tc.enc = hpack.NewEncoder(&tc.encBuf)
+	tc.rfr = http2.NewFramer(nil, &tc.out)
+	tc.rfr.ReadMetaHeaders = hpack.NewDecoder(4096, nil)
+	return tc
+}
+
+// flush：把客户端写入的数据交给服务端处理，与 Connection.handlerProtocol 相同
+func (tc *testClient) flush() {
+	_, _ = tc.buffer.Write(tc.in.Bytes())
+	tc.in.Reset()
+	ctx, data := tc.p.UnPacket(tc.c, tc.buffer)
+	for ctx != nil || len(data) != 0 {
+		if send := tc.w.OnMessage(tc.c, ctx, data); len(send) > 0 {
+			tc.out.Write(tc.p.Packet(tc.c, send))
+		}
+		ctx, data = tc.p.UnPacket(tc.c, tc.buffer)
+	}
+}
+
+// handshake：prior knowledge 方式建立连接，跳过服务端的 SETTINGS 与 ACK
+func (tc *testClient) handshake(settings ...http2.Setting) {
+	tc.in.Write(clientPreface)
+	_ = tc.fr.WriteSettings(settings...)
+	tc.flush()
+	if f := tc.readFrame().(*http2.SettingsFrame); f.IsAck() {
+		tc.t.Fatal("server should send settings first")
+	}
+	if f := tc.readFrame().(*http2.SettingsFrame); !f.IsAck() {
+		tc.t.Fatal("server should ack settings")
+	}
+}
+
+func (tc *testClient) headerBlock(fields ...string) []byte {
+	tc.encBuf.Reset()
+	for i := 0; i < len(fields); i += 2 {
+		_ = tc.enc.WriteField(hpack.HeaderField{Name: fields[i], Value: fields[i+1]})
+	}
+	return append([]byte(nil), tc.encBuf.Bytes()...)
+}
+
+func (tc *testClient) writeHeaders(streamID uint32, endStream bool, fields ...string) {
+	_ = tc.fr.WriteHeaders(http2.HeadersFrameParam{
+		StreamID:      streamID,
+		BlockFragment: tc.headerBlock(fields...),
+		EndStream:     endStream,
+		EndHeaders:    true,
+	})
+}
+
+func (tc *testClient) readFrame() http2.Frame {
+	f, err := tc.rfr.ReadFrame()
+	if err != nil {
+		tc.t.Fatal(err)
+	}
+	return f
+}
+
+// readResponse：读取一个流上的响应，返回状态码、响应头、响应体与 trailer
+func (tc *testClient) readResponse(streamID uint32) (status string, header, trailer map[string]string, body string) {
+	header = make(map[string]string)
+	for {
+		switch f := tc.readFrame().(type) {
+		case *http2.MetaHeadersFrame:
+			if f.StreamID != streamID {
+				tc.t.Fatalf("got headers on stream %d, want %d", f.StreamID, streamID)
+			}
+			fields := header
+			if status != "" {
+				trailer = make(map[string]string)
+				fields = trailer
+			}
+			for _, hf := range f.Fields {
+				if hf.Name == ":status" {
+					status = hf.Value
+					continue
+				}
+				fields[hf.Name] = hf.Value
+			}
+			if f.StreamEnded() {
+				return
+			}
+		case *http2.DataFrame:
+			if f.StreamID != streamID {
+				tc.t.Fatalf("got data on stream %d, want %d", f.StreamID, streamID)
+			}
+			body += string(f.Data())
+			if f.StreamEnded() {
+				return
+			}
+		default:
+			tc.t.Fatalf("unexpected frame %v", f)
+		}
+	}
+}
+
+// closed：服务端是否已经关闭连接
+func (tc *testClient) closed() bool {
+	n, err := unix.Read(tc.fd, make([]byte, 64))
+	return n == 0 && err == nil
+}
+
+func echo(c *connection.Connection, req *Request) *Response {
+	resp := Text(200, req.Method+" "+req.Path+"?"+req.RawQuery+" "+string(req.Body))
+	resp.Header.Set("X-Stream", strconv.Itoa(int(req.StreamID)))
+	return resp
+}
+
+func TestProtocol_PriorKnowledge(t *testing.T) {
+	tc := newTestClient(t, echo)
+	tc.handshake()
+
+	_ = tc.fr.WritePing(false, [8]byte{1, 2, 3})
+	tc.writeHeaders(1, true, ":method", "GET", ":scheme", "http", ":authority", "example.com", ":path", "/a?x=1")
+	// 两个流交错发送请求体
+	tc.writeHeaders(3, false, ":method", "POST", ":scheme", "http", ":path", "/b", "content-length", "6")
+	tc.writeHeaders(5, false, ":method", "POST", ":scheme", "http", ":path", "/c")
+	_ = tc.fr.WriteData(3, false, []byte("abc"))
+	_ = tc.fr.WriteData(5, false, []byte("x"))
+	_ = tc.fr.WriteData(3, true, []byte("def"))
+	_ = tc.fr.WriteData(5, false, []byte("y"))
+	tc.writeHeaders(5, true, "x-checksum", "2")
+	tc.flush()
+
+	if f := tc.readFrame().(*http2.PingFrame); !f.IsAck() || f.Data != [8]byte{1, 2, 3} {
+		t.Fatalf("got %v", f)
+	}
+	tests := []struct {
+		id   uint32
+		body string
+	}{
+		{1, "GET /a?x=1 "},
+		{3, "POST /b? abcdef"},
+		{5, "POST /c? xy"},
+	}
+	for _, tt := range tests {
+		status, header, _, body := tc.readResponse(tt.id)
+		if status != "200" || body != tt.body || header["content-length"] != strconv.Itoa(len(tt.body)) ||
+			header["x-stream"] != strconv.Itoa(int(tt.id)) {
+			t.Fatalf("stream %d: got %s %v %q", tt.id, status, header, body)
+		}
+	}
+	if tc.out.Len() != 0 {
+		t.Fatalf("unexpected data % x", tc.out.Bytes())
+	}
+}
+
+func TestProtocol_Trailer(t *testing.T) {
+	// gRPC 风格的 unary 调用：请求与响应都带 trailer
+	tc := newTestClient(t, func(c *connection.Connection, req *Request) *Response {
+		if req.Header.Get("Content-Type") != "application/grpc" || req.Header.Get("Te") != "trailers" {
+			return Error(400)
+		}
+		resp := NewResponse(200, req.Body)
+		resp.Header.Set("Content-Type", "application/grpc")
+		resp.Trailer = map[string][]string{"Grpc-Status": {"0"}}
+		return resp
+	})
+	tc.handshake()
+	tc.writeHeaders(1, false, ":method", "POST", ":scheme", "http", ":path", "/pkg.Service/Method",
+		"content-type", "application/grpc", "te", "trailers")
+	_ = tc.fr.WriteData(1, true, []byte("\x00\x00\x00\x00\x02hi"))
+	tc.flush()
+
+	status, header, trailer, body := tc.readResponse(1)
+	if status != "200" || header["content-type"] != "application/grpc" || body != "\x00\x00\x00\x00\x02hi" {
+		t.Fatalf("got %s %v %q", status, header, body)
+	}
+	if _, ok := header["content-length"]; ok || trailer["grpc-status"] != "0" {
+		t.Fatalf("got %v %v", header, trailer)
+	}
+}
+
+func TestProtocol_FlowControl(t *testing.T) {
+	tc := newTestClient(t, func(c *connection.Connection, req *Request) *Response {
+		return NewResponse(200, []byte(strings.Repeat("x", 25)))
+	}, InitialWindowSize(100))
+	tc.handshake(http2.Setting{ID: http2.SettingInitialWindowSize, Val: 10})
+
+	// 发送窗口只有 10 字节，等待 WINDOW_UPDATE 之后继续发送
+	tc.writeHeaders(1, true, ":method", "GET", ":scheme", "http", ":path", "/")
+	tc.flush()
+	tc.readFrame()
+	if f := tc.readFrame().(*http2.DataFrame); len(f.Data()) != 10 || f.StreamEnded() {
+		t.Fatalf("got %v", f)
+	}
+	if tc.out.Len() != 0 {
+		t.Fatal("stream window should be exhausted")
+	}
+	_ = tc.fr.WriteWindowUpdate(1, 10)
+	tc.flush()
+	if f := tc.readFrame().(*http2.DataFrame); len(f.Data()) != 10 || f.StreamEnded() {
+		t.Fatalf("got %v", f)
+	}
+	// 增大 INITIAL_WINDOW_SIZE 也会增大已经打开的流的发送窗口
+	_ = tc.fr.WriteSettings(http2.Setting{ID: http2.SettingInitialWindowSize, Val: 20})
+	tc.flush()
+	tc.readFrame()
+	if f := tc.readFrame().(*http2.DataFrame); len(f.Data()) != 5 || !f.StreamEnded() {
+		t.Fatalf("got %v", f)
+	}
+
+	// 接收窗口过半之后发送 WINDOW_UPDATE，超过窗口的数据为流错误
+	tc.writeHeaders(3, false, ":method", "POST", ":scheme", "http", ":path", "/")
+	_ = tc.fr.WriteData(3, false, make([]byte, 60))
+	tc.flush()
+	if f := tc.readFrame().(*http2.WindowUpdateFrame); f.StreamID != 3 || f.Increment != 60 {
+		t.Fatalf("got %v", f)
+	}
+	_ = tc.fr.WriteData(3, false, make([]byte, 101))
+	tc.flush()
+	if f := tc.readFrame().(*http2.RSTStreamFrame); f.StreamID != 3 || f.ErrCode != http2.ErrCodeFlowControl {
+		t.Fatalf("got %v", f)
+	}
+}
+
+func TestProtocol_Upgrade(t *testing.T) {
+	tc := newTestClient(t, echo)
+
+	var settings bytes.Buffer
+	_ = http2.NewFramer(&settings, nil).WriteSettings(http2.Setting{ID: http2.SettingMaxFrameSize, Val: 1 << 20})
+	tc.in.WriteString("POST /up?y=2 HTTP/1.1\r\nHost: example.com\r\nContent-Length: 4\r\n" +
+		"Connection: Upgrade, HTTP2-Settings\r\nUpgrade: h2c\r\n" +
+		"HTTP2-Settings: " + base64.RawURLEncoding.EncodeToString(settings.Bytes()[9:]) + "\r\n\r\nbody")
+	tc.flush()
+	if !strings.HasPrefix(tc.out.String(), upgradeResponse) {
+		t.Fatalf("got %q", tc.out.String())
+	}
+	tc.out.Next(len(upgradeResponse))
+	if f := tc.readFrame().(*http2.SettingsFrame); f.IsAck() {
+		t.Fatal("server should send settings after 101")
+	}
+	// Upgrade 请求作为流 1 的请求
+	if status, _, _, body := tc.readResponse(1); status != "200" || body != "POST /up?y=2 body" {
+		t.Fatalf("got %s %q", status, body)
+	}
+
+	// 之后客户端发送连接序言
+	tc.in.Write(clientPreface)
+	_ = tc.fr.WriteSettings()
+	tc.writeHeaders(3, true, ":method", "GET", ":scheme", "http", ":path", "/next")
+	tc.flush()
+	tc.readFrame()
+	if status, _, _, body := tc.readResponse(3); status != "200" || body != "GET /next? " {
+		t.Fatalf("got %s %q", status, body)
+	}
+
+	// 不是 Upgrade 请求
+	tc = newTestClient(t, echo)
+	tc.in.WriteString("GET / HTTP/1.1\r\nHost: example.com\r\n\r\n")
+	tc.flush()
+	if tc.out.String() != upgradeRequired || !tc.closed() {
+		t.Fatalf("got %q", tc.out.String())
+	}
+}
+
+func TestProtocol_Errors(t *testing.T) {
+	get := []string{":method", "GET", ":scheme", "http", ":path", "/"}
+	tests := []struct {
+		name   string
+		opts   []Option
+		write  func(tc *testClient)
+		goAway http2.ErrCode // 0 时为 RST_STREAM
+		rst    http2.ErrCode
+	}{
+		{
+			name:   "first frame not settings",
+			write:  func(tc *testClient) { _ = tc.fr.WritePing(false, [8]byte{}) },
+			goAway: http2.ErrCodeProtocol,
+		},
+		{
+			name:   "frame too large",
+			write:  func(tc *testClient) { _ = tc.fr.WriteData(1, false, make([]byte, defaultMaxFrameSize+1)) },
+			goAway: http2.ErrCodeFrameSize,
+		},
+		{
+			name:   "even stream id",
+			write:  func(tc *testClient) { tc.writeHeaders(2, true, get...) },
+			goAway: http2.ErrCodeProtocol,
+		},
+		{
+			name:   "data on idle stream",
+			write:  func(tc *testClient) { _ = tc.fr.WriteData(7, true, []byte("x")) },
+			goAway: http2.ErrCodeProtocol,
+		},
+		{
+			name:   "zero window update",
+			write:  func(tc *testClient) { _ = tc.fr.WriteWindowUpdate(0, 0) },
+			goAway: http2.ErrCodeProtocol,
+		},
+		{
+			name: "interrupted header block",
+			write: func(tc *testClient) {
+				_ = tc.fr.WriteHeaders(http2.HeadersFrameParam{StreamID: 1, BlockFragment: tc.headerBlock(get...)})
+				_ = tc.fr.WritePing(false, [8]byte{})
+			},
+			goAway: http2.ErrCodeProtocol,
+		},
+		{
+			name:   "bad hpack",
+			write:  func(tc *testClient) { _ = tc.fr.WriteRawFrame(http2.FrameHeaders, 0x5, 1, []byte{0xff}) },
+			goAway: http2.ErrCodeCompression,
+		},
+		{
+			name:  "uppercase header",
+			write: func(tc *testClient) { tc.writeHeaders(1, true, append(get, "X-Upper", "1")...) },
+			rst:   http2.ErrCodeProtocol,
+		},
+		{
+			name:  "missing path",
+			write: func(tc *testClient) { tc.writeHeaders(1, true, ":method", "GET", ":scheme", "http") },
+			rst:   http2.ErrCodeProtocol,
+		},
+		{
+			name:  "connection header",
+			write: func(tc *testClient) { tc.writeHeaders(1, true, append(get, "connection", "close")...) },
+			rst:   http2.ErrCodeProtocol,
+		},
+		{
+			name: "content-length mismatch",
+			write: func(tc *testClient) {
+				tc.writeHeaders(1, false, append(get, "content-length", "3")...)
+				_ = tc.fr.WriteData(1, true, []byte("ab"))
+			},
+			rst: http2.ErrCodeProtocol,
+		},
+		{
+			name: "too many streams",
+			opts: []Option{MaxConcurrentStreams(1)},
+			write: func(tc *testClient) {
+				tc.writeHeaders(1, false, get...)
+				tc.writeHeaders(3, false, get...)
+			},
+			rst: http2.ErrCodeRefusedStream,
+		},
+		{
+			name:   "reset idle stream",
+			write:  func(tc *testClient) { _ = tc.fr.WriteRSTStream(1, http2.ErrCodeCancel) },
+			goAway: http2.ErrCodeProtocol,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tc := newTestClient(t, echo, tt.opts...)
+			if tt.name == "first frame not settings" {
+				tc.in.Write(clientPreface)
+				tc.flush()
+				tc.readFrame()
+			} else {
+				tc.handshake()
+			}
+			tt.write(tc)
+			tc.flush()
+
+			if tt.goAway != 0 {
+				f, ok := tc.readFrame().(*http2.GoAwayFrame)
+				if !ok || f.ErrCode != tt.goAway {
+					t.Fatalf("got %v", f)
+				}
+				if !tc.closed() {
+					t.Fatal("connection should be closed")
+				}
+				return
+			}
+			f, ok := tc.readFrame().(*http2.RSTStreamFrame)
+			if !ok || f.ErrCode != tt.rst {
+				t.Fatalf("got %v", f)
+			}
+		})
+	}
+}
+
+func TestProtocol_TooLarge(t *testing.T) {
+	tc := newTestClient(t, echo, MaxBodySize(4))
+	tc.handshake()
+	tc.writeHeaders(1, false, ":method", "POST", ":scheme", "http", ":path", "/")
+	_ = tc.fr.WriteData(1, false, []byte("hello"))
+	// 流已经关闭，之后的数据为 STREAM_CLOSED
+	_ = tc.fr.WriteData(1, true, []byte("!"))
+	tc.flush()
+
+	if status, _, _, _ := tc.readResponse(1); status != "413" {
+		t.Fatalf("got %s", status)
+	}
+	if f := tc.readFrame().(*http2.RSTStreamFrame); f.ErrCode != http2.ErrCodeNo {
+		t.Fatalf("got %v", f)
+	}
+	if f := tc.readFrame().(*http2.RSTStreamFrame); f.ErrCode != http2.ErrCodeStreamClosed {
+		t.Fatalf("got %v", f)
+	}
+}
@@ -0,0 +1,146 @@
+package h2c
+
+import (
+	nethttp "net/http"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/http2/hpack"
+)
+
+// Request：一个流上的完整请求
+type Request struct {
+	StreamID  uint32
+	Method    string
+	Scheme    string
+	Authority string
+	Path      string
+	RawQuery  string
+	Header    nethttp.Header
+	Body      []byte
+	Trailer   nethttp.Header
+}
+
+// Query：解析 URL 查询参数
+func (r *Request) Query() url.Values {
+	v, _ := url.ParseQuery(r.RawQuery)
+	return v
+}
+
+// Host：返回 :authority，没有时返回 Host 请求头
+func (r *Request) Host() string {
+	if r.Authority != "" {
+		return r.Authority
+	}
+	return r.Header.Get("Host")
+}
+
+// connectionHeaders：HTTP/2 中不允许出现的连接相关请求头
+// See https://tools.ietf.org/html/rfc7540#section-8.1.2.2
+var connectionHeaders = map[string]bool{
+	"connection":        true,
+	"keep-alive":        true,
+	"proxy-connection":  true,
+	"transfer-encoding": true,
+	"upgrade":           true,
+}
+
+// newRequest：由解码之后的请求头创建请求，请求头不合法时为流错误
+// See https://tools.ietf.org/html/rfc7540#section-8.1.2
+func newRequest(streamID uint32, fields []hpack.HeaderField) (*Request, error) {
+	malformed := StreamError{StreamID: streamID, Code: ErrCodeProtocol}
+	req := &Request{StreamID: streamID, Header: make(nethttp.Header)}
+
+	var path string
+	var regular bool
+	seen := make(map[string]bool, 4)
+	for _, f := range fields {
+		if !validFieldName(f.Name) {
+			return nil, malformed
+		}
+		if !f.IsPseudo() {
+			regular = true
+			if !validRegularField(f) {
+				return nil, malformed
+			}
+			req.Header.Add(f.Name, f.Value)
+			continue
+		}
+
+		// 伪首部必须在普通首部之前，并且每个只能出现一次
+		if regular || seen[f.Name] {
+			return nil, malformed
+		}
+		seen[f.Name] = true
+		switch f.Name {
+		case ":method":
+			req.Method = f.Value
+		case ":scheme":
+			req.Scheme = f.Value
+		case ":authority":
+			req.Authority = f.Value
+		case ":path":
+			path = f.Value
+		default:
+			return nil, malformed
+		}
+	}
+
+	// CONNECT 只能有 :method 与 :authority，其他方法必须有 :method、:scheme 与 :path
+	if req.Method == nethttp.MethodConnect {
+		if req.Authority == "" || req.Scheme != "" || path != "" {
+			return nil, malformed
+		}
+	} else if req.Method == "" || req.Scheme == "" || path == "" {
+		return nil, malformed
+	}
+
+	// 多个 cookie 首部需要合并
+	if cookies := req.Header["Cookie"]; len(cookies) > 1 {
+		req.Header.Set("Cookie", strings.Join(cookies, "; "))
+	}
+	req.Path, req.RawQuery = path, ""
+	if i := strings.IndexByte(path, '?'); i >= 0 {
+		req.Path, req.RawQuery = path[:i], path[i+1:]
+	}
+	return req, nil
+}
+
+// newTrailer：trailer 中不能有伪首部
+func newTrailer(streamID uint32, fields []hpack.HeaderField) (nethttp.Header, error) {
+	trailer := make(nethttp.Header, len(fields))
+	for _, f := range fields {
+		if !validFieldName(f.Name) || f.IsPseudo() || !validRegularField(f) {
+			return nil, StreamError{StreamID: streamID, Code: ErrCodeProtocol}
+		}
+		trailer.Add(f.Name, f.Value)
+	}
+	return trailer, nil
+}
+
+// validFieldName：首部名必须为小写
+func validFieldName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		if c := name[i]; 'A' <= c && c <= 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+// validRegularField：不能有连接相关首部，TE 只能为 trailers
+func validRegularField(f hpack.HeaderField) bool {
+	return !connectionHeaders[f.Name] && (f.Name != "te" || f.Value == "trailers")
+}
+
+// headerListSize：按 SETTINGS_MAX_HEADER_LIST_SIZE 的定义计算请求头大小
+func headerListSize(fields []hpack.HeaderField) uint32 {
+	var n uint32
+	for _, f := range fields {
+		n += f.Size()
+	}
+	return n
+}
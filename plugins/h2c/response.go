@@ -0,0 +1,41 @@
+package h2c
+
+import (
+	nethttp "net/http"
+)
+
+// Response：HTTP/2 响应，Trailer 不为空时在响应体之后发送，例如 gRPC 的 grpc-status
+type Response struct {
+	StatusCode int
+	Header     nethttp.Header
+	Body       []byte
+	Trailer    nethttp.Header
+}
+
+// NewResponse：创建响应
+func NewResponse(statusCode int, body []byte) *Response {
+	return &Response{
+		StatusCode: statusCode,
+		Header:     make(nethttp.Header),
+		Body:       body,
+	}
+}
+
+// Text：创建 text/plain 响应
+func Text(statusCode int, body string) *Response {
+	resp := NewResponse(statusCode, []byte(body))
+	resp.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	return resp
+}
+
+// JSON：创建 application/json 响应，body 需要是已经编码好的 JSON
+func JSON(statusCode int, body []byte) *Response {
+	resp := NewResponse(statusCode, body)
+	resp.Header.Set("Content-Type", "application/json")
+	return resp
+}
+
+// Error：创建错误响应
+func Error(statusCode int) *Response {
+	return Text(statusCode, nethttp.StatusText(statusCode))
+}
@@ -0,0 +1,203 @@
+package h2c
+
+import (
+	nethttp "net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/http2/hpack"
+)
+
+// streamState：流状态，服务端不推送，所以没有 reserved 状态
+// See https://tools.ietf.org/html/rfc7540#section-5.1
+type streamState int
+
+const (
+	streamOpen             streamState = iota // 正在接收请求
+	streamHalfClosedRemote                    // 请求已经完整接收，等待响应
+)
+
+// stream：一个流的状态，关闭之后从 serverConn 中删除
+type stream struct {
+	id         uint32
+	state      streamState
+	req        *Request
+	body       []byte
+	sendWindow int64
+	recvWindow int64
+
+	// 已经开始响应，pending 为等待发送窗口的响应体，之后发送 trailer
+	responded bool
+	pending   []byte
+	trailer   nethttp.Header
+}
+
+// newStream：打开一个新的流
+func (sc *serverConn) newStream(req *Request) *stream {
+	st := &stream{
+		id:         req.StreamID,
+		state:      streamOpen,
+		req:        req,
+		sendWindow: sc.initialWindowSize,
+		recvWindow: int64(sc.opts.InitialWindowSize),
+	}
+	sc.streams[st.id] = st
+	return st
+}
+
+// endStream：请求完整接收，Content-Length 与实际长度不一致时为流错误
+func (sc *serverConn) endStream(st *stream) error {
+	if cl := st.req.Header.Get("Content-Length"); cl != "" {
+		if n, err := strconv.Atoi(cl); err != nil || n != len(st.body) {
+			return StreamError{StreamID: st.id, Code: ErrCodeProtocol}
+		}
+	}
+	st.state = streamHalfClosedRemote
+	st.req.Body = st.body
+	st.body = nil
+	sc.ready = append(sc.ready, st.req)
+	return nil
+}
+
+// reject：直接以错误状态码响应，请求还没有完整接收时以 NO_ERROR 重置流
+func (sc *serverConn) reject(st *stream, statusCode int) {
+	sc.writeHeaders(st.id, sc.encodeHeaders(statusCode, nil, 0), true)
+	if st.state == streamOpen {
+		sc.out = appendUint32Frame(sc.out, FrameRSTStream, st.id, uint32(ErrCodeNo))
+	}
+	sc.closeStream(st)
+}
+
+// respond：发送响应，noBody 为 true 时（HEAD 请求）不发送响应体
+func (sc *serverConn) respond(streamID uint32, resp *Response, noBody bool) {
+	st := sc.streams[streamID]
+	if st == nil || st.responded {
+		// 流已经被对端重置
+		return
+	}
+
+	body := resp.Body
+	contentLength := len(body)
+	if noBody {
+		body = nil
+	}
+	if len(resp.Trailer) > 0 {
+		contentLength = -1
+	}
+	endStream := len(body) == 0 && len(resp.Trailer) == 0
+	sc.writeHeaders(st.id, sc.encodeHeaders(resp.StatusCode, resp.Header, contentLength), endStream)
+	if endStream {
+		sc.closeStream(st)
+		return
+	}
+
+	st.responded = true
+	st.pending = body
+	st.trailer = resp.Trailer
+	sc.flushStream(st)
+}
+
+// flush：发送窗口增大之后，按流 ID 顺序继续发送等待窗口的响应体
+func (sc *serverConn) flush() {
+	ids := make([]uint32, 0, len(sc.streams))
+	for id, st := range sc.streams {
+		if st.responded {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	for _, id := range ids {
+		if sc.sendWindow <= 0 {
+			return
+		}
+		sc.flushStream(sc.streams[id])
+	}
+}
+
+// flushStream：在连接与流的发送窗口内发送响应体，全部发送之后发送 trailer 并关闭流
+func (sc *serverConn) flushStream(st *stream) {
+	for len(st.pending) > 0 {
+		n := int64(len(st.pending))
+		for _, limit := range []int64{int64(sc.maxFrameSize), sc.sendWindow, st.sendWindow} {
+			if limit < n {
+				n = limit
+			}
+		}
+		if n <= 0 {
+			return
+		}
+
+		var flags uint8
+		if int(n) == len(st.pending) && len(st.trailer) == 0 {
+			flags = flagEndStream
+		}
+		sc.out = appendFrame(sc.out, FrameData, flags, st.id, st.pending[:n])
+		st.pending = st.pending[n:]
+		sc.sendWindow -= n
+		st.sendWindow -= n
+	}
+
+	if len(st.trailer) > 0 {
+		sc.writeHeaders(st.id, sc.encodeHeaders(0, st.trailer, -1), true)
+	}
+	sc.closeStream(st)
+}
+
+// closeStream：关闭并删除流
+func (sc *serverConn) closeStream(st *stream) {
+	delete(sc.streams, st.id)
+	sc.closeIfIdle()
+}
+
+// writeHeaders：发送头部块，超过对端 MAX_FRAME_SIZE 时拆分为 CONTINUATION
+func (sc *serverConn) writeHeaders(streamID uint32, block []byte, endStream bool) {
+	t := FrameHeaders
+	var flags uint8
+	if endStream {
+		flags = flagEndStream
+	}
+	for {
+		n := len(block)
+		if n > int(sc.maxFrameSize) {
+			n = int(sc.maxFrameSize)
+		}
+		if n == len(block) {
+			flags |= flagEndHeaders
+		}
+		sc.out = appendFrame(sc.out, t, flags, streamID, block[:n])
+		if block = block[n:]; len(block) == 0 {
+			return
+		}
+		t, flags = FrameContinuation, 0
+	}
+}
+
+// encodeHeaders：HPACK 编码，statusCode 为 0 时为 trailer，contentLength 小于 0 时不写入 content-length
+// HPACK 的动态表是连接级的，编码顺序必须与发送顺序一致
+func (sc *serverConn) encodeHeaders(statusCode int, header nethttp.Header, contentLength int) []byte {
+	sc.encBuf.Reset()
+	if statusCode != 0 {
+		sc.writeField(":status", strconv.Itoa(statusCode))
+	}
+	for k, vs := range header {
+		name := strings.ToLower(k)
+		if connectionHeaders[name] || name == "content-length" {
+			continue
+		}
+		for _, v := range vs {
+			sc.writeField(name, v)
+		}
+	}
+	if contentLength >= 0 {
+		sc.writeField("content-length", strconv.Itoa(contentLength))
+	}
+
+	block := make([]byte, sc.encBuf.Len())
+	copy(block, sc.encBuf.Bytes())
+	return block
+}
+
+func (sc *serverConn) writeField(name, value string) {
+	_ = sc.enc.WriteField(hpack.HeaderField{Name: name, Value: value})
+}
@@ -0,0 +1,57 @@
+package h2c
+
+import (
+	nethttp "net/http"
+
+	"github.com/Dongxiem/fastnet/connection"
+)
+
+// Handler：HTTP/2 请求处理接口
+type Handler interface {
+	Serve(c *connection.Connection, req *Request) *Response
+}
+
+// HandlerFunc：HTTP/2 请求处理方法，在连接所属的 loop 中执行，不能阻塞
+type HandlerFunc func(c *connection.Connection, req *Request) *Response
+
+// Serve：实现 Handler
+func (f HandlerFunc) Serve(c *connection.Connection, req *Request) *Response {
+	return f(c, req)
+}
+
+// HandlerWrap：fastnet Handler 包装
+type HandlerWrap struct {
+	handler Handler
+}
+
+// NewHandlerWrap：创建 h2c Handler 包装
+func NewHandlerWrap(handler Handler) *HandlerWrap {
+	return &HandlerWrap{handler: handler}
+}
+
+// OnConnect wrap
+func (s *HandlerWrap) OnConnect(c *connection.Connection) {}
+
+// OnMessage：data 为 Protocol 产生的帧，ctx 为 *Request 时在其后追加响应
+// 同一次读事件中完整接收的多个流依次处理，响应体受流量控制时等待 WINDOW_UPDATE 之后继续发送
+func (s *HandlerWrap) OnMessage(c *connection.Connection, ctx interface{}, data []byte) []byte {
+	req, ok := ctx.(*Request)
+	if !ok {
+		return data
+	}
+	v, ok := c.Get(connKey)
+	if !ok {
+		return data
+	}
+	sc := v.(*serverConn)
+
+	resp := s.handler.Serve(c, req)
+	if resp == nil {
+		resp = NewResponse(nethttp.StatusOK, nil)
+	}
+	sc.respond(req.StreamID, resp, req.Method == nethttp.MethodHead)
+	return append(data, sc.takeOut()...)
+}
+
+// OnClose wrap
+func (s *HandlerWrap) OnClose(c *connection.Connection) {}
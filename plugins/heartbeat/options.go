@@ -0,0 +1,67 @@
+package heartbeat
+
+import (
+	"time"
+)
+
+// Options：心跳配置
+type Options struct {
+	Interval  time.Duration                           // 连接静默多久之后发送 ping
+	MaxMissed int                                     // 最多允许连续丢失的 pong 个数，超过则关闭连接
+	Ping      []byte                                  // ping 负载，会经过内部协议的 Packet 封装后发送
+	IsPong    func(ctx interface{}, data []byte) bool // 判断拆包结果是否为 pong
+}
+
+// Option ...
+type Option func(*Options)
+
+// newOptions：返回一个新的 Options 配置
+func newOptions(opt ...Option) *Options {
+	opts := Options{}
+
+	for _, o := range opt {
+		o(&opts)
+	}
+	// 默认静默 30s 后发送 ping
+	if opts.Interval <= 0 {
+		opts.Interval = 30 * time.Second
+	}
+	// 默认最多丢失 3 个 pong
+	if opts.MaxMissed <= 0 {
+		opts.MaxMissed = 3
+	}
+	// 默认 ping 负载
+	if opts.Ping == nil {
+		opts.Ping = []byte("ping")
+	}
+
+	return &opts
+}
+
+// Interval：连接静默多久之后发送 ping
+func Interval(d time.Duration) Option {
+	return func(o *Options) {
+		o.Interval = d
+	}
+}
+
+// MaxMissed：最多允许连续丢失的 pong 个数
+func MaxMissed(n int) Option {
+	return func(o *Options) {
+		o.MaxMissed = n
+	}
+}
+
+// Ping：ping 负载
+func Ping(p []byte) Option {
+	return func(o *Options) {
+		o.Ping = p
+	}
+}
+
+// MatchPong：设置 pong 判断方法，优先级高于内部协议实现的 PongMatcher
+func MatchPong(f func(ctx interface{}, data []byte) bool) Option {
+	return func(o *Options) {
+		o.IsPong = f
+	}
+}
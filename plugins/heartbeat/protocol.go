@@ -0,0 +1,62 @@
+package heartbeat
+
+import (
+	"github.com/Dongxiem/fastnet/connection"
+	"github.com/Dongxiem/fastnet/tool/ringbuffer"
+)
+
+var _ connection.Protocol = &Protocol{}
+
+// PongMatcher：内部协议可以实现该接口，用于识别 pong 数据包
+type PongMatcher interface {
+	IsPong(ctx interface{}, data []byte) bool
+}
+
+// Protocol：心跳协议，包装任意 connection.Protocol
+type Protocol struct {
+	inner connection.Protocol
+	opts  *Options
+}
+
+// New：创建心跳 Protocol，inner 为实际使用的协议
+func New(inner connection.Protocol, opts ...Option) *Protocol {
+	if inner == nil {
+		inner = &connection.DefaultProtocol{}
+	}
+	options := newOptions(opts...)
+	// 未配置 pong 判断方法时，尝试使用内部协议的实现
+	if options.IsPong == nil {
+		if m, ok := inner.(PongMatcher); ok {
+			options.IsPong = m.IsPong
+		}
+	}
+	return &Protocol{inner: inner, opts: options}
+}
+
+// UnPacket：拆包，收到任何数据包都视为连接存活，pong 数据包会被直接丢弃
+func (p *Protocol) UnPacket(c *connection.Connection, buffer *ringbuffer.RingBuffer) (ctx interface{}, out []byte) {
+	for {
+		ctx, out = p.inner.UnPacket(c, buffer)
+		if ctx == nil && len(out) == 0 {
+			return
+		}
+
+		if s := getState(c); s != nil {
+			s.alive()
+		}
+		// 不是 pong 则交给用户 OnMessage 处理，否则继续拆下一个包
+		if p.opts.IsPong == nil || !p.opts.IsPong(ctx, out) {
+			return
+		}
+	}
+}
+
+// Packet：装包，直接使用内部协议
+func (p *Protocol) Packet(c *connection.Connection, data []byte) []byte {
+	return p.inner.Packet(c, data)
+}
+
+// Options：返回 options
+func (p *Protocol) Options() Options {
+	return *p.opts
+}
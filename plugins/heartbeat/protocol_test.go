@@ -0,0 +1,140 @@
+package heartbeat
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Dongxiem/fastnet/connection"
+	"github.com/Dongxiem/fastnet/eventloop"
+	"github.com/Dongxiem/fastnet/tool/ringbuffer"
+	"github.com/RussellLuo/timingwheel"
+	"golang.org/x/sys/unix"
+)
+
+// lineProtocol：以 '\n' 分包的测试协议
+type lineProtocol struct{}
+
+func (l *lineProtocol) UnPacket(c *connection.Connection, buffer *ringbuffer.RingBuffer) (interface{}, []byte) {
+	data := buffer.Bytes()
+	for i, b := range data {
+		if b == '\n' {
+			buffer.Retrieve(i + 1)
+			return nil, data[:i]
+		}
+	}
+	return nil, nil
+}
+
+func (l *lineProtocol) Packet(c *connection.Connection, data []byte) []byte {
+	return append(data, '\n')
+}
+
+func (l *lineProtocol) IsPong(ctx interface{}, data []byte) bool {
+	return string(data) == "pong"
+}
+
+func TestProtocol_UnPacket(t *testing.T) {
+	p := New(&lineProtocol{})
+	c := connection.New(-1, nil, nil, p, nil, 0, nil)
+	s := &state{}
+	_ = s.missed.Swap(2)
+	c.Set(stateKey, s)
+
+	buffer := ringbuffer.New(64)
+	_, _ = buffer.WriteString("pong\nhello\npong\npong\n")
+
+	_, out := p.UnPacket(c, buffer)
+	if string(out) != "hello" {
+		t.Fatalf("out should be hello, but %q", out)
+	}
+	if s.missed.Get() != 0 {
+		t.Fatalf("missed should be 0, but %d", s.missed.Get())
+	}
+
+	ctx, out := p.UnPacket(c, buffer)
+	if ctx != nil || len(out) != 0 {
+		t.Fatalf("pong should be dropped, but %q", out)
+	}
+	if buffer.Length() != 0 {
+		t.Fatalf("buffer should be empty, but %d", buffer.Length())
+	}
+}
+
+type closeHandler struct {
+	closed chan struct{}
+}
+
+func (h *closeHandler) OnConnect(c *connection.Connection) {}
+
+func (h *closeHandler) OnMessage(c *connection.Connection, ctx interface{}, data []byte) []byte {
+	return nil
+}
+
+func (h *closeHandler) OnClose(c *connection.Connection) {
+	close(h.closed)
+}
+
+func TestHandlerWrap_Check(t *testing.T) {
+	fds, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_STREAM, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = unix.SetNonblock(fds[0], true)
+	_ = unix.SetsockoptTimeval(fds[1], unix.SOL_SOCKET, unix.SO_RCVTIMEO, &unix.Timeval{Sec: 2})
+	defer unix.Close(fds[1])
+
+	loop, err := eventloop.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	go loop.RunLoop()
+	defer loop.Stop()
+	tw := timingwheel.NewTimingWheel(time.Millisecond, 20)
+	tw.Start()
+	defer tw.Stop()
+
+	const interval = 20 * time.Millisecond
+	p := New(&lineProtocol{}, Interval(interval), MaxMissed(2))
+	h := &closeHandler{closed: make(chan struct{})}
+	wrap := NewHandlerWrap(p, h)
+	c := connection.New(fds[0], loop, nil, p, tw, 0, wrap)
+	if err = loop.AddSocketAndEnableRead(fds[0], c); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	wrap.OnConnect(c)
+
+	// 连接静默 Interval 之后发送 ping，时间轮最多会提前一个 tick 执行
+	buf := make([]byte, 64)
+	n, err := unix.Read(fds[1], buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < interval-time.Millisecond {
+		t.Fatalf("ping sent too early: %v", elapsed)
+	}
+	got := string(buf[:n])
+
+	// 连续 MaxMissed 个 ping 没有回应，之后关闭连接
+	for {
+		n, err = unix.Read(fds[1], buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n == 0 {
+			break
+		}
+		got += string(buf[:n])
+	}
+	if got != "ping\nping\n" {
+		t.Fatalf("got %q", got)
+	}
+	select {
+	case <-h.closed:
+	case <-time.After(time.Second):
+		t.Fatal("connection should be closed")
+	}
+	if getState(c) != nil {
+		t.Fatal("state should be deleted")
+	}
+}
@@ -0,0 +1,101 @@
+package heartbeat
+
+import (
+	"time"
+
+	"github.com/Dongxiem/fastnet/connection"
+	"github.com/Dongxiem/fastnet/log"
+	"github.com/Dongxiem/fastnet/tool/sync/atomic"
+)
+
+const stateKey = "fastnet_heartbeat_state"
+
+// Handler：用户注册接口，与 fastnet.Handler 一致
+type Handler interface {
+	connection.CallBack
+	OnConnect(c *connection.Connection)
+}
+
+// state：每个连接的心跳状态
+type state struct {
+	activeTime atomic.Int64 // 最近一次收到数据包的时间（纳秒）
+	missed     atomic.Int64 // 已发送但尚未收到回应的 ping 个数
+}
+
+// alive：收到数据包，刷新存活状态
+func (s *state) alive() {
+	_ = s.activeTime.Swap(time.Now().UnixNano())
+	_ = s.missed.Swap(0)
+}
+
+// getState：获取连接的心跳状态
+func getState(c *connection.Connection) *state {
+	v, ok := c.Get(stateKey)
+	if !ok {
+		return nil
+	}
+	return v.(*state)
+}
+
+// HandlerWrap：心跳 Handler 包装
+type HandlerWrap struct {
+	handler Handler
+	opts    *Options
+}
+
+// NewHandlerWrap：创建心跳 Handler 包装，p 为同一 Server 使用的心跳 Protocol
+func NewHandlerWrap(p *Protocol, handler Handler) *HandlerWrap {
+	return &HandlerWrap{
+		handler: handler,
+		opts:    p.opts,
+	}
+}
+
+// OnConnect：初始化心跳状态并启动检测定时器
+func (h *HandlerWrap) OnConnect(c *connection.Connection) {
+	s := &state{}
+	s.alive()
+	c.Set(stateKey, s)
+	c.RunAfter(h.opts.Interval, h.check(c, s))
+
+	h.handler.OnConnect(c)
+}
+
+// OnMessage wrap
+func (h *HandlerWrap) OnMessage(c *connection.Connection, ctx interface{}, data []byte) []byte {
+	return h.handler.OnMessage(c, ctx, data)
+}
+
+// OnClose wrap
+func (h *HandlerWrap) OnClose(c *connection.Connection) {
+	c.Delete(stateKey)
+	h.handler.OnClose(c)
+}
+
+// check：心跳检测，连接静默超过 Interval 则发送 ping，连续 MaxMissed 个 ping 没有回应则关闭连接
+func (h *HandlerWrap) check(c *connection.Connection, s *state) func() {
+	return func() {
+		if !c.Connected() {
+			return
+		}
+
+		intervals := time.Since(time.Unix(0, s.activeTime.Get()))
+		// 期间收到过数据包，顺延下一次检测
+		if intervals < h.opts.Interval {
+			c.RunAfter(h.opts.Interval-intervals, h.check(c, s))
+			return
+		}
+
+		if s.missed.Get() >= int64(h.opts.MaxMissed) {
+			log.Info("[heartbeat] close dead connection: ", c.PeerAddr())
+			_ = c.Close()
+			return
+		}
+
+		_ = s.missed.Add(1)
+		if err := c.Send(h.opts.Ping); err != nil {
+			return
+		}
+		c.RunAfter(h.opts.Interval, h.check(c, s))
+	}
+}
@@ -0,0 +1,143 @@
+package http
+
+import (
+	"bytes"
+	"strconv"
+
+	"github.com/Dongxiem/fastnet/tool/ringbuffer"
+)
+
+// chunkedKey：chunked 请求体还没有接收完整时保存解析进度
+const chunkedKey = "fastnet_http_chunked"
+
+// view：buffer 中可读数据的只读视图，直接使用 PeekAll 返回的两段数据，不会拷贝
+type view struct {
+	first, end []byte
+}
+
+func newView(buffer *ringbuffer.RingBuffer) view {
+	first, end := buffer.PeekAll()
+	return view{first: first, end: end}
+}
+
+func (v view) len() int {
+	return len(v.first) + len(v.end)
+}
+
+// indexCRLF：从 from 开始查找 CRLF，返回相对读指针的位置，不存在则返回 -1
+func (v view) indexCRLF(from int) int {
+	if from < len(v.first) {
+		if i := bytes.Index(v.first[from:], crlf); i >= 0 {
+			return from + i
+		}
+		// CRLF 横跨两段
+		last := len(v.first) - 1
+		if last >= from && v.first[last] == '\r' && len(v.end) > 0 && v.end[0] == '\n' {
+			return last
+		}
+		from = len(v.first)
+	}
+	if i := bytes.Index(v.end[from-len(v.first):], crlf); i >= 0 {
+		return from + i
+	}
+	return -1
+}
+
+// copyAt：从 from 开始拷贝 len(dst) 个字节
+func (v view) copyAt(dst []byte, from int) {
+	if from < len(v.first) {
+		n := copy(dst, v.first[from:])
+		copy(dst[n:], v.end)
+		return
+	}
+	copy(dst, v.end[from-len(v.first):])
+}
+
+// chunkedReader：chunked 请求体的增量解析
+// 记录已经解析的位置，每次读事件只处理新到达的数据，请求体在接收完整之后只拷贝一次
+type chunkedReader struct {
+	req        *Request
+	n          int      // 已经解析的位置，相对 buffer 读指针，包括请求头
+	chunks     [][2]int // 每个 chunk 数据的位置与长度
+	bodyLen    int
+	trailer    bool // 最后一个 chunk 已经解析，正在跳过 trailer
+	trailerLen int
+}
+
+// read：继续解析，返回请求与消耗的字节数，数据不完整时返回 errNeedMore
+// chunk 大小所在的行与 trailer 的总长度都不能超过 maxHeaderSize
+func (r *chunkedReader) read(v view, maxHeaderSize, maxBodySize int) (*Request, int, error) {
+	for {
+		i := v.indexCRLF(r.n)
+		if i < 0 {
+			if v.len()-r.n+r.trailerLen > maxHeaderSize {
+				return nil, 0, errHeaderTooLarge
+			}
+			return nil, 0, errNeedMore
+		}
+		lineLen := i - r.n
+
+		if r.trailer {
+			r.trailerLen += lineLen + len(crlf)
+			if r.trailerLen > maxHeaderSize {
+				return nil, 0, errHeaderTooLarge
+			}
+			r.n = i + len(crlf)
+			if lineLen == 0 {
+				return r.finish(v), r.n, nil
+			}
+			continue
+		}
+
+		if lineLen > maxHeaderSize {
+			return nil, 0, errHeaderTooLarge
+		}
+		line := make([]byte, lineLen)
+		v.copyAt(line, r.n)
+		// 忽略 chunk 扩展
+		if j := bytes.IndexByte(line, ';'); j >= 0 {
+			line = line[:j]
+		}
+		size, err := strconv.ParseInt(string(bytes.TrimSpace(line)), 16, 64)
+		if err != nil || size < 0 {
+			return nil, 0, errMalformedRequest
+		}
+		if int64(r.bodyLen)+size > int64(maxBodySize) {
+			return nil, 0, errBodyTooLarge
+		}
+
+		// 最后一个 chunk，之后是 trailer
+		if size == 0 {
+			r.n = i + len(crlf)
+			r.trailer = true
+			continue
+		}
+
+		start := i + len(crlf)
+		if v.len() < start+int(size)+len(crlf) {
+			return nil, 0, errNeedMore
+		}
+		tail := make([]byte, len(crlf))
+		v.copyAt(tail, start+int(size))
+		if !bytes.Equal(tail, crlf) {
+			return nil, 0, errMalformedRequest
+		}
+		r.chunks = append(r.chunks, [2]int{start, int(size)})
+		r.bodyLen += int(size)
+		r.n = start + int(size) + len(crlf)
+	}
+}
+
+// finish：拼接所有 chunk 的数据
+func (r *chunkedReader) finish(v view) *Request {
+	if r.bodyLen > 0 {
+		body := make([]byte, r.bodyLen)
+		off := 0
+		for _, chunk := range r.chunks {
+			v.copyAt(body[off:off+chunk[1]], chunk[0])
+			off += chunk[1]
+		}
+		r.req.Body = body
+	}
+	return r.req
+}
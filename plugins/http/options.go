@@ -0,0 +1,43 @@
+package http
+
+// Options：HTTP 配置
+type Options struct {
+	MaxHeaderSize int // 请求行与请求头的最大字节数
+	MaxBodySize   int // 请求体的最大字节数
+}
+
+// Option ...
+type Option func(*Options)
+
+// newOptions：返回一个新的 Options 配置
+func newOptions(opt ...Option) *Options {
+	opts := Options{}
+
+	for _, o := range opt {
+		o(&opts)
+	}
+	// 默认请求头最大 8K
+	if opts.MaxHeaderSize <= 0 {
+		opts.MaxHeaderSize = 8 * 1024
+	}
+	// 默认请求体最大 4M
+	if opts.MaxBodySize <= 0 {
+		opts.MaxBodySize = 4 * 1024 * 1024
+	}
+
+	return &opts
+}
+
+// MaxHeaderSize：请求行与请求头的最大字节数
+func MaxHeaderSize(n int) Option {
+	return func(o *Options) {
+		o.MaxHeaderSize = n
+	}
+}
+
+// MaxBodySize：请求体的最大字节数
+func MaxBodySize(n int) Option {
+	return func(o *Options) {
+		o.MaxBodySize = n
+	}
+}
@@ -0,0 +1,114 @@
+package http
+
+import (
+	"github.com/Dongxiem/fastnet/connection"
+	"github.com/Dongxiem/fastnet/tool/ringbuffer"
+)
+
+var _ connection.Protocol = &Protocol{}
+
+// closingKey：连接已经准备关闭或者已经转为流式响应，之后收到的数据全部丢弃
+const closingKey = "fastnet_http_closing"
+
+var headerEnd = []byte("\r\n\r\n")
+
+// Protocol：HTTP/1.1 协议
+type Protocol struct {
+	opts *Options
+}
+
+// New：创建 HTTP Protocol
+func New(opts ...Option) *Protocol {
+	return &Protocol{opts: newOptions(opts...)}
+}
+
+// Options：返回 Protocol 的配置
+func (p *Protocol) Options() Options {
+	return *p.opts
+}
+
+// UnPacket：拆包，返回的 ctx 为 *Request，流水线中的多个请求会依次返回
+func (p *Protocol) UnPacket(c *connection.Connection, buffer *ringbuffer.RingBuffer) (ctx interface{}, out []byte) {
+	if _, ok := c.Get(closingKey); ok {
+		buffer.RetrieveAll()
+		return
+	}
+
+	req, n, err := p.parse(c, buffer)
+	if err == errNeedMore {
+		return
+	}
+	c.Delete(chunkedKey)
+	if err != nil {
+		buffer.RetrieveAll()
+		return &Request{err: err, Close: true}, nil
+	}
+
+	buffer.Retrieve(n)
+	return req, nil
+}
+
+// parse：解析一个完整的请求，返回请求与消耗的字节数
+func (p *Protocol) parse(c *connection.Connection, buffer *ringbuffer.RingBuffer) (*Request, int, error) {
+	// chunked 请求体还没有接收完整，请求头已经解析过
+	if v, ok := c.Get(chunkedKey); ok {
+		return p.readChunked(c, buffer, v.(*chunkedReader))
+	}
+
+	i := buffer.Index(headerEnd)
+	if i < 0 {
+		if buffer.Length() > p.opts.MaxHeaderSize {
+			return nil, 0, errHeaderTooLarge
+		}
+		return nil, 0, errNeedMore
+	}
+	if i+len(headerEnd) > p.opts.MaxHeaderSize {
+		return nil, 0, errHeaderTooLarge
+	}
+
+	headLen := i + len(headerEnd)
+	req, err := parseHeader(peek(buffer, i))
+	if err != nil {
+		return nil, 0, err
+	}
+	bodyLen, err := bodyLength(req, p.opts.MaxBodySize)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// chunked 编码
+	if bodyLen < 0 {
+		return p.readChunked(c, buffer, &chunkedReader{req: req, n: headLen})
+	}
+
+	if buffer.Length() < headLen+bodyLen {
+		return nil, 0, errNeedMore
+	}
+	if bodyLen > 0 {
+		req.Body = peek(buffer, headLen+bodyLen)[headLen:]
+	}
+	return req, headLen + bodyLen, nil
+}
+
+// readChunked：增量解析 chunked 请求体，数据不完整时保存解析进度
+func (p *Protocol) readChunked(c *connection.Connection, buffer *ringbuffer.RingBuffer, r *chunkedReader) (*Request, int, error) {
+	req, n, err := r.read(newView(buffer), p.opts.MaxHeaderSize, p.opts.MaxBodySize)
+	if err == errNeedMore {
+		c.Set(chunkedKey, r)
+	}
+	return req, n, err
+}
+
+// Packet：直接返回，响应由 HandlerWrap 完成编码
+func (p *Protocol) Packet(c *connection.Connection, data []byte) []byte {
+	return data
+}
+
+// peek：拷贝 buffer 中前 n 个字节
+func peek(buffer *ringbuffer.RingBuffer, n int) []byte {
+	first, end := buffer.Peek(n)
+	ret := make([]byte, len(first)+len(end))
+	copy(ret, first)
+	copy(ret[len(first):], end)
+	return ret
+}
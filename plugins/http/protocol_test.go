@@ -0,0 +1,186 @@
+package http
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Dongxiem/fastnet/connection"
+	"github.com/Dongxiem/fastnet/tool/ringbuffer"
+)
+
+func TestProtocol_UnPacket(t *testing.T) {
+	p := New()
+	c := connection.New(-1, nil, nil, p, nil, 0, nil)
+
+	buffer := ringbuffer.New(64)
+	_, _ = buffer.WriteString("GET /a?x=1 HTTP/1.1\r\nHost: example.com\r\n\r\n" +
+		"POST /b HTTP/1.1\r\nContent-Length: 5\r\n\r\nhello" +
+		"POST /c HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n3;ext=1\r\nabc\r\n2\r\nde\r\n0\r\nX-Trailer: 1\r\n\r\n" +
+		"GET /d HTTP/1.0\r\n\r\n" +
+		"POST /e HTTP/1.1\r\nContent-Length: 10\r\n\r\npart")
+
+	tests := []struct {
+		method, path, body string
+		close              bool
+	}{
+		{"GET", "/a", "", false},
+		{"POST", "/b", "hello", false},
+		{"POST", "/c", "abcde", false},
+		{"GET", "/d", "", true},
+	}
+	for _, tt := range tests {
+		ctx, _ := p.UnPacket(c, buffer)
+		req, ok := ctx.(*Request)
+		if !ok || req.err != nil {
+			t.Fatalf("%s: parse fail %v", tt.path, req)
+		}
+		if req.Method != tt.method || req.Path != tt.path || string(req.Body) != tt.body || req.Close != tt.close {
+			t.Fatalf("%s: got %+v", tt.path, req)
+		}
+	}
+
+	// 请求体不完整
+	if ctx, _ := p.UnPacket(c, buffer); ctx != nil {
+		t.Fatal("request should not be ready")
+	}
+	_, _ = buffer.WriteString("-more-")
+	ctx, _ := p.UnPacket(c, buffer)
+	if req := ctx.(*Request); string(req.Body) != "part-more-" {
+		t.Fatalf("body should be part-more-, but %q", req.Body)
+	}
+	if buffer.Length() != 0 {
+		t.Fatalf("buffer should be empty, but %d", buffer.Length())
+	}
+}
+
+func TestProtocol_UnPacketError(t *testing.T) {
+	tests := []struct {
+		in     string
+		status int
+	}{
+		{"GET /\r\n\r\n", 400},
+		{"GET / HTTP/2.0\r\n\r\n", 400},
+		{"GET / HTTP/1.1\r\n bad\r\n\r\n", 400},
+		{"POST / HTTP/1.1\r\nContent-Length: -1\r\n\r\n", 400},
+		{"POST / HTTP/1.1\r\nContent-Length: 2048\r\n\r\n", 413},
+		{"POST / HTTP/1.1\r\nTransfer-Encoding: gzip\r\n\r\n", 501},
+		{"POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\nzz\r\n", 400},
+		{"GET / HTTP/1.1\r\nX: " + strings.Repeat("a", 256), 431},
+		{"POST / HTTP/1.1\r\nContent-Length: 1\r\nContent-Length: 2\r\n\r\nab", 400},
+		{"POST / HTTP/1.1\r\nContent-Length: 1, 2\r\n\r\nab", 400},
+		// 字段名与冒号之间的空白以及同时出现的 Transfer-Encoding 与 Content-Length 都可能导致请求走私
+		{"GET / HTTP/1.1\r\nHost : a\r\n\r\n", 400},
+		{"POST / HTTP/1.1\r\nContent-Length\t: 1\r\n\r\na", 400},
+		{"POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\nContent-Length: 1\r\n\r\n0\r\n\r\n", 400},
+		{"POST / HTTP/1.1\r\nContent-Length: 1\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n\r\n", 400},
+		{"POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\nTransfer-Encoding: gzip\r\n\r\n", 501},
+		// chunk 大小所在的行与 trailer 不能无限增长
+		{"POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n" + strings.Repeat("1", 200), 431},
+		{"POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n0\r\nX: " + strings.Repeat("a", 200), 431},
+		{"POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n0\r\nX: 1\r\n" + strings.Repeat("Y: 1\r\n", 30), 431},
+		{"POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n400\r\n" + strings.Repeat("a", 1024) + "\r\n1\r\n", 413},
+	}
+
+	for _, tt := range tests {
+		p := New(MaxHeaderSize(128), MaxBodySize(1024))
+		c := connection.New(-1, nil, nil, p, nil, 0, nil)
+		buffer := ringbuffer.New(64)
+		_, _ = buffer.WriteString(tt.in)
+
+		ctx, _ := p.UnPacket(c, buffer)
+		req, ok := ctx.(*Request)
+		if !ok || req.err == nil {
+			t.Fatalf("%q: should fail", tt.in)
+		}
+		if status := errorStatus(req.err); status != tt.status {
+			t.Fatalf("%q: status should be %d, but %d", tt.in, tt.status, status)
+		}
+	}
+}
+
+func TestProtocol_UnPacketIncremental(t *testing.T) {
+	p := New()
+	c := connection.New(-1, nil, nil, p, nil, 0, nil)
+	buffer := ringbuffer.New(16)
+
+	// chunked 请求体逐字节到达，跨越 ring buffer 的尾部与头部
+	in := "POST /c HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n" +
+		"3\r\nabc\r\n10;x=y\r\n0123456789abcdef\r\n0\r\nX-Trailer: 1\r\n\r\n" +
+		"POST /d HTTP/1.1\r\nContent-Length: 2\r\nContent-Length: 2\r\n\r\nok"
+	var reqs []*Request
+	for i := 0; i < len(in); i++ {
+		_ = buffer.WriteByte(in[i])
+		for {
+			ctx, _ := p.UnPacket(c, buffer)
+			if ctx == nil {
+				break
+			}
+			reqs = append(reqs, ctx.(*Request))
+		}
+	}
+	if len(reqs) != 2 || reqs[0].err != nil || reqs[1].err != nil {
+		t.Fatalf("got %+v", reqs)
+	}
+	if reqs[0].Path != "/c" || string(reqs[0].Body) != "abc0123456789abcdef" {
+		t.Fatalf("got %+v", reqs[0])
+	}
+	if reqs[1].Path != "/d" || string(reqs[1].Body) != "ok" {
+		t.Fatalf("got %+v", reqs[1])
+	}
+	if _, ok := c.Get(chunkedKey); ok || buffer.Length() != 0 {
+		t.Fatal("chunked state should be cleared")
+	}
+}
+
+func TestRouter_Serve(t *testing.T) {
+	r := NewRouter()
+	r.GET("/health", func(c *connection.Connection, req *Request) *Response {
+		return Text(200, "ok")
+	})
+	r.Handle("", "/api/", func(c *connection.Connection, req *Request) *Response {
+		return Text(200, "api")
+	})
+	r.Handle("", "/api/v2/", func(c *connection.Connection, req *Request) *Response {
+		return Text(200, "v2")
+	})
+
+	tests := []struct {
+		method, path string
+		status       int
+		body         string
+	}{
+		{"GET", "/health", 200, "ok"},
+		{"HEAD", "/health", 200, "ok"},
+		{"POST", "/health", 405, "Method Not Allowed"},
+		{"GET", "/api/x", 200, "api"},
+		{"DELETE", "/api/v2/x", 200, "v2"},
+		{"GET", "/nope", 404, "Not Found"},
+	}
+	for _, tt := range tests {
+		resp := r.Serve(nil, &Request{Method: tt.method, Path: tt.path})
+		if resp.StatusCode != tt.status || string(resp.Body) != tt.body {
+			t.Fatalf("%s %s: got %d %q", tt.method, tt.path, resp.StatusCode, resp.Body)
+		}
+	}
+
+	resp := Text(200, "ok").encode(true, true)
+	want := "HTTP/1.1 200 OK\r\nContent-Type: text/plain; charset=utf-8\r\nContent-Length: 2\r\nConnection: close\r\n\r\n"
+	if string(resp) != want {
+		t.Fatalf("got %q", resp)
+	}
+}
+
+func TestEvent_Encode(t *testing.T) {
+	e := &Event{ID: "7", Event: "update\n", Data: []byte("a\r\nb"), Retry: 3 * time.Second}
+	want := "id: 7\nevent: update\nretry: 3000\ndata: a\ndata: b\n\n"
+	if got := string(e.encode()); got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+
+	resp := NewResponse(200, nil)
+	resp.stream = true
+	if got := string(resp.encode(false, false)); strings.Contains(got, "Content-Length") {
+		t.Fatalf("stream response should not have Content-Length, got %q", got)
+	}
+}
@@ -0,0 +1,137 @@
+package http
+
+import (
+	"bytes"
+	"errors"
+	nethttp "net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/http/httpguts"
+)
+
+var (
+	errMalformedRequest = errors.New("http: malformed request")
+	errUnsupportedTE    = errors.New("http: unsupported transfer encoding")
+	errHeaderTooLarge   = errors.New("http: request header too large")
+	errBodyTooLarge     = errors.New("http: request body too large")
+	errNeedMore         = errors.New("http: need more data")
+)
+
+var crlf = []byte("\r\n")
+
+// Request：HTTP 请求
+type Request struct {
+	Method     string
+	URI        string // 原始请求 URI
+	Path       string
+	RawQuery   string
+	Proto      string // "HTTP/1.1"
+	ProtoMajor int
+	ProtoMinor int
+	Header     nethttp.Header
+	Body       []byte
+
+	// Close：响应之后是否关闭连接
+	Close bool
+
+	// err：解析错误，HandlerWrap 会直接返回错误响应并关闭连接
+	err error
+}
+
+// Query：解析 URL 查询参数
+func (r *Request) Query() url.Values {
+	v, _ := url.ParseQuery(r.RawQuery)
+	return v
+}
+
+// Host：返回 Host 请求头
+func (r *Request) Host() string {
+	return r.Header.Get("Host")
+}
+
+// parseHeader：解析请求行与请求头，head 不包含最后的空行
+func parseHeader(head []byte) (*Request, error) {
+	lines := bytes.Split(head, crlf)
+
+	// 请求行：Method SP Request-URI SP HTTP-Version
+	parts := bytes.Split(lines[0], []byte{' '})
+	if len(parts) != 3 || len(parts[0]) == 0 || len(parts[1]) == 0 {
+		return nil, errMalformedRequest
+	}
+	req := &Request{
+		Method: string(parts[0]),
+		URI:    string(parts[1]),
+		Proto:  string(parts[2]),
+		Header: make(nethttp.Header),
+	}
+	var ok bool
+	if req.ProtoMajor, req.ProtoMinor, ok = nethttp.ParseHTTPVersion(req.Proto); !ok || req.ProtoMajor != 1 {
+		return nil, errMalformedRequest
+	}
+
+	u, err := url.ParseRequestURI(req.URI)
+	if err != nil {
+		return nil, errMalformedRequest
+	}
+	req.Path = u.Path
+	req.RawQuery = u.RawQuery
+
+	for _, line := range lines[1:] {
+		i := bytes.IndexByte(line, ':')
+		// 不支持 obs-fold，字段名与冒号之间不能有空白（RFC 7230 3.2.4）
+		if i <= 0 || !httpguts.ValidHeaderFieldName(string(line[:i])) {
+			return nil, errMalformedRequest
+		}
+		key := string(line[:i])
+		value := string(bytes.TrimSpace(line[i+1:]))
+		req.Header.Add(key, value)
+	}
+
+	// HTTP/1.1 默认 keep-alive，HTTP/1.0 默认短连接
+	conn := strings.ToLower(req.Header.Get("Connection"))
+	if req.ProtoMinor == 0 {
+		req.Close = !strings.Contains(conn, "keep-alive")
+	} else {
+		req.Close = strings.Contains(conn, "close")
+	}
+	return req, nil
+}
+
+// bodyLength：根据请求头得到请求体长度，chunked 编码时返回 -1
+func bodyLength(req *Request, maxBodySize int) (int, error) {
+	if te := req.Header.Values("Transfer-Encoding"); len(te) > 0 {
+		if len(te) != 1 || !strings.EqualFold(strings.TrimSpace(te[0]), "chunked") {
+			return 0, errUnsupportedTE
+		}
+		// 同时带有 Content-Length 时无法确定请求体的边界（RFC 7230 3.3.3），拒绝以免请求走私
+		if len(req.Header.Values("Content-Length")) > 0 {
+			return 0, errMalformedRequest
+		}
+		return -1, nil
+	}
+
+	// 重复的 Content-Length 必须完全相同
+	var cl string
+	for _, v := range req.Header.Values("Content-Length") {
+		for _, s := range strings.Split(v, ",") {
+			s = strings.TrimSpace(s)
+			if cl != "" && s != cl {
+				return 0, errMalformedRequest
+			}
+			cl = s
+		}
+	}
+	if cl == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(cl)
+	if err != nil || n < 0 {
+		return 0, errMalformedRequest
+	}
+	if n > maxBodySize {
+		return 0, errBodyTooLarge
+	}
+	return n, nil
+}
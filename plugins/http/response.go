@@ -0,0 +1,83 @@
+package http
+
+import (
+	"bytes"
+	nethttp "net/http"
+	"strconv"
+)
+
+// Response：HTTP 响应
+type Response struct {
+	StatusCode int
+	Header     nethttp.Header
+	Body       []byte
+
+	// stream：流式响应，不写入 Content-Length，响应头之后的数据由用户通过 Connection 发送
+	stream bool
+}
+
+// NewResponse：创建响应
+func NewResponse(statusCode int, body []byte) *Response {
+	return &Response{
+		StatusCode: statusCode,
+		Header:     make(nethttp.Header),
+		Body:       body,
+	}
+}
+
+// Text：创建 text/plain 响应
+func Text(statusCode int, body string) *Response {
+	resp := NewResponse(statusCode, []byte(body))
+	resp.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	return resp
+}
+
+// JSON：创建 application/json 响应，body 需要是已经编码好的 JSON
+func JSON(statusCode int, body []byte) *Response {
+	resp := NewResponse(statusCode, body)
+	resp.Header.Set("Content-Type", "application/json")
+	return resp
+}
+
+// Error：创建错误响应
+func Error(statusCode int) *Response {
+	return Text(statusCode, nethttp.StatusText(statusCode))
+}
+
+// encode：序列化响应，noBody 为 true 时（HEAD 请求）不写入响应体
+func (r *Response) encode(close, noBody bool) []byte {
+	var buf bytes.Buffer
+	buf.Grow(128 + len(r.Body))
+
+	buf.WriteString("HTTP/1.1 ")
+	buf.WriteString(strconv.Itoa(r.StatusCode))
+	buf.WriteByte(' ')
+	buf.WriteString(nethttp.StatusText(r.StatusCode))
+	buf.Write(crlf)
+
+	for k, vs := range r.Header {
+		if k == "Content-Length" || k == "Connection" {
+			continue
+		}
+		for _, v := range vs {
+			buf.WriteString(k)
+			buf.WriteString(": ")
+			buf.WriteString(v)
+			buf.Write(crlf)
+		}
+	}
+	if !r.stream {
+		buf.WriteString("Content-Length: ")
+		buf.WriteString(strconv.Itoa(len(r.Body)))
+		buf.Write(crlf)
+	}
+	if close {
+		buf.WriteString("Connection: close\r\n")
+	}
+	buf.Write(crlf)
+
+	if !noBody {
+		buf.Write(r.Body)
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,89 @@
+package http
+
+import (
+	nethttp "net/http"
+	"strings"
+	"sync"
+
+	"github.com/Dongxiem/fastnet/connection"
+)
+
+// HandlerFunc：HTTP 请求处理方法，在连接所属的 loop 中执行，不能阻塞
+type HandlerFunc func(c *connection.Connection, req *Request) *Response
+
+// route：路由，method 为空时匹配所有方法
+type route struct {
+	method  string
+	handler HandlerFunc
+}
+
+// Router：简单路由，以 "/" 结尾的路径按前缀匹配，其他路径精确匹配
+type Router struct {
+	mu       sync.RWMutex
+	exact    map[string][]route
+	prefix   map[string][]route
+	NotFound HandlerFunc
+}
+
+// NewRouter：创建路由
+func NewRouter() *Router {
+	return &Router{
+		exact:  make(map[string][]route),
+		prefix: make(map[string][]route),
+		NotFound: func(c *connection.Connection, req *Request) *Response {
+			return Error(nethttp.StatusNotFound)
+		},
+	}
+}
+
+// Handle：注册路由，method 为空时匹配所有方法
+func (r *Router) Handle(method, path string, h HandlerFunc) {
+	r.mu.Lock()
+	if strings.HasSuffix(path, "/") {
+		r.prefix[path] = append(r.prefix[path], route{method: method, handler: h})
+	} else {
+		r.exact[path] = append(r.exact[path], route{method: method, handler: h})
+	}
+	r.mu.Unlock()
+}
+
+// GET：注册 GET 路由，同时匹配 HEAD
+func (r *Router) GET(path string, h HandlerFunc) {
+	r.Handle(nethttp.MethodGet, path, h)
+}
+
+// POST：注册 POST 路由
+func (r *Router) POST(path string, h HandlerFunc) {
+	r.Handle(nethttp.MethodPost, path, h)
+}
+
+// Serve：根据请求路径与方法分发请求
+func (r *Router) Serve(c *connection.Connection, req *Request) *Response {
+	r.mu.RLock()
+	routes, ok := r.exact[req.Path]
+	if !ok {
+		// 最长前缀匹配
+		longest := ""
+		for p, rs := range r.prefix {
+			if strings.HasPrefix(req.Path, p) && len(p) > len(longest) {
+				longest = p
+				routes = rs
+			}
+		}
+	}
+	r.mu.RUnlock()
+
+	if len(routes) == 0 {
+		return r.NotFound(c, req)
+	}
+	method := req.Method
+	if method == nethttp.MethodHead {
+		method = nethttp.MethodGet
+	}
+	for _, rt := range routes {
+		if rt.method == "" || rt.method == method {
+			return rt.handler(c, req)
+		}
+	}
+	return Error(nethttp.StatusMethodNotAllowed)
+}
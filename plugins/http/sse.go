@@ -0,0 +1,118 @@
+package http
+
+import (
+	"bytes"
+	nethttp "net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Dongxiem/fastnet/connection"
+)
+
+var keepAliveComment = []byte(": keepalive\n\n")
+
+// Event：Server-Sent Events 事件
+type Event struct {
+	ID    string        // 事件 ID，客户端重连时通过 Last-Event-ID 请求头带回
+	Event string        // 事件类型，为空时客户端按 message 处理
+	Data  []byte        // 事件数据，多行数据会拆分为多个 data 字段
+	Retry time.Duration // 客户端重连间隔，为 0 时不发送
+}
+
+// encode：编码事件
+func (e *Event) encode() []byte {
+	var buf bytes.Buffer
+	buf.Grow(len(e.Data) + 32)
+
+	if e.ID != "" {
+		buf.WriteString("id: ")
+		buf.WriteString(sanitize(e.ID))
+		buf.WriteByte('\n')
+	}
+	if e.Event != "" {
+		buf.WriteString("event: ")
+		buf.WriteString(sanitize(e.Event))
+		buf.WriteByte('\n')
+	}
+	if e.Retry > 0 {
+		buf.WriteString("retry: ")
+		buf.WriteString(strconv.FormatInt(int64(e.Retry/time.Millisecond), 10))
+		buf.WriteByte('\n')
+	}
+	for _, line := range bytes.Split(e.Data, []byte{'\n'}) {
+		buf.WriteString("data: ")
+		buf.Write(bytes.TrimSuffix(line, []byte{'\r'}))
+		buf.WriteByte('\n')
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes()
+}
+
+// sanitize：去掉字段中的换行符
+func sanitize(s string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(s)
+}
+
+// Stream：SSE 事件流
+type Stream struct {
+	conn        *connection.Connection
+	lastEventID string
+}
+
+// Conn：返回事件流对应的连接
+func (s *Stream) Conn() *connection.Connection {
+	return s.conn
+}
+
+// LastEventID：客户端重连时带回的最后一个事件 ID
+func (s *Stream) LastEventID() string {
+	return s.lastEventID
+}
+
+// Send：发送事件，可以在任意协程中调用
+func (s *Stream) Send(e *Event) error {
+	return s.conn.Send(e.encode())
+}
+
+// Close：关闭事件流
+func (s *Stream) Close() error {
+	return s.conn.Close()
+}
+
+// SSE：返回处理 SSE 请求的 HandlerFunc
+// onOpen 在响应头发送之前调用，此时通过 Stream 发送的事件会在响应头之后按顺序发送
+// keepAlive 大于 0 时，定时发送注释行保持连接
+func SSE(keepAlive time.Duration, onOpen func(s *Stream)) HandlerFunc {
+	return func(c *connection.Connection, req *Request) *Response {
+		if req.Method != nethttp.MethodGet {
+			return Error(nethttp.StatusMethodNotAllowed)
+		}
+
+		resp := NewResponse(nethttp.StatusOK, nil)
+		resp.Header.Set("Content-Type", "text/event-stream")
+		resp.Header.Set("Cache-Control", "no-cache")
+		resp.stream = true
+
+		s := &Stream{
+			conn:        c,
+			lastEventID: req.Header.Get("Last-Event-ID"),
+		}
+		onOpen(s)
+
+		if keepAlive > 0 {
+			c.RunAfter(keepAlive, s.keepAlive(keepAlive))
+		}
+		return resp
+	}
+}
+
+// keepAlive：定时发送注释行，连接关闭后停止
+func (s *Stream) keepAlive(d time.Duration) func() {
+	return func() {
+		if err := s.conn.Send(keepAliveComment); err != nil {
+			return
+		}
+		s.conn.RunAfter(d, s.keepAlive(d))
+	}
+}
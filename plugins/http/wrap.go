@@ -0,0 +1,75 @@
+package http
+
+import (
+	nethttp "net/http"
+
+	"github.com/Dongxiem/fastnet/connection"
+	"github.com/Dongxiem/fastnet/log"
+)
+
+// Handler：HTTP 请求处理接口，Router 实现了该接口
+type Handler interface {
+	Serve(c *connection.Connection, req *Request) *Response
+}
+
+// HandlerWrap：fastnet Handler 包装
+type HandlerWrap struct {
+	handler Handler
+}
+
+// NewHandlerWrap：创建 HTTP Handler 包装
+func NewHandlerWrap(handler Handler) *HandlerWrap {
+	return &HandlerWrap{handler: handler}
+}
+
+// OnConnect wrap
+func (s *HandlerWrap) OnConnect(c *connection.Connection) {}
+
+// OnMessage：处理一个请求并返回编码后的响应
+// 流水线中的请求在同一次读事件中依次处理，响应按请求顺序写入
+func (s *HandlerWrap) OnMessage(c *connection.Connection, ctx interface{}, data []byte) []byte {
+	req, ok := ctx.(*Request)
+	if !ok {
+		return nil
+	}
+
+	var resp *Response
+	if req.err != nil {
+		log.Error("[http]", c.PeerAddr(), req.err)
+		resp = Error(errorStatus(req.err))
+	} else {
+		resp = s.handler.Serve(c, req)
+		if resp == nil {
+			resp = NewResponse(nethttp.StatusOK, nil)
+		}
+	}
+
+	if resp.stream {
+		// 流式响应由用户关闭连接，之后收到的数据全部丢弃
+		c.Set(closingKey, true)
+		return resp.encode(false, false)
+	}
+	if req.Close {
+		// 之后收到的数据全部丢弃，响应发送完之后关闭连接
+		c.Set(closingKey, true)
+		_ = c.CloseAfterFlush()
+	}
+	return resp.encode(req.Close, req.Method == nethttp.MethodHead)
+}
+
+// OnClose wrap
+func (s *HandlerWrap) OnClose(c *connection.Connection) {}
+
+// errorStatus：根据解析错误得到响应状态码
+func errorStatus(err error) int {
+	switch err {
+	case errHeaderTooLarge:
+		return nethttp.StatusRequestHeaderFieldsTooLarge
+	case errBodyTooLarge:
+		return nethttp.StatusRequestEntityTooLarge
+	case errUnsupportedTE:
+		return nethttp.StatusNotImplemented
+	default:
+		return nethttp.StatusBadRequest
+	}
+}
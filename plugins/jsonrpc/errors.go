@@ -0,0 +1,38 @@
+package jsonrpc
+
+import "strconv"
+
+// JSON-RPC 2.0 预定义的错误码
+// See https://www.jsonrpc.org/specification#error_object
+const (
+	CodeParseError     = -32700 // 无法解析的 JSON
+	CodeInvalidRequest = -32600 // 不是合法的请求对象
+	CodeMethodNotFound = -32601 // 方法不存在
+	CodeInvalidParams  = -32602 // 参数错误
+	CodeInternalError  = -32603 // 内部错误
+	CodeServerError    = -32000 // 方法返回的普通 error
+)
+
+// Error：JSON-RPC 错误对象，方法返回 *Error 时原样应答，返回其他 error 时使用 CodeServerError
+type Error struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+// NewError：创建错误对象
+func NewError(code int, message string) *Error {
+	return &Error{Code: code, Message: message}
+}
+
+func (e *Error) Error() string {
+	return "jsonrpc: " + strconv.Itoa(e.Code) + " " + e.Message
+}
+
+var (
+	errParse          = NewError(CodeParseError, "Parse error")
+	errInvalidRequest = NewError(CodeInvalidRequest, "Invalid Request")
+	errMethodNotFound = NewError(CodeMethodNotFound, "Method not found")
+	errInvalidParams  = NewError(CodeInvalidParams, "Invalid params")
+	errInternal       = NewError(CodeInternalError, "Internal error")
+)
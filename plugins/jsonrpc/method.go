@@ -0,0 +1,130 @@
+package jsonrpc
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+
+	"github.com/Dongxiem/fastnet/connection"
+	"github.com/Dongxiem/fastnet/log"
+)
+
+var (
+	typeOfConn  = reflect.TypeOf((*connection.Connection)(nil))
+	typeOfError = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// ErrInvalidMethod：注册的方法签名不合法
+var ErrInvalidMethod = errors.New("jsonrpc: method must be func([*connection.Connection], args...) ([result], [error])")
+
+// method：通过反射调用的方法
+type method struct {
+	fn       reflect.Value
+	withConn bool           // 第一个参数为 *connection.Connection
+	args     []reflect.Type // 由 params 解码的参数
+	result   bool           // 有返回结果
+	err      bool           // 最后一个返回值为 error
+}
+
+// newMethod：检查方法签名
+func newMethod(fn interface{}) (*method, error) {
+	v := reflect.ValueOf(fn)
+	t := v.Type()
+	if t.Kind() != reflect.Func || t.IsVariadic() || t.NumOut() > 2 {
+		return nil, ErrInvalidMethod
+	}
+
+	m := &method{fn: v}
+	for i := 0; i < t.NumIn(); i++ {
+		if i == 0 && t.In(i) == typeOfConn {
+			m.withConn = true
+			continue
+		}
+		m.args = append(m.args, t.In(i))
+	}
+
+	switch t.NumOut() {
+	case 2:
+		if t.Out(1) != typeOfError {
+			return nil, ErrInvalidMethod
+		}
+		m.result, m.err = true, true
+	case 1:
+		m.err = t.Out(0) == typeOfError
+		m.result = !m.err
+	}
+	return m, nil
+}
+
+// decodeArgs：params 为数组时按位置解码，只有一个参数时也可以直接解码整个 params，
+// params 为对象时只能有一个参数，缺少的参数为零值
+func (m *method) decodeArgs(params json.RawMessage) ([]reflect.Value, error) {
+	args := make([]reflect.Value, len(m.args))
+	for i, t := range m.args {
+		args[i] = reflect.New(t)
+	}
+
+	switch {
+	case len(params) == 0:
+	case len(m.args) == 1 && (params[0] == '{' || isList(m.args[0])):
+		if err := json.Unmarshal(params, args[0].Interface()); err != nil {
+			return nil, err
+		}
+	case params[0] == '[':
+		var list []json.RawMessage
+		if err := json.Unmarshal(params, &list); err != nil {
+			return nil, err
+		}
+		if len(list) > len(args) {
+			return nil, errInvalidParams
+		}
+		for i, raw := range list {
+			if err := json.Unmarshal(raw, args[i].Interface()); err != nil {
+				return nil, err
+			}
+		}
+	default:
+		return nil, errInvalidParams
+	}
+
+	for i := range args {
+		args[i] = args[i].Elem()
+	}
+	return args, nil
+}
+
+// call：调用方法，方法 panic 时返回内部错误
+func (m *method) call(c *connection.Connection, args []reflect.Value) (result interface{}, rpcErr *Error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Error("[jsonrpc] method panic:", r)
+			result, rpcErr = nil, errInternal
+		}
+	}()
+
+	if m.withConn {
+		args = append([]reflect.Value{reflect.ValueOf(c)}, args...)
+	}
+	out := m.fn.Call(args)
+
+	if m.err {
+		if err, _ := out[len(out)-1].Interface().(error); err != nil {
+			if e, ok := err.(*Error); ok {
+				return nil, e
+			}
+			return nil, NewError(CodeServerError, err.Error())
+		}
+	}
+	if m.result {
+		return out[0].Interface(), nil
+	}
+	return nil, nil
+}
+
+// isList：参数为 slice 或 array 时，数组形式的 params 整体解码
+func isList(t reflect.Type) bool {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Slice || t.Kind() == reflect.Array
+}
@@ -0,0 +1,30 @@
+package jsonrpc
+
+// Options：JSON-RPC 配置
+type Options struct {
+	MaxBatchSize int // 批量请求最多包含的请求个数，超过则应答 Invalid Request
+}
+
+// Option ...
+type Option func(*Options)
+
+// newOptions：返回一个新的 Options 配置
+func newOptions(opt ...Option) *Options {
+	opts := Options{}
+
+	for _, o := range opt {
+		o(&opts)
+	}
+	if opts.MaxBatchSize <= 0 {
+		opts.MaxBatchSize = 128
+	}
+
+	return &opts
+}
+
+// MaxBatchSize：批量请求最多包含的请求个数
+func MaxBatchSize(n int) Option {
+	return func(o *Options) {
+		o.MaxBatchSize = n
+	}
+}
@@ -0,0 +1,176 @@
+package jsonrpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"sync"
+
+	"github.com/Dongxiem/fastnet/connection"
+	"github.com/Dongxiem/fastnet/log"
+)
+
+const version = "2.0"
+
+var null = json.RawMessage("null")
+
+// response：应答对象，成功时 Result 至少为 null，失败时不包含 Result
+type response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+	ID      json.RawMessage `json:"id"`
+}
+
+// Server：JSON-RPC 2.0 服务端，支持批量请求与通知
+// 实现了 fastnet Handler，可以配合 delimiter 或 lengthfield Protocol 使用；
+// 在 WebSocket 的 OnMessage 中可以直接返回 ServeMessage 的结果
+type Server struct {
+	mu      sync.RWMutex
+	methods map[string]*method
+	opts    *Options
+}
+
+// NewServer：创建 JSON-RPC 服务端
+func NewServer(opts ...Option) *Server {
+	return &Server{
+		methods: make(map[string]*method),
+		opts:    newOptions(opts...),
+	}
+}
+
+// Register：按名称注册方法，fn 的签名为 func([*connection.Connection], args...) ([result], [error])
+// 方法在连接所属的 loop 中执行，不能阻塞，参数由 params 通过 encoding/json 解码
+func (s *Server) Register(name string, fn interface{}) error {
+	m, err := newMethod(fn)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.methods[name] = m
+	s.mu.Unlock()
+	return nil
+}
+
+// OnConnect wrap
+func (s *Server) OnConnect(c *connection.Connection) {}
+
+// OnMessage：data 为一个完整的请求或者批量请求
+func (s *Server) OnMessage(c *connection.Connection, ctx interface{}, data []byte) []byte {
+	return s.ServeMessage(c, data)
+}
+
+// OnClose wrap
+func (s *Server) OnClose(c *connection.Connection) {}
+
+// ServeMessage：处理一个请求或者批量请求，返回编码后的应答，全部为通知时返回 nil
+func (s *Server) ServeMessage(c *connection.Connection, data []byte) []byte {
+	data = bytes.TrimSpace(data)
+	if !json.Valid(data) {
+		return s.encode(&response{JSONRPC: version, Error: errParse, ID: null})
+	}
+	if data[0] != '[' {
+		if resp := s.handle(c, data); resp != nil {
+			return s.encode(resp)
+		}
+		return nil
+	}
+
+	var batch []json.RawMessage
+	_ = json.Unmarshal(data, &batch)
+	if len(batch) == 0 || len(batch) > s.opts.MaxBatchSize {
+		return s.encode(&response{JSONRPC: version, Error: errInvalidRequest, ID: null})
+	}
+	resps := make([]*response, 0, len(batch))
+	for _, raw := range batch {
+		if resp := s.handle(c, raw); resp != nil {
+			resps = append(resps, resp)
+		}
+	}
+	if len(resps) == 0 {
+		return nil
+	}
+	return s.encode(resps)
+}
+
+// handle：处理一个请求，通知返回 nil
+func (s *Server) handle(c *connection.Connection, raw json.RawMessage) *response {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &fields); err != nil || fields == nil {
+		return &response{JSONRPC: version, Error: errInvalidRequest, ID: null}
+	}
+
+	id, hasID := fields["id"]
+	if hasID && !validID(id) {
+		return &response{JSONRPC: version, Error: errInvalidRequest, ID: null}
+	}
+	if !hasID {
+		id = nil
+	}
+	resp := &response{JSONRPC: version, ID: id}
+
+	var ver, name string
+	params := fields["params"]
+	if bytes.Equal(params, null) {
+		params = nil
+	}
+	if json.Unmarshal(fields["jsonrpc"], &ver) != nil || ver != version ||
+		json.Unmarshal(fields["method"], &name) != nil ||
+		len(params) > 0 && params[0] != '[' && params[0] != '{' {
+		// 不合法的请求对象不是通知，总是需要应答
+		if !hasID {
+			resp.ID = null
+		}
+		resp.Error = errInvalidRequest
+		return resp
+	}
+
+	s.mu.RLock()
+	m, ok := s.methods[name]
+	s.mu.RUnlock()
+	if !ok {
+		resp.Error = errMethodNotFound
+		return s.reply(resp, hasID)
+	}
+	args, err := m.decodeArgs(params)
+	if err != nil {
+		resp.Error = &Error{Code: CodeInvalidParams, Message: errInvalidParams.Message, Data: err.Error()}
+		return s.reply(resp, hasID)
+	}
+
+	result, rpcErr := m.call(c, args)
+	if rpcErr != nil {
+		resp.Error = rpcErr
+		return s.reply(resp, hasID)
+	}
+	if resp.Result, err = json.Marshal(result); err != nil {
+		log.Error("[jsonrpc] marshal result:", name, err)
+		resp.Result, resp.Error = nil, errInternal
+	}
+	return s.reply(resp, hasID)
+}
+
+// reply：通知不需要应答，即使出错
+func (s *Server) reply(resp *response, hasID bool) *response {
+	if !hasID {
+		return nil
+	}
+	return resp
+}
+
+func (s *Server) encode(v interface{}) []byte {
+	out, err := json.Marshal(v)
+	if err != nil {
+		log.Error("[jsonrpc] marshal response:", err)
+		return nil
+	}
+	return out
+}
+
+// validID：id 只能是字符串、数字或者 null
+func validID(id json.RawMessage) bool {
+	switch id[0] {
+	case '"', '-', '0', '1', '2', '3', '4', '5', '6', '7', '8', '9':
+		return true
+	}
+	return bytes.Equal(id, null)
+}
@@ -0,0 +1,221 @@
+package jsonrpc
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Dongxiem/fastnet/connection"
+	"github.com/Dongxiem/fastnet/plugins/delimiter"
+	"github.com/Dongxiem/fastnet/plugins/lengthfield"
+	"github.com/Dongxiem/fastnet/tool/ringbuffer"
+)
+
+type subtractArgs struct {
+	Minuend    int `json:"minuend"`
+	Subtrahend int `json:"subtrahend"`
+}
+
+func newServer(t *testing.T) *Server {
+	s := NewServer(MaxBatchSize(8))
+	methods := map[string]interface{}{
+		"subtract": func(a, b int) int { return a - b },
+		"subtract_named": func(args subtractArgs) int {
+			return args.Minuend - args.Subtrahend
+		},
+		"sum": func(nums []int) (sum int) {
+			for _, n := range nums {
+				sum += n
+			}
+			return
+		},
+		"update":     func(a, b, c, d, e int) {},
+		"notify_sum": func(a, b, c int) {},
+		"get_data":   func() []interface{} { return []interface{}{"hello", 5} },
+		"fail":       func() error { return errors.New("boom") },
+		"forbidden":  func() (int, error) { return 0, &Error{Code: 1, Message: "forbidden"} },
+		"panic":      func() { panic("oops") },
+		"peer":       func(c *connection.Connection) bool { return c == nil },
+	}
+	for name, fn := range methods {
+		if err := s.Register(name, fn); err != nil {
+			t.Fatal(name, err)
+		}
+	}
+	if err := s.Register("bad", func() (int, int) { return 0, 0 }); err != ErrInvalidMethod {
+		t.Fatalf("got %v", err)
+	}
+	return s
+}
+
+// 用例来自 https://www.jsonrpc.org/specification#examples
+func TestServer_ServeMessage(t *testing.T) {
+	s := newServer(t)
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{
+			name: "positional",
+			in:   `{"jsonrpc": "2.0", "method": "subtract", "params": [42, 23], "id": 1}`,
+			want: `{"jsonrpc":"2.0","result":19,"id":1}`,
+		},
+		{
+			name: "named",
+			in:   `{"jsonrpc": "2.0", "method": "subtract_named", "params": {"subtrahend": 23, "minuend": 42}, "id": "a"}`,
+			want: `{"jsonrpc":"2.0","result":19,"id":"a"}`,
+		},
+		{
+			name: "list",
+			in:   `{"jsonrpc": "2.0", "method": "sum", "params": [1, 2, 4], "id": null}`,
+			want: `{"jsonrpc":"2.0","result":7,"id":null}`,
+		},
+		{
+			name: "no result",
+			in:   `{"jsonrpc": "2.0", "method": "update", "id": 2}`,
+			want: `{"jsonrpc":"2.0","result":null,"id":2}`,
+		},
+		{
+			name: "connection",
+			in:   `{"jsonrpc": "2.0", "method": "peer", "id": 3}`,
+			want: `{"jsonrpc":"2.0","result":true,"id":3}`,
+		},
+		{
+			name: "notification",
+			in:   `{"jsonrpc": "2.0", "method": "update", "params": [1,2,3,4,5]}`,
+		},
+		{
+			name: "notification error",
+			in:   `{"jsonrpc": "2.0", "method": "foobar"}`,
+		},
+		{
+			name: "method not found",
+			in:   `{"jsonrpc": "2.0", "method": "foobar", "id": "1"}`,
+			want: `{"jsonrpc":"2.0","error":{"code":-32601,"message":"Method not found"},"id":"1"}`,
+		},
+		{
+			name: "invalid params",
+			in:   `{"jsonrpc": "2.0", "method": "subtract", "params": [1, 2, 3], "id": 4}`,
+			want: `{"jsonrpc":"2.0","error":{"code":-32602,"message":"Invalid params","data":"jsonrpc: -32602 Invalid params"},"id":4}`,
+		},
+		{
+			name: "error",
+			in:   `{"jsonrpc": "2.0", "method": "fail", "id": 5}`,
+			want: `{"jsonrpc":"2.0","error":{"code":-32000,"message":"boom"},"id":5}`,
+		},
+		{
+			name: "rpc error",
+			in:   `{"jsonrpc": "2.0", "method": "forbidden", "id": 6}`,
+			want: `{"jsonrpc":"2.0","error":{"code":1,"message":"forbidden"},"id":6}`,
+		},
+		{
+			name: "panic",
+			in:   `{"jsonrpc": "2.0", "method": "panic", "id": 7}`,
+			want: `{"jsonrpc":"2.0","error":{"code":-32603,"message":"Internal error"},"id":7}`,
+		},
+		{
+			name: "parse error",
+			in:   `{"jsonrpc": "2.0", "method": "foobar, "params": "bar", "baz]`,
+			want: `{"jsonrpc":"2.0","error":{"code":-32700,"message":"Parse error"},"id":null}`,
+		},
+		{
+			name: "invalid request",
+			in:   `{"jsonrpc": "2.0", "method": 1, "params": "bar", "id": 8}`,
+			want: `{"jsonrpc":"2.0","error":{"code":-32600,"message":"Invalid Request"},"id":8}`,
+		},
+		{
+			name: "invalid version",
+			in:   `{"jsonrpc": "1.0", "method": "update", "id": 9}`,
+			want: `{"jsonrpc":"2.0","error":{"code":-32600,"message":"Invalid Request"},"id":9}`,
+		},
+		{
+			name: "invalid id",
+			in:   `{"jsonrpc": "2.0", "method": "update", "id": {}}`,
+			want: `{"jsonrpc":"2.0","error":{"code":-32600,"message":"Invalid Request"},"id":null}`,
+		},
+		{
+			name: "batch parse error",
+			in:   `[{"jsonrpc": "2.0", "method": "sum", "params": [1,2,4], "id": "1"},{"jsonrpc": "2.0", "method"]`,
+			want: `{"jsonrpc":"2.0","error":{"code":-32700,"message":"Parse error"},"id":null}`,
+		},
+		{
+			name: "empty batch",
+			in:   `[]`,
+			want: `{"jsonrpc":"2.0","error":{"code":-32600,"message":"Invalid Request"},"id":null}`,
+		},
+		{
+			name: "batch too large",
+			in:   `[1,2,3,4,5,6,7,8,9]`,
+			want: `{"jsonrpc":"2.0","error":{"code":-32600,"message":"Invalid Request"},"id":null}`,
+		},
+		{
+			name: "invalid batch",
+			in:   `[1,2]`,
+			want: `[{"jsonrpc":"2.0","error":{"code":-32600,"message":"Invalid Request"},"id":null},` +
+				`{"jsonrpc":"2.0","error":{"code":-32600,"message":"Invalid Request"},"id":null}]`,
+		},
+		{
+			name: "batch",
+			in: `[
+				{"jsonrpc": "2.0", "method": "sum", "params": [1,2,4], "id": "1"},
+				{"jsonrpc": "2.0", "method": "notify_sum", "params": [1,2,4]},
+				{"jsonrpc": "2.0", "method": "subtract", "params": [42,23], "id": "2"},
+				{"foo": "boo"},
+				{"jsonrpc": "2.0", "method": "foo.get", "params": {"name": "myself"}, "id": "5"},
+				{"jsonrpc": "2.0", "method": "get_data", "id": "9"}
+			]`,
+			want: `[{"jsonrpc":"2.0","result":7,"id":"1"},` +
+				`{"jsonrpc":"2.0","result":19,"id":"2"},` +
+				`{"jsonrpc":"2.0","error":{"code":-32600,"message":"Invalid Request"},"id":null},` +
+				`{"jsonrpc":"2.0","error":{"code":-32601,"message":"Method not found"},"id":"5"},` +
+				`{"jsonrpc":"2.0","result":["hello",5],"id":"9"}]`,
+		},
+		{
+			name: "batch notifications",
+			in: `[
+				{"jsonrpc": "2.0", "method": "notify_sum", "params": [1,2,4]},
+				{"jsonrpc": "2.0", "method": "update", "params": [7]}
+			]`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(s.ServeMessage(nil, []byte(tt.in))); got != tt.want {
+				t.Fatalf("got  %s\nwant %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// 请求与应答可以使用 delimiter 或者 lengthfield 分帧
+func TestServer_Framing(t *testing.T) {
+	s := newServer(t)
+	lf, err := lengthfield.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	protocols := map[string]connection.Protocol{
+		"delimiter":   delimiter.New(),
+		"lengthfield": lf,
+	}
+	for name, p := range protocols {
+		t.Run(name, func(t *testing.T) {
+			buffer := ringbuffer.New(0)
+			_, _ = buffer.Write(p.Packet(nil, []byte(`{"jsonrpc":"2.0","method":"subtract","params":[5,3],"id":1}`)))
+			_, _ = buffer.Write(p.Packet(nil, []byte(`{"jsonrpc":"2.0","method":"update"}`)))
+
+			ctx, data := p.UnPacket(nil, buffer)
+			out := p.Packet(nil, s.OnMessage(nil, ctx, data))
+			ctx, data = p.UnPacket(nil, buffer)
+			if reply := s.OnMessage(nil, ctx, data); reply != nil {
+				t.Fatalf("notification got %s", reply)
+			}
+
+			buffer.Reset()
+			_, _ = buffer.Write(out)
+			if _, got := p.UnPacket(nil, buffer); string(got) != `{"jsonrpc":"2.0","result":2,"id":1}` {
+				t.Fatalf("got %s", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package lengthfield
+
+import (
+	"encoding/binary"
+
+	"github.com/Dongxiem/fastnet/connection"
+)
+
+// Options：长度字段解码配置，与 Netty LengthFieldBasedFrameDecoder 一致
+type Options struct {
+	LengthFieldOffset   int              // 长度字段的偏移
+	LengthFieldLength   int              // 长度字段的字节数：1、2、4、8
+	ByteOrder           binary.ByteOrder // 长度字段的字节序
+	LengthAdjustment    int              // 长度字段的值加上该值得到长度字段之后的数据长度
+	InitialBytesToStrip int              // 从数据帧头部去掉的字节数
+	MaxFrameLength      int              // 数据帧最大长度，超过则关闭连接
+	SkipEmpty           bool             // 是否跳过去掉头部之后为空的数据帧
+
+	OnError connection.ErrorHandler // 解码出错时的回调，之后连接会被关闭
+}
+
+// Option ...
+type Option func(*Options)
+
+// newOptions：返回一个新的 Options 配置
+func newOptions(opt ...Option) *Options {
+	// 默认为 4 字节大端序长度前缀，解码后去掉长度字段
+	opts := Options{
+		LengthFieldLength:   4,
+		InitialBytesToStrip: 4,
+	}
+
+	for _, o := range opt {
+		o(&opts)
+	}
+	if opts.ByteOrder == nil {
+		opts.ByteOrder = binary.BigEndian
+	}
+	// 默认最大 4M
+	if opts.MaxFrameLength <= 0 {
+		opts.MaxFrameLength = 4 * 1024 * 1024
+	}
+	if opts.OnError == nil {
+		opts.OnError = connection.LogError("[lengthfield]")
+	}
+
+	return &opts
+}
+
+// LengthField：长度字段的偏移与字节数
+func LengthField(offset, length int) Option {
+	return func(o *Options) {
+		o.LengthFieldOffset = offset
+		o.LengthFieldLength = length
+	}
+}
+
+// ByteOrder：长度字段的字节序
+func ByteOrder(order binary.ByteOrder) Option {
+	return func(o *Options) {
+		o.ByteOrder = order
+	}
+}
+
+// LengthAdjustment：长度修正值
+func LengthAdjustment(n int) Option {
+	return func(o *Options) {
+		o.LengthAdjustment = n
+	}
+}
+
+// InitialBytesToStrip：从数据帧头部去掉的字节数
+func InitialBytesToStrip(n int) Option {
+	return func(o *Options) {
+		o.InitialBytesToStrip = n
+	}
+}
+
+// MaxFrameLength：数据帧最大长度
+func MaxFrameLength(n int) Option {
+	return func(o *Options) {
+		o.MaxFrameLength = n
+	}
+}
+
+// SkipEmpty：跳过去掉头部之后为空的数据帧，默认空的数据帧也作为一条消息
+func SkipEmpty(skip bool) Option {
+	return func(o *Options) {
+		o.SkipEmpty = skip
+	}
+}
+
+// OnError：解码出错时的回调
+func OnError(f func(c *connection.Connection, err error)) Option {
+	return func(o *Options) {
+		o.OnError = f
+	}
+}
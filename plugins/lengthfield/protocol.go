@@ -0,0 +1,161 @@
+package lengthfield
+
+import (
+	"errors"
+	"math"
+
+	"github.com/Dongxiem/fastnet/connection"
+	"github.com/Dongxiem/fastnet/tool/ringbuffer"
+)
+
+var _ connection.Protocol = &Protocol{}
+
+var (
+	// ErrInvalidLengthField：长度字段配置错误
+	ErrInvalidLengthField = errors.New("lengthfield: length field length must be 1, 2, 4 or 8")
+	// ErrInvalidOptions：偏移等配置错误
+	ErrInvalidOptions = errors.New("lengthfield: invalid options")
+	// ErrFrameTooLong：数据帧超过最大长度
+	ErrFrameTooLong = errors.New("lengthfield: frame too long")
+	// ErrInvalidFrameLength：长度字段的值修正之后不合法
+	ErrInvalidFrameLength = errors.New("lengthfield: invalid frame length")
+)
+
+// EmptyFrame：空数据帧的 ctx，ctx 与 out 同时为空表示没有完整的数据，所以空数据帧使用 EmptyFrame{} 作为 ctx
+type EmptyFrame struct{}
+
+// logPacketError：Packet 出错时记录日志，Broadcast 等调用 Packet 时 c 为 nil
+var logPacketError = connection.LogError("[lengthfield]")
+
+// Protocol：基于长度字段的拆包协议
+type Protocol struct {
+	opts *Options
+	// headerLen：长度字段结束的位置
+	headerLen int
+}
+
+// New：创建 lengthfield Protocol
+func New(opts ...Option) (*Protocol, error) {
+	options := newOptions(opts...)
+	switch options.LengthFieldLength {
+	case 1, 2, 4, 8:
+	default:
+		return nil, ErrInvalidLengthField
+	}
+	if options.LengthFieldOffset < 0 || options.InitialBytesToStrip < 0 {
+		return nil, ErrInvalidOptions
+	}
+
+	return &Protocol{
+		opts:      options,
+		headerLen: options.LengthFieldOffset + options.LengthFieldLength,
+	}, nil
+}
+
+// UnPacket：拆包，去掉头部之后为空的数据帧返回的 ctx 为 EmptyFrame{}，SkipEmpty 时直接跳过
+func (p *Protocol) UnPacket(c *connection.Connection, buffer *ringbuffer.RingBuffer) (ctx interface{}, out []byte) {
+	for buffer.Length() >= p.headerLen {
+		frameLen, err := p.frameLength(buffer)
+		if err != nil {
+			connection.CloseOnError(c, buffer, p.opts.OnError, err)
+			return
+		}
+		// 数据还没有接收完整
+		if buffer.Length() < frameLen {
+			return
+		}
+
+		buffer.Retrieve(p.opts.InitialBytesToStrip)
+		dataLen := frameLen - p.opts.InitialBytesToStrip
+		if dataLen == 0 {
+			if p.opts.SkipEmpty {
+				continue
+			}
+			return EmptyFrame{}, nil
+		}
+		out = make([]byte, dataLen)
+		_, _ = buffer.Read(out)
+		return
+	}
+	return
+}
+
+// frameLength：根据长度字段计算完整数据帧的长度
+func (p *Protocol) frameLength(buffer *ringbuffer.RingBuffer) (int, error) {
+	var field [8]byte
+	first, end := buffer.Peek(p.headerLen)
+	n := copy(field[:], skip(first, p.opts.LengthFieldOffset))
+	copy(field[n:p.opts.LengthFieldLength], skip(end, p.opts.LengthFieldOffset-len(first)))
+
+	var length uint64
+	switch p.opts.LengthFieldLength {
+	case 1:
+		length = uint64(field[0])
+	case 2:
+		length = uint64(p.opts.ByteOrder.Uint16(field[:2]))
+	case 4:
+		length = uint64(p.opts.ByteOrder.Uint32(field[:4]))
+	case 8:
+		length = p.opts.ByteOrder.Uint64(field[:8])
+	}
+	if length > math.MaxInt32 {
+		return 0, ErrFrameTooLong
+	}
+
+	frameLen := p.headerLen + int(length) + p.opts.LengthAdjustment
+	if frameLen < p.headerLen || frameLen < p.opts.InitialBytesToStrip {
+		return 0, ErrInvalidFrameLength
+	}
+	if frameLen > p.opts.MaxFrameLength {
+		return 0, ErrFrameTooLong
+	}
+	return frameLen, nil
+}
+
+// Packet：装包，仅当长度字段位于数据帧头部并且解码时会去掉长度字段时，才会在 data 前面加上长度字段
+// 其他配置下直接返回 data，由用户自行封装；长度超出长度字段的范围或者 MaxFrameLength 时丢弃并记录日志
+func (p *Protocol) Packet(c *connection.Connection, data []byte) []byte {
+	if p.opts.LengthFieldOffset != 0 || p.opts.InitialBytesToStrip != p.opts.LengthFieldLength {
+		return data
+	}
+
+	n := int64(len(data)) - int64(p.opts.LengthAdjustment)
+	var err error
+	switch {
+	case n < 0:
+		err = ErrInvalidFrameLength
+	case p.opts.LengthFieldLength < 8 && uint64(n) > 1<<(8*uint(p.opts.LengthFieldLength))-1,
+		p.headerLen+len(data) > p.opts.MaxFrameLength:
+		err = ErrFrameTooLong
+	}
+	if err != nil {
+		logPacketError(c, err)
+		return nil
+	}
+
+	length := uint64(n)
+	ret := make([]byte, p.headerLen+len(data))
+	switch p.opts.LengthFieldLength {
+	case 1:
+		ret[0] = byte(length)
+	case 2:
+		p.opts.ByteOrder.PutUint16(ret, uint16(length))
+	case 4:
+		p.opts.ByteOrder.PutUint32(ret, uint32(length))
+	case 8:
+		p.opts.ByteOrder.PutUint64(ret, length)
+	}
+	copy(ret[p.headerLen:], data)
+	return ret
+}
+
+// skip：跳过 b 的前 n 个字节
+func skip(b []byte, n int) []byte {
+	if n <= 0 {
+		return b
+	}
+	if n >= len(b) {
+		return nil
+	}
+	return b[n:]
+}
@@ -0,0 +1,174 @@
+package lengthfield
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+
+	"github.com/Dongxiem/fastnet/connection"
+	"github.com/Dongxiem/fastnet/eventloop"
+	"github.com/Dongxiem/fastnet/tool/ringbuffer"
+)
+
+func TestProtocol_UnPacket(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []Option
+		in   []byte
+		want []string
+	}{
+		{
+			name: "default",
+			in:   []byte{0, 0, 0, 5, 'h', 'e', 'l', 'l', 'o', 0, 0, 0, 2, 'h', 'i'},
+			want: []string{"hello", "hi"},
+		},
+		{
+			name: "keep header",
+			opts: []Option{LengthField(0, 2), InitialBytesToStrip(0)},
+			in:   []byte{0, 2, 'h', 'i'},
+			want: []string{"\x00\x02hi"},
+		},
+		{
+			name: "length includes header",
+			opts: []Option{LengthField(0, 2), LengthAdjustment(-2), InitialBytesToStrip(2)},
+			in:   []byte{0, 4, 'h', 'i'},
+			want: []string{"hi"},
+		},
+		{
+			name: "offset and little endian",
+			opts: []Option{LengthField(2, 4), ByteOrder(binary.LittleEndian), InitialBytesToStrip(6)},
+			in:   []byte{0xca, 0xfe, 2, 0, 0, 0, 'h', 'i'},
+			want: []string{"hi"},
+		},
+		{
+			name: "header after length",
+			opts: []Option{LengthField(1, 1), LengthAdjustment(1), InitialBytesToStrip(3)},
+			in:   []byte{0xca, 2, 0xfe, 'h', 'i'},
+			want: []string{"hi"},
+		},
+		{
+			name: "empty frame",
+			opts: []Option{LengthField(0, 1), InitialBytesToStrip(1)},
+			in:   []byte{0, 0, 2, 'h', 'i', 3, 'a'},
+			want: []string{"", "", "hi"},
+		},
+		{
+			name: "skip empty frame",
+			opts: []Option{LengthField(0, 1), InitialBytesToStrip(1), SkipEmpty(true)},
+			in:   []byte{0, 0, 2, 'h', 'i', 3, 'a'},
+			want: []string{"hi"},
+		},
+	}
+
+	for _, tt := range tests {
+		p, err := New(tt.opts...)
+		if err != nil {
+			t.Fatal(tt.name, err)
+		}
+		buffer := ringbuffer.New(4)
+		_, _ = buffer.Write(tt.in)
+
+		var got []string
+		for {
+			ctx, out := p.UnPacket(nil, buffer)
+			if ctx == nil && len(out) == 0 {
+				break
+			}
+			if _, ok := ctx.(EmptyFrame); ok != (len(out) == 0) {
+				t.Fatalf("%s: ctx %v out %q", tt.name, ctx, out)
+			}
+			got = append(got, string(out))
+		}
+		if len(got) != len(tt.want) {
+			t.Fatalf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Fatalf("%s: got %q, want %q", tt.name, got, tt.want)
+			}
+		}
+	}
+}
+
+func TestProtocol_FrameTooLong(t *testing.T) {
+	loop, err := eventloop.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var reported error
+	p, err := New(MaxFrameLength(8), OnError(func(c *connection.Connection, err error) {
+		reported = err
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := connection.New(-1, loop, nil, p, nil, 0, nil)
+
+	buffer := ringbuffer.New(16)
+	_, _ = buffer.Write([]byte{0, 0, 0, 4, 'h'})
+	if _, out := p.UnPacket(c, buffer); len(out) != 0 || buffer.Length() != 5 {
+		t.Fatal("frame should not be ready")
+	}
+
+	buffer.RetrieveAll()
+	_, _ = buffer.Write([]byte{0, 0, 1, 0, 'h'})
+	if _, out := p.UnPacket(c, buffer); len(out) != 0 {
+		t.Fatal("frame should be dropped")
+	}
+	if reported != ErrFrameTooLong || buffer.Length() != 0 {
+		t.Fatalf("err should be ErrFrameTooLong, but %v", reported)
+	}
+}
+
+func TestProtocol_Packet(t *testing.T) {
+	p, err := New(LengthField(0, 2), LengthAdjustment(-2), InitialBytesToStrip(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	buffer := ringbuffer.New(8)
+	_, _ = buffer.Write(p.Packet(nil, []byte("hello")))
+	if _, out := p.UnPacket(nil, buffer); string(out) != "hello" {
+		t.Fatalf("out should be hello, but %q", out)
+	}
+
+	if _, err := New(LengthField(0, 3)); err != ErrInvalidLengthField {
+		t.Fatalf("err should be ErrInvalidLengthField, but %v", err)
+	}
+}
+
+func TestProtocol_PacketLimit(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    []Option
+		ok, bad int // 能够装包与超出范围的数据长度
+	}{
+		{"1 byte", []Option{LengthField(0, 1), InitialBytesToStrip(1)}, 255, 256},
+		{"2 bytes", []Option{LengthField(0, 2), InitialBytesToStrip(2)}, 65535, 65536},
+		{"2 bytes with adjustment", []Option{LengthField(0, 2), LengthAdjustment(-2), InitialBytesToStrip(2)}, 65533, 65534},
+		{"4 bytes", []Option{MaxFrameLength(1024)}, 1020, 1021},
+		{"8 bytes", []Option{LengthField(0, 8), InitialBytesToStrip(8), MaxFrameLength(1024)}, 1016, 1017},
+		{"negative length", []Option{LengthField(0, 2), LengthAdjustment(4), InitialBytesToStrip(2)}, 4, 3},
+	}
+	for _, tt := range tests {
+		p, err := New(tt.opts...)
+		if err != nil {
+			t.Fatal(tt.name, err)
+		}
+		if out := p.Packet(nil, make([]byte, tt.ok)); len(out) != p.headerLen+tt.ok {
+			t.Fatalf("%s: %d bytes should be packed, got %d", tt.name, tt.ok, len(out))
+		}
+		if out := p.Packet(nil, make([]byte, tt.bad)); out != nil {
+			t.Fatalf("%s: %d bytes should be dropped", tt.name, tt.bad)
+		}
+	}
+
+	// 4 字节长度字段的值不能超过 MaxUint32
+	p, err := New(LengthAdjustment(-math.MaxUint32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out := p.Packet(nil, []byte("a")); out != nil {
+		t.Fatal("length should overflow the 4 byte field")
+	}
+}
@@ -0,0 +1,158 @@
+package mqtt
+
+import (
+	"encoding/binary"
+	"unicode/utf8"
+)
+
+// maxRemainingLength：剩余长度最多 4 个字节，最大值为 268435455
+const maxRemainingLength = 268435455
+
+// reader：解码变长头与负载，发生错误之后的读取全部返回零值
+type reader struct {
+	b   []byte
+	err error
+}
+
+func (r *reader) fail() {
+	if r.err == nil {
+		r.err = ErrMalformedPacket
+	}
+	r.b = nil
+}
+
+func (r *reader) len() int {
+	return len(r.b)
+}
+
+func (r *reader) readByte() byte {
+	if len(r.b) < 1 {
+		r.fail()
+		return 0
+	}
+	v := r.b[0]
+	r.b = r.b[1:]
+	return v
+}
+
+func (r *reader) readUint16() uint16 {
+	if len(r.b) < 2 {
+		r.fail()
+		return 0
+	}
+	v := binary.BigEndian.Uint16(r.b)
+	r.b = r.b[2:]
+	return v
+}
+
+func (r *reader) readUint32() uint32 {
+	if len(r.b) < 4 {
+		r.fail()
+		return 0
+	}
+	v := binary.BigEndian.Uint32(r.b)
+	r.b = r.b[4:]
+	return v
+}
+
+func (r *reader) readVarInt() uint32 {
+	v, n := decodeVarInt(r.b)
+	if n <= 0 {
+		r.fail()
+		return 0
+	}
+	r.b = r.b[n:]
+	return v
+}
+
+func (r *reader) readBinary() []byte {
+	n := int(r.readUint16())
+	if r.err != nil || len(r.b) < n {
+		r.fail()
+		return nil
+	}
+	v := r.b[:n:n]
+	r.b = r.b[n:]
+	return v
+}
+
+// readString：UTF-8 编码的字符串，不允许包含 U+0000
+func (r *reader) readString() string {
+	b := r.readBinary()
+	if r.err != nil {
+		return ""
+	}
+	if !utf8.Valid(b) {
+		r.fail()
+		return ""
+	}
+	for _, c := range b {
+		if c == 0 {
+			r.fail()
+			return ""
+		}
+	}
+	return string(b)
+}
+
+// rest：读取剩余的全部数据
+func (r *reader) rest() []byte {
+	v := r.b
+	r.b = nil
+	return v
+}
+
+// decodeVarInt：解码变长整数，n 为使用的字节数，n == 0 表示数据不完整，n < 0 表示格式错误
+func decodeVarInt(b []byte) (v uint32, n int) {
+	var shift uint
+	for i := 0; i < 4; i++ {
+		if i >= len(b) {
+			return 0, 0
+		}
+		v |= uint32(b[i]&0x7f) << shift
+		if b[i]&0x80 == 0 {
+			return v, i + 1
+		}
+		shift += 7
+	}
+	return 0, -1
+}
+
+func appendVarInt(b []byte, v uint32) []byte {
+	for {
+		c := byte(v & 0x7f)
+		v >>= 7
+		if v > 0 {
+			c |= 0x80
+		}
+		b = append(b, c)
+		if v == 0 {
+			return b
+		}
+	}
+}
+
+func appendUint16(b []byte, v uint16) []byte {
+	return append(b, byte(v>>8), byte(v))
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	return append(b, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+func appendString(b []byte, s string) []byte {
+	b = appendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
+
+func appendBinary(b []byte, s []byte) []byte {
+	b = appendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
+
+// appendPacket：固定头 + 变长头与负载
+func appendPacket(b []byte, header byte, body []byte) []byte {
+	b = append(b, header)
+	b = appendVarInt(b, uint32(len(body)))
+	return append(b, body...)
+}
@@ -0,0 +1,56 @@
+package mqtt
+
+import (
+	"time"
+)
+
+// Options：MQTT 配置
+type Options struct {
+	MaxPacketSize  int           // 数据包的最大长度（固定头之后的剩余长度）
+	ConnectTimeout time.Duration // 建立 TCP 连接之后等待 CONNECT 的最长时间
+	MaxKeepAlive   uint16        // 服务端允许的最大 keep alive（秒），为 0 时不限制，仅对 MQTT 5.0 生效
+}
+
+// Option ...
+type Option func(*Options)
+
+// newOptions：返回一个新的 Options 配置
+func newOptions(opt ...Option) *Options {
+	opts := Options{}
+
+	for _, o := range opt {
+		o(&opts)
+	}
+	if opts.MaxPacketSize <= 0 {
+		opts.MaxPacketSize = 1024 * 1024
+	}
+	if opts.MaxPacketSize > maxRemainingLength {
+		opts.MaxPacketSize = maxRemainingLength
+	}
+	if opts.ConnectTimeout <= 0 {
+		opts.ConnectTimeout = 10 * time.Second
+	}
+
+	return &opts
+}
+
+// MaxPacketSize：数据包的最大长度
+func MaxPacketSize(n int) Option {
+	return func(o *Options) {
+		o.MaxPacketSize = n
+	}
+}
+
+// ConnectTimeout：等待 CONNECT 的最长时间
+func ConnectTimeout(d time.Duration) Option {
+	return func(o *Options) {
+		o.ConnectTimeout = d
+	}
+}
+
+// MaxKeepAlive：服务端允许的最大 keep alive（秒）
+func MaxKeepAlive(seconds uint16) Option {
+	return func(o *Options) {
+		o.MaxKeepAlive = seconds
+	}
+}
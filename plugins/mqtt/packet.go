@@ -0,0 +1,579 @@
+package mqtt
+
+import (
+	"errors"
+	"strings"
+)
+
+// PacketType：控制报文类型
+type PacketType byte
+
+// 控制报文类型
+const (
+	CONNECT PacketType = iota + 1
+	CONNACK
+	PUBLISH
+	PUBACK
+	PUBREC
+	PUBREL
+	PUBCOMP
+	SUBSCRIBE
+	SUBACK
+	UNSUBSCRIBE
+	UNSUBACK
+	PINGREQ
+	PINGRESP
+	DISCONNECT
+	AUTH
+)
+
+// 协议版本
+const (
+	Version31  byte = 3
+	Version311 byte = 4
+	Version5   byte = 5
+)
+
+// ReasonCode：MQTT 5.0 原因码，MQTT 3.1.1 的 CONNACK 返回码由原因码转换得到
+type ReasonCode byte
+
+// 常用原因码
+const (
+	Success                    ReasonCode = 0x00
+	GrantedQoS1                ReasonCode = 0x01
+	GrantedQoS2                ReasonCode = 0x02
+	NoMatchingSubscribers      ReasonCode = 0x10
+	NoSubscriptionExisted      ReasonCode = 0x11
+	UnspecifiedError           ReasonCode = 0x80
+	MalformedPacket            ReasonCode = 0x81
+	ProtocolErrorCode          ReasonCode = 0x82
+	ImplementationSpecific     ReasonCode = 0x83
+	UnsupportedProtocolVersion ReasonCode = 0x84
+	ClientIdentifierNotValid   ReasonCode = 0x85
+	BadUserNameOrPassword      ReasonCode = 0x86
+	NotAuthorized              ReasonCode = 0x87
+	ServerUnavailable          ReasonCode = 0x88
+	ServerBusy                 ReasonCode = 0x89
+	KeepAliveTimeout           ReasonCode = 0x8D
+	SessionTakenOver           ReasonCode = 0x8E
+	TopicFilterInvalid         ReasonCode = 0x8F
+	TopicNameInvalid           ReasonCode = 0x90
+	PacketIdentifierNotFound   ReasonCode = 0x92
+	TopicAliasInvalid          ReasonCode = 0x94
+	PacketTooLarge             ReasonCode = 0x95
+)
+
+var (
+	ErrMalformedPacket    = errors.New("mqtt: malformed packet")
+	ErrProtocolError      = errors.New("mqtt: protocol error")
+	ErrUnsupportedVersion = errors.New("mqtt: unsupported protocol version")
+	ErrPacketTooLarge     = errors.New("mqtt: packet too large")
+	ErrTopicAliasInvalid  = errors.New("mqtt: topic alias invalid")
+)
+
+// reasonCode：错误对应的 DISCONNECT 原因码
+func reasonCode(err error) ReasonCode {
+	switch err {
+	case ErrMalformedPacket:
+		return MalformedPacket
+	case ErrProtocolError:
+		return ProtocolErrorCode
+	case ErrUnsupportedVersion:
+		return UnsupportedProtocolVersion
+	case ErrPacketTooLarge:
+		return PacketTooLarge
+	case ErrTopicAliasInvalid:
+		return TopicAliasInvalid
+	}
+	return UnspecifiedError
+}
+
+// Packet：控制报文
+type Packet interface {
+	Type() PacketType
+}
+
+// Encoder：可以由服务端发送的控制报文，version 为客户端使用的协议版本
+type Encoder interface {
+	Packet
+	Encode(version byte) []byte
+}
+
+// Will：遗嘱消息
+type Will struct {
+	Topic      string
+	Payload    []byte
+	QoS        byte
+	Retain     bool
+	Properties Properties
+}
+
+// Connect：CONNECT 报文
+type Connect struct {
+	ProtocolName string
+	Version      byte
+	CleanStart   bool // MQTT 3.1.1 中为 Clean Session
+	KeepAlive    uint16
+	Properties   Properties
+	ClientID     string
+	Will         *Will
+	Username     string
+	Password     []byte // 未设置密码时为 nil
+}
+
+// ConnAck：CONNACK 报文
+type ConnAck struct {
+	SessionPresent bool
+	ReasonCode     ReasonCode
+	Properties     Properties
+}
+
+// Publish：PUBLISH 报文
+type Publish struct {
+	Dup        bool
+	QoS        byte
+	Retain     bool
+	Topic      string
+	PacketID   uint16
+	Properties Properties
+	Payload    []byte
+}
+
+// Ack：PUBACK、PUBREC、PUBREL、PUBCOMP 报文
+type Ack struct {
+	PacketType PacketType
+	PacketID   uint16
+	ReasonCode ReasonCode
+	Properties Properties
+}
+
+// Subscription：订阅选项
+type Subscription struct {
+	Topic             string
+	QoS               byte
+	NoLocal           bool
+	RetainAsPublished bool
+	RetainHandling    byte
+}
+
+// Subscribe：SUBSCRIBE 报文
+type Subscribe struct {
+	PacketID      uint16
+	Properties    Properties
+	Subscriptions []Subscription
+}
+
+// SubAck：SUBACK 报文，MQTT 3.1.1 中原因码只能为 0x00、0x01、0x02、0x80
+type SubAck struct {
+	PacketID    uint16
+	Properties  Properties
+	ReasonCodes []ReasonCode
+}
+
+// Unsubscribe：UNSUBSCRIBE 报文
+type Unsubscribe struct {
+	PacketID   uint16
+	Properties Properties
+	Topics     []string
+}
+
+// UnsubAck：UNSUBACK 报文，MQTT 3.1.1 中不包含原因码
+type UnsubAck struct {
+	PacketID    uint16
+	Properties  Properties
+	ReasonCodes []ReasonCode
+}
+
+// PingReq：PINGREQ 报文
+type PingReq struct{}
+
+// PingResp：PINGRESP 报文
+type PingResp struct{}
+
+// Disconnect：DISCONNECT 报文，MQTT 3.1.1 中不包含原因码与属性
+type Disconnect struct {
+	ReasonCode ReasonCode
+	Properties Properties
+}
+
+// Type ...
+func (*Connect) Type() PacketType { return CONNECT }
+
+// Type ...
+func (*ConnAck) Type() PacketType { return CONNACK }
+
+// Type ...
+func (*Publish) Type() PacketType { return PUBLISH }
+
+// Type ...
+func (a *Ack) Type() PacketType { return a.PacketType }
+
+// Type ...
+func (*Subscribe) Type() PacketType { return SUBSCRIBE }
+
+// Type ...
+func (*SubAck) Type() PacketType { return SUBACK }
+
+// Type ...
+func (*Unsubscribe) Type() PacketType { return UNSUBSCRIBE }
+
+// Type ...
+func (*UnsubAck) Type() PacketType { return UNSUBACK }
+
+// Type ...
+func (*PingReq) Type() PacketType { return PINGREQ }
+
+// Type ...
+func (*PingResp) Type() PacketType { return PINGRESP }
+
+// Type ...
+func (*Disconnect) Type() PacketType { return DISCONNECT }
+
+// decode：解码客户端发送的控制报文，version 为 CONNECT 中协议的版本，CONNECT 之前为 0
+func decode(header byte, body []byte, version byte) (Packet, error) {
+	t := PacketType(header >> 4)
+	flags := header & 0x0f
+
+	// 除 PUBLISH 外，固定头的标志位都是固定值
+	switch t {
+	case PUBLISH:
+	case PUBREL, SUBSCRIBE, UNSUBSCRIBE:
+		if flags != 0x02 {
+			return nil, ErrMalformedPacket
+		}
+	default:
+		if flags != 0 {
+			return nil, ErrMalformedPacket
+		}
+	}
+
+	if t != CONNECT && version == 0 {
+		return nil, ErrProtocolError
+	}
+
+	r := &reader{b: body}
+	var p Packet
+	switch t {
+	case CONNECT:
+		p = decodeConnect(r)
+	case PUBLISH:
+		p = decodePublish(r, flags, version)
+	case PUBACK, PUBREC, PUBREL, PUBCOMP:
+		p = decodeAck(r, t, version)
+	case SUBSCRIBE:
+		p = decodeSubscribe(r, version)
+	case UNSUBSCRIBE:
+		p = decodeUnsubscribe(r, version)
+	case PINGREQ:
+		p = &PingReq{}
+	case DISCONNECT:
+		d := &Disconnect{}
+		if version == Version5 {
+			if r.len() > 0 {
+				d.ReasonCode = ReasonCode(r.readByte())
+			}
+			if r.len() > 0 {
+				d.Properties = r.readProperties()
+			}
+		}
+		p = d
+	default:
+		return nil, ErrProtocolError
+	}
+
+	if r.err != nil {
+		return nil, r.err
+	}
+	// 解析完成之后不应该有多余的数据
+	if r.len() != 0 {
+		return nil, ErrMalformedPacket
+	}
+	return p, nil
+}
+
+func decodeConnect(r *reader) *Connect {
+	p := &Connect{}
+	p.ProtocolName = r.readString()
+	p.Version = r.readByte()
+	if r.err != nil {
+		return p
+	}
+	switch {
+	case p.ProtocolName == "MQTT" && (p.Version == Version311 || p.Version == Version5):
+	case p.ProtocolName == "MQIsdp" && p.Version == Version31:
+	default:
+		r.err = ErrUnsupportedVersion
+		return p
+	}
+
+	flags := r.readByte()
+	if flags&0x01 != 0 {
+		r.fail()
+		return p
+	}
+	p.CleanStart = flags&0x02 != 0
+	p.KeepAlive = r.readUint16()
+	if p.Version == Version5 {
+		p.Properties = r.readProperties()
+	}
+	p.ClientID = r.readString()
+
+	if flags&0x04 != 0 {
+		w := &Will{
+			QoS:    (flags >> 3) & 0x03,
+			Retain: flags&0x20 != 0,
+		}
+		if w.QoS > 2 {
+			r.fail()
+			return p
+		}
+		if p.Version == Version5 {
+			w.Properties = r.readProperties()
+		}
+		w.Topic = r.readString()
+		w.Payload = r.readBinary()
+		if r.err == nil && !validTopic(w.Topic) {
+			r.fail()
+		}
+		p.Will = w
+	} else if flags&0x38 != 0 {
+		// 没有遗嘱消息时，Will QoS 与 Will Retain 必须为 0
+		r.fail()
+		return p
+	}
+
+	if flags&0x80 != 0 {
+		p.Username = r.readString()
+	}
+	if flags&0x40 != 0 {
+		p.Password = r.readBinary()
+		if p.Password == nil {
+			p.Password = []byte{}
+		}
+	}
+	return p
+}
+
+func decodePublish(r *reader, flags byte, version byte) *Publish {
+	p := &Publish{
+		Dup:    flags&0x08 != 0,
+		QoS:    (flags >> 1) & 0x03,
+		Retain: flags&0x01 != 0,
+	}
+	if p.QoS > 2 || (p.QoS == 0 && p.Dup) {
+		r.fail()
+		return p
+	}
+
+	p.Topic = r.readString()
+	if p.QoS > 0 {
+		p.PacketID = r.readUint16()
+		if r.err == nil && p.PacketID == 0 {
+			r.fail()
+		}
+	}
+	if version == Version5 {
+		p.Properties = r.readProperties()
+	}
+	if r.err != nil {
+		return p
+	}
+	// MQTT 5.0 中使用 Topic Alias 时 Topic 可以为空
+	if p.Topic == "" {
+		if _, ok := p.Properties.Int(PropTopicAlias); !ok {
+			r.err = ErrProtocolError
+		}
+	} else if !validTopic(p.Topic) {
+		r.fail()
+	}
+	p.Payload = r.rest()
+	return p
+}
+
+func decodeAck(r *reader, t PacketType, version byte) *Ack {
+	p := &Ack{PacketType: t}
+	p.PacketID = r.readUint16()
+	if version == Version5 {
+		if r.len() > 0 {
+			p.ReasonCode = ReasonCode(r.readByte())
+		}
+		if r.len() > 0 {
+			p.Properties = r.readProperties()
+		}
+	}
+	return p
+}
+
+func decodeSubscribe(r *reader, version byte) *Subscribe {
+	p := &Subscribe{}
+	p.PacketID = r.readUint16()
+	if version == Version5 {
+		p.Properties = r.readProperties()
+	}
+	for r.err == nil && r.len() > 0 {
+		s := Subscription{Topic: r.readString()}
+		opts := r.readByte()
+		s.QoS = opts & 0x03
+		if version == Version5 {
+			s.NoLocal = opts&0x04 != 0
+			s.RetainAsPublished = opts&0x08 != 0
+			s.RetainHandling = (opts >> 4) & 0x03
+			if opts&0xc0 != 0 || s.RetainHandling > 2 {
+				r.fail()
+			}
+		} else if opts&0xfc != 0 {
+			r.fail()
+		}
+		if s.QoS > 2 || s.Topic == "" {
+			r.fail()
+		}
+		p.Subscriptions = append(p.Subscriptions, s)
+	}
+	if r.err == nil && (p.PacketID == 0 || len(p.Subscriptions) == 0) {
+		r.err = ErrProtocolError
+	}
+	return p
+}
+
+func decodeUnsubscribe(r *reader, version byte) *Unsubscribe {
+	p := &Unsubscribe{}
+	p.PacketID = r.readUint16()
+	if version == Version5 {
+		p.Properties = r.readProperties()
+	}
+	for r.err == nil && r.len() > 0 {
+		topic := r.readString()
+		if topic == "" {
+			r.fail()
+		}
+		p.Topics = append(p.Topics, topic)
+	}
+	if r.err == nil && (p.PacketID == 0 || len(p.Topics) == 0) {
+		r.err = ErrProtocolError
+	}
+	return p
+}
+
+// validTopic：PUBLISH 与遗嘱消息的 Topic 不能包含通配符
+func validTopic(topic string) bool {
+	return !strings.ContainsAny(topic, "+#")
+}
+
+// Encode ...
+func (p *ConnAck) Encode(version byte) []byte {
+	var body []byte
+	if p.SessionPresent {
+		body = append(body, 0x01)
+	} else {
+		body = append(body, 0x00)
+	}
+	if version == Version5 {
+		body = append(body, byte(p.ReasonCode))
+		body = appendProperties(body, p.Properties)
+	} else {
+		body = append(body, connAckReturnCode(p.ReasonCode))
+	}
+	return appendPacket(nil, byte(CONNACK)<<4, body)
+}
+
+// connAckReturnCode：MQTT 5.0 原因码转换为 MQTT 3.1.1 的 CONNACK 返回码
+func connAckReturnCode(code ReasonCode) byte {
+	switch code {
+	case Success:
+		return 0x00
+	case UnsupportedProtocolVersion:
+		return 0x01
+	case ClientIdentifierNotValid:
+		return 0x02
+	case ServerUnavailable, ServerBusy:
+		return 0x03
+	case BadUserNameOrPassword:
+		return 0x04
+	default:
+		return 0x05
+	}
+}
+
+// Encode ...
+func (p *Publish) Encode(version byte) []byte {
+	header := byte(PUBLISH)<<4 | p.QoS<<1
+	if p.Dup {
+		header |= 0x08
+	}
+	if p.Retain {
+		header |= 0x01
+	}
+
+	body := make([]byte, 0, len(p.Topic)+len(p.Payload)+8)
+	body = appendString(body, p.Topic)
+	if p.QoS > 0 {
+		body = appendUint16(body, p.PacketID)
+	}
+	if version == Version5 {
+		body = appendProperties(body, p.Properties)
+	}
+	body = append(body, p.Payload...)
+	return appendPacket(nil, header, body)
+}
+
+// Encode ...
+func (p *Ack) Encode(version byte) []byte {
+	header := byte(p.PacketType) << 4
+	if p.PacketType == PUBREL {
+		header |= 0x02
+	}
+
+	body := appendUint16(nil, p.PacketID)
+	// 原因码为 Success 且没有属性时可以省略
+	if version == Version5 && (p.ReasonCode != Success || len(p.Properties) > 0) {
+		body = append(body, byte(p.ReasonCode))
+		if len(p.Properties) > 0 {
+			body = appendProperties(body, p.Properties)
+		}
+	}
+	return appendPacket(nil, header, body)
+}
+
+// Encode ...
+func (p *SubAck) Encode(version byte) []byte {
+	body := appendUint16(nil, p.PacketID)
+	if version == Version5 {
+		body = appendProperties(body, p.Properties)
+	}
+	for _, code := range p.ReasonCodes {
+		if version != Version5 && code > GrantedQoS2 {
+			code = UnspecifiedError
+		}
+		body = append(body, byte(code))
+	}
+	return appendPacket(nil, byte(SUBACK)<<4, body)
+}
+
+// Encode ...
+func (p *UnsubAck) Encode(version byte) []byte {
+	body := appendUint16(nil, p.PacketID)
+	if version == Version5 {
+		body = appendProperties(body, p.Properties)
+		for _, code := range p.ReasonCodes {
+			body = append(body, byte(code))
+		}
+	}
+	return appendPacket(nil, byte(UNSUBACK)<<4, body)
+}
+
+// Encode ...
+func (p *PingResp) Encode(version byte) []byte {
+	return []byte{byte(PINGRESP) << 4, 0}
+}
+
+// Encode ...
+func (p *Disconnect) Encode(version byte) []byte {
+	var body []byte
+	if version == Version5 && (p.ReasonCode != Success || len(p.Properties) > 0) {
+		body = append(body, byte(p.ReasonCode))
+		if len(p.Properties) > 0 {
+			body = appendProperties(body, p.Properties)
+		}
+	}
+	return appendPacket(nil, byte(DISCONNECT)<<4, body)
+}
@@ -0,0 +1,189 @@
+package mqtt
+
+// MQTT 5.0 属性标识符
+const (
+	PropPayloadFormat          byte = 0x01
+	PropMessageExpiry          byte = 0x02
+	PropContentType            byte = 0x03
+	PropResponseTopic          byte = 0x08
+	PropCorrelationData        byte = 0x09
+	PropSubscriptionIdentifier byte = 0x0B
+	PropSessionExpiry          byte = 0x11
+	PropAssignedClientID       byte = 0x12
+	PropServerKeepAlive        byte = 0x13
+	PropAuthMethod             byte = 0x15
+	PropAuthData               byte = 0x16
+	PropRequestProblemInfo     byte = 0x17
+	PropWillDelay              byte = 0x18
+	PropRequestResponseInfo    byte = 0x19
+	PropResponseInfo           byte = 0x1A
+	PropServerReference        byte = 0x1C
+	PropReasonString           byte = 0x1F
+	PropReceiveMaximum         byte = 0x21
+	PropTopicAliasMaximum      byte = 0x22
+	PropTopicAlias             byte = 0x23
+	PropMaximumQoS             byte = 0x24
+	PropRetainAvailable        byte = 0x25
+	PropUserProperty           byte = 0x26
+	PropMaximumPacketSize      byte = 0x27
+	PropWildcardSubAvailable   byte = 0x28
+	PropSubIdentifierAvailable byte = 0x29
+	PropSharedSubAvailable     byte = 0x2A
+)
+
+// 属性值的编码类型
+const (
+	propByte = iota + 1
+	propUint16
+	propUint32
+	propVarInt
+	propString
+	propBinary
+	propPair
+)
+
+var propTypes = map[byte]int{
+	PropPayloadFormat:          propByte,
+	PropMessageExpiry:          propUint32,
+	PropContentType:            propString,
+	PropResponseTopic:          propString,
+	PropCorrelationData:        propBinary,
+	PropSubscriptionIdentifier: propVarInt,
+	PropSessionExpiry:          propUint32,
+	PropAssignedClientID:       propString,
+	PropServerKeepAlive:        propUint16,
+	PropAuthMethod:             propString,
+	PropAuthData:               propBinary,
+	PropRequestProblemInfo:     propByte,
+	PropWillDelay:              propUint32,
+	PropRequestResponseInfo:    propByte,
+	PropResponseInfo:           propString,
+	PropServerReference:        propString,
+	PropReasonString:           propString,
+	PropReceiveMaximum:         propUint16,
+	PropTopicAliasMaximum:      propUint16,
+	PropTopicAlias:             propUint16,
+	PropMaximumQoS:             propByte,
+	PropRetainAvailable:        propByte,
+	PropUserProperty:           propPair,
+	PropMaximumPacketSize:      propUint32,
+	PropWildcardSubAvailable:   propByte,
+	PropSubIdentifierAvailable: propByte,
+	PropSharedSubAvailable:     propByte,
+}
+
+// Property：MQTT 5.0 属性
+// 整数类型的值保存在 Int，字符串保存在 Str，二进制数据保存在 Bin，User Property 的 key 保存在 Key、value 保存在 Str
+type Property struct {
+	ID  byte
+	Int uint32
+	Str string
+	Bin []byte
+	Key string
+}
+
+// Properties：按出现顺序保存的属性列表
+type Properties []Property
+
+// Get：获取第一个标识符为 id 的属性
+func (ps Properties) Get(id byte) (Property, bool) {
+	for _, p := range ps {
+		if p.ID == id {
+			return p, true
+		}
+	}
+	return Property{}, false
+}
+
+// Int：获取整数类型的属性
+func (ps Properties) Int(id byte) (uint32, bool) {
+	p, ok := ps.Get(id)
+	return p.Int, ok
+}
+
+// String：获取字符串类型的属性
+func (ps Properties) String(id byte) (string, bool) {
+	p, ok := ps.Get(id)
+	return p.Str, ok
+}
+
+// readProperties：读取属性，除 User Property 与 Subscription Identifier 外，同一属性出现多次视为协议错误
+func (r *reader) readProperties() Properties {
+	n := int(r.readVarInt())
+	if r.err != nil {
+		return nil
+	}
+	if n > len(r.b) {
+		r.fail()
+		return nil
+	}
+	if n == 0 {
+		return nil
+	}
+
+	sub := &reader{b: r.b[:n]}
+	r.b = r.b[n:]
+
+	var ps Properties
+	for sub.len() > 0 {
+		p := Property{ID: byte(sub.readVarInt())}
+		switch propTypes[p.ID] {
+		case propByte:
+			p.Int = uint32(sub.readByte())
+		case propUint16:
+			p.Int = uint32(sub.readUint16())
+		case propUint32:
+			p.Int = sub.readUint32()
+		case propVarInt:
+			p.Int = sub.readVarInt()
+		case propString:
+			p.Str = sub.readString()
+		case propBinary:
+			p.Bin = sub.readBinary()
+		case propPair:
+			p.Key = sub.readString()
+			p.Str = sub.readString()
+		default:
+			sub.fail()
+		}
+		if sub.err != nil {
+			r.err = sub.err
+			return nil
+		}
+		if p.ID != PropUserProperty && p.ID != PropSubscriptionIdentifier {
+			if _, ok := ps.Get(p.ID); ok {
+				r.err = ErrProtocolError
+				return nil
+			}
+		}
+		ps = append(ps, p)
+	}
+	return ps
+}
+
+// appendProperties：编码属性，包括属性长度
+func appendProperties(b []byte, ps Properties) []byte {
+	var body []byte
+	for _, p := range ps {
+		body = appendVarInt(body, uint32(p.ID))
+		switch propTypes[p.ID] {
+		case propByte:
+			body = append(body, byte(p.Int))
+		case propUint16:
+			body = appendUint16(body, uint16(p.Int))
+		case propUint32:
+			body = appendUint32(body, p.Int)
+		case propVarInt:
+			body = appendVarInt(body, p.Int)
+		case propString:
+			body = appendString(body, p.Str)
+		case propBinary:
+			body = appendBinary(body, p.Bin)
+		case propPair:
+			body = appendString(body, p.Key)
+			body = appendString(body, p.Str)
+		}
+	}
+	b = appendVarInt(b, uint32(len(body)))
+	return append(b, body...)
+}
@@ -0,0 +1,105 @@
+package mqtt
+
+import (
+	"github.com/Dongxiem/fastnet/connection"
+	"github.com/Dongxiem/fastnet/log"
+	"github.com/Dongxiem/fastnet/tool/ringbuffer"
+)
+
+var _ connection.Protocol = &Protocol{}
+
+// Protocol：MQTT 3.1.1 / 5.0 协议
+type Protocol struct {
+	opts *Options
+}
+
+// New：创建 MQTT Protocol
+func New(opts ...Option) *Protocol {
+	return &Protocol{opts: newOptions(opts...)}
+}
+
+// UnPacket：拆包，返回的 ctx 为 *Connect、*Publish、*Ack、*Subscribe、*Unsubscribe、*PingReq 或 *Disconnect
+func (p *Protocol) UnPacket(c *connection.Connection, buffer *ringbuffer.RingBuffer) (ctx interface{}, out []byte) {
+	s := getOrCreateSession(c)
+	if s.closing {
+		buffer.RetrieveAll()
+		return
+	}
+
+	// 固定头：1 个字节的类型与标志位 + 1 到 4 个字节的剩余长度
+	if buffer.Length() < 2 {
+		return
+	}
+	var head [5]byte
+	first, end := buffer.Peek(len(head))
+	n := copy(head[:], first)
+	n += copy(head[n:], end)
+
+	length, size := decodeVarInt(head[1:n])
+	if size == 0 {
+		return
+	}
+	if size < 0 {
+		p.fail(c, s, buffer, ErrMalformedPacket)
+		return
+	}
+	if int(length) > p.opts.MaxPacketSize {
+		p.fail(c, s, buffer, ErrPacketTooLarge)
+		return
+	}
+	// 数据还没有接收完整
+	if buffer.Length() < 1+size+int(length) {
+		return
+	}
+
+	buffer.Retrieve(1 + size)
+	body := make([]byte, length)
+	_, _ = buffer.Read(body)
+	s.alive()
+
+	pkt, err := decode(head[0], body, s.Version)
+	if err != nil {
+		p.fail(c, s, buffer, err)
+		return
+	}
+	if connect, ok := pkt.(*Connect); ok {
+		// 同一个连接只能发送一次 CONNECT
+		if s.Version != 0 {
+			p.fail(c, s, buffer, ErrProtocolError)
+			return
+		}
+		s.Version = connect.Version
+	}
+	return pkt, nil
+}
+
+// Packet：直接返回，报文由 Encode 编码
+func (p *Protocol) Packet(c *connection.Connection, data []byte) []byte {
+	return data
+}
+
+// Options：返回 options
+func (p *Protocol) Options() Options {
+	return *p.opts
+}
+
+// fail：丢弃已经接收的数据并断开连接
+func (p *Protocol) fail(c *connection.Connection, s *Session, buffer *ringbuffer.RingBuffer, err error) {
+	buffer.RetrieveAll()
+	abort(c, s, err)
+}
+
+// abort：协议错误，MQTT 5.0 会先发送带原因码的 DISCONNECT，发送完之后关闭连接
+// 不支持的协议版本会回复 CONNACK
+func abort(c *connection.Connection, s *Session, err error) {
+	log.Error("[mqtt]", c.PeerAddr(), err)
+	s.closing = true
+
+	switch {
+	case err == ErrUnsupportedVersion:
+		_ = c.Send((&ConnAck{ReasonCode: UnsupportedProtocolVersion}).Encode(Version311))
+	case s.Version == Version5 && s.Connected():
+		_ = c.Send((&Disconnect{ReasonCode: reasonCode(err)}).Encode(Version5))
+	}
+	_ = c.CloseAfterFlush()
+}
@@ -0,0 +1,262 @@
+package mqtt
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/Dongxiem/fastnet/connection"
+	"github.com/Dongxiem/fastnet/eventloop"
+	"github.com/Dongxiem/fastnet/tool/ringbuffer"
+	"github.com/RussellLuo/timingwheel"
+)
+
+// connectPacket：构造 CONNECT 报文
+func connectPacket(version byte, clientID string, keepAlive uint16, props []byte) []byte {
+	var body []byte
+	if version == Version31 {
+		body = appendString(body, "MQIsdp")
+	} else {
+		body = appendString(body, "MQTT")
+	}
+	body = append(body, version, 0x02|0x04|0x08|0x80) // clean, will qos 1, username
+	body = appendUint16(body, keepAlive)
+	if version == Version5 {
+		body = append(body, props...)
+	}
+	body = appendString(body, clientID)
+	if version == Version5 {
+		body = append(body, 0) // will properties
+	}
+	body = appendString(body, "will/topic")
+	body = appendBinary(body, []byte("bye"))
+	body = appendString(body, "user")
+	return appendPacket(nil, byte(CONNECT)<<4, body)
+}
+
+func TestProtocol_UnPacket(t *testing.T) {
+	p := New()
+	c := connection.New(-1, nil, nil, p, nil, 0, nil)
+
+	var in []byte
+	in = append(in, connectPacket(Version311, "dev-1", 60, nil)...)
+	in = append(in, (&Publish{QoS: 1, Topic: "a/b", PacketID: 7, Payload: []byte("hi")}).Encode(Version311)...)
+	in = append(in, appendPacket(nil, byte(SUBSCRIBE)<<4|0x02, append(appendString(appendUint16(nil, 8), "a/#"), 1))...)
+	in = append(in, byte(PINGREQ)<<4, 0)
+	in = append(in, byte(DISCONNECT)<<4, 0)
+
+	// 让数据在 ring buffer 中跨越尾部与头部，并且逐字节写入
+	buffer := ringbuffer.New(128)
+	_, _ = buffer.Write(make([]byte, 100))
+	_, _ = buffer.Read(make([]byte, 100))
+
+	var got []Packet
+	for _, b := range in {
+		_ = buffer.WriteByte(b)
+		ctx, _ := p.UnPacket(c, buffer)
+		if ctx != nil {
+			got = append(got, ctx.(Packet))
+		}
+	}
+	if len(got) != 5 || buffer.Length() != 0 {
+		t.Fatalf("got %d packets, left %d", len(got), buffer.Length())
+	}
+
+	connect := got[0].(*Connect)
+	if connect.Version != Version311 || connect.ClientID != "dev-1" || connect.KeepAlive != 60 ||
+		!connect.CleanStart || connect.Username != "user" || connect.Password != nil ||
+		connect.Will == nil || connect.Will.QoS != 1 || string(connect.Will.Payload) != "bye" {
+		t.Fatalf("connect got %+v", connect)
+	}
+	publish := got[1].(*Publish)
+	if publish.QoS != 1 || publish.Topic != "a/b" || publish.PacketID != 7 || string(publish.Payload) != "hi" {
+		t.Fatalf("publish got %+v", publish)
+	}
+	subscribe := got[2].(*Subscribe)
+	if subscribe.PacketID != 8 || len(subscribe.Subscriptions) != 1 || subscribe.Subscriptions[0].Topic != "a/#" || subscribe.Subscriptions[0].QoS != 1 {
+		t.Fatalf("subscribe got %+v", subscribe)
+	}
+	if got[3].Type() != PINGREQ || got[4].Type() != DISCONNECT {
+		t.Fatalf("got %v %v", got[3].Type(), got[4].Type())
+	}
+}
+
+func TestProtocol_UnPacketV5(t *testing.T) {
+	p := New()
+	c := connection.New(-1, nil, nil, p, nil, 0, nil)
+
+	props := appendProperties(nil, Properties{
+		{ID: PropSessionExpiry, Int: 3600},
+		{ID: PropUserProperty, Key: "k", Str: "v"},
+	})
+	buffer := ringbuffer.New(128)
+	_, _ = buffer.Write(connectPacket(Version5, "dev-5", 30, props))
+	pub := &Publish{QoS: 2, Topic: "t", PacketID: 1, Properties: Properties{{ID: PropTopicAlias, Int: 3}}, Payload: []byte("x")}
+	_, _ = buffer.Write(pub.Encode(Version5))
+
+	ctx, _ := p.UnPacket(c, buffer)
+	connect := ctx.(*Connect)
+	if v, _ := connect.Properties.Int(PropSessionExpiry); v != 3600 || connect.Version != Version5 {
+		t.Fatalf("connect got %+v", connect)
+	}
+	if u, _ := connect.Properties.Get(PropUserProperty); u.Key != "k" || u.Str != "v" {
+		t.Fatalf("user property got %+v", u)
+	}
+
+	ctx, _ = p.UnPacket(c, buffer)
+	publish := ctx.(*Publish)
+	if alias, _ := publish.Properties.Int(PropTopicAlias); alias != 3 || !bytes.Equal(publish.Encode(Version5), pub.Encode(Version5)) {
+		t.Fatalf("publish got %+v", publish)
+	}
+}
+
+func TestProtocol_UnPacketError(t *testing.T) {
+	loop, err := eventloop.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	connect := connectPacket(Version311, "dev", 0, nil)
+	tests := []struct {
+		name string
+		in   []byte
+	}{
+		{"publish before connect", (&Publish{Topic: "a"}).Encode(Version311)},
+		{"unsupported version", connectPacket(6, "dev", 0, nil)},
+		{"invalid remaining length", []byte{byte(PINGREQ) << 4, 0xff, 0xff, 0xff, 0xff}},
+		{"packet too large", []byte{byte(PUBLISH) << 4, 0x81, 0x01}},
+		{"second connect", append(append([]byte{}, connect...), connect...)},
+		{"invalid flags", append(append([]byte{}, connect...), byte(PINGREQ)<<4|0x01, 0)},
+		{"wildcard topic", append(append([]byte{}, connect...), (&Publish{Topic: "a/+"}).Encode(Version311)...)},
+		{"qos 3", append(append([]byte{}, connect...), byte(PUBLISH)<<4|0x06, 3, 0, 1, 'a')},
+	}
+	for _, tt := range tests {
+		p := New(MaxPacketSize(128))
+		c := connection.New(-1, loop, nil, p, nil, 0, nil)
+		buffer := ringbuffer.New(256)
+		_, _ = buffer.Write(tt.in)
+
+		for buffer.Length() > 0 {
+			if ctx, _ := p.UnPacket(c, buffer); ctx == nil {
+				break
+			}
+		}
+		if s := GetSession(c); !s.closing || buffer.Length() != 0 {
+			t.Fatalf("%s: connection should be closing", tt.name)
+		}
+	}
+}
+
+func TestEncode(t *testing.T) {
+	tests := []struct {
+		name    string
+		p       Encoder
+		version byte
+		want    []byte
+	}{
+		{"connack v3", &ConnAck{ReasonCode: BadUserNameOrPassword}, Version311, []byte{0x20, 2, 0, 4}},
+		{"connack v5", &ConnAck{SessionPresent: true, Properties: Properties{{ID: PropServerKeepAlive, Int: 10}}}, Version5, []byte{0x20, 6, 1, 0, 3, 0x13, 0, 10}},
+		{"puback v5 success", &Ack{PacketType: PUBACK, PacketID: 5}, Version5, []byte{0x40, 2, 0, 5}},
+		{"pubrel", &Ack{PacketType: PUBREL, PacketID: 5}, Version311, []byte{0x62, 2, 0, 5}},
+		{"suback v3", &SubAck{PacketID: 1, ReasonCodes: []ReasonCode{GrantedQoS1, NotAuthorized}}, Version311, []byte{0x90, 4, 0, 1, 1, 0x80}},
+		{"unsuback v5", &UnsubAck{PacketID: 1, ReasonCodes: []ReasonCode{NoSubscriptionExisted}}, Version5, []byte{0xb0, 4, 0, 1, 0, 0x11}},
+		{"pingresp", &PingResp{}, Version311, []byte{0xd0, 0}},
+		{"disconnect v5", &Disconnect{ReasonCode: KeepAliveTimeout}, Version5, []byte{0xe0, 1, 0x8d}},
+	}
+	for _, tt := range tests {
+		if got := tt.p.Encode(tt.version); !bytes.Equal(got, tt.want) {
+			t.Fatalf("%s: got % x, want % x", tt.name, got, tt.want)
+		}
+	}
+
+	for _, v := range []uint32{0, 127, 128, 16383, 16384, maxRemainingLength} {
+		b := appendVarInt(nil, v)
+		if got, n := decodeVarInt(b); got != v || n != len(b) {
+			t.Fatalf("varint %d: got %d %d", v, got, n)
+		}
+	}
+}
+
+type handler struct {
+	published int
+}
+
+func (h *handler) OnConnect(c *connection.Connection) {}
+
+func (h *handler) OnMessage(c *connection.Connection, ctx interface{}, data []byte) []byte {
+	if _, ok := ctx.(*Publish); ok {
+		h.published++
+	}
+	return nil
+}
+
+func (h *handler) OnClose(c *connection.Connection) {}
+
+func TestHandlerWrap(t *testing.T) {
+	loop, err := eventloop.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tw := timingwheel.NewTimingWheel(time.Millisecond, 20)
+	tw.Start()
+	defer tw.Stop()
+
+	p := New(MaxKeepAlive(30))
+	h := &handler{}
+	wrap := NewHandlerWrap(p, h)
+
+	// MQTT 3.1.1 中 Client ID 为空且没有设置 Clean Session
+	c := connection.New(-1, loop, nil, p, tw, 0, wrap)
+	wrap.OnConnect(c)
+	out := wrap.OnMessage(c, &Connect{Version: Version311}, nil)
+	if !bytes.Equal(out, []byte{0x20, 2, 0, 2}) || !GetSession(c).closing {
+		t.Fatalf("connack got % x", out)
+	}
+
+	// MQTT 5.0 由服务端分配 Client ID，并限制 keep alive
+	c = connection.New(-1, loop, nil, p, tw, 0, wrap)
+	wrap.OnConnect(c)
+	GetSession(c).Version = Version5
+	out = wrap.OnMessage(c, &Connect{Version: Version5, KeepAlive: 600}, nil)
+	ack, err := decodeConnAck(out)
+	if err != nil || ack.ReasonCode != Success {
+		t.Fatalf("connack got % x", out)
+	}
+	s := GetSession(c)
+	if id, _ := ack.Properties.String(PropAssignedClientID); id == "" || id != s.ClientID || s.KeepAlive != 30 || !s.Connected() {
+		t.Fatalf("session got %+v", s)
+	}
+
+	if out = wrap.OnMessage(c, &PingReq{}, nil); !bytes.Equal(out, []byte{0xd0, 0}) {
+		t.Fatalf("pingresp got % x", out)
+	}
+
+	// QoS 2 消息在收到 PUBREL 之前重发，只会交给用户处理一次
+	pub := &Publish{QoS: 2, Topic: "a", PacketID: 9, Properties: Properties{{ID: PropTopicAlias, Int: 1}}}
+	for i := 0; i < 2; i++ {
+		if out = wrap.OnMessage(c, pub, nil); !bytes.Equal(out, []byte{0x50, 2, 0, 9}) {
+			t.Fatalf("pubrec got % x", out)
+		}
+	}
+	if out = wrap.OnMessage(c, &Ack{PacketType: PUBREL, PacketID: 9}, nil); !bytes.Equal(out, []byte{0x70, 2, 0, 9}) {
+		t.Fatalf("pubcomp got % x", out)
+	}
+	// 通过 Topic Alias 发布
+	_ = wrap.OnMessage(c, &Publish{Properties: Properties{{ID: PropTopicAlias, Int: 1}}}, nil)
+	if h.published != 2 {
+		t.Fatalf("published should be 2, but %d", h.published)
+	}
+
+	_ = wrap.OnMessage(c, &Publish{Properties: Properties{{ID: PropTopicAlias, Int: 2}}}, nil)
+	if !s.closing {
+		t.Fatal("unknown topic alias should close connection")
+	}
+}
+
+// decodeConnAck：测试使用，解码 MQTT 5.0 CONNACK
+func decodeConnAck(b []byte) (*ConnAck, error) {
+	r := &reader{b: b[2:]}
+	ack := &ConnAck{SessionPresent: r.readByte() == 1, ReasonCode: ReasonCode(r.readByte())}
+	ack.Properties = r.readProperties()
+	return ack, r.err
+}
@@ -0,0 +1,68 @@
+package mqtt
+
+import (
+	"time"
+
+	"github.com/Dongxiem/fastnet/connection"
+	"github.com/Dongxiem/fastnet/tool/sync/atomic"
+)
+
+const sessionKey = "fastnet_mqtt_session"
+
+// Session：MQTT 连接的会话状态，在收到 CONNECT 之后填充
+// 除 activeTime 与 connected 外，其余字段只在 loop 中修改
+type Session struct {
+	ClientID   string
+	Username   string
+	Version    byte   // 协议版本，收到 CONNECT 之前为 0
+	CleanStart bool   // MQTT 3.1.1 中为 Clean Session
+	KeepAlive  uint16 // 实际生效的 keep alive（秒）
+	// Will：遗嘱消息，收到正常的 DISCONNECT 之后会被清除，连接异常断开时由用户在 OnClose 中发布
+	Will *Will
+
+	connected  atomic.Bool
+	closing    bool
+	activeTime atomic.Int64
+	aliases    map[uint16]string   // 客户端的 Topic Alias
+	inflight   map[uint16]struct{} // 已经收到但尚未收到 PUBREL 的 QoS 2 消息
+}
+
+// Connected：是否已经完成 CONNECT
+func (s *Session) Connected() bool {
+	return s.connected.Get()
+}
+
+// alive：收到数据包，刷新存活时间
+func (s *Session) alive() {
+	_ = s.activeTime.Swap(time.Now().UnixNano())
+}
+
+// GetSession：获取连接的 MQTT 会话
+func GetSession(c *connection.Connection) *Session {
+	v, ok := c.Get(sessionKey)
+	if !ok {
+		return nil
+	}
+	return v.(*Session)
+}
+
+// getOrCreateSession：获取连接的 MQTT 会话，不存在则创建
+func getOrCreateSession(c *connection.Connection) *Session {
+	if s := GetSession(c); s != nil {
+		return s
+	}
+	s := &Session{}
+	s.alive()
+	c.Set(sessionKey, s)
+	return s
+}
+
+// Send：按照连接使用的协议版本编码报文并发送，可以在任意协程中调用
+func Send(c *connection.Connection, p Encoder) error {
+	var version byte
+	// connected 之前写入 Version，通过 connected 保证其他协程读取的可见性
+	if s := GetSession(c); s != nil && s.Connected() {
+		version = s.Version
+	}
+	return c.Send(p.Encode(version))
+}
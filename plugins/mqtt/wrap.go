@@ -0,0 +1,211 @@
+package mqtt
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/Dongxiem/fastnet/connection"
+	"github.com/Dongxiem/fastnet/log"
+)
+
+// maxTopicAlias：MQTT 5.0 中允许客户端使用的 Topic Alias 个数
+const maxTopicAlias = 64
+
+// Handler：用户注册接口，与 fastnet.Handler 一致
+// OnMessage 的 ctx 为解码后的报文，CONNECT 在回复 CONNACK 之后才会交给 OnMessage
+// PINGREQ、PUBREL 由 HandlerWrap 处理，不会交给 OnMessage
+// SUBSCRIBE、UNSUBSCRIBE 需要用户自行回复 SUBACK、UNSUBACK
+type Handler interface {
+	connection.CallBack
+	OnConnect(c *connection.Connection)
+}
+
+// Authenticator：Handler 可以实现该接口校验 CONNECT，返回 Success 以外的原因码则拒绝连接
+type Authenticator interface {
+	Authenticate(c *connection.Connection, p *Connect) ReasonCode
+}
+
+// HandlerWrap：MQTT Handler 包装，处理 CONNECT、keep alive 与 QoS 应答
+type HandlerWrap struct {
+	handler Handler
+	opts    *Options
+}
+
+// NewHandlerWrap：创建 MQTT Handler 包装，p 为同一 Server 使用的 MQTT Protocol
+func NewHandlerWrap(p *Protocol, handler Handler) *HandlerWrap {
+	return &HandlerWrap{
+		handler: handler,
+		opts:    p.opts,
+	}
+}
+
+// OnConnect：创建会话，ConnectTimeout 之内没有收到 CONNECT 则关闭连接
+func (h *HandlerWrap) OnConnect(c *connection.Connection) {
+	s := getOrCreateSession(c)
+	c.RunAfter(h.opts.ConnectTimeout, func() {
+		if !s.Connected() && c.Connected() {
+			log.Info("[mqtt] connect timeout: ", c.PeerAddr())
+			_ = c.Close()
+		}
+	})
+
+	h.handler.OnConnect(c)
+}
+
+// OnMessage wrap
+func (h *HandlerWrap) OnMessage(c *connection.Connection, ctx interface{}, data []byte) (out []byte) {
+	s := GetSession(c)
+	if s == nil || s.closing {
+		return
+	}
+
+	switch p := ctx.(type) {
+	case *Connect:
+		return h.connect(c, s, p, data)
+
+	case *PingReq:
+		return (&PingResp{}).Encode(s.Version)
+
+	case *Disconnect:
+		// MQTT 5.0 中原因码 0x04 表示断开连接时仍然需要发布遗嘱消息
+		if p.ReasonCode != 0x04 {
+			s.Will = nil
+		}
+		s.closing = true
+		out = h.handler.OnMessage(c, ctx, data)
+		_ = c.CloseAfterFlush()
+		return
+
+	case *Publish:
+		return h.publish(c, s, p, data)
+
+	case *Ack:
+		switch p.PacketType {
+		case PUBREL:
+			delete(s.inflight, p.PacketID)
+			return (&Ack{PacketType: PUBCOMP, PacketID: p.PacketID}).Encode(s.Version)
+		case PUBREC:
+			out = h.handler.OnMessage(c, ctx, data)
+			if p.ReasonCode < UnspecifiedError {
+				out = append(out, (&Ack{PacketType: PUBREL, PacketID: p.PacketID}).Encode(s.Version)...)
+			}
+			return
+		}
+	}
+
+	return h.handler.OnMessage(c, ctx, data)
+}
+
+// OnClose wrap，OnClose 中仍然可以通过 GetSession 获取会话，用于发布遗嘱消息
+func (h *HandlerWrap) OnClose(c *connection.Connection) {
+	h.handler.OnClose(c)
+	c.Delete(sessionKey)
+}
+
+// connect：处理 CONNECT，回复 CONNACK 并启动 keep alive 检测
+func (h *HandlerWrap) connect(c *connection.Connection, s *Session, p *Connect, data []byte) []byte {
+	ack := &ConnAck{}
+
+	// MQTT 3.1.1 中 Client ID 为空时必须设置 Clean Session，MQTT 5.0 中由服务端分配
+	clientID := p.ClientID
+	if clientID == "" {
+		if p.Version != Version5 && !p.CleanStart {
+			ack.ReasonCode = ClientIdentifierNotValid
+		} else if p.Version == Version5 {
+			clientID = "fastnet-" + strconv.FormatInt(c.ID(), 10)
+			ack.Properties = append(ack.Properties, Property{ID: PropAssignedClientID, Str: clientID})
+		}
+	}
+	if a, ok := h.handler.(Authenticator); ok && ack.ReasonCode == Success {
+		ack.ReasonCode = a.Authenticate(c, p)
+	}
+	if ack.ReasonCode != Success {
+		s.closing = true
+		_ = c.CloseAfterFlush()
+		ack.Properties = nil
+		return ack.Encode(p.Version)
+	}
+
+	keepAlive := p.KeepAlive
+	if p.Version == Version5 {
+		if max := h.opts.MaxKeepAlive; max > 0 && (keepAlive == 0 || keepAlive > max) {
+			keepAlive = max
+			ack.Properties = append(ack.Properties, Property{ID: PropServerKeepAlive, Int: uint32(max)})
+		}
+		ack.Properties = append(ack.Properties, Property{ID: PropTopicAliasMaximum, Int: maxTopicAlias})
+	}
+
+	s.ClientID = clientID
+	s.Username = p.Username
+	s.CleanStart = p.CleanStart
+	s.KeepAlive = keepAlive
+	s.Will = p.Will
+	s.connected.Set(true)
+
+	if keepAlive > 0 {
+		// 超过 1.5 倍 keep alive 没有收到任何报文则断开连接
+		timeout := time.Duration(keepAlive) * time.Second * 3 / 2
+		c.RunAfter(timeout, h.check(c, s, timeout))
+	}
+
+	out := ack.Encode(p.Version)
+	return append(out, h.handler.OnMessage(c, p, data)...)
+}
+
+// publish：解析 Topic Alias，处理 QoS 2 重复的消息，交给用户处理之后回复 PUBACK 或 PUBREC
+func (h *HandlerWrap) publish(c *connection.Connection, s *Session, p *Publish, data []byte) (out []byte) {
+	if alias, ok := p.Properties.Int(PropTopicAlias); ok {
+		if alias == 0 || alias > maxTopicAlias {
+			abort(c, s, ErrTopicAliasInvalid)
+			return
+		}
+		if s.aliases == nil {
+			s.aliases = make(map[uint16]string)
+		}
+		if p.Topic != "" {
+			s.aliases[uint16(alias)] = p.Topic
+		} else if p.Topic = s.aliases[uint16(alias)]; p.Topic == "" {
+			abort(c, s, ErrTopicAliasInvalid)
+			return
+		}
+	}
+
+	switch p.QoS {
+	case 0:
+		return h.handler.OnMessage(c, p, data)
+	case 1:
+		out = h.handler.OnMessage(c, p, data)
+		return append(out, (&Ack{PacketType: PUBACK, PacketID: p.PacketID}).Encode(s.Version)...)
+	default:
+		// 收到 PUBREL 之前重发的消息不再交给用户处理
+		if _, ok := s.inflight[p.PacketID]; !ok {
+			if s.inflight == nil {
+				s.inflight = make(map[uint16]struct{})
+			}
+			s.inflight[p.PacketID] = struct{}{}
+			out = h.handler.OnMessage(c, p, data)
+		}
+		return append(out, (&Ack{PacketType: PUBREC, PacketID: p.PacketID}).Encode(s.Version)...)
+	}
+}
+
+// check：keep alive 检测，timeout 内收到过报文则顺延，否则断开连接
+func (h *HandlerWrap) check(c *connection.Connection, s *Session, timeout time.Duration) func() {
+	return func() {
+		if !c.Connected() {
+			return
+		}
+
+		intervals := time.Since(time.Unix(0, s.activeTime.Get()))
+		if intervals < timeout {
+			c.RunAfter(timeout-intervals, h.check(c, s, timeout))
+			return
+		}
+
+		log.Info("[mqtt] keep alive timeout: ", c.PeerAddr())
+		if s.Version == Version5 {
+			_ = c.Send((&Disconnect{ReasonCode: KeepAliveTimeout}).Encode(Version5))
+		}
+		_ = c.CloseAfterFlush()
+	}
+}
@@ -0,0 +1,58 @@
+package protobuf
+
+import (
+	"github.com/Dongxiem/fastnet/connection"
+)
+
+// Options：protobuf 协议配置
+type Options struct {
+	MaxFrameLength int // 长度字段的最大值，即消息类型与消息体的总长度，超过则关闭连接
+	MaxTypeLength  int // 消息类型的最大长度，超过则关闭连接
+
+	OnError connection.ErrorHandler // 拆包出错时的回调，之后连接会被关闭
+}
+
+// Option ...
+type Option func(*Options)
+
+// newOptions：返回一个新的 Options 配置
+func newOptions(opt ...Option) *Options {
+	opts := Options{}
+
+	for _, o := range opt {
+		o(&opts)
+	}
+	// 默认最大 4M
+	if opts.MaxFrameLength <= 0 {
+		opts.MaxFrameLength = 4 * 1024 * 1024
+	}
+	if opts.MaxTypeLength <= 0 {
+		opts.MaxTypeLength = 256
+	}
+	if opts.OnError == nil {
+		opts.OnError = connection.LogError("[protobuf]")
+	}
+
+	return &opts
+}
+
+// MaxFrameLength：长度字段的最大值
+func MaxFrameLength(n int) Option {
+	return func(o *Options) {
+		o.MaxFrameLength = n
+	}
+}
+
+// MaxTypeLength：消息类型的最大长度
+func MaxTypeLength(n int) Option {
+	return func(o *Options) {
+		o.MaxTypeLength = n
+	}
+}
+
+// OnError：拆包出错时的回调
+func OnError(f func(c *connection.Connection, err error)) Option {
+	return func(o *Options) {
+		o.OnError = f
+	}
+}
@@ -1,8 +1,14 @@
 package protobuf
 
-import "encoding/binary"
+import (
+	"encoding/binary"
 
-// PackMessage：按自定义协议打包数据
+	"github.com/Dongxiem/fastnet/connection"
+	"github.com/golang/protobuf/proto"
+)
+
+// PackMessage：按自定义协议打包数据，得到包含长度字段的完整数据帧
+// 用于直接写入 socket 的客户端，不能作为 Connection.Send 的参数，服务端使用 EncodeMessage
 func PackMessage(msgType string, data []byte) []byte {
 	typeLen := len(msgType)
 	len := len(data) + typeLen + 2
@@ -16,3 +22,18 @@ func PackMessage(msgType string, data []byte) []byte {
 
 	return ret
 }
+
+// EncodeMessage：编码消息类型与消息体，不包含长度字段，由 Protocol.Packet 加上
+// OnMessage 的返回值以及 Connection.Send、Broadcast、SendToGroup 的参数都需要使用该格式
+func EncodeMessage(msgType string, data []byte) []byte {
+	return PackMessage(msgType, data)[4:]
+}
+
+// SendMessage：序列化 msg 并以其全名作为消息类型发送，可以在任意协程中调用
+func SendMessage(c *connection.Connection, msg proto.Message) error {
+	data, err := proto.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return c.Send(EncodeMessage(proto.MessageName(msg), data))
+}
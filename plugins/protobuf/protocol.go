@@ -1,11 +1,30 @@
 package protobuf
 
 import (
+	"encoding/binary"
+	"errors"
+
 	"github.com/Dongxiem/fastnet/connection"
 	"github.com/Dongxiem/fastnet/tool/ringbuffer"
-	"github.com/gobwas/pool/pbytes"
 )
 
+var _ connection.Protocol = &Protocol{}
+
+var (
+	// ErrFrameTooLong：长度字段超过 MaxFrameLength
+	ErrFrameTooLong = errors.New("protobuf: frame too long")
+	// ErrTypeTooLong：消息类型超过 MaxTypeLength
+	ErrTypeTooLong = errors.New("protobuf: message type too long")
+	// ErrInvalidFrame：长度字段小于消息类型占用的长度
+	ErrInvalidFrame = errors.New("protobuf: invalid frame")
+)
+
+// logPacketError：Packet 出错时记录日志，Broadcast 等调用 Packet 时 c 为 nil
+var logPacketError = connection.LogError("[protobuf]")
+
+// headerLen：4 字节长度字段与 2 字节消息类型长度
+const headerLen = 6
+
 // Message 数据帧定义
 type Message struct {
 	Len     uint32
@@ -16,41 +35,62 @@ type Message struct {
 
 // Protocol protobuf
 type Protocol struct {
+	opts *Options
 }
 
 // New 创建 protobuf Protocol
-func New() *Protocol {
-	return &Protocol{}
+func New(opts ...Option) *Protocol {
+	return &Protocol{opts: newOptions(opts...)}
 }
 
-// UnPacket：拆包
+// UnPacket：拆包，返回的 ctx 为消息类型，长度字段或消息类型长度不合法时关闭连接
 func (p *Protocol) UnPacket(c *connection.Connection, buffer *ringbuffer.RingBuffer) (ctx interface{}, out []byte) {
-	if buffer.Length() > 6 {
-		// 得到长度
-		len := int(buffer.PeekUint32())
-		if buffer.Length() >= len+4 {
-			buffer.Retrieve(4)
-
-			typeLen := int(buffer.PeekUint16())
-			buffer.Retrieve(2)
-
-			typeByte := pbytes.GetLen(typeLen)
-			_, _ = buffer.Read(typeByte)
-
-			dataLen := len - 2 - typeLen
-			data := make([]byte, dataLen)
-			_, _ = buffer.Read(data)
-
-			out = data
-			ctx = string(typeByte)
-			pbytes.Put(typeByte)
-		}
+	if buffer.Length() < headerLen {
+		return
 	}
 
-	return
+	var header [headerLen]byte
+	first, end := buffer.Peek(headerLen)
+	copy(header[copy(header[:], first):], end)
+	frameLen := int(binary.BigEndian.Uint32(header[:]))
+	typeLen := int(binary.BigEndian.Uint16(header[4:]))
+
+	// 在分配内存之前检查长度
+	switch {
+	case frameLen > p.opts.MaxFrameLength:
+		connection.CloseOnError(c, buffer, p.opts.OnError, ErrFrameTooLong)
+		return
+	case typeLen > p.opts.MaxTypeLength:
+		connection.CloseOnError(c, buffer, p.opts.OnError, ErrTypeTooLong)
+		return
+	case frameLen < 2+typeLen:
+		connection.CloseOnError(c, buffer, p.opts.OnError, ErrInvalidFrame)
+		return
+	}
+	if buffer.Length() < frameLen+4 {
+		return
+	}
+	buffer.Retrieve(headerLen)
+
+	typeByte := make([]byte, typeLen)
+	_, _ = buffer.Read(typeByte)
+	data := make([]byte, frameLen-2-typeLen)
+	_, _ = buffer.Read(data)
+
+	return string(typeByte), data
 }
 
-// Packet：装包
+// Packet：装包，在 data 前面加上长度字段，data 必须是 EncodeMessage 编码的消息类型与消息体
+// Packet 不会检查 data 的内容，OnMessage 的返回值以及 Send、Broadcast、SendToGroup 的参数都由调用方使用
+// EncodeMessage 编码，或者使用 SendMessage 发送；数据帧超过 MaxFrameLength 时丢弃并记录日志，c 可能为 nil
 func (p *Protocol) Packet(c *connection.Connection, data []byte) []byte {
-	return data
+	if len(data) > p.opts.MaxFrameLength {
+		logPacketError(c, ErrFrameTooLong)
+		return nil
+	}
+
+	ret := make([]byte, 4+len(data))
+	binary.BigEndian.PutUint32(ret, uint32(len(data)))
+	copy(ret[4:], data)
+	return ret
 }
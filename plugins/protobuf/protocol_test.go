@@ -0,0 +1,120 @@
+package protobuf
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Dongxiem/fastnet/connection"
+	"github.com/Dongxiem/fastnet/eventloop"
+	"github.com/Dongxiem/fastnet/tool/ringbuffer"
+)
+
+func TestProtocol_UnPacket(t *testing.T) {
+	p := New()
+	buffer := ringbuffer.New(4)
+	_, _ = buffer.Write(PackMessage("msg1", []byte("hello")))
+	_, _ = buffer.Write(PackMessage("", nil))
+	_, _ = buffer.Write(PackMessage("msg2", []byte("hi"))[:8])
+
+	want := []struct{ msgType, data string }{{"msg1", "hello"}, {"", ""}}
+	for _, w := range want {
+		ctx, out := p.UnPacket(nil, buffer)
+		if ctx != w.msgType || string(out) != w.data {
+			t.Fatalf("got %v %q, want %s %q", ctx, out, w.msgType, w.data)
+		}
+	}
+
+	// 数据帧不完整
+	if ctx, _ := p.UnPacket(nil, buffer); ctx != nil || buffer.Length() != 8 {
+		t.Fatal("frame should not be ready")
+	}
+	_, _ = buffer.Write(PackMessage("msg2", []byte("hi"))[8:])
+	if ctx, out := p.UnPacket(nil, buffer); ctx != "msg2" || string(out) != "hi" {
+		t.Fatalf("got %v %q", ctx, out)
+	}
+}
+
+func TestProtocol_UnPacketError(t *testing.T) {
+	loop, err := eventloop.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		in   []byte
+		err  error
+	}{
+		{"frame too long", []byte{0xff, 0xff, 0xff, 0xff, 0, 4}, ErrFrameTooLong},
+		{"type too long", []byte{0, 0, 0, 12, 0, 10, 'a'}, ErrTypeTooLong},
+		{"type longer than frame", []byte{0, 0, 0, 4, 0, 4, 'm', 's'}, ErrInvalidFrame},
+		{"frame shorter than header", []byte{0, 0, 0, 1, 0, 0, 'm'}, ErrInvalidFrame},
+	}
+	for _, tt := range tests {
+		var reported error
+		p := New(MaxFrameLength(1024), MaxTypeLength(8), OnError(func(c *connection.Connection, err error) {
+			reported = err
+		}))
+		c := connection.New(-1, loop, nil, p, nil, 0, nil)
+
+		buffer := ringbuffer.New(16)
+		_, _ = buffer.Write(tt.in)
+		if ctx, out := p.UnPacket(c, buffer); ctx != nil || out != nil {
+			t.Fatalf("%s: frame should be dropped", tt.name)
+		}
+		if reported != tt.err || buffer.Length() != 0 {
+			t.Fatalf("%s: got %v", tt.name, reported)
+		}
+	}
+}
+
+func TestProtocol_Packet(t *testing.T) {
+	loop, err := eventloop.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := New(MaxFrameLength(64), MaxTypeLength(8))
+	c := connection.New(-1, loop, nil, p, nil, 0, nil)
+
+	out := p.Packet(c, EncodeMessage("msg1", []byte("hello")))
+	if string(out) != string(PackMessage("msg1", []byte("hello"))) {
+		t.Fatalf("got % x", out)
+	}
+
+	data := EncodeMessage("msg1", []byte(strings.Repeat("a", 64)))
+	if out := p.Packet(c, data); out != nil {
+		t.Fatalf("% x should be dropped, got % x", data, out)
+	}
+}
+
+func TestProtocol_PacketNilConnection(t *testing.T) {
+	// Broadcast 与 SendToGroup 只装包一次，调用 Packet 时 c 为 nil
+	p := New(MaxFrameLength(64), MaxTypeLength(8))
+	out := p.Packet(nil, EncodeMessage("msg1", []byte("hello")))
+	if string(out) != string(PackMessage("msg1", []byte("hello"))) {
+		t.Fatalf("got % x", out)
+	}
+	if out := p.Packet(nil, EncodeMessage("msg1", []byte(strings.Repeat("a", 64)))); out != nil {
+		t.Fatalf("frame should be dropped, got % x", out)
+	}
+
+	// 默认的 OnError 也不能依赖连接
+	buffer := ringbuffer.New(16)
+	_, _ = buffer.Write([]byte{0xff, 0xff, 0xff, 0xff, 0, 4})
+	if ctx, out := p.UnPacket(nil, buffer); ctx != nil || out != nil || buffer.Length() != 0 {
+		t.Fatal("frame should be dropped")
+	}
+}
+
+func TestProtocol_PacketRoundTrip(t *testing.T) {
+	// Packet 不检查内容，消息体的任意长度与内容都原样装包
+	p := New()
+	for _, size := range []int{0, 1, 65530, 684138} {
+		body := []byte(strings.Repeat("a", size))
+		buffer := ringbuffer.New(1024)
+		_, _ = buffer.Write(p.Packet(nil, EncodeMessage("proto.Msg1", body)))
+		if ctx, out := p.UnPacket(nil, buffer); ctx != "proto.Msg1" || string(out) != string(body) {
+			t.Fatalf("size %d: got %v %d bytes", size, ctx, len(out))
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package protobuf
+
+import (
+	"sync"
+
+	"github.com/Dongxiem/fastnet/connection"
+	"github.com/Dongxiem/fastnet/log"
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+// HandlerFunc：消息处理方法，在连接所属的 loop 中执行，不能阻塞
+// 返回的消息不为 nil 时，以其全名作为消息类型回复
+type HandlerFunc func(c *connection.Connection, msg proto.Message) proto.Message
+
+// NotFoundFunc：处理没有注册 handler 或者不在 protobuf 注册表中的消息，返回值需要使用 EncodeMessage 编码
+type NotFoundFunc func(c *connection.Connection, msgType string, data []byte) []byte
+
+// Router：按照消息全名（例如 "proto.Msg1"）分发消息，并通过 protobuf 注册表自动反序列化
+// 实现了 fastnet Handler，也可以嵌入到自定义的 Handler 中
+type Router struct {
+	mu       sync.RWMutex
+	handlers map[string]HandlerFunc
+	NotFound NotFoundFunc
+}
+
+// NewRouter：创建消息路由
+func NewRouter() *Router {
+	return &Router{
+		handlers: make(map[string]HandlerFunc),
+		NotFound: func(c *connection.Connection, msgType string, data []byte) []byte {
+			log.Error("[protobuf] unknown message type:", msgType, c.PeerAddr())
+			return nil
+		},
+	}
+}
+
+// Handle：为消息全名注册 handler
+func (r *Router) Handle(msgType string, h HandlerFunc) {
+	r.mu.Lock()
+	r.handlers[msgType] = h
+	r.mu.Unlock()
+}
+
+// OnConnect wrap
+func (r *Router) OnConnect(c *connection.Connection) {}
+
+// OnMessage：ctx 为 Protocol 解析出的消息类型，反序列化之后交给对应的 handler 处理
+func (r *Router) OnMessage(c *connection.Connection, ctx interface{}, data []byte) []byte {
+	msgType, ok := ctx.(string)
+	if !ok {
+		return nil
+	}
+
+	r.mu.RLock()
+	h, ok := r.handlers[msgType]
+	r.mu.RUnlock()
+	if !ok {
+		return r.NotFound(c, msgType, data)
+	}
+	mt, err := protoregistry.GlobalTypes.FindMessageByName(protoreflect.FullName(msgType))
+	if err != nil {
+		return r.NotFound(c, msgType, data)
+	}
+
+	msg := proto.MessageV1(mt.New().Interface())
+	if err := proto.Unmarshal(data, msg); err != nil {
+		log.Error("[protobuf] unmarshal", msgType, err)
+		return nil
+	}
+
+	resp := h(c, msg)
+	if resp == nil {
+		return nil
+	}
+	out, err := proto.Marshal(resp)
+	if err != nil {
+		log.Error("[protobuf] marshal", proto.MessageName(resp), err)
+		return nil
+	}
+	return EncodeMessage(proto.MessageName(resp), out)
+}
+
+// OnClose wrap
+func (r *Router) OnClose(c *connection.Connection) {}
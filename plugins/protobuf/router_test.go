@@ -0,0 +1,57 @@
+package protobuf
+
+import (
+	"testing"
+
+	"github.com/Dongxiem/fastnet/connection"
+	"github.com/Dongxiem/fastnet/tool/ringbuffer"
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestRouter(t *testing.T) {
+	r := NewRouter()
+	r.Handle("google.protobuf.StringValue", func(c *connection.Connection, msg proto.Message) proto.Message {
+		return &wrapperspb.Int64Value{Value: int64(len(msg.(*wrapperspb.StringValue).Value))}
+	})
+	r.Handle("google.protobuf.BoolValue", func(c *connection.Connection, msg proto.Message) proto.Message {
+		return nil
+	})
+	r.Handle("unregistered.Message", func(c *connection.Connection, msg proto.Message) proto.Message {
+		t.Fatal("unregistered message should not be handled")
+		return nil
+	})
+	var unknown []string
+	r.NotFound = func(c *connection.Connection, msgType string, data []byte) []byte {
+		unknown = append(unknown, msgType)
+		return nil
+	}
+
+	p := New()
+	c := connection.New(-1, nil, nil, p, nil, 0, r)
+	data, _ := proto.Marshal(&wrapperspb.StringValue{Value: "fastnet"})
+
+	// 处理结果以 handler 返回消息的全名回复
+	buffer := ringbuffer.NewWithData(PackMessage("google.protobuf.StringValue", data))
+	ctx, payload := p.UnPacket(c, buffer)
+	out := r.OnMessage(c, ctx, payload)
+	ctx, payload = p.UnPacket(c, ringbuffer.NewWithData(p.Packet(c, out)))
+	resp := &wrapperspb.Int64Value{}
+	if err := proto.Unmarshal(payload, resp); err != nil || ctx != "google.protobuf.Int64Value" || resp.Value != 7 {
+		t.Fatalf("got %v %v %v", ctx, resp, err)
+	}
+
+	if out := r.OnMessage(c, "google.protobuf.BoolValue", nil); out != nil {
+		t.Fatalf("got % x", out)
+	}
+	// 反序列化失败时丢弃消息
+	if out := r.OnMessage(c, "google.protobuf.StringValue", []byte{0xff}); out != nil {
+		t.Fatalf("got % x", out)
+	}
+
+	r.OnMessage(c, "google.protobuf.Int32Value", nil)
+	r.OnMessage(c, "unregistered.Message", nil)
+	if len(unknown) != 2 || unknown[0] != "google.protobuf.Int32Value" || unknown[1] != "unregistered.Message" {
+		t.Fatalf("got %v", unknown)
+	}
+}
@@ -0,0 +1,96 @@
+package pubsub
+
+import (
+	"sync"
+
+	"github.com/Dongxiem/fastnet/connection"
+)
+
+// Broker：进程内主题发布订阅
+type Broker struct {
+	mu   sync.RWMutex
+	root *node
+	subs map[*connection.Connection]*Subscriber
+}
+
+// New：创建 Broker
+func New() *Broker {
+	return &Broker{
+		root: newNode(),
+		subs: make(map[*connection.Connection]*Subscriber),
+	}
+}
+
+// Subscribe：连接订阅主题，pattern 支持 `a.*.c` 与 `a.>` 通配符
+// opts 只在连接第一次订阅、创建订阅者时生效，之后不再修改，连接关闭时自动取消所有订阅
+func (b *Broker) Subscribe(c *connection.Connection, pattern string, opts ...Option) (*Subscriber, error) {
+	tokens, err := splitPattern(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	b.mu.Lock()
+	s, ok := b.subs[c]
+	if !ok {
+		s = newSubscriber(c, opts...)
+		b.subs[c] = s
+	}
+	if _, ok := s.patterns[pattern]; !ok {
+		s.patterns[pattern] = tokens
+		b.root.insert(tokens, s)
+	}
+	b.mu.Unlock()
+
+	// 如果连接已经关闭，AddCloseHook 会立即执行回调，所以不能持有锁
+	if !ok {
+		c.AddDrainHook(s.drained)
+		c.AddCloseHook(b.UnsubscribeAll)
+	}
+	return s, nil
+}
+
+// Unsubscribe：取消订阅主题
+func (b *Broker) Unsubscribe(c *connection.Connection, pattern string) {
+	b.mu.Lock()
+	if s, ok := b.subs[c]; ok {
+		if tokens, ok := s.patterns[pattern]; ok {
+			delete(s.patterns, pattern)
+			b.root.remove(tokens, s)
+		}
+	}
+	b.mu.Unlock()
+}
+
+// UnsubscribeAll：取消连接的所有订阅
+func (b *Broker) UnsubscribeAll(c *connection.Connection) {
+	b.mu.Lock()
+	if s, ok := b.subs[c]; ok {
+		for _, tokens := range s.patterns {
+			b.root.remove(tokens, s)
+		}
+		delete(b.subs, c)
+	}
+	b.mu.Unlock()
+}
+
+// Publish：发布消息，可以在任意协程中调用，返回成功投递的订阅者个数
+// payload 会经过订阅连接的 Protocol.Packet 封装，并在连接所属的 loop 中发送
+func (b *Broker) Publish(topic string, payload []byte) (int, error) {
+	tokens, err := splitTopic(topic)
+	if err != nil {
+		return 0, err
+	}
+
+	matched := make(map[*Subscriber]struct{})
+	b.mu.RLock()
+	b.root.match(tokens, matched)
+	b.mu.RUnlock()
+
+	n := 0
+	for s := range matched {
+		if s.deliver(payload) {
+			n++
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,237 @@
+package pubsub
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Dongxiem/fastnet/connection"
+	"github.com/Dongxiem/fastnet/eventloop"
+	"golang.org/x/sys/unix"
+)
+
+type callback struct{}
+
+func (callback) OnMessage(c *connection.Connection, ctx interface{}, data []byte) []byte { return nil }
+
+func (callback) OnClose(c *connection.Connection) {}
+
+func newLoop(t *testing.T) *eventloop.EventLoop {
+	loop, err := eventloop.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	go loop.RunLoop()
+	t.Cleanup(func() {
+		_ = loop.Stop()
+	})
+	return loop
+}
+
+// newConn：创建 socketpair 上的连接，返回连接与对端的 fd
+func newConn(t *testing.T, loop *eventloop.EventLoop) (*connection.Connection, int) {
+	fds, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_STREAM, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = unix.SetNonblock(fds[0], true)
+	_ = unix.SetsockoptTimeval(fds[1], unix.SOL_SOCKET, unix.SO_RCVTIMEO, &unix.Timeval{Sec: 2})
+	t.Cleanup(func() {
+		_ = unix.Close(fds[1])
+	})
+
+	c := connection.New(fds[0], loop, nil, &connection.DefaultProtocol{}, nil, 0, callback{})
+	if err = loop.AddSocketAndEnableRead(fds[0], c); err != nil {
+		t.Fatal(err)
+	}
+	return c, fds[1]
+}
+
+// newSlowConn：对端不读取数据，发送缓冲区很小，大消息会积压在写 buffer 中
+func newSlowConn(t *testing.T, loop *eventloop.EventLoop) (*connection.Connection, int) {
+	c, fd := newConn(t, loop)
+	_ = unix.SetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_RCVBUF, 4096)
+	return c, fd
+}
+
+// read：读取一次对端收到的数据，超时返回空
+func read(fd int, timeout time.Duration) string {
+	tv := unix.NsecToTimeval(timeout.Nanoseconds())
+	_ = unix.SetsockoptTimeval(fd, unix.SOL_SOCKET, unix.SO_RCVTIMEO, &tv)
+	buf := make([]byte, 64)
+	n, err := unix.Read(fd, buf)
+	if err != nil || n <= 0 {
+		return ""
+	}
+	return string(buf[:n])
+}
+
+// readN：对端读取 n 个字节
+func readN(t *testing.T, fd int, n int) {
+	buf := make([]byte, 64*1024)
+	total := 0
+	for total < n {
+		m, err := unix.Read(fd, buf)
+		if err != nil {
+			t.Fatalf("read %d bytes: %v", total, err)
+		}
+		total += m
+	}
+}
+
+// waitDrained：等待写 buffer 发送完毕
+func waitDrained(t *testing.T, s *Subscriber) {
+	deadline := time.Now().Add(time.Second)
+	for s.backlog() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("backlog should be drained, got %d", s.backlog())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// waitClosed：等待连接关闭
+func waitClosed(t *testing.T, c *connection.Connection) {
+	deadline := time.Now().Add(time.Second)
+	for c.Connected() {
+		if time.Now().After(deadline) {
+			t.Fatal("connection should be closed")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestBroker_Publish(t *testing.T) {
+	loop := newLoop(t)
+	b := New()
+	c1, fd1 := newConn(t, loop)
+	c2, fd2 := newConn(t, loop)
+	c3, fd3 := newConn(t, loop)
+	for c, pattern := range map[*connection.Connection]string{c1: "news.*", c2: "news.>", c3: "sports.*"} {
+		if _, err := b.Subscribe(c, pattern); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if n, err := b.Publish("news.tech", []byte("go")); n != 2 || err != nil {
+		t.Fatalf("expect 2 but got %d %v", n, err)
+	}
+	for _, fd := range []int{fd1, fd2} {
+		if got := read(fd, time.Second); got != "go" {
+			t.Fatalf("expect go but got %q", got)
+		}
+	}
+	if got := read(fd3, 20*time.Millisecond); got != "" {
+		t.Fatalf("sports.* should not match, but got %q", got)
+	}
+	if _, err := b.Publish("news.*", nil); err != ErrInvalidTopic {
+		t.Fatalf("expect ErrInvalidTopic but got %v", err)
+	}
+
+	b.Unsubscribe(c1, "news.*")
+	if n, _ := b.Publish("news.tech.go", []byte("x")); n != 1 {
+		t.Fatalf("expect 1 but got %d", n)
+	}
+
+	// 连接关闭时自动取消订阅
+	_ = c2.Close()
+	waitClosed(t, c2)
+	if n, _ := b.Publish("news.tech", []byte("x")); n != 0 {
+		t.Fatalf("expect 0 but got %d", n)
+	}
+}
+
+func TestSubscriber_SlowConsumer(t *testing.T) {
+	loop := newLoop(t)
+	payload := make([]byte, 256*1024)
+
+	t.Run("drop", func(t *testing.T) {
+		b := New()
+		c, fd := newSlowConn(t, loop)
+		s, _ := b.Subscribe(c, "a", MaxPending(1024), SlowConsumer(PolicyDrop))
+
+		// 积压为 0 时总是投递，之后超过 MaxPending 的消息被丢弃
+		if n, _ := b.Publish("a", payload); n != 1 {
+			t.Fatalf("expect 1 but got %d", n)
+		}
+		if n, _ := b.Publish("a", payload); n != 0 || s.Dropped() != 1 || !c.Connected() {
+			t.Fatalf("expect dropped, got %d %d", n, s.Dropped())
+		}
+
+		// 对端读取之后不再积压，之后的消息正常投递
+		readN(t, fd, len(payload))
+		waitDrained(t, s)
+		if n, _ := b.Publish("a", []byte("x")); n != 1 || s.Dropped() != 1 {
+			t.Fatalf("expect delivered, got %d %d", n, s.Dropped())
+		}
+	})
+
+	t.Run("disconnect after drained", func(t *testing.T) {
+		b := New()
+		c, fd := newSlowConn(t, loop)
+		s, _ := b.Subscribe(c, "a", MaxPending(1024), SlowConsumer(PolicyDisconnect))
+
+		if n, _ := b.Publish("a", payload); n != 1 {
+			t.Fatalf("expect 1 but got %d", n)
+		}
+		readN(t, fd, len(payload))
+		waitDrained(t, s)
+		if n, _ := b.Publish("a", []byte("x")); n != 1 || !c.Connected() {
+			t.Fatalf("caught-up consumer should not be disconnected, got %d", n)
+		}
+	})
+
+	t.Run("disconnect", func(t *testing.T) {
+		b := New()
+		c, _ := newSlowConn(t, loop)
+		_, _ = b.Subscribe(c, "a", MaxPending(1024), SlowConsumer(PolicyDisconnect))
+
+		if n, _ := b.Publish("a", payload); n != 1 {
+			t.Fatalf("expect 1 but got %d", n)
+		}
+		if n, _ := b.Publish("a", payload); n != 0 {
+			t.Fatalf("expect 0 but got %d", n)
+		}
+		waitClosed(t, c)
+	})
+
+	t.Run("block", func(t *testing.T) {
+		b := New()
+		c, fd := newSlowConn(t, loop)
+		_, _ = b.Subscribe(c, "a", MaxPending(1024), SlowConsumer(PolicyBlock))
+
+		if n, _ := b.Publish("a", payload); n != 1 {
+			t.Fatalf("expect 1 but got %d", n)
+		}
+		done := make(chan int, 1)
+		go func() {
+			n, _ := b.Publish("a", payload)
+			done <- n
+		}()
+		select {
+		case <-done:
+			t.Fatal("Publish should block while the peer is not reading")
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		// 对端读取之后写 buffer 清空，Publish 继续投递
+		readN(t, fd, 2*len(payload))
+		select {
+		case n := <-done:
+			if n != 1 {
+				t.Fatalf("expect 1 but got %d", n)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Publish should return after the peer drains")
+		}
+	})
+
+	t.Run("options are fixed at creation", func(t *testing.T) {
+		b := New()
+		c, _ := newSlowConn(t, loop)
+		s, _ := b.Subscribe(c, "a", MaxPending(1024))
+		_, _ = b.Subscribe(c, "b", SlowConsumer(PolicyDisconnect))
+		if s.opts.MaxPending != 1024 || s.opts.Policy != PolicyDrop {
+			t.Fatalf("got %+v", s.opts)
+		}
+	})
+}
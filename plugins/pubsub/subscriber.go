@@ -0,0 +1,143 @@
+package pubsub
+
+import (
+	"time"
+
+	"github.com/Dongxiem/fastnet/connection"
+	"github.com/Dongxiem/fastnet/tool/sync/atomic"
+)
+
+// Policy：慢消费者处理策略
+type Policy int
+
+const (
+	// PolicyDrop：丢弃消息
+	PolicyDrop Policy = iota
+	// PolicyDisconnect：关闭连接
+	PolicyDisconnect
+	// PolicyBlock：阻塞 Publish 直到写 buffer 有空间，不能在 loop 中调用 Publish
+	PolicyBlock
+)
+
+// Options：订阅者配置
+type Options struct {
+	MaxPending int    // 写 buffer 中最多积压的字节数，0 表示不限制
+	Policy     Policy // 超过 MaxPending 时的处理策略
+}
+
+// Option ...
+type Option func(*Options)
+
+// MaxPending：写 buffer 中最多积压的字节数
+func MaxPending(n int) Option {
+	return func(o *Options) {
+		o.MaxPending = n
+	}
+}
+
+// SlowConsumer：超过 MaxPending 时的处理策略
+func SlowConsumer(p Policy) Option {
+	return func(o *Options) {
+		o.Policy = p
+	}
+}
+
+// Subscriber：订阅者，每个连接对应一个
+type Subscriber struct {
+	conn     *connection.Connection
+	opts     Options // 创建之后只读，deliver 在任意协程中读取
+	patterns map[string][]string // 已订阅的主题
+
+	pending atomic.Int64 // 已经投递给 loop 但尚未写入 buffer 的字节数
+	outLen  atomic.Int64 // 最近一次在 loop 中观察到的写 buffer 长度，写 buffer 发送完毕时清零
+	dropped atomic.Int64 // 被丢弃的消息个数
+}
+
+// newSubscriber：创建订阅者
+func newSubscriber(c *connection.Connection, opts ...Option) *Subscriber {
+	s := &Subscriber{
+		conn:     c,
+		patterns: make(map[string][]string),
+	}
+	for _, o := range opts {
+		o(&s.opts)
+	}
+	return s
+}
+
+// Conn：返回订阅者对应的连接
+func (s *Subscriber) Conn() *connection.Connection {
+	return s.conn
+}
+
+// Dropped：返回被丢弃的消息个数
+func (s *Subscriber) Dropped() int64 {
+	return s.dropped.Get()
+}
+
+// backlog：当前积压的字节数
+func (s *Subscriber) backlog() int64 {
+	return s.pending.Get() + s.outLen.Get()
+}
+
+// deliver：投递消息，返回是否投递成功
+func (s *Subscriber) deliver(payload []byte) bool {
+	n := int64(len(payload))
+	if s.opts.MaxPending > 0 {
+		for {
+			backlog := s.backlog()
+			// 积压为 0 时总是允许投递，避免大于 MaxPending 的消息永远无法发送
+			if backlog == 0 || backlog+n <= int64(s.opts.MaxPending) {
+				break
+			}
+
+			switch s.opts.Policy {
+			case PolicyDisconnect:
+				_ = s.conn.Close()
+				return false
+			case PolicyBlock:
+				if !s.wait() {
+					return false
+				}
+			default:
+				_ = s.dropped.Add(1)
+				return false
+			}
+		}
+	}
+
+	_ = s.pending.Add(n)
+	if err := s.conn.Send(payload); err != nil {
+		_ = s.pending.Add(-n)
+		return false
+	}
+	// QueueInLoop 按顺序执行，此时 payload 已经写入 fd 或写 buffer
+	s.conn.QueueInLoop(func() {
+		_ = s.pending.Add(-n)
+		_ = s.outLen.Swap(int64(s.conn.OutBufferLength()))
+	})
+	return true
+}
+
+// drained：写 buffer 发送完毕，之前观察到的积压已经不存在，否则 Drop 与 Disconnect 策略会一直按照过期的长度处理
+func (s *Subscriber) drained(c *connection.Connection) {
+	_ = s.outLen.Swap(0)
+}
+
+// wait：在 loop 中刷新写 buffer 长度，仍然积压则稍后重试，连接已关闭时返回 false
+func (s *Subscriber) wait() bool {
+	if !s.conn.Connected() {
+		return false
+	}
+	done := make(chan struct{})
+	s.conn.QueueInLoop(func() {
+		_ = s.outLen.Swap(int64(s.conn.OutBufferLength()))
+		close(done)
+	})
+	<-done
+
+	if s.backlog() > 0 {
+		time.Sleep(time.Millisecond)
+	}
+	return s.conn.Connected()
+}
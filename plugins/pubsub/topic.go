@@ -0,0 +1,114 @@
+package pubsub
+
+import (
+	"errors"
+	"strings"
+)
+
+const (
+	tokenSep = "."
+	wildOne  = "*" // 匹配一个层级
+	wildRest = ">" // 匹配剩余的一个或多个层级，只能出现在最后
+)
+
+var (
+	// ErrInvalidPattern：订阅主题格式错误
+	ErrInvalidPattern = errors.New("pubsub: invalid subscription pattern")
+	// ErrInvalidTopic：发布主题格式错误
+	ErrInvalidTopic = errors.New("pubsub: invalid publish topic")
+)
+
+// splitPattern：解析订阅主题，支持 `a.*.c` 与 `a.>` 通配符
+func splitPattern(pattern string) ([]string, error) {
+	tokens := strings.Split(pattern, tokenSep)
+	for i, t := range tokens {
+		if len(t) == 0 {
+			return nil, ErrInvalidPattern
+		}
+		if t == wildRest && i != len(tokens)-1 {
+			return nil, ErrInvalidPattern
+		}
+	}
+	return tokens, nil
+}
+
+// splitTopic：解析发布主题，不允许包含通配符
+func splitTopic(topic string) ([]string, error) {
+	tokens := strings.Split(topic, tokenSep)
+	for _, t := range tokens {
+		if len(t) == 0 || t == wildOne || t == wildRest {
+			return nil, ErrInvalidTopic
+		}
+	}
+	return tokens, nil
+}
+
+// node：主题树节点
+type node struct {
+	children map[string]*node
+	subs     map[*Subscriber]struct{}
+}
+
+func newNode() *node {
+	return &node{
+		children: make(map[string]*node),
+		subs:     make(map[*Subscriber]struct{}),
+	}
+}
+
+// empty：节点是否可以删除
+func (n *node) empty() bool {
+	return len(n.children) == 0 && len(n.subs) == 0
+}
+
+// insert：添加订阅
+func (n *node) insert(tokens []string, s *Subscriber) {
+	cur := n
+	for _, t := range tokens {
+		child, ok := cur.children[t]
+		if !ok {
+			child = newNode()
+			cur.children[t] = child
+		}
+		cur = child
+	}
+	cur.subs[s] = struct{}{}
+}
+
+// remove：删除订阅，并清理空节点
+func (n *node) remove(tokens []string, s *Subscriber) {
+	if len(tokens) == 0 {
+		delete(n.subs, s)
+		return
+	}
+	child, ok := n.children[tokens[0]]
+	if !ok {
+		return
+	}
+	child.remove(tokens[1:], s)
+	if child.empty() {
+		delete(n.children, tokens[0])
+	}
+}
+
+// match：查找所有匹配 tokens 的订阅者，结果去重后放入 out
+func (n *node) match(tokens []string, out map[*Subscriber]struct{}) {
+	if len(tokens) == 0 {
+		for s := range n.subs {
+			out[s] = struct{}{}
+		}
+		return
+	}
+	// `>` 匹配剩余所有层级
+	if child, ok := n.children[wildRest]; ok {
+		for s := range child.subs {
+			out[s] = struct{}{}
+		}
+	}
+	if child, ok := n.children[wildOne]; ok {
+		child.match(tokens[1:], out)
+	}
+	if child, ok := n.children[tokens[0]]; ok {
+		child.match(tokens[1:], out)
+	}
+}
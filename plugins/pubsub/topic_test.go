@@ -0,0 +1,74 @@
+package pubsub
+
+import (
+	"testing"
+)
+
+func TestSplitPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		ok      bool
+	}{
+		{"a.b.c", true},
+		{"a.*.c", true},
+		{"a.>", true},
+		{">", true},
+		{"a..c", false},
+		{"a.>.c", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if _, err := splitPattern(tt.pattern); (err == nil) != tt.ok {
+			t.Fatalf("pattern %q: err %v", tt.pattern, err)
+		}
+	}
+
+	if _, err := splitTopic("a.*.c"); err != ErrInvalidTopic {
+		t.Fatalf("err should be ErrInvalidTopic, but %v", err)
+	}
+}
+
+func TestNode_Match(t *testing.T) {
+	root := newNode()
+	subs := map[string]*Subscriber{}
+	for _, p := range []string{"a.b.c", "a.*.c", "a.>", "*.b.*", "x.y"} {
+		tokens, err := splitPattern(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		subs[p] = &Subscriber{}
+		root.insert(tokens, subs[p])
+	}
+
+	tests := []struct {
+		topic string
+		want  []string
+	}{
+		{"a.b.c", []string{"a.b.c", "a.*.c", "a.>", "*.b.*"}},
+		{"a.x.c", []string{"a.*.c", "a.>"}},
+		{"a", nil},
+		{"a.b", []string{"a.>"}},
+		{"z.b.z", []string{"*.b.*"}},
+		{"x.y", []string{"x.y"}},
+		{"x.y.z", nil},
+	}
+	for _, tt := range tests {
+		tokens, _ := splitTopic(tt.topic)
+		out := make(map[*Subscriber]struct{})
+		root.match(tokens, out)
+		if len(out) != len(tt.want) {
+			t.Fatalf("topic %q: matched %d, want %d", tt.topic, len(out), len(tt.want))
+		}
+		for _, p := range tt.want {
+			if _, ok := out[subs[p]]; !ok {
+				t.Fatalf("topic %q should match %q", tt.topic, p)
+			}
+		}
+	}
+
+	tokens, _ := splitPattern("a.>")
+	root.remove(tokens, subs["a.>"])
+	if _, ok := root.children["a"].children[">"]; ok {
+		t.Fatal("empty node should be removed")
+	}
+}
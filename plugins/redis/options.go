@@ -0,0 +1,65 @@
+package redis
+
+// Options：RESP 解析配置
+type Options struct {
+	MaxBulkLength int // Bulk String 的最大长度
+	MaxElements   int // 聚合类型的最大元素个数
+	MaxLineLength int // 类型行与 inline command 的最大长度
+	MaxDepth      int // 聚合类型的最大嵌套层数
+}
+
+// Option ...
+type Option func(*Options)
+
+// newOptions：返回一个新的 Options 配置
+func newOptions(opt ...Option) *Options {
+	opts := Options{}
+
+	for _, o := range opt {
+		o(&opts)
+	}
+	// 与 redis 默认的 proto-max-bulk-len 一致
+	if opts.MaxBulkLength <= 0 {
+		opts.MaxBulkLength = 512 * 1024 * 1024
+	}
+	if opts.MaxElements <= 0 {
+		opts.MaxElements = 1024 * 1024
+	}
+	// 与 redis 的 PROTO_INLINE_MAX_SIZE 一致
+	if opts.MaxLineLength <= 0 {
+		opts.MaxLineLength = 64 * 1024
+	}
+	if opts.MaxDepth <= 0 {
+		opts.MaxDepth = 32
+	}
+
+	return &opts
+}
+
+// MaxBulkLength：Bulk String 的最大长度
+func MaxBulkLength(n int) Option {
+	return func(o *Options) {
+		o.MaxBulkLength = n
+	}
+}
+
+// MaxElements：聚合类型的最大元素个数
+func MaxElements(n int) Option {
+	return func(o *Options) {
+		o.MaxElements = n
+	}
+}
+
+// MaxLineLength：类型行与 inline command 的最大长度
+func MaxLineLength(n int) Option {
+	return func(o *Options) {
+		o.MaxLineLength = n
+	}
+}
+
+// MaxDepth：聚合类型的最大嵌套层数
+func MaxDepth(n int) Option {
+	return func(o *Options) {
+		o.MaxDepth = n
+	}
+}
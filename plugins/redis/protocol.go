@@ -0,0 +1,278 @@
+package redis
+
+import (
+	"bytes"
+	"errors"
+	"strconv"
+
+	"github.com/Dongxiem/fastnet/connection"
+	"github.com/Dongxiem/fastnet/log"
+	"github.com/Dongxiem/fastnet/tool/ringbuffer"
+)
+
+var _ connection.Protocol = &Protocol{}
+
+// closingKey：协议出错，连接准备关闭，之后收到的数据全部丢弃
+const closingKey = "fastnet_redis_closing"
+
+// attribute：RESP3 属性类型，解析时直接丢弃
+const attribute = '|'
+
+// maxPrealloc：聚合类型最多预分配的元素个数
+const maxPrealloc = 16
+
+// ProtocolError：RESP 协议错误
+type ProtocolError string
+
+func (p ProtocolError) Error() string { return string(p) }
+
+var (
+	errIncomplete = errors.New("redis: incomplete value")
+
+	ErrInvalidLine     = ProtocolError("invalid line")
+	ErrInvalidLength   = ProtocolError("invalid length")
+	ErrInvalidInteger  = ProtocolError("invalid integer")
+	ErrInvalidBoolean  = ProtocolError("invalid boolean")
+	ErrLineTooLong     = ProtocolError("line too long")
+	ErrBulkTooLong     = ProtocolError("bulk length exceeds limit")
+	ErrTooManyElements = ProtocolError("too many elements")
+	ErrTooDeep         = ProtocolError("nesting too deep")
+)
+
+// Protocol：RESP2/RESP3 协议
+type Protocol struct {
+	opts *Options
+}
+
+// New：创建 redis Protocol
+func New(opts ...Option) *Protocol {
+	return &Protocol{opts: newOptions(opts...)}
+}
+
+// UnPacket：拆包，返回的 ctx 为 *Value
+// 使用 VirtualRead 解析，数据不完整时 VirtualRevert，等待下一次读事件
+func (p *Protocol) UnPacket(c *connection.Connection, buffer *ringbuffer.RingBuffer) (ctx interface{}, out []byte) {
+	if _, ok := c.Get(closingKey); ok {
+		buffer.RetrieveAll()
+		return
+	}
+
+	for buffer.Length() > 0 {
+		v, err := p.read(buffer, 0)
+		if err == errIncomplete {
+			buffer.VirtualRevert()
+			return
+		}
+		if err != nil {
+			buffer.VirtualRevert()
+			p.fail(c, buffer, err)
+			return
+		}
+		buffer.VirtualFlush()
+		// 空的 inline command 直接跳过
+		if v != nil {
+			return v, nil
+		}
+	}
+	return
+}
+
+// Packet：直接返回，回复由 Append 系列方法编码
+func (p *Protocol) Packet(c *connection.Connection, data []byte) []byte {
+	return data
+}
+
+// fail：回复协议错误，发送完之后关闭连接
+func (p *Protocol) fail(c *connection.Connection, buffer *ringbuffer.RingBuffer, err error) {
+	buffer.RetrieveAll()
+	log.Error("[redis]", c.PeerAddr(), err)
+
+	c.Set(closingKey, true)
+	_ = c.Send(AppendError(nil, "ERR Protocol error: "+err.Error()))
+	_ = c.CloseAfterFlush()
+}
+
+// read：读取一个完整的 Value
+func (p *Protocol) read(buffer *ringbuffer.RingBuffer, depth int) (*Value, error) {
+	var b [1]byte
+	if _, err := buffer.VirtualRead(b[:]); err != nil {
+		return nil, errIncomplete
+	}
+	t := Type(b[0])
+
+	switch t {
+	case SimpleString, Error, Double, BigNumber:
+		line, err := p.readLine(buffer, false)
+		if err != nil {
+			return nil, err
+		}
+		return &Value{Type: t, Str: line}, nil
+
+	case Integer:
+		n, err := p.readInt(buffer)
+		if err != nil {
+			return nil, err
+		}
+		return &Value{Type: t, Int: n}, nil
+
+	case Null:
+		line, err := p.readLine(buffer, false)
+		if err != nil {
+			return nil, err
+		}
+		if len(line) != 0 {
+			return nil, ErrInvalidLine
+		}
+		return &Value{Type: t}, nil
+
+	case Boolean:
+		line, err := p.readLine(buffer, false)
+		if err != nil {
+			return nil, err
+		}
+		if len(line) != 1 || (line[0] != 't' && line[0] != 'f') {
+			return nil, ErrInvalidBoolean
+		}
+		return &Value{Type: t, Bool: line[0] == 't'}, nil
+
+	case BulkString, BulkError, VerbatimString:
+		return p.readBulk(buffer, t)
+
+	case Array, Set, Push, Map, attribute:
+		return p.readAggregate(buffer, t, depth)
+
+	default:
+		if depth != 0 {
+			return nil, ErrInvalidLine
+		}
+		return p.readInline(buffer, b[0])
+	}
+}
+
+// readLine：读取以 CRLF 结尾的一行，inline 为 true 时同时接受 LF 结尾
+func (p *Protocol) readLine(buffer *ringbuffer.RingBuffer, inline bool) ([]byte, error) {
+	// 包括 CR 在内最多 MaxLineLength 个字节，之后必须是 LF
+	i := buffer.VirtualIndexByte('\n', p.opts.MaxLineLength+1)
+	if i < 0 {
+		if buffer.VirtualLength() > p.opts.MaxLineLength {
+			return nil, ErrLineTooLong
+		}
+		return nil, errIncomplete
+	}
+
+	line := make([]byte, i+1)
+	_, _ = buffer.VirtualRead(line)
+	line = line[:i]
+	if len(line) > 0 && line[len(line)-1] == '\r' {
+		return line[:len(line)-1], nil
+	}
+	if inline {
+		return line, nil
+	}
+	return nil, ErrInvalidLine
+}
+
+// readInt：读取一行整数
+func (p *Protocol) readInt(buffer *ringbuffer.RingBuffer) (int64, error) {
+	line, err := p.readLine(buffer, false)
+	if err != nil {
+		return 0, err
+	}
+	n, err := strconv.ParseInt(string(line), 10, 64)
+	if err != nil {
+		return 0, ErrInvalidInteger
+	}
+	return n, nil
+}
+
+// readBulk：读取 Bulk String、Bulk Error 与 Verbatim String
+func (p *Protocol) readBulk(buffer *ringbuffer.RingBuffer, t Type) (*Value, error) {
+	n, err := p.readInt(buffer)
+	if err != nil {
+		return nil, err
+	}
+	if n == -1 && t == BulkString {
+		return &Value{Type: t, IsNull: true}, nil
+	}
+	if n < 0 {
+		return nil, ErrInvalidLength
+	}
+	if n > int64(p.opts.MaxBulkLength) {
+		return nil, ErrBulkTooLong
+	}
+	// 数据还没有接收完整，避免无意义的拷贝
+	if buffer.VirtualLength() < int(n)+2 {
+		return nil, errIncomplete
+	}
+
+	str := make([]byte, n+2)
+	_, _ = buffer.VirtualRead(str)
+	if str[n] != '\r' || str[n+1] != '\n' {
+		return nil, ErrInvalidLine
+	}
+	return &Value{Type: t, Str: str[:n]}, nil
+}
+
+// readAggregate：读取 Array、Set、Push、Map，属性会被丢弃并返回其后的 Value
+func (p *Protocol) readAggregate(buffer *ringbuffer.RingBuffer, t Type, depth int) (*Value, error) {
+	n, err := p.readInt(buffer)
+	if err != nil {
+		return nil, err
+	}
+	if n == -1 && t == Array {
+		return &Value{Type: t, IsNull: true}, nil
+	}
+	if n < 0 {
+		return nil, ErrInvalidLength
+	}
+	if n > int64(p.opts.MaxElements) {
+		return nil, ErrTooManyElements
+	}
+	if depth+1 > p.opts.MaxDepth {
+		return nil, ErrTooDeep
+	}
+	if t == Map || t == attribute {
+		n *= 2
+	}
+
+	// 元素个数由对端声明，只预分配少量空间，按实际解析出的元素增长
+	size := n
+	if size > maxPrealloc {
+		size = maxPrealloc
+	}
+	v := &Value{Type: t, Elems: make([]*Value, 0, size)}
+	for i := int64(0); i < n; i++ {
+		elem, err := p.read(buffer, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		v.Elems = append(v.Elems, elem)
+	}
+
+	if t == attribute {
+		return p.read(buffer, depth)
+	}
+	return v, nil
+}
+
+// readInline：读取 inline command，first 为已经读取的第一个字节，空行返回 nil
+func (p *Protocol) readInline(buffer *ringbuffer.RingBuffer, first byte) (*Value, error) {
+	var line []byte
+	if first != '\n' {
+		rest, err := p.readLine(buffer, true)
+		if err != nil {
+			return nil, err
+		}
+		line = append([]byte{first}, rest...)
+	}
+
+	fields := bytes.Fields(line)
+	if len(fields) == 0 {
+		return nil, nil
+	}
+	v := &Value{Type: Array, Inline: true, Elems: make([]*Value, len(fields))}
+	for i, f := range fields {
+		v.Elems[i] = &Value{Type: BulkString, Str: f}
+	}
+	return v, nil
+}
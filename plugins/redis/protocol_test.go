@@ -0,0 +1,185 @@
+package redis
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/Dongxiem/fastnet/connection"
+	"github.com/Dongxiem/fastnet/eventloop"
+	"github.com/Dongxiem/fastnet/tool/ringbuffer"
+)
+
+func TestProtocol_UnPacket(t *testing.T) {
+	p := New()
+	c := connection.New(-1, nil, nil, p, nil, 0, nil)
+
+	// 让数据在 ring buffer 中跨越尾部与头部
+	buffer := ringbuffer.New(64)
+	_, _ = buffer.Write(make([]byte, 50))
+	_, _ = buffer.Read(make([]byte, 50))
+	_, _ = buffer.WriteString("*3\r\n$3\r\nSET\r\n$1\r\nk\r\n$5\r\nhello\r\n" +
+		"\r\nPING  a\n" +
+		"%1\r\n+a\r\n*2\r\n:1\r\n#t\r\n" +
+		"|1\r\n+ttl\r\n:3\r\n$-1\r\n" +
+		"*2\r\n$3\r\nGET\r\n$1\r\n")
+
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{"set", []string{"k", "hello"}},
+		{"ping", []string{"a"}},
+	}
+	for _, tt := range tests {
+		ctx, _ := p.UnPacket(c, buffer)
+		v, ok := ctx.(*Value)
+		if !ok {
+			t.Fatalf("%s: value should be ready", tt.name)
+		}
+		name, args, ok := v.Command()
+		if !ok || name != tt.name || len(args) != len(tt.args) {
+			t.Fatalf("%s: got %q %q", tt.name, name, args)
+		}
+		for i := range args {
+			if string(args[i]) != tt.args[i] {
+				t.Fatalf("%s: got %q", tt.name, args)
+			}
+		}
+	}
+
+	ctx, _ := p.UnPacket(c, buffer)
+	v := ctx.(*Value)
+	if v.Type != Map || len(v.Elems) != 2 || v.Elems[1].Elems[0].Int != 1 || !v.Elems[1].Elems[1].Bool {
+		t.Fatalf("map got %+v", v)
+	}
+
+	// 属性被丢弃
+	ctx, _ = p.UnPacket(c, buffer)
+	if v := ctx.(*Value); v.Type != BulkString || !v.IsNull {
+		t.Fatalf("null bulk got %+v", v)
+	}
+
+	// 数据不完整
+	if ctx, _ := p.UnPacket(c, buffer); ctx != nil {
+		t.Fatal("value should not be ready")
+	}
+	_, _ = buffer.WriteString("k\r\n")
+	ctx, _ = p.UnPacket(c, buffer)
+	if name, args, _ := ctx.(*Value).Command(); name != "get" || string(args[0]) != "k" {
+		t.Fatalf("got %q %q", name, args)
+	}
+	if buffer.Length() != 0 {
+		t.Fatalf("buffer should be empty, but %d", buffer.Length())
+	}
+}
+
+func TestProtocol_UnPacketError(t *testing.T) {
+	loop, err := eventloop.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		in   string
+		opts []Option
+	}{
+		{in: ":abc\r\n"},
+		{in: "$3\r\nabcd\r\n"},
+		{in: "$-2\r\n"},
+		{in: "#x\r\n"},
+		{in: "+ok\n"},
+		{in: "*1\r\nPING\r\n"},
+		{in: "$9\r\n", opts: []Option{MaxBulkLength(8)}},
+		{in: "*9\r\n", opts: []Option{MaxElements(8)}},
+		{in: "*1\r\n*1\r\n*1\r\n", opts: []Option{MaxDepth(2)}},
+		{in: "PING aaaaaaaa", opts: []Option{MaxLineLength(8)}},
+		{in: "+12345678\r\n", opts: []Option{MaxLineLength(8)}},
+	}
+	for _, tt := range tests {
+		p := New(tt.opts...)
+		c := connection.New(-1, loop, nil, p, nil, 0, nil)
+		buffer := ringbuffer.New(64)
+		_, _ = buffer.WriteString(tt.in)
+
+		if ctx, _ := p.UnPacket(c, buffer); ctx != nil {
+			t.Fatalf("%q: should fail", tt.in)
+		}
+		if _, ok := c.Get(closingKey); !ok || buffer.Length() != 0 {
+			t.Fatalf("%q: connection should be closing", tt.in)
+		}
+	}
+}
+
+func TestProtocol_UnPacketLargeCount(t *testing.T) {
+	p := New()
+	c := connection.New(-1, nil, nil, p, nil, 0, nil)
+
+	// 每一层都声明最多的元素个数，数据不完整时不能按声明的个数分配内存
+	buffer := ringbuffer.New(1024)
+	for i := 0; i < p.opts.MaxDepth; i++ {
+		_, _ = buffer.WriteString("*1048576\r\n")
+	}
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	if ctx, _ := p.UnPacket(c, buffer); ctx != nil {
+		t.Fatal("value should not be ready")
+	}
+	runtime.ReadMemStats(&after)
+	if n := after.TotalAlloc - before.TotalAlloc; n > 64*1024 {
+		t.Fatalf("allocated %d bytes for an incomplete value", n)
+	}
+
+	// 一行数据分多次到达
+	buffer = ringbuffer.New(8)
+	for _, part := range []string{"*2\r", "\n+hel", "lo\r\n:4", "2\r\n"} {
+		_, _ = buffer.WriteString(part)
+		ctx, _ := p.UnPacket(c, buffer)
+		if part != "2\r\n" {
+			if ctx != nil {
+				t.Fatalf("%q: value should not be ready", part)
+			}
+			continue
+		}
+		v, ok := ctx.(*Value)
+		if !ok || len(v.Elems) != 2 || string(v.Elems[0].Str) != "hello" || v.Elems[1].Int != 42 {
+			t.Fatalf("got %+v", ctx)
+		}
+	}
+}
+
+func TestAppendValue(t *testing.T) {
+	var b []byte
+	b = AppendArray(b, 3)
+	b = AppendBulkString(b, "a")
+	b = AppendNullBulk(b)
+	b = AppendInt(b, -7)
+	b = AppendSimpleString(b, "OK")
+	b = AppendError(b, "ERR x")
+	b = AppendMap(b, 1)
+	b = AppendBool(b, true)
+	b = AppendDouble(b, 1.5)
+	b = AppendNull(b)
+
+	want := "*3\r\n$1\r\na\r\n$-1\r\n:-7\r\n+OK\r\n-ERR x\r\n%1\r\n#t\r\n,1.5\r\n_\r\n"
+	if string(b) != want {
+		t.Fatalf("got %q, want %q", b, want)
+	}
+
+	// 编码后再解析应当得到相同的结果
+	p := New()
+	c := connection.New(-1, nil, nil, p, nil, 0, nil)
+	buffer := ringbuffer.New(64)
+	_, _ = buffer.Write(b)
+
+	var out []byte
+	for {
+		ctx, _ := p.UnPacket(c, buffer)
+		if ctx == nil {
+			break
+		}
+		out = AppendValue(out, ctx.(*Value))
+	}
+	if string(out) != want {
+		t.Fatalf("got %q, want %q", out, want)
+	}
+}
@@ -0,0 +1,62 @@
+package redis
+
+import (
+	"strings"
+)
+
+// Type：RESP 数据类型，取值为类型前缀字符
+type Type byte
+
+// RESP2 与 RESP3 数据类型
+// See https://github.com/redis/redis-specifications/blob/master/protocol/RESP3.md
+const (
+	SimpleString   Type = '+'
+	Error          Type = '-'
+	Integer        Type = ':'
+	BulkString     Type = '$'
+	Array          Type = '*'
+	Null           Type = '_'
+	Boolean        Type = '#'
+	Double         Type = ','
+	BigNumber      Type = '('
+	BulkError      Type = '!'
+	VerbatimString Type = '='
+	Map            Type = '%'
+	Set            Type = '~'
+	Push           Type = '>'
+)
+
+// Value：RESP 数据
+type Value struct {
+	Type Type
+	// Str：SimpleString、Error、BulkString、Double、BigNumber、BulkError、VerbatimString 的内容
+	Str []byte
+	// Int：Integer 的值
+	Int int64
+	// Bool：Boolean 的值
+	Bool bool
+	// Elems：Array、Set、Push 的元素，Map 的元素按 key、value 依次排列
+	Elems []*Value
+	// IsNull：RESP2 中的 Null Bulk String（$-1）与 Null Array（*-1）
+	IsNull bool
+	// Inline：是否为 inline command
+	Inline bool
+}
+
+// Command：将 Value 作为命令解析，返回小写的命令名与参数
+// 只有元素全部为 BulkString 或 SimpleString 的非空 Array 才是合法命令
+func (v *Value) Command() (name string, args [][]byte, ok bool) {
+	if v.Type != Array || len(v.Elems) == 0 {
+		return "", nil, false
+	}
+	for _, e := range v.Elems {
+		if e.Type != BulkString && e.Type != SimpleString {
+			return "", nil, false
+		}
+	}
+	args = make([][]byte, len(v.Elems)-1)
+	for i, e := range v.Elems[1:] {
+		args[i] = e.Str
+	}
+	return strings.ToLower(string(v.Elems[0].Str)), args, true
+}
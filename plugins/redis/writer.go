@@ -0,0 +1,141 @@
+package redis
+
+import (
+	"strconv"
+)
+
+var crlf = []byte{'\r', '\n'}
+
+// 以下 Append 系列方法将回复编码后追加到 b，返回追加后的 slice
+// pipeline 时可以将多个回复追加到同一个 slice，一次 Send 发送
+
+// AppendSimpleString：+OK\r\n
+func AppendSimpleString(b []byte, s string) []byte {
+	b = append(b, byte(SimpleString))
+	b = append(b, s...)
+	return append(b, crlf...)
+}
+
+// AppendError：-ERR message\r\n
+func AppendError(b []byte, s string) []byte {
+	b = append(b, byte(Error))
+	b = append(b, s...)
+	return append(b, crlf...)
+}
+
+// AppendInt：:1\r\n
+func AppendInt(b []byte, n int64) []byte {
+	return appendPrefix(b, Integer, n)
+}
+
+// AppendBulk：$5\r\nhello\r\n
+func AppendBulk(b []byte, s []byte) []byte {
+	b = appendPrefix(b, BulkString, int64(len(s)))
+	b = append(b, s...)
+	return append(b, crlf...)
+}
+
+// AppendBulkString：与 AppendBulk 相同，参数为 string
+func AppendBulkString(b []byte, s string) []byte {
+	b = appendPrefix(b, BulkString, int64(len(s)))
+	b = append(b, s...)
+	return append(b, crlf...)
+}
+
+// AppendNullBulk：RESP2 的 Null Bulk String，$-1\r\n
+func AppendNullBulk(b []byte) []byte {
+	return appendPrefix(b, BulkString, -1)
+}
+
+// AppendNullArray：RESP2 的 Null Array，*-1\r\n
+func AppendNullArray(b []byte) []byte {
+	return appendPrefix(b, Array, -1)
+}
+
+// AppendNull：RESP3 的 Null，_\r\n
+func AppendNull(b []byte) []byte {
+	b = append(b, byte(Null))
+	return append(b, crlf...)
+}
+
+// AppendArray：数组头，之后需要追加 n 个元素
+func AppendArray(b []byte, n int) []byte {
+	return appendPrefix(b, Array, int64(n))
+}
+
+// AppendMap：RESP3 Map 头，之后需要按 key、value 依次追加 n 对元素
+func AppendMap(b []byte, n int) []byte {
+	return appendPrefix(b, Map, int64(n))
+}
+
+// AppendSet：RESP3 Set 头，之后需要追加 n 个元素
+func AppendSet(b []byte, n int) []byte {
+	return appendPrefix(b, Set, int64(n))
+}
+
+// AppendPush：RESP3 Push 头，之后需要追加 n 个元素
+func AppendPush(b []byte, n int) []byte {
+	return appendPrefix(b, Push, int64(n))
+}
+
+// AppendBool：RESP3 Boolean，#t\r\n 或 #f\r\n
+func AppendBool(b []byte, v bool) []byte {
+	b = append(b, byte(Boolean))
+	if v {
+		b = append(b, 't')
+	} else {
+		b = append(b, 'f')
+	}
+	return append(b, crlf...)
+}
+
+// AppendDouble：RESP3 Double
+func AppendDouble(b []byte, f float64) []byte {
+	b = append(b, byte(Double))
+	b = strconv.AppendFloat(b, f, 'g', -1, 64)
+	return append(b, crlf...)
+}
+
+// AppendValue：编码任意 Value
+func AppendValue(b []byte, v *Value) []byte {
+	switch v.Type {
+	case SimpleString, Error, Double, BigNumber:
+		b = append(b, byte(v.Type))
+		b = append(b, v.Str...)
+		return append(b, crlf...)
+	case Integer:
+		return AppendInt(b, v.Int)
+	case Null:
+		return AppendNull(b)
+	case Boolean:
+		return AppendBool(b, v.Bool)
+	case BulkString, BulkError, VerbatimString:
+		if v.IsNull {
+			return appendPrefix(b, v.Type, -1)
+		}
+		b = appendPrefix(b, v.Type, int64(len(v.Str)))
+		b = append(b, v.Str...)
+		return append(b, crlf...)
+	case Array, Set, Push, Map:
+		if v.IsNull {
+			return appendPrefix(b, v.Type, -1)
+		}
+		n := len(v.Elems)
+		if v.Type == Map {
+			n /= 2
+		}
+		b = appendPrefix(b, v.Type, int64(n))
+		for _, e := range v.Elems {
+			b = AppendValue(b, e)
+		}
+		return b
+	}
+	return b
+}
+
+// appendPrefix：类型前缀 + 整数 + CRLF
+func appendPrefix(b []byte, t Type, n int64) []byte {
+	b = append(b, byte(t))
+	b = strconv.AppendInt(b, n, 10)
+	return append(b, crlf...)
+}
@@ -0,0 +1,218 @@
+package rpc
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/Dongxiem/fastnet/connection"
+	"github.com/Dongxiem/fastnet/eventloop"
+	"github.com/Dongxiem/fastnet/internal/netutil"
+	"github.com/RussellLuo/timingwheel"
+	"golang.org/x/sys/unix"
+)
+
+var (
+	// ErrTimeout：调用在 Timeout 内没有收到应答
+	ErrTimeout = errors.New("rpc: call timeout")
+	// ErrClosed：客户端已经关闭或者连接已经断开
+	ErrClosed = errors.New("rpc: client is closed")
+)
+
+// ServerError：服务端应答的错误
+type ServerError string
+
+func (e ServerError) Error() string {
+	return string(e)
+}
+
+// Call：一次异步调用，Done 关闭之后可以读取 Reply 与 Error
+type Call struct {
+	Method string
+	Args   interface{}
+	Reply  interface{}
+	Error  error
+
+	done  chan struct{}
+	timer *timingwheel.Timer
+}
+
+// Done：调用完成时关闭
+func (call *Call) Done() <-chan struct{} {
+	return call.done
+}
+
+// Wait：等待调用完成，返回 Error
+func (call *Call) Wait() error {
+	<-call.done
+	return call.Error
+}
+
+func (call *Call) finish(err error) {
+	call.Error = err
+	close(call.done)
+}
+
+// Client：RPC 客户端，同一个连接上的多个调用并发进行，通过调用 ID 匹配应答
+type Client struct {
+	loop        *eventloop.EventLoop
+	timingWheel *timingwheel.TimingWheel
+	conn        *connection.Connection
+	opts        *Options
+
+	mu       sync.Mutex
+	seq      uint64
+	pending  map[uint64]*Call
+	closed   bool
+	stopOnce sync.Once
+}
+
+// Dial：连接 RPC 服务端，p 为与服务端一致的 Protocol，为 nil 时使用默认的 Protocol
+// 客户端使用独立的事件循环与定时器，Close 时一起关闭
+func Dial(addr string, p *Protocol, opts ...Option) (*Client, error) {
+	if p == nil {
+		p = New(nil)
+	}
+	options := newOptions(opts...)
+
+	fd, sa, err := netutil.Dial(addr, options.DialTimeout)
+	if err != nil {
+		return nil, err
+	}
+	loop, err := eventloop.New()
+	if err != nil {
+		_ = unix.Close(fd)
+		return nil, err
+	}
+
+	cl := &Client{
+		loop:        loop,
+		timingWheel: timingwheel.NewTimingWheel(time.Millisecond, 20),
+		opts:        options,
+		pending:     make(map[uint64]*Call),
+	}
+	cl.conn = connection.New(fd, loop, sa, p, cl.timingWheel, 0, &clientWrap{cl})
+	if err = loop.AddSocketAndEnableRead(fd, cl.conn); err != nil {
+		_ = unix.Close(fd)
+		return nil, err
+	}
+
+	cl.timingWheel.Start()
+	go loop.RunLoop()
+	return cl, nil
+}
+
+// Go：异步调用，返回的 Call 在收到应答、超时或者连接断开时完成
+func (cl *Client) Go(method string, args, reply interface{}) *Call {
+	call := &Call{Method: method, Args: args, Reply: reply, done: make(chan struct{})}
+
+	payload, err := cl.opts.Codec.Marshal(args)
+	if err != nil {
+		call.finish(err)
+		return call
+	}
+
+	cl.mu.Lock()
+	if cl.closed {
+		cl.mu.Unlock()
+		call.finish(ErrClosed)
+		return call
+	}
+	cl.seq++
+	id := cl.seq
+	data, err := encodeMessage(kindRequest, id, method, payload)
+	if err != nil {
+		cl.mu.Unlock()
+		call.finish(err)
+		return call
+	}
+	cl.pending[id] = call
+	call.timer = cl.conn.RunAfter(cl.opts.Timeout, func() {
+		if call := cl.remove(id); call != nil {
+			call.finish(ErrTimeout)
+		}
+	})
+	cl.mu.Unlock()
+
+	if err := cl.conn.Send(data); err != nil {
+		if call := cl.remove(id); call != nil {
+			call.timer.Stop()
+			call.finish(ErrClosed)
+		}
+	}
+	return call
+}
+
+// Call：同步调用，等待应答、超时或者连接断开
+func (cl *Client) Call(method string, args, reply interface{}) error {
+	return cl.Go(method, args, reply).Wait()
+}
+
+// Close：关闭连接、事件循环与定时器，未完成的调用返回 ErrClosed
+func (cl *Client) Close() (err error) {
+	cl.shutdown()
+	cl.stopOnce.Do(func() {
+		cl.timingWheel.Stop()
+		err = cl.loop.Stop()
+	})
+	return
+}
+
+// remove：取出等待应答的调用，已经完成时返回 nil
+func (cl *Client) remove(id uint64) *Call {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	call, ok := cl.pending[id]
+	if !ok {
+		return nil
+	}
+	delete(cl.pending, id)
+	return call
+}
+
+// shutdown：标记客户端关闭，未完成的调用返回 ErrClosed
+func (cl *Client) shutdown() {
+	cl.mu.Lock()
+	if cl.closed {
+		cl.mu.Unlock()
+		return
+	}
+	cl.closed = true
+	pending := cl.pending
+	cl.pending = make(map[uint64]*Call)
+	cl.mu.Unlock()
+
+	for _, call := range pending {
+		call.timer.Stop()
+		call.finish(ErrClosed)
+	}
+}
+
+// clientWrap：客户端连接的回调
+type clientWrap struct {
+	cl *Client
+}
+
+func (w *clientWrap) OnMessage(c *connection.Connection, ctx interface{}, data []byte) []byte {
+	msg, ok := ctx.(*Message)
+	if !ok || msg.Kind == kindRequest {
+		return nil
+	}
+	// 已经超时的调用直接丢弃应答
+	call := w.cl.remove(msg.ID)
+	if call == nil {
+		return nil
+	}
+	call.timer.Stop()
+
+	if msg.Kind == kindError {
+		call.finish(ServerError(msg.Name))
+	} else {
+		call.finish(w.cl.opts.Codec.Unmarshal(msg.Payload, call.Reply))
+	}
+	return nil
+}
+
+func (w *clientWrap) OnClose(c *connection.Connection) {
+	w.cl.shutdown()
+}
@@ -0,0 +1,51 @@
+package rpc
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/golang/protobuf/proto"
+)
+
+// ErrNotProtoMessage：ProtoCodec 的参数不是 proto.Message
+var ErrNotProtoMessage = errors.New("rpc: value is not a proto.Message")
+
+// Codec：参数与返回值的编解码
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// JSONCodec：使用 encoding/json 编解码
+type JSONCodec struct{}
+
+// Marshal ...
+func (JSONCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// Unmarshal ...
+func (JSONCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// ProtoCodec：使用 protobuf 编解码，参数与返回值都需要是 proto.Message
+type ProtoCodec struct{}
+
+// Marshal ...
+func (ProtoCodec) Marshal(v interface{}) ([]byte, error) {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return nil, ErrNotProtoMessage
+	}
+	return proto.Marshal(m)
+}
+
+// Unmarshal ...
+func (ProtoCodec) Unmarshal(data []byte, v interface{}) error {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return ErrNotProtoMessage
+	}
+	return proto.Unmarshal(data, m)
+}
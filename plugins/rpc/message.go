@@ -0,0 +1,67 @@
+package rpc
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// 消息类型
+const (
+	kindRequest  byte = 1
+	kindResponse byte = 2
+	kindError    byte = 3 // 调用失败，Name 为错误信息
+)
+
+// headerLen：1 字节消息类型、8 字节调用 ID 与 2 字节 Name 长度
+const headerLen = 11
+
+var (
+	// ErrInvalidMessage：消息格式错误
+	ErrInvalidMessage = errors.New("rpc: invalid message")
+	// ErrNameTooLong：方法名或错误信息超过 65535 字节
+	ErrNameTooLong = errors.New("rpc: name too long")
+)
+
+// Message：RPC 消息，由内部协议拆包之后解析得到
+// | kind 1B | id 8B | name length 2B | name | payload |
+type Message struct {
+	Kind    byte
+	ID      uint64
+	Name    string // 请求的方法名，或者错误应答的错误信息
+	Payload []byte
+}
+
+// encodeMessage：编码消息，之后由内部协议的 Packet 封装
+func encodeMessage(kind byte, id uint64, name string, payload []byte) ([]byte, error) {
+	if len(name) > 0xffff {
+		return nil, ErrNameTooLong
+	}
+	ret := make([]byte, headerLen+len(name)+len(payload))
+	ret[0] = kind
+	binary.BigEndian.PutUint64(ret[1:], id)
+	binary.BigEndian.PutUint16(ret[9:], uint16(len(name)))
+	copy(ret[headerLen:], name)
+	copy(ret[headerLen+len(name):], payload)
+	return ret, nil
+}
+
+// decodeMessage：解析内部协议拆包得到的数据
+func decodeMessage(data []byte) (*Message, error) {
+	if len(data) < headerLen {
+		return nil, ErrInvalidMessage
+	}
+	kind := data[0]
+	if kind != kindRequest && kind != kindResponse && kind != kindError {
+		return nil, ErrInvalidMessage
+	}
+	nameLen := int(binary.BigEndian.Uint16(data[9:]))
+	if len(data) < headerLen+nameLen {
+		return nil, ErrInvalidMessage
+	}
+	return &Message{
+		Kind:    kind,
+		ID:      binary.BigEndian.Uint64(data[1:]),
+		Name:    string(data[headerLen : headerLen+nameLen]),
+		Payload: data[headerLen+nameLen:],
+	}, nil
+}
@@ -0,0 +1,57 @@
+package rpc
+
+import (
+	"time"
+)
+
+// Options：RPC 配置，服务端与客户端需要使用相同的 Codec
+type Options struct {
+	Codec       Codec         // 参数与返回值的编解码，默认为 JSONCodec
+	Timeout     time.Duration // 客户端调用的超时时间，超时之后返回 ErrTimeout
+	DialTimeout time.Duration // 客户端建立连接的超时时间
+}
+
+// Option ...
+type Option func(*Options)
+
+// newOptions：返回一个新的 Options 配置
+func newOptions(opt ...Option) *Options {
+	opts := Options{}
+
+	for _, o := range opt {
+		o(&opts)
+	}
+	if opts.Codec == nil {
+		opts.Codec = JSONCodec{}
+	}
+	// 默认调用超时 5s
+	if opts.Timeout <= 0 {
+		opts.Timeout = 5 * time.Second
+	}
+	if opts.DialTimeout <= 0 {
+		opts.DialTimeout = 5 * time.Second
+	}
+
+	return &opts
+}
+
+// WithCodec：参数与返回值的编解码
+func WithCodec(c Codec) Option {
+	return func(o *Options) {
+		o.Codec = c
+	}
+}
+
+// Timeout：客户端调用的超时时间
+func Timeout(d time.Duration) Option {
+	return func(o *Options) {
+		o.Timeout = d
+	}
+}
+
+// DialTimeout：客户端建立连接的超时时间
+func DialTimeout(d time.Duration) Option {
+	return func(o *Options) {
+		o.DialTimeout = d
+	}
+}
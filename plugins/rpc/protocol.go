@@ -0,0 +1,46 @@
+package rpc
+
+import (
+	"github.com/Dongxiem/fastnet/connection"
+	"github.com/Dongxiem/fastnet/plugins/lengthfield"
+	"github.com/Dongxiem/fastnet/tool/ringbuffer"
+)
+
+var _ connection.Protocol = &Protocol{}
+
+// logError：消息格式错误时记录日志
+var logError = connection.LogError("[rpc]")
+
+// Protocol：RPC 协议，包装任意按消息拆包的 connection.Protocol
+type Protocol struct {
+	inner connection.Protocol
+}
+
+// New：创建 RPC Protocol，inner 为实际使用的协议，为 nil 时使用默认配置的 lengthfield
+func New(inner connection.Protocol) *Protocol {
+	if inner == nil {
+		// 默认配置不会出错
+		inner, _ = lengthfield.New()
+	}
+	return &Protocol{inner: inner}
+}
+
+// UnPacket：拆包，返回的 ctx 为 *Message，消息格式错误时关闭连接
+func (p *Protocol) UnPacket(c *connection.Connection, buffer *ringbuffer.RingBuffer) (ctx interface{}, out []byte) {
+	ctx, out = p.inner.UnPacket(c, buffer)
+	if ctx == nil && len(out) == 0 {
+		return
+	}
+
+	msg, err := decodeMessage(out)
+	if err != nil {
+		connection.CloseOnError(c, buffer, logError, err)
+		return nil, nil
+	}
+	return msg, msg.Payload
+}
+
+// Packet：装包，直接使用内部协议
+func (p *Protocol) Packet(c *connection.Connection, data []byte) []byte {
+	return p.inner.Packet(c, data)
+}
@@ -0,0 +1,192 @@
+package rpc
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Dongxiem/fastnet/connection"
+	"github.com/Dongxiem/fastnet/eventloop"
+	"github.com/Dongxiem/fastnet/tool/ringbuffer"
+	"github.com/RussellLuo/timingwheel"
+	"golang.org/x/sys/unix"
+)
+
+type args struct {
+	A, B int
+}
+
+// newConn：创建 socketpair 上的连接，返回连接与对端的 fd
+func newConn(t *testing.T, p *Protocol, tw *timingwheel.TimingWheel, cb connection.CallBack) (*connection.Connection, int) {
+	fds, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_STREAM, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = unix.SetNonblock(fds[0], true)
+	_ = unix.SetsockoptTimeval(fds[1], unix.SOL_SOCKET, unix.SO_RCVTIMEO, &unix.Timeval{Sec: 2})
+
+	loop, err := eventloop.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	go loop.RunLoop()
+	t.Cleanup(func() {
+		_ = loop.Stop()
+		_ = unix.Close(fds[1])
+	})
+
+	c := connection.New(fds[0], loop, nil, p, tw, 0, cb)
+	if err = loop.AddSocketAndEnableRead(fds[0], c); err != nil {
+		t.Fatal(err)
+	}
+	return c, fds[1]
+}
+
+// readMessages：从 fd 读取 n 个 RPC 消息
+func readMessages(t *testing.T, p *Protocol, c *connection.Connection, fd int, n int) []*Message {
+	var msgs []*Message
+	buffer := ringbuffer.New(0)
+	buf := make([]byte, 1024)
+	for len(msgs) < n {
+		ctx, _ := p.UnPacket(c, buffer)
+		if msg, ok := ctx.(*Message); ok {
+			msgs = append(msgs, msg)
+			continue
+		}
+		m, err := unix.Read(fd, buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = buffer.Write(buf[:m])
+	}
+	return msgs
+}
+
+func TestProtocol(t *testing.T) {
+	p := New(nil)
+	data, _ := encodeMessage(kindRequest, 7, "Arith.Add", []byte(`{"A":1}`))
+
+	buffer := ringbuffer.New(0)
+	_, _ = buffer.Write(p.Packet(nil, data))
+	ctx, out := p.UnPacket(nil, buffer)
+	msg := ctx.(*Message)
+	if msg.Kind != kindRequest || msg.ID != 7 || msg.Name != "Arith.Add" || string(out) != `{"A":1}` {
+		t.Fatalf("got %+v", msg)
+	}
+
+	// 消息格式错误时关闭连接
+	c, fd := newConn(t, p, nil, NewServer())
+	_, _ = buffer.Write(p.Packet(nil, []byte{9, 0, 0}))
+	if ctx, _ := p.UnPacket(c, buffer); ctx != nil || buffer.Length() != 0 {
+		t.Fatal("invalid message should be dropped")
+	}
+	if n, err := unix.Read(fd, make([]byte, 8)); n != 0 || err != nil {
+		t.Fatalf("connection should be closed, got %d %v", n, err)
+	}
+}
+
+func TestServer(t *testing.T) {
+	s := NewServer()
+	s.Handle("Arith.Add", func(req *Request) {
+		var a args
+		if err := req.Decode(&a); err != nil {
+			_ = req.ReplyError(err)
+			return
+		}
+		_ = req.Reply(a.A + a.B)
+		if err := req.Reply(0); err != ErrReplied {
+			t.Errorf("got %v", err)
+		}
+	})
+	async := make(chan *Request, 1)
+	s.Handle("Async", func(req *Request) {
+		async <- req
+	})
+
+	p := New(nil)
+	c, fd := newConn(t, p, nil, s)
+	request := func(id uint64, method string, payload string) []byte {
+		data, _ := encodeMessage(kindRequest, id, method, []byte(payload))
+		msg, _ := decodeMessage(data)
+		return s.OnMessage(c, msg, msg.Payload)
+	}
+
+	// 处理函数返回之前的应答随 OnMessage 的返回值发送
+	msg, _ := decodeMessage(request(1, "Arith.Add", `{"A":1,"B":2}`))
+	if msg.Kind != kindResponse || msg.ID != 1 || string(msg.Payload) != "3" {
+		t.Fatalf("got %+v", msg)
+	}
+	msg, _ = decodeMessage(request(2, "Arith.Sub", `{}`))
+	if msg.Kind != kindError || msg.ID != 2 || msg.Name != "rpc: method not found: Arith.Sub" {
+		t.Fatalf("got %+v", msg)
+	}
+
+	// 处理函数返回之后的应答通过连接发送
+	if out := request(3, "Async", ""); out != nil {
+		t.Fatalf("got % x", out)
+	}
+	if err := (<-async).Reply("done"); err != nil {
+		t.Fatal(err)
+	}
+	msg = readMessages(t, p, c, fd, 1)[0]
+	if msg.Kind != kindResponse || msg.ID != 3 || string(msg.Payload) != `"done"` {
+		t.Fatalf("got %+v", msg)
+	}
+}
+
+func TestClient(t *testing.T) {
+	tw := timingwheel.NewTimingWheel(time.Millisecond, 20)
+	tw.Start()
+	defer tw.Stop()
+
+	p := New(nil)
+	cl := &Client{opts: newOptions(Timeout(50 * time.Millisecond)), pending: make(map[uint64]*Call)}
+	var fd int
+	cl.conn, fd = newConn(t, p, tw, &clientWrap{cl})
+	respond := func(kind byte, id uint64, name, payload string) {
+		data, _ := encodeMessage(kind, id, name, []byte(payload))
+		msg, _ := decodeMessage(data)
+		(&clientWrap{cl}).OnMessage(cl.conn, msg, msg.Payload)
+	}
+
+	// 同一个连接上的多个调用，应答可以乱序到达
+	var r1, r2 int
+	call1 := cl.Go("Arith.Add", &args{1, 2}, &r1)
+	call2 := cl.Go("Arith.Add", &args{3, 4}, &r2)
+	reqs := readMessages(t, p, cl.conn, fd, 2)
+	req1, req2 := reqs[0], reqs[1]
+	if req1.ID == req2.ID || req1.Name != "Arith.Add" || string(req2.Payload) != `{"A":3,"B":4}` {
+		t.Fatalf("got %+v %+v", req1, req2)
+	}
+	respond(kindResponse, req2.ID, "", "7")
+	respond(kindError, req1.ID, "overflow", "")
+	if err := call2.Wait(); err != nil || r2 != 7 {
+		t.Fatalf("got %d %v", r2, err)
+	}
+	if err := call1.Wait(); err != ServerError("overflow") {
+		t.Fatalf("got %v", err)
+	}
+
+	// 超时之后的应答直接丢弃
+	start := time.Now()
+	call := cl.Go("Slow", nil, &r1)
+	if err := call.Wait(); err != ErrTimeout || time.Since(start) < 40*time.Millisecond {
+		t.Fatalf("got %v after %v", err, time.Since(start))
+	}
+	respond(kindResponse, readMessages(t, p, cl.conn, fd, 1)[0].ID, "", "1")
+
+	// 连接断开时未完成的调用返回 ErrClosed
+	call = cl.Go("Pending", nil, &r1)
+	(&clientWrap{cl}).OnClose(cl.conn)
+	if err := call.Wait(); err != ErrClosed {
+		t.Fatalf("got %v", err)
+	}
+	if err := cl.Call("Arith.Add", &args{}, &r1); err != ErrClosed {
+		t.Fatalf("got %v", err)
+	}
+}
+
+func TestDial(t *testing.T) {
+	if _, err := Dial("127.0.0.1:1", nil, DialTimeout(time.Second)); err == nil {
+		t.Fatal("dial should fail")
+	}
+}
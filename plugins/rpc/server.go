@@ -0,0 +1,132 @@
+package rpc
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/Dongxiem/fastnet/connection"
+	"github.com/Dongxiem/fastnet/log"
+)
+
+// ErrReplied：同一个请求只能应答一次
+var ErrReplied = errors.New("rpc: request already replied")
+
+// HandlerFunc：方法处理函数，在连接所属的 loop 中执行，不能阻塞
+// 可以在返回之前调用 Request.Reply，也可以把 Request 交给其他协程稍后应答，同一个连接上的应答不需要按请求顺序
+type HandlerFunc func(req *Request)
+
+// Request：服务端收到的调用请求
+type Request struct {
+	ID     uint64
+	Method string
+	Args   []byte // 编码后的参数，使用 Decode 解码
+
+	c     *connection.Connection
+	codec Codec
+
+	mu      sync.Mutex
+	replied bool
+	inLoop  bool   // 处理函数还没有返回，应答随 OnMessage 的返回值一起发送
+	out     []byte // inLoop 时的应答
+}
+
+// Conn：请求所属的连接
+func (r *Request) Conn() *connection.Connection {
+	return r.c
+}
+
+// Decode：解码参数
+func (r *Request) Decode(v interface{}) error {
+	return r.codec.Unmarshal(r.Args, v)
+}
+
+// Reply：应答调用结果，可以在任意协程中调用
+func (r *Request) Reply(v interface{}) error {
+	payload, err := r.codec.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return r.send(kindResponse, "", payload)
+}
+
+// ReplyError：应答调用失败，客户端收到 ServerError
+func (r *Request) ReplyError(err error) error {
+	return r.send(kindError, err.Error(), nil)
+}
+
+func (r *Request) send(kind byte, name string, payload []byte) error {
+	data, err := encodeMessage(kind, r.ID, name, payload)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.replied {
+		return ErrReplied
+	}
+	r.replied = true
+	if r.inLoop {
+		r.out = data
+		return nil
+	}
+	return r.c.Send(data)
+}
+
+// Server：RPC 服务端，按方法名分发请求，实现了 fastnet Handler，也可以嵌入到自定义的 Handler 中
+type Server struct {
+	mu       sync.RWMutex
+	handlers map[string]HandlerFunc
+	opts     *Options
+}
+
+// NewServer：创建 RPC 服务端
+func NewServer(opts ...Option) *Server {
+	return &Server{
+		handlers: make(map[string]HandlerFunc),
+		opts:     newOptions(opts...),
+	}
+}
+
+// Handle：注册方法
+func (s *Server) Handle(method string, h HandlerFunc) {
+	s.mu.Lock()
+	s.handlers[method] = h
+	s.mu.Unlock()
+}
+
+// OnConnect wrap
+func (s *Server) OnConnect(c *connection.Connection) {}
+
+// OnMessage：分发请求，没有注册的方法直接应答错误
+func (s *Server) OnMessage(c *connection.Connection, ctx interface{}, data []byte) []byte {
+	msg, ok := ctx.(*Message)
+	if !ok || msg.Kind != kindRequest {
+		return nil
+	}
+
+	req := &Request{
+		ID:     msg.ID,
+		Method: msg.Name,
+		Args:   msg.Payload,
+		c:      c,
+		codec:  s.opts.Codec,
+		inLoop: true,
+	}
+	s.mu.RLock()
+	h, ok := s.handlers[msg.Name]
+	s.mu.RUnlock()
+	if ok {
+		h(req)
+	} else if err := req.ReplyError(errors.New("rpc: method not found: " + msg.Name)); err != nil {
+		log.Error("[rpc]", err)
+	}
+
+	req.mu.Lock()
+	defer req.mu.Unlock()
+	req.inLoop = false
+	return req.out
+}
+
+// OnClose wrap
+func (s *Server) OnClose(c *connection.Connection) {}
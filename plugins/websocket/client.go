@@ -0,0 +1,194 @@
+package websocket
+
+import (
+	"crypto/rand"
+	"errors"
+	"time"
+
+	"github.com/Dongxiem/fastnet/connection"
+	"github.com/Dongxiem/fastnet/eventloop"
+	"github.com/Dongxiem/fastnet/internal/netutil"
+	"github.com/Dongxiem/fastnet/log"
+	"github.com/Dongxiem/fastnet/plugins/websocket/ws"
+	"github.com/Dongxiem/fastnet/tool/ringbuffer"
+	"github.com/RussellLuo/timingwheel"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	nonceKey     = "fastnet_ws_nonce"
+	handshakeKey = "fastnet_ws_handshake"
+)
+
+// ErrHandshakeTimeout：客户端在 HandshakeTimeout 内没有完成握手
+var ErrHandshakeTimeout = errors.New("websocket handshake timeout")
+
+// Client：websocket 客户端，所有连接共享一个事件循环，通过 WSHandler 接收消息
+// 客户端模式不支持 Compression
+type Client struct {
+	loop        *eventloop.EventLoop
+	timingWheel *timingwheel.TimingWheel
+	protocol    *Protocol
+	callback    *clientWrap
+	opts        *Options
+}
+
+// NewClient：创建 websocket 客户端并启动事件循环，d 为 nil 时使用默认的握手配置
+func NewClient(handler WSHandler, d *ws.Dialer, opts ...Option) (*Client, error) {
+	if handler == nil {
+		return nil, errors.New("handler is nil")
+	}
+	if d == nil {
+		d = &ws.Dialer{}
+	}
+	options := newOptions(opts...)
+
+	loop, err := eventloop.New()
+	if err != nil {
+		return nil, err
+	}
+	cl := &Client{
+		loop:        loop,
+		timingWheel: timingwheel.NewTimingWheel(time.Millisecond, 20),
+		protocol:    &Protocol{dialer: d, opts: options},
+		callback:    &clientWrap{HandlerWrap: &HandlerWrap{wsHandler: handler, opts: options}},
+		opts:        options,
+	}
+
+	cl.timingWheel.Start()
+	go cl.loop.RunLoop()
+	return cl, nil
+}
+
+// Dial：连接 websocket 服务端并完成握手，握手成功之后在 loop 中回调 WSHandler.OnConnect
+// addr 为服务端地址，uri 为请求路径，握手失败或超时返回 error 并关闭连接
+func (cl *Client) Dial(addr, uri string) (*WSConn, error) {
+	deadline := time.Now().Add(cl.opts.HandshakeTimeout)
+
+	fd, sa, err := netutil.Dial(addr, cl.opts.HandshakeTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	req, nonce, err := cl.protocol.dialer.Request(addr, uri)
+	if err != nil {
+		_ = unix.Close(fd)
+		return nil, err
+	}
+
+	done := make(chan error, 1)
+	c := connection.New(fd, cl.loop, sa, cl.protocol, cl.timingWheel, 0, cl.callback)
+	c.Set(nonceKey, nonce)
+	c.Set(handshakeKey, done)
+	if err = cl.loop.AddSocketAndEnableRead(fd, c); err != nil {
+		_ = unix.Close(fd)
+		return nil, err
+	}
+	// 握手请求不是数据帧，不经过 Protocol.Packet
+	c.QueueInLoop(func() {
+		c.SendInLoop(req)
+	})
+
+	timer := time.NewTimer(time.Until(deadline))
+	defer timer.Stop()
+	select {
+	case err = <-done:
+	case <-timer.C:
+		err = ErrHandshakeTimeout
+	}
+	if err != nil {
+		_ = c.Close()
+		return nil, err
+	}
+	return GetWSConn(c), nil
+}
+
+// Stop：关闭客户端的事件循环与定时器
+func (cl *Client) Stop() {
+	cl.timingWheel.Stop()
+	if err := cl.loop.Stop(); err != nil {
+		log.Error(err)
+	}
+}
+
+// handshake：客户端解析服务端的握手应答，握手成功时返回 *ws.Handshake
+func (p *Protocol) handshake(c *connection.Connection, buffer *ringbuffer.RingBuffer) interface{} {
+	nonce, _ := c.Get(nonceKey)
+	hs, err := p.dialer.Response(buffer, nonce.([]byte))
+	if err == ws.ErrHeaderNotReady {
+		return nil
+	}
+
+	c.Delete(nonceKey)
+	if err != nil {
+		handshakeDone(c, err)
+		log.Error("Websocket Handshake :", c.PeerAddr(), err)
+		buffer.RetrieveAll()
+		c.Set(closingKey, true)
+		_ = c.Close()
+		return nil
+	}
+	c.Set(upgradedKey, true)
+	return &hs
+}
+
+// handshakeDone：通知 Dial 握手结果
+func handshakeDone(c *connection.Connection, err error) {
+	if done, ok := c.Get(handshakeKey); ok {
+		c.Delete(handshakeKey)
+		done.(chan error) <- err
+	}
+}
+
+// maskFrames：客户端发送的每个数据帧都必须使用随机的掩码，data 为一个或多个完整的数据帧
+func maskFrames(data []byte) []byte {
+	buffer := ringbuffer.NewWithData(data)
+	ret := make([]byte, 0, len(data)+len(data)/2+8)
+	for buffer.Length() > 0 {
+		header, err := ws.VirtualReadHeader(buffer)
+		if err != nil || buffer.VirtualLength() < int(header.Length) {
+			log.Error("Websocket mask frames : invalid frame")
+			return ret
+		}
+		buffer.VirtualFlush()
+
+		payload := make([]byte, int(header.Length))
+		_, _ = buffer.Read(payload)
+
+		header.Masked = true
+		_, _ = rand.Read(header.Mask[:])
+		ws.Cipher(payload, header.Mask, 0)
+
+		h, err := ws.WriteHeader(&header)
+		if err != nil {
+			log.Error("Websocket mask frames :", err)
+			return ret
+		}
+		ret = append(ret, h...)
+		ret = append(ret, payload...)
+	}
+	return ret
+}
+
+// clientWrap：客户端连接的回调，握手完成之后才回调 WSHandler
+type clientWrap struct {
+	*HandlerWrap
+}
+
+// OnMessage wrap
+func (w *clientWrap) OnMessage(c *connection.Connection, ctx interface{}, payload []byte) []byte {
+	if _, ok := ctx.(*ws.Handshake); ok {
+		w.upgraded(c)
+		w.wsHandler.OnConnect(c)
+		handshakeDone(c, nil)
+		return nil
+	}
+	return w.HandlerWrap.OnMessage(c, ctx, payload)
+}
+
+// OnClose wrap
+func (w *clientWrap) OnClose(c *connection.Connection) {
+	if _, ok := c.Get(upgradedKey); ok {
+		w.wsHandler.OnClose(c)
+	}
+}
@@ -0,0 +1,166 @@
+package websocket
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Dongxiem/fastnet/connection"
+	"github.com/Dongxiem/fastnet/eventloop"
+	"github.com/Dongxiem/fastnet/plugins/websocket/ws"
+	"github.com/Dongxiem/fastnet/plugins/websocket/ws/util"
+	"github.com/Dongxiem/fastnet/tool/ringbuffer"
+)
+
+// newClientConn：构造已经发送了握手请求的客户端连接，返回握手请求
+func newClientConn(t *testing.T, d *ws.Dialer) (*Protocol, *connection.Connection, []byte) {
+	loop, err := eventloop.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &Protocol{dialer: d, opts: newOptions()}
+	c := connection.New(-1, loop, nil, p, nil, 0, nil)
+
+	req, nonce, err := d.Request("localhost:1833", "/chat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Set(nonceKey, nonce)
+	c.Set(handshakeKey, make(chan error, 1))
+	return p, c, req
+}
+
+// upgradeResponse：使用服务端 Protocol 处理握手请求，返回握手应答
+func upgradeResponse(t *testing.T, u *ws.Upgrader, req []byte) []byte {
+	loop, err := eventloop.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := New(u)
+	c := connection.New(-1, loop, nil, p, nil, 0, nil)
+	buffer := ringbuffer.New(1024)
+	_, _ = buffer.Write(req)
+	_, out := p.UnPacket(c, buffer)
+	return out
+}
+
+func TestClient_Handshake(t *testing.T) {
+	d := &ws.Dialer{Protocols: []string{"chat", "superchat"}}
+	p, c, req := newClientConn(t, d)
+	resp := upgradeResponse(t, &ws.Upgrader{
+		Protocol: func(b []byte) bool { return string(b) == "superchat" },
+	}, req)
+
+	// 握手应答与服务端的第一个数据帧一起到达，逐字节写入
+	frame, _ := util.PackData(ws.MessageText, []byte("hello"))
+	buffer := ringbuffer.New(1024)
+	var got []interface{}
+	for _, b := range append(resp, frame...) {
+		_ = buffer.WriteByte(b)
+		if ctx, out := p.UnPacket(c, buffer); ctx != nil {
+			got = append(got, ctx)
+			if len(got) == 2 && string(out) != "hello" {
+				t.Fatalf("got %q", out)
+			}
+		}
+	}
+	if len(got) != 2 {
+		t.Fatalf("got %v", got)
+	}
+	if hs, ok := got[0].(*ws.Handshake); !ok || hs.Protocol != "superchat" {
+		t.Fatalf("got %v", got[0])
+	}
+
+	// 回调 OnConnect 之后通知 Dial 握手成功
+	done, _ := c.Get(handshakeKey)
+	h := &stubHandler{}
+	w := &clientWrap{HandlerWrap: NewHandlerWrap(nil, h)}
+	w.OnMessage(c, got[0], nil)
+	if err := <-done.(chan error); err != nil || h.connected != 1 || GetWSConn(c) == nil {
+		t.Fatalf("handshake should succeed, %v", err)
+	}
+}
+
+func TestClient_HandshakeError(t *testing.T) {
+	tests := []struct {
+		name string
+		resp func(req []byte) []byte
+		err  error
+	}{
+		{"bad accept", func(req []byte) []byte {
+			return []byte("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: s3pPLMBiTxaQ9kYGzzhZRbK+xOo=\r\n\r\n")
+		}, ws.ErrHandshakeBadSecAccept},
+		{"bad status", func(req []byte) []byte {
+			return []byte("HTTP/1.1 400 Bad Request\r\nContent-Length: 0\r\n\r\n")
+		}, ws.StatusError(400)},
+		{"malformed", func(req []byte) []byte {
+			return []byte("HTTP/1.1 1O1 Switching Protocols\r\n\r\n")
+		}, ws.ErrMalformedResponse},
+		{"unrequested protocol", func(req []byte) []byte {
+			return upgradeResponse(t, &ws.Upgrader{Protocol: func([]byte) bool { return true }}, req)
+		}, ws.ErrHandshakeBadSubProtocol},
+	}
+
+	for _, tt := range tests {
+		d := &ws.Dialer{}
+		if tt.name == "unrequested protocol" {
+			// 请求头中的 subprotocol 由 Dialer.Header 写入，Dialer 并不知道
+			d.Header = ws.HandshakeHeaderString("Sec-WebSocket-Protocol: chat\r\n")
+		}
+		p, c, req := newClientConn(t, d)
+		done, _ := c.Get(handshakeKey)
+
+		buffer := ringbuffer.New(1024)
+		_, _ = buffer.Write(tt.resp(req))
+		if ctx, _ := p.UnPacket(c, buffer); ctx != nil {
+			t.Fatalf("%s: handshake should fail", tt.name)
+		}
+		if err := <-done.(chan error); err != tt.err {
+			t.Fatalf("%s: got %v, want %v", tt.name, err, tt.err)
+		}
+		if _, ok := c.Get(closingKey); !ok {
+			t.Fatalf("%s: connection should be closing", tt.name)
+		}
+	}
+}
+
+func TestClient_MaskFrames(t *testing.T) {
+	p, c, _ := newClientConn(t, &ws.Dialer{})
+	c.Set(upgradedKey, true)
+
+	msg := strings.Repeat("fastnet", 10)
+	data, _ := util.PackFragments(ws.MessageText, []byte(msg), 16)
+	ping, _ := ws.FrameToBytes(ws.NewPingFrame([]byte("p")))
+	out := p.Packet(c, append(data, ping...))
+
+	// 每个数据帧都带有掩码
+	buffer := ringbuffer.New(1024)
+	_, _ = buffer.Write(out)
+	for buffer.Length() > 0 {
+		h, err := ws.VirtualReadHeader(buffer)
+		if err != nil || !h.Masked {
+			t.Fatalf("frame should be masked, %v", err)
+		}
+		buffer.VirtualFlush()
+		buffer.Retrieve(int(h.Length))
+	}
+
+	// 服务端可以正确解析
+	server := New(&ws.Upgrader{})
+	sc := newUpgradedConn(t, server)
+	_, _ = buffer.Write(out)
+	if ctx, payload := server.UnPacket(sc, buffer); ctx.(*ws.Header).OpCode != ws.OpText || string(payload) != msg {
+		t.Fatalf("got %q", payload)
+	}
+	if ctx, payload := server.UnPacket(sc, buffer); ctx.(*ws.Header).OpCode != ws.OpPing || string(payload) != "p" {
+		t.Fatalf("got %q", payload)
+	}
+
+	// 客户端收到带掩码的数据帧时关闭连接
+	_, _ = buffer.Write(maskedFrame(ws.OpText, true, "hello"))
+	if ctx, _ := p.UnPacket(c, buffer); ctx != nil {
+		t.Fatal("masked frame should be rejected")
+	}
+	if _, ok := c.Get(closingKey); !ok {
+		t.Fatal("connection should be closing")
+	}
+}
@@ -0,0 +1,334 @@
+package websocket
+
+import (
+	"bytes"
+	"compress/flate"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"sync"
+
+	"github.com/Dongxiem/fastnet/connection"
+	"github.com/Dongxiem/fastnet/plugins/websocket/ws"
+	"github.com/Dongxiem/fastnet/plugins/websocket/ws/util"
+	"github.com/gobwas/httphead"
+)
+
+// permessage-deflate（RFC 7692）
+// See https://tools.ietf.org/html/rfc7692
+
+const (
+	deflateKey       = "fastnet_ws_deflate"
+	deflateExtension = "permessage-deflate"
+
+	serverNoContextTakeover = "server_no_context_takeover"
+	clientNoContextTakeover = "client_no_context_takeover"
+	serverMaxWindowBits     = "server_max_window_bits"
+	clientMaxWindowBits     = "client_max_window_bits"
+
+	// maxWindowBits：compress/flate 固定使用 32K 的滑动窗口
+	maxWindowBits = 15
+	maxWindowSize = 1 << maxWindowBits
+)
+
+var (
+	// deflateTail：压缩之后去掉、解压之前补上的尾部，后面追加一个空的 final block 使解压可以正常结束
+	deflateTail = []byte{0x00, 0x00, 0xff, 0xff, 0x01, 0x00, 0x00, 0xff, 0xff}
+
+	errInvalidCompressedData = errors.New("invalid compressed data")
+
+	flateReaderPool sync.Pool
+	flateWriterPool = map[int]*sync.Pool{}
+	flateWriterMu   sync.Mutex
+)
+
+// deflateParams：协商得到的 permessage-deflate 参数
+type deflateParams struct {
+	serverNoContextTakeover bool
+	clientNoContextTakeover bool
+	// compress：客户端要求的 server_max_window_bits 小于 15 时，服务端只发送不压缩的消息
+	compress bool
+}
+
+// negotiateDeflate：依次检查客户端的 offer，返回第一个可以接受的 offer 对应的应答
+func negotiateDeflate(opts *Options, offers []httphead.Option) (resp httphead.Option, params deflateParams, ok bool) {
+	for _, offer := range offers {
+		if string(offer.Name) != deflateExtension {
+			continue
+		}
+		if resp, params, ok = acceptDeflate(opts, offer); ok {
+			return
+		}
+	}
+	return
+}
+
+// acceptDeflate：检查单个 offer，参数重复、取值非法或者存在未知参数时拒绝该 offer
+func acceptDeflate(opts *Options, offer httphead.Option) (resp httphead.Option, params deflateParams, ok bool) {
+	params = deflateParams{
+		serverNoContextTakeover: opts.ServerNoContextTakeover,
+		clientNoContextTakeover: opts.ClientNoContextTakeover,
+		compress:                true,
+	}
+	resp = httphead.Option{Name: []byte(deflateExtension)}
+
+	var (
+		seen         = map[string]bool{}
+		clientWindow = -1 // -1 表示客户端没有提供 client_max_window_bits
+		valid        = true
+	)
+	offer.Parameters.ForEach(func(k, v []byte) bool {
+		key := string(k)
+		if seen[key] {
+			valid = false
+			return false
+		}
+		seen[key] = true
+
+		switch key {
+		case serverNoContextTakeover:
+			params.serverNoContextTakeover = true
+			valid = len(v) == 0
+		case clientNoContextTakeover:
+			params.clientNoContextTakeover = true
+			valid = len(v) == 0
+		case serverMaxWindowBits:
+			bits, err := parseWindowBits(v)
+			if err != nil {
+				valid = false
+				break
+			}
+			// compress/flate 不支持更小的滑动窗口，协商成功但不压缩发送的消息
+			if bits < maxWindowBits {
+				params.compress = false
+			}
+			resp.Parameters.Set(k, v)
+		case clientMaxWindowBits:
+			clientWindow = 0
+			if len(v) != 0 {
+				bits, err := parseWindowBits(v)
+				if err != nil {
+					valid = false
+					break
+				}
+				clientWindow = bits
+			}
+		default:
+			valid = false
+		}
+		return valid
+	})
+	if !valid {
+		return resp, params, false
+	}
+
+	if params.serverNoContextTakeover {
+		resp.Parameters.Set([]byte(serverNoContextTakeover), nil)
+	}
+	if params.clientNoContextTakeover {
+		resp.Parameters.Set([]byte(clientNoContextTakeover), nil)
+	}
+	// 只有客户端提供了 client_max_window_bits 时，服务端才可以在应答中限制客户端的滑动窗口
+	if bits := opts.ClientMaxWindowBits; bits > 0 && clientWindow >= 0 {
+		if clientWindow > 0 && clientWindow < bits {
+			bits = clientWindow
+		}
+		resp.Parameters.Set([]byte(clientMaxWindowBits), []byte(strconv.Itoa(bits)))
+	}
+	return resp, params, true
+}
+
+// parseWindowBits：滑动窗口的取值范围为 8 到 15
+func parseWindowBits(v []byte) (int, error) {
+	bits, err := strconv.Atoi(string(v))
+	if err != nil || bits < 8 || bits > maxWindowBits {
+		return 0, errors.New("invalid window bits")
+	}
+	return bits, nil
+}
+
+// extensionHook：包装 Upgrader 中用户配置的扩展选择方法，并在握手时协商 permessage-deflate
+func extensionHook(u *ws.Upgrader, opts *Options) func(*connection.Connection, []byte, []httphead.Option) ([]httphead.Option, bool) {
+	custom, check := u.ExtensionCustom, u.Extension
+
+	return func(c *connection.Connection, header []byte, selected []httphead.Option) ([]httphead.Option, bool) {
+		var ok bool
+		switch {
+		case custom != nil:
+			if selected, ok = custom(c, header, selected); !ok {
+				return selected, false
+			}
+		case check != nil:
+			s := httphead.OptionSelector{
+				Flags: httphead.SelectUnique | httphead.SelectCopy,
+				Check: func(opt httphead.Option) bool {
+					return string(opt.Name) != deflateExtension && check(opt)
+				},
+			}
+			if selected, ok = s.Select(header, selected); !ok {
+				return selected, false
+			}
+		}
+
+		for _, opt := range selected {
+			if string(opt.Name) == deflateExtension {
+				return selected, true
+			}
+		}
+		offers, ok := httphead.ParseOptions(header, nil)
+		if !ok {
+			return selected, false
+		}
+		if resp, params, ok := negotiateDeflate(opts, offers); ok {
+			selected = append(selected, resp)
+			c.Set(deflateKey, newDeflateState(params, opts))
+		}
+		return selected, true
+	}
+}
+
+// deflateState：连接的压缩上下文
+// 发送方向的压缩必须在 loop 中进行，保证压缩的顺序与发送的顺序一致
+type deflateState struct {
+	params    deflateParams
+	level     int
+	threshold int
+
+	fw *flate.Writer // 保留上下文时使用，不保留上下文时使用 flateWriterPool
+	fb bytes.Buffer
+
+	fr     io.ReadCloser // 保留上下文时使用，不保留上下文时使用 flateReaderPool
+	window []byte        // 保留上下文时，最近解压的 32K 数据
+}
+
+func newDeflateState(params deflateParams, opts *Options) *deflateState {
+	return &deflateState{
+		params:    params,
+		level:     opts.CompressionLevel,
+		threshold: opts.CompressionThreshold,
+	}
+}
+
+// getDeflateState：获取连接协商得到的压缩上下文，没有协商 permessage-deflate 时返回 nil
+func getDeflateState(c *connection.Connection) *deflateState {
+	v, ok := c.Get(deflateKey)
+	if !ok {
+		return nil
+	}
+	return v.(*deflateState)
+}
+
+// shouldCompress：是否压缩发送的消息
+func (d *deflateState) shouldCompress(data []byte) bool {
+	return d.params.compress && len(data) >= d.threshold
+}
+
+// deflate：压缩消息，去掉末尾的 0x00 0x00 0xff 0xff
+func (d *deflateState) deflate(data []byte) ([]byte, error) {
+	d.fb.Reset()
+
+	fw := d.fw
+	if d.params.serverNoContextTakeover {
+		fw = getFlateWriter(d.level, &d.fb)
+		defer putFlateWriter(d.level, fw)
+	} else if fw == nil {
+		var err error
+		if fw, err = flate.NewWriter(&d.fb, d.level); err != nil {
+			return nil, err
+		}
+		d.fw = fw
+	}
+
+	if _, err := fw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := fw.Flush(); err != nil {
+		return nil, err
+	}
+
+	out := bytes.TrimSuffix(d.fb.Bytes(), deflateTail[:4])
+	if len(out) == 0 {
+		return []byte{0x00}, nil
+	}
+	return append([]byte(nil), out...), nil
+}
+
+// inflate：解压消息，解压之后超过 max 返回 ws.ErrProtocolMessageTooBig
+func (d *deflateState) inflate(data []byte, max int) ([]byte, error) {
+	in := io.MultiReader(bytes.NewReader(data), bytes.NewReader(deflateTail))
+
+	var dict []byte
+	if !d.params.clientNoContextTakeover {
+		dict = d.window
+	}
+
+	fr := d.fr
+	if d.params.clientNoContextTakeover {
+		fr = getFlateReader(in)
+		defer flateReaderPool.Put(fr)
+	} else if fr == nil {
+		fr = flate.NewReaderDict(in, dict)
+		d.fr = fr
+	} else if err := fr.(flate.Resetter).Reset(in, dict); err != nil {
+		return nil, err
+	}
+
+	out, err := ioutil.ReadAll(io.LimitReader(fr, int64(max)+1))
+	if err != nil {
+		return nil, errInvalidCompressedData
+	}
+	if len(out) > max {
+		return nil, ws.ErrProtocolMessageTooBig
+	}
+
+	if !d.params.clientNoContextTakeover {
+		d.window = append(d.window, out...)
+		if len(d.window) > maxWindowSize {
+			d.window = append(d.window[:0], d.window[len(d.window)-maxWindowSize:]...)
+		}
+	}
+	return out, nil
+}
+
+// pack：封装消息，必须在 loop 中调用
+func (d *deflateState) pack(messageType ws.MessageType, data []byte, fragmentSize int) ([]byte, error) {
+	compressed, err := d.deflate(data)
+	if err != nil {
+		return nil, err
+	}
+	return util.PackMessage(messageType, compressed, fragmentSize, true)
+}
+
+func getFlateWriter(level int, w io.Writer) *flate.Writer {
+	flateWriterMu.Lock()
+	pool, ok := flateWriterPool[level]
+	if !ok {
+		pool = &sync.Pool{}
+		flateWriterPool[level] = pool
+	}
+	flateWriterMu.Unlock()
+
+	if fw, ok := pool.Get().(*flate.Writer); ok {
+		fw.Reset(w)
+		return fw
+	}
+	// level 在 Options 中已经校验过
+	fw, _ := flate.NewWriter(w, level)
+	return fw
+}
+
+func putFlateWriter(level int, fw *flate.Writer) {
+	flateWriterMu.Lock()
+	pool := flateWriterPool[level]
+	flateWriterMu.Unlock()
+	pool.Put(fw)
+}
+
+func getFlateReader(r io.Reader) io.ReadCloser {
+	if fr, ok := flateReaderPool.Get().(io.ReadCloser); ok {
+		_ = fr.(flate.Resetter).Reset(r, nil)
+		return fr
+	}
+	return flate.NewReader(r)
+}
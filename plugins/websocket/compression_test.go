@@ -0,0 +1,176 @@
+package websocket
+
+import (
+	"bytes"
+	"compress/flate"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/Dongxiem/fastnet/plugins/websocket/ws"
+	"github.com/Dongxiem/fastnet/tool/ringbuffer"
+	"github.com/gobwas/httphead"
+)
+
+func TestNegotiateDeflate(t *testing.T) {
+	tests := []struct {
+		offer    string
+		opts     []Option
+		resp     string
+		compress bool
+	}{
+		{"permessage-deflate", nil, "permessage-deflate", true},
+		{"permessage-deflate; client_max_window_bits", []Option{ClientMaxWindowBits(10)}, "permessage-deflate;client_max_window_bits=10", true},
+		{"permessage-deflate; client_max_window_bits=9", []Option{ClientMaxWindowBits(10)}, "permessage-deflate;client_max_window_bits=9", true},
+		{"permessage-deflate; server_no_context_takeover", nil, "permessage-deflate;server_no_context_takeover", true},
+		{"permessage-deflate", []Option{ClientNoContextTakeover(true)}, "permessage-deflate;client_no_context_takeover", true},
+		{"permessage-deflate; server_max_window_bits=10", nil, "permessage-deflate;server_max_window_bits=10", false},
+		// 第一个 offer 参数非法，选择第二个
+		{"permessage-deflate; server_max_window_bits=7, permessage-deflate", nil, "permessage-deflate", true},
+		{"permessage-deflate; unknown", nil, "", false},
+		{"permessage-deflate; server_no_context_takeover; server_no_context_takeover", nil, "", false},
+		{"x-webkit-deflate-frame", nil, "", false},
+	}
+
+	for _, tt := range tests {
+		offers, ok := httphead.ParseOptions([]byte(tt.offer), nil)
+		if !ok {
+			t.Fatalf("%q: parse fail", tt.offer)
+		}
+		resp, params, ok := negotiateDeflate(newOptions(tt.opts...), offers)
+		if tt.resp == "" {
+			if ok {
+				t.Fatalf("%q: should be declined", tt.offer)
+			}
+			continue
+		}
+
+		var buf bytes.Buffer
+		_, _ = httphead.WriteOptions(&buf, []httphead.Option{resp})
+		if !ok || buf.String() != tt.resp || params.compress != tt.compress {
+			t.Fatalf("%q: got %q compress %v", tt.offer, buf.String(), params.compress)
+		}
+	}
+}
+
+// compressedFrame：模拟客户端，使用同一个压缩上下文压缩消息并封装为带掩码的数据帧
+func compressedFrame(fw *flate.Writer, buf *bytes.Buffer, payload string) []byte {
+	buf.Reset()
+	_, _ = fw.Write([]byte(payload))
+	_ = fw.Flush()
+	p := bytes.TrimSuffix(buf.Bytes(), []byte{0, 0, 0xff, 0xff})
+
+	h := ws.Header{Fin: true, Rsv: ws.Rsv1, OpCode: ws.OpText, Masked: true, Mask: [4]byte{1, 2, 3, 4}, Length: int64(len(p))}
+	ret, _ := ws.WriteHeader(&h)
+	p = append([]byte(nil), p...)
+	ws.Cipher(p, h.Mask, 0)
+	return append(ret, p...)
+}
+
+func TestProtocol_Inflate(t *testing.T) {
+	for _, noContextTakeover := range []bool{false, true} {
+		p := New(&ws.Upgrader{}, Compression(true), MaxMessageSize(1024))
+		c := newUpgradedConn(t, p)
+		c.Set(deflateKey, newDeflateState(deflateParams{compress: true, clientNoContextTakeover: noContextTakeover}, p.opts))
+
+		var buf bytes.Buffer
+		fw, _ := flate.NewWriter(&buf, flate.BestSpeed)
+		msg := `{"id":1,"name":"fastnet","tags":["a","b","c"]}`
+
+		buffer := ringbuffer.New(1024)
+		for i := 0; i < 3; i++ {
+			// 客户端不保留上下文时，每个消息使用新的压缩上下文
+			if noContextTakeover {
+				fw.Reset(&buf)
+			}
+			_, _ = buffer.Write(compressedFrame(fw, &buf, msg))
+			ctx, out := p.UnPacket(c, buffer)
+			if h := ctx.(*ws.Header); h.Rsv != 0 || string(out) != msg {
+				t.Fatalf("message %d: got %v %q", i, h, out)
+			}
+		}
+
+		// 解压之后超过 MaxMessageSize
+		_, _ = buffer.Write(compressedFrame(fw, &buf, strings.Repeat("a", 2048)))
+		if ctx, _ := p.UnPacket(c, buffer); ctx != nil {
+			t.Fatal("message should be too big")
+		}
+		if _, ok := c.Get(closingKey); !ok {
+			t.Fatal("connection should be closing")
+		}
+	}
+}
+
+func TestProtocol_Rsv1WithoutDeflate(t *testing.T) {
+	p := New(&ws.Upgrader{})
+	c := newUpgradedConn(t, p)
+
+	var buf bytes.Buffer
+	fw, _ := flate.NewWriter(&buf, flate.BestSpeed)
+	buffer := ringbuffer.New(64)
+	_, _ = buffer.Write(compressedFrame(fw, &buf, "hello"))
+	if ctx, _ := p.UnPacket(c, buffer); ctx != nil {
+		t.Fatal("rsv1 should be rejected")
+	}
+	if _, ok := c.Get(closingKey); !ok {
+		t.Fatal("connection should be closing")
+	}
+}
+
+func TestHandlerWrap_Deflate(t *testing.T) {
+	for _, noContextTakeover := range []bool{false, true} {
+		u := &ws.Upgrader{}
+		p := New(u, Compression(true), CompressionThreshold(16), FragmentSize(8))
+		wrap := NewHandlerWrap(u, nil, Compression(true), CompressionThreshold(16), FragmentSize(8))
+		c := newUpgradedConn(t, p)
+		d := newDeflateState(deflateParams{compress: true, serverNoContextTakeover: noContextTakeover}, p.opts)
+		c.Set(deflateKey, d)
+
+		// 服务端压缩之后交给同一个 Protocol 解析，验证分片、RSV1 与压缩上下文
+		client := newDeflateState(deflateParams{clientNoContextTakeover: noContextTakeover}, p.opts)
+		msg := strings.Repeat("fastnet websocket ", 8)
+		for i := 0; i < 3; i++ {
+			out, err := wrap.pack(c, ws.MessageText, []byte(msg))
+			if err != nil {
+				t.Fatal(err)
+			}
+			// 保留上下文时，之后的消息压缩之后可能不需要分片
+			if out[0]&0x7f != 0x41 {
+				t.Fatalf("message %d: first frame should be compressed text frame, got %x", i, out[0])
+			}
+
+			c.Set(deflateKey, client)
+			buffer := ringbuffer.New(1024)
+			_, _ = buffer.Write(maskFrames(out))
+			ctx, data := p.UnPacket(c, buffer)
+			if ctx == nil || string(data) != msg {
+				t.Fatalf("message %d: got %q", i, data)
+			}
+			c.Set(deflateKey, d)
+		}
+
+		// 小于 CompressionThreshold 的消息不压缩
+		out, _ := wrap.pack(c, ws.MessageText, []byte("small"))
+		if out[0] != 0x81 {
+			t.Fatalf("small message should not be compressed, got %x", out[0])
+		}
+	}
+}
+
+func TestDeflateState_Empty(t *testing.T) {
+	d := newDeflateState(deflateParams{compress: true}, newOptions())
+	out, err := d.deflate(nil)
+	if err != nil || !bytes.Equal(out, []byte{0x00}) {
+		t.Fatalf("got % x, %v", out, err)
+	}
+	if out, err = d.inflate(out, 16); err != nil || len(out) != 0 {
+		t.Fatalf("got % x, %v", out, err)
+	}
+
+	// 标准库可以解压压缩之后的数据
+	out, _ = d.deflate([]byte("hello"))
+	r := flate.NewReader(bytes.NewReader(append(out, deflateTail...)))
+	if data, err := ioutil.ReadAll(r); err != nil || string(data) != "hello" {
+		t.Fatalf("got %q, %v", data, err)
+	}
+}
@@ -0,0 +1,70 @@
+package websocket
+
+import (
+	"bytes"
+
+	"github.com/Dongxiem/fastnet/connection"
+	"github.com/Dongxiem/fastnet/plugins/http"
+	"github.com/Dongxiem/fastnet/tool/ringbuffer"
+)
+
+const httpKey = "fastnet_ws_http"
+
+var (
+	headerEnd    = []byte("\r\n\r\n")
+	headerSep    = []byte("\r\n")
+	upgradeKey   = []byte("Upgrade")
+	websocketTok = []byte("websocket")
+)
+
+// fallback：连接的第一个请求不是 websocket 握手请求时，之后的请求都交给 HTTP Protocol 解析
+// handled 为 false 时按照 websocket 握手处理
+func (p *Protocol) fallback(c *connection.Connection, buffer *ringbuffer.RingBuffer) (ctx interface{}, handled bool) {
+	if _, ok := c.Get(httpKey); !ok {
+		ready, upgrade := isUpgradeRequest(buffer, p.http.Options().MaxHeaderSize)
+		if !ready {
+			return nil, true
+		}
+		if upgrade {
+			return nil, false
+		}
+		c.Set(httpKey, true)
+	}
+	ctx, _ = p.http.UnPacket(c, buffer)
+	return ctx, true
+}
+
+// isUpgradeRequest：ready 表示请求头是否完整，upgrade 表示是否包含 Upgrade: websocket
+// 请求头超过 HTTP Protocol 配置的 MaxHeaderSize 时交给 HTTP Protocol 返回错误
+func isUpgradeRequest(buffer *ringbuffer.RingBuffer, maxHeaderSize int) (ready, upgrade bool) {
+	i := buffer.Index(headerEnd)
+	if i < 0 {
+		return buffer.Length() > maxHeaderSize, false
+	}
+
+	first, end := buffer.Peek(i)
+	head := make([]byte, 0, i)
+	head = append(append(head, first...), end...)
+
+	lines := bytes.Split(head, headerSep)
+	for _, line := range lines[1:] {
+		j := bytes.IndexByte(line, ':')
+		if j < 0 || !bytes.EqualFold(bytes.TrimSpace(line[:j]), upgradeKey) {
+			continue
+		}
+		for _, token := range bytes.Split(line[j+1:], []byte{','}) {
+			if bytes.EqualFold(bytes.TrimSpace(token), websocketTok) {
+				return true, true
+			}
+		}
+	}
+	return true, false
+}
+
+// newHTTPWrap：配置了 HTTPHandler 时创建 HTTP Handler 包装
+func newHTTPWrap(opts *Options) *http.HandlerWrap {
+	if opts.HTTPHandler == nil {
+		return nil
+	}
+	return http.NewHandlerWrap(opts.HTTPHandler)
+}
@@ -0,0 +1,107 @@
+package websocket
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Dongxiem/fastnet/connection"
+	"github.com/Dongxiem/fastnet/eventloop"
+	"github.com/Dongxiem/fastnet/plugins/http"
+	"github.com/Dongxiem/fastnet/plugins/websocket/ws"
+	"github.com/Dongxiem/fastnet/tool/ringbuffer"
+)
+
+// serve：依次解析 in 中的请求，返回所有应答
+func serve(t *testing.T, p *Protocol, wrap *HandlerWrap, in string) (*connection.Connection, string) {
+	loop, err := eventloop.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := connection.New(-1, loop, nil, p, nil, 0, wrap)
+
+	buffer := ringbuffer.New(1024)
+	_, _ = buffer.WriteString(in)
+	var out []byte
+	for {
+		ctx, data := p.UnPacket(c, buffer)
+		if ctx == nil && len(data) == 0 {
+			break
+		}
+		out = append(out, wrap.OnMessage(c, ctx, data)...)
+	}
+	return c, string(out)
+}
+
+func TestProtocol_HTTPFallback(t *testing.T) {
+	router := http.NewRouter()
+	router.GET("/health", func(c *connection.Connection, req *http.Request) *http.Response {
+		return http.Text(200, "ok")
+	})
+	u := &ws.Upgrader{}
+	opts := []Option{HTTPFallback(router)}
+	p := New(u, opts...)
+	wrap := NewHandlerWrap(u, &stubHandler{}, opts...)
+
+	// 同一个连接上的多个 HTTP 请求
+	c, out := serve(t, p, wrap, "GET /health HTTP/1.1\r\nHost: localhost\r\n\r\n"+
+		"GET /metrics HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	if !strings.HasPrefix(out, "HTTP/1.1 200 OK\r\n") || !strings.Contains(out, "\r\n\r\nokHTTP/1.1 404 Not Found\r\n") {
+		t.Fatalf("got %q", out)
+	}
+	if _, ok := c.Get(upgradedKey); ok {
+		t.Fatal("http connection should not be upgraded")
+	}
+
+	// websocket 握手请求
+	c, out = serve(t, p, wrap, upgradeRequest("/chat", ""))
+	if !strings.HasPrefix(out, "HTTP/1.1 101 Switching Protocols\r\n") {
+		t.Fatalf("got %q", out)
+	}
+	if _, ok := c.Get(upgradedKey); !ok {
+		t.Fatal("connection should be upgraded")
+	}
+
+	// 请求头不完整时等待更多数据
+	if _, out = serve(t, p, wrap, "GET /health HTTP/1.1\r\nHost: localhost\r\n"); out != "" {
+		t.Fatalf("got %q", out)
+	}
+
+	// 请求头超过配置的 MaxHeaderSize 时返回 431，不再等待更多数据
+	opts = []Option{HTTPFallback(router, http.MaxHeaderSize(128))}
+	p = New(u, opts...)
+	_, out = serve(t, p, NewHandlerWrap(u, &stubHandler{}, opts...), "GET /health HTTP/1.1\r\nX-Long: "+strings.Repeat("a", 256))
+	if !strings.HasPrefix(out, "HTTP/1.1 431 ") {
+		t.Fatalf("got %q", out)
+	}
+
+	// 没有配置 HTTPHandler 时拒绝握手并关闭连接
+	p = New(u)
+	c, out = serve(t, p, NewHandlerWrap(u, &stubHandler{}), "GET /health HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	if !strings.HasPrefix(out, "HTTP/1.1 400 Bad Request\r\n") {
+		t.Fatalf("got %q", out)
+	}
+	if _, ok := c.Get(closingKey); !ok {
+		t.Fatal("connection should be closing")
+	}
+}
+
+func TestIsUpgradeRequest(t *testing.T) {
+	tests := []struct {
+		in             string
+		ready, upgrade bool
+	}{
+		{"GET / HTTP/1.1\r\nHost: a\r\n", false, false},
+		{"GET / HTTP/1.1\r\nHost: a\r\n\r\n", true, false},
+		{"GET / HTTP/1.1\r\nupgrade:  WebSocket \r\n\r\n", true, true},
+		{"GET / HTTP/1.1\r\nUpgrade: h2c, websocket\r\n\r\n", true, true},
+		{"GET / HTTP/1.1\r\nUpgrade: h2c\r\n\r\n", true, false},
+		{"GET / HTTP/1.1\r\nX-Long: " + strings.Repeat("a", 128), true, false},
+	}
+	for _, tt := range tests {
+		buffer := ringbuffer.New(0)
+		_, _ = buffer.WriteString(tt.in)
+		if ready, upgrade := isUpgradeRequest(buffer, 128); ready != tt.ready || upgrade != tt.upgrade {
+			t.Fatalf("%q: got %v %v", tt.in, ready, upgrade)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package websocket
+
+import (
+	"encoding/binary"
+	"time"
+
+	"github.com/Dongxiem/fastnet/connection"
+	"github.com/Dongxiem/fastnet/log"
+	"github.com/Dongxiem/fastnet/plugins/websocket/ws"
+	"github.com/Dongxiem/fastnet/tool/sync/atomic"
+)
+
+const keepaliveKey = "fastnet_ws_keepalive"
+
+// keepalive：每个连接的 ping/pong 状态
+type keepalive struct {
+	pingTime atomic.Int64 // 等待 pong 的 ping 的发送时间（纳秒），0 表示没有等待中的 ping
+	rtt      atomic.Int64 // 最近一次 ping/pong 的往返时间（纳秒）
+}
+
+// getKeepalive：获取连接的 ping/pong 状态
+func getKeepalive(c *connection.Connection) *keepalive {
+	v, ok := c.Get(keepaliveKey)
+	if !ok {
+		return nil
+	}
+	return v.(*keepalive)
+}
+
+// RTT：返回连接最近一次 ping/pong 的往返时间，没有启用 PingInterval 或者还没有收到 pong 时返回 0
+func RTT(c *connection.Connection) time.Duration {
+	if k := getKeepalive(c); k != nil {
+		return time.Duration(k.rtt.Get())
+	}
+	return 0
+}
+
+// startKeepalive：握手完成之后启动 ping 定时器
+func (s *HandlerWrap) startKeepalive(c *connection.Connection) {
+	if s.opts.PingInterval <= 0 {
+		return
+	}
+	k := &keepalive{}
+	c.Set(keepaliveKey, k)
+	c.RunAfter(s.opts.PingInterval, s.ping(c, k))
+}
+
+// ping：发送 ping，负载为发送时间，并在 PongTimeout 之后检查是否收到 pong
+func (s *HandlerWrap) ping(c *connection.Connection, k *keepalive) func() {
+	return func() {
+		if !c.Connected() {
+			return
+		}
+
+		// 上一个 ping 还没有收到 pong 时不发送新的 ping，由它的 pongDeadline 关闭连接
+		// 默认 PongTimeout 与 PingInterval 相同，两个定时器可能在同一个 tick 中以任意顺序执行
+		now := time.Now().UnixNano()
+		if !k.pingTime.CompareAndSwap(0, now) {
+			c.RunAfter(s.opts.PingInterval, s.ping(c, k))
+			return
+		}
+
+		payload := make([]byte, 8)
+		binary.BigEndian.PutUint64(payload, uint64(now))
+		frame, err := ws.FrameToBytes(ws.NewPingFrame(payload))
+		if err != nil {
+			log.Error(err)
+			return
+		}
+
+		// ping 经过 Send 在连接所属的 loop 中发送
+		if err = c.Send(frame); err != nil {
+			return
+		}
+		c.RunAfter(s.opts.PongTimeout, s.pongDeadline(c, k, now))
+		c.RunAfter(s.opts.PingInterval, s.ping(c, k))
+	}
+}
+
+// pongDeadline：发送时间为 sent 的 ping 在 PongTimeout 内没有收到 pong，以 1001 关闭连接
+func (s *HandlerWrap) pongDeadline(c *connection.Connection, k *keepalive, sent int64) func() {
+	return func() {
+		if !c.Connected() || k.pingTime.Get() != sent {
+			return
+		}
+
+		log.Info("Websocket pong timeout: ", c.PeerAddr())
+		c.Set(closingKey, true)
+		if frame, err := ws.FrameToBytes(ws.NewCloseFrame(ws.NewCloseFrameBody(ws.StatusGoingAway, "pong timeout"))); err == nil {
+			_ = c.Send(frame)
+		}
+		_ = c.CloseAfterFlush()
+	}
+}
+
+// handlePong：收到 pong，负载与等待中的 ping 一致时记录往返时间，其余的 pong 直接忽略
+func (s *HandlerWrap) handlePong(c *connection.Connection, payload []byte) {
+	k := getKeepalive(c)
+	if k == nil || len(payload) != 8 {
+		return
+	}
+
+	sent := int64(binary.BigEndian.Uint64(payload))
+	if sent == 0 || !k.pingTime.CompareAndSwap(sent, 0) {
+		return
+	}
+	_ = k.rtt.Swap(time.Now().UnixNano() - sent)
+}
@@ -0,0 +1,137 @@
+package websocket
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/Dongxiem/fastnet/connection"
+	"github.com/Dongxiem/fastnet/eventloop"
+	"github.com/Dongxiem/fastnet/plugins/websocket/ws"
+	"github.com/RussellLuo/timingwheel"
+)
+
+func TestHandlerWrap_Pong(t *testing.T) {
+	u := &ws.Upgrader{}
+	p := New(u)
+	wrap := NewHandlerWrap(u, nil, PingInterval(time.Minute))
+	c := newUpgradedConn(t, p)
+	k := &keepalive{}
+	c.Set(keepaliveKey, k)
+
+	sent := time.Now().Add(-time.Millisecond).UnixNano()
+	_ = k.pingTime.Swap(sent)
+	payload := make([]byte, 8)
+
+	// 与等待中的 ping 不一致的 pong 直接忽略
+	binary.BigEndian.PutUint64(payload, uint64(sent-1))
+	if out := wrap.OnMessage(c, &ws.Header{Fin: true, OpCode: ws.OpPong, Length: 8}, payload); out != nil {
+		t.Fatalf("pong should not be answered, got % x", out)
+	}
+	if RTT(c) != 0 || k.pingTime.Get() != sent {
+		t.Fatal("unsolicited pong should be ignored")
+	}
+
+	binary.BigEndian.PutUint64(payload, uint64(sent))
+	if out := wrap.OnMessage(c, &ws.Header{Fin: true, OpCode: ws.OpPong, Length: 8}, payload); out != nil {
+		t.Fatalf("pong should not be answered, got % x", out)
+	}
+	if RTT(c) < time.Millisecond || k.pingTime.Get() != 0 {
+		t.Fatalf("rtt should be recorded, got %v", RTT(c))
+	}
+}
+
+func TestHandlerWrap_PongTimeout(t *testing.T) {
+	loop, err := eventloop.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tw := timingwheel.NewTimingWheel(time.Millisecond, 20)
+	tw.Start()
+	defer tw.Stop()
+
+	u := &ws.Upgrader{}
+	p := New(u)
+	wrap := NewHandlerWrap(u, nil, PingInterval(20*time.Millisecond), PongTimeout(10*time.Millisecond))
+	c := connection.New(-1, loop, nil, p, tw, 0, nil)
+	c.Set(upgradedKey, true)
+
+	wrap.startKeepalive(c)
+	k := getKeepalive(c)
+
+	// 第一个 ping 发送之后没有收到 pong
+	deadline := time.Now().Add(time.Second)
+	for k.pingTime.Get() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("ping should be sent")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	for {
+		if _, ok := c.Get(closingKey); ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("connection should be closing after pong timeout")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestHandlerWrap_PongTimeoutDefault(t *testing.T) {
+	loop, err := eventloop.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tw := timingwheel.NewTimingWheel(time.Millisecond, 20)
+	tw.Start()
+	defer tw.Stop()
+
+	// 默认 PongTimeout 与 PingInterval 相同
+	u := &ws.Upgrader{}
+	p := New(u)
+	wrap := NewHandlerWrap(u, nil, PingInterval(20*time.Millisecond))
+	c := connection.New(-1, loop, nil, p, tw, 0, nil)
+	c.Set(upgradedKey, true)
+	k := &keepalive{}
+	c.Set(keepaliveKey, k)
+
+	// 下一个 ping 先于上一个 ping 的 pongDeadline 执行，不能覆盖等待中的 ping
+	sent := time.Now().UnixNano()
+	_ = k.pingTime.Swap(sent)
+	wrap.ping(c, k)()
+	if k.pingTime.Get() != sent {
+		t.Fatal("ping should not be sent while another one is unanswered")
+	}
+	wrap.pongDeadline(c, k, sent)()
+	if _, ok := c.Get(closingKey); !ok {
+		t.Fatal("connection should be closing after pong timeout")
+	}
+
+	// 使用定时器，对端一直没有回复 pong
+	c = connection.New(-1, loop, nil, p, tw, 0, nil)
+	c.Set(upgradedKey, true)
+	wrap.startKeepalive(c)
+	deadline := time.Now().Add(time.Second)
+	for {
+		if _, ok := c.Get(closingKey); ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("connection should be closing after pong timeout")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestOptions_PongTimeout(t *testing.T) {
+	if opts := newOptions(PingInterval(time.Second)); opts.PongTimeout != time.Second {
+		t.Fatalf("got %v", opts.PongTimeout)
+	}
+	if opts := newOptions(PingInterval(time.Second), PongTimeout(2*time.Second)); opts.PongTimeout != time.Second {
+		t.Fatalf("got %v", opts.PongTimeout)
+	}
+	if opts := newOptions(PingInterval(time.Second), PongTimeout(time.Millisecond)); opts.PongTimeout != time.Millisecond {
+		t.Fatalf("got %v", opts.PongTimeout)
+	}
+}
@@ -0,0 +1,174 @@
+package websocket
+
+import (
+	"compress/flate"
+	"time"
+
+	"github.com/Dongxiem/fastnet/plugins/http"
+)
+
+// Options：websocket 配置
+type Options struct {
+	MaxMessageSize int // 分片重组（解压）之后消息的最大长度，超过则以 1009 关闭连接
+	MaxFrameSize   int // 单个数据帧 payload 的最大长度，超过则以 1009 关闭连接，默认与 MaxMessageSize 相同
+	FragmentSize   int // 发送的消息超过该长度时自动分片，小于 0 时不分片
+
+	HandshakeTimeout time.Duration // 客户端建立连接与完成握手的超时时间
+
+	PingInterval time.Duration // 握手完成之后每隔 PingInterval 发送一次 ping，小于等于 0 时不发送
+	PongTimeout  time.Duration // 发送 ping 之后 PongTimeout 内没有收到 pong 则以 1001 关闭连接，默认与 PingInterval 相同
+	CloseTimeout time.Duration // CloseWithCode 发送 close frame 之后等待对端 close frame 的超时时间
+
+	// permessage-deflate 配置
+	Compression             bool // 是否启用 permessage-deflate
+	CompressionLevel        int  // 压缩级别，默认为 flate.BestSpeed
+	CompressionThreshold    int  // 小于该长度的消息不压缩
+	ServerNoContextTakeover bool // 服务端每个消息使用新的压缩上下文，可以节省每个连接约 1M 的内存
+	ClientNoContextTakeover bool // 要求客户端每个消息使用新的压缩上下文
+	ClientMaxWindowBits     int  // 客户端提供 client_max_window_bits 时，限制客户端的滑动窗口，取值为 8 到 15
+
+	// 第一个请求不是 websocket 握手请求的连接交给 HTTPHandler 处理，为 nil 时拒绝握手
+	HTTPHandler http.Handler
+	HTTPOptions []http.Option
+}
+
+// Option ...
+type Option func(*Options)
+
+// newOptions：返回一个新的 Options 配置
+func newOptions(opt ...Option) *Options {
+	opts := Options{}
+
+	for _, o := range opt {
+		o(&opts)
+	}
+	if opts.MaxMessageSize <= 0 {
+		opts.MaxMessageSize = 16 * 1024 * 1024
+	}
+	if opts.MaxFrameSize <= 0 || opts.MaxFrameSize > opts.MaxMessageSize {
+		opts.MaxFrameSize = opts.MaxMessageSize
+	}
+	if opts.FragmentSize == 0 {
+		opts.FragmentSize = 64 * 1024
+	}
+	if opts.HandshakeTimeout <= 0 {
+		opts.HandshakeTimeout = 10 * time.Second
+	}
+	if opts.CloseTimeout <= 0 {
+		opts.CloseTimeout = 5 * time.Second
+	}
+	// PongTimeout 不能超过 PingInterval，等待 pong 期间不会发送新的 ping
+	if opts.PongTimeout <= 0 || opts.PongTimeout > opts.PingInterval {
+		opts.PongTimeout = opts.PingInterval
+	}
+	if opts.CompressionLevel == 0 || opts.CompressionLevel < flate.HuffmanOnly || opts.CompressionLevel > flate.BestCompression {
+		opts.CompressionLevel = flate.BestSpeed
+	}
+	if opts.CompressionThreshold <= 0 {
+		opts.CompressionThreshold = 256
+	}
+	if opts.ClientMaxWindowBits != 0 && (opts.ClientMaxWindowBits < 8 || opts.ClientMaxWindowBits > maxWindowBits) {
+		opts.ClientMaxWindowBits = 0
+	}
+
+	return &opts
+}
+
+// MaxMessageSize：消息的最大长度
+func MaxMessageSize(n int) Option {
+	return func(o *Options) {
+		o.MaxMessageSize = n
+	}
+}
+
+// MaxFrameSize：单个数据帧的最大长度
+func MaxFrameSize(n int) Option {
+	return func(o *Options) {
+		o.MaxFrameSize = n
+	}
+}
+
+// FragmentSize：发送消息时的分片大小，小于 0 时不分片
+func FragmentSize(n int) Option {
+	return func(o *Options) {
+		o.FragmentSize = n
+	}
+}
+
+// HandshakeTimeout：客户端建立连接与完成握手的超时时间
+func HandshakeTimeout(d time.Duration) Option {
+	return func(o *Options) {
+		o.HandshakeTimeout = d
+	}
+}
+
+// PingInterval：发送 ping 的间隔
+func PingInterval(d time.Duration) Option {
+	return func(o *Options) {
+		o.PingInterval = d
+	}
+}
+
+// PongTimeout：等待 pong 的超时时间
+func PongTimeout(d time.Duration) Option {
+	return func(o *Options) {
+		o.PongTimeout = d
+	}
+}
+
+// CloseTimeout：CloseWithCode 等待对端 close frame 的超时时间
+func CloseTimeout(d time.Duration) Option {
+	return func(o *Options) {
+		o.CloseTimeout = d
+	}
+}
+
+// Compression：启用 permessage-deflate
+func Compression(b bool) Option {
+	return func(o *Options) {
+		o.Compression = b
+	}
+}
+
+// CompressionLevel：压缩级别
+func CompressionLevel(level int) Option {
+	return func(o *Options) {
+		o.CompressionLevel = level
+	}
+}
+
+// CompressionThreshold：小于该长度的消息不压缩
+func CompressionThreshold(n int) Option {
+	return func(o *Options) {
+		o.CompressionThreshold = n
+	}
+}
+
+// ServerNoContextTakeover：服务端每个消息使用新的压缩上下文
+func ServerNoContextTakeover(b bool) Option {
+	return func(o *Options) {
+		o.ServerNoContextTakeover = b
+	}
+}
+
+// ClientNoContextTakeover：要求客户端每个消息使用新的压缩上下文
+func ClientNoContextTakeover(b bool) Option {
+	return func(o *Options) {
+		o.ClientNoContextTakeover = b
+	}
+}
+
+// ClientMaxWindowBits：限制客户端的滑动窗口
+func ClientMaxWindowBits(bits int) Option {
+	return func(o *Options) {
+		o.ClientMaxWindowBits = bits
+	}
+}
+
+// HTTPFallback：同一个端口上的普通 HTTP 请求交给 h 处理，例如健康检查、监控指标与静态页面
+func HTTPFallback(h http.Handler, opts ...http.Option) Option {
+	return func(o *Options) {
+		o.HTTPHandler = h
+		o.HTTPOptions = opts
+	}
+}
@@ -1,63 +1,203 @@
 package websocket
 
 import (
-	"github.com/Dongxiem/gfaio/connection"
-	"github.com/Dongxiem/gfaio/log"
-	"github.com/Dongxiem/gfaio/plugins/websocket/ws"
-	"github.com/Dongxiem/gfaio/tool/ringbuffer"
+	"github.com/Dongxiem/fastnet/connection"
+	"github.com/Dongxiem/fastnet/log"
+	"github.com/Dongxiem/fastnet/plugins/http"
+	"github.com/Dongxiem/fastnet/plugins/websocket/ws"
+	"github.com/Dongxiem/fastnet/tool/ringbuffer"
 )
 
-const upgradedKey = "gev_ws_upgraded"
+const (
+	upgradedKey = "fastnet_ws_upgraded"
+	messageKey  = "fastnet_ws_message"
+	closingKey  = "fastnet_ws_closing"
+)
+
+// message：正在重组的分片消息
+type message struct {
+	opCode     ws.OpCode
+	compressed bool
+	payload    []byte
+	checked    int // text 消息中已经校验过 UTF-8 的长度
+}
 
 // Protocol websocket
 type Protocol struct {
 	upgrade *ws.Upgrader
+	dialer  *ws.Dialer     // 客户端模式时不为 nil
+	http    *http.Protocol // 配置了 HTTPHandler 时不为 nil
+	opts    *Options
 }
 
 // New：创建 websocket Protocol
-func New(u *ws.Upgrader) *Protocol {
-	return &Protocol{upgrade: u}
+// 启用 Compression 时会包装 u 的扩展选择方法，在握手时协商 permessage-deflate
+func New(u *ws.Upgrader, opts ...Option) *Protocol {
+	options := newOptions(opts...)
+	if options.Compression {
+		u.ExtensionCustom = extensionHook(u, options)
+	}
+	p := &Protocol{
+		upgrade: u,
+		opts:    options,
+	}
+	if options.HTTPHandler != nil {
+		p.http = http.New(options.HTTPOptions...)
+	}
+	return p
 }
 
 // UnPacket：解析 websocket 协议，返回 header ，payload
+// 分片消息会在重组完成之后作为一个完整的消息返回，控制帧可以穿插在分片之间
 func (p *Protocol) UnPacket(c *connection.Connection, buffer *ringbuffer.RingBuffer) (ctx interface{}, out []byte) {
+	if _, ok := c.Get(closingKey); ok {
+		buffer.RetrieveAll()
+		return
+	}
+
 	_, ok := c.Get(upgradedKey)
-	if !ok {
+	if !ok && p.dialer != nil {
+		ctx = p.handshake(c, buffer)
+	} else if !ok {
+		if p.http != nil {
+			var handled bool
+			if ctx, handled = p.fallback(c, buffer); handled {
+				return
+			}
+		}
+
 		var err error
 		out, _, err = p.upgrade.Upgrade(c, buffer)
 		if err != nil {
 			log.Error("Websocket Upgrade :", err)
+			// 握手被拒绝时返回错误应答，发送之后关闭连接；请求不完整时等待更多数据
+			if len(out) > 0 {
+				buffer.RetrieveAll()
+				c.Set(closingKey, true)
+				_ = c.CloseAfterFlush()
+			}
 			return
 		}
 		c.Set(upgradedKey, true)
 	} else {
+		ctx, out = p.readMessage(c, buffer)
+	}
+	return
+}
+
+// readMessage：读取数据帧，返回控制帧或完整的消息
+func (p *Protocol) readMessage(c *connection.Connection, buffer *ringbuffer.RingBuffer) (ctx interface{}, out []byte) {
+	for {
 		header, err := ws.VirtualReadHeader(buffer)
 		if err != nil {
+			buffer.VirtualRevert()
 			if err != ws.ErrHeaderNotReady {
-				log.Error(err)
+				p.fail(c, buffer, ws.StatusProtocolError, err)
 			}
 			return
 		}
-		if buffer.VirtualLength() >= int(header.Length) {
-			buffer.VirtualFlush()
 
-			payload := make([]byte, int(header.Length))
-			_, _ = buffer.Read(payload)
+		msg := getMessage(c)
+		deflate := getDeflateState(c)
+		if code, err := p.checkHeader(&header, msg, deflate); err != nil {
+			p.fail(c, buffer, code, err)
+			return
+		}
 
-			if header.Masked {
-				ws.Cipher(payload, header.Mask, 0)
+		if buffer.VirtualLength() < int(header.Length) {
+			buffer.VirtualRevert()
+			return
+		}
+		buffer.VirtualFlush()
+
+		payload := make([]byte, int(header.Length))
+		_, _ = buffer.Read(payload)
+		if header.Masked {
+			ws.Cipher(payload, header.Mask, 0)
+		}
+
+		if header.OpCode.IsControl() {
+			if header.OpCode == ws.OpClose {
+				if code, err := checkClose(payload); err != nil {
+					p.fail(c, buffer, code, err)
+					return
+				}
 			}
+			return &header, payload
+		}
 
-			ctx = &header
-			out = payload
+		if header.OpCode == ws.OpContinuation {
+			msg.payload = append(msg.payload, payload...)
 		} else {
-			buffer.VirtualRevert()
+			msg = &message{opCode: header.OpCode, compressed: header.Rsv1(), payload: payload}
+			// 未分片的消息不需要保存
+			if !header.Fin {
+				c.Set(messageKey, msg)
+			}
+		}
+
+		// 未压缩的 text 消息每收到一个分片就校验一次，尽早发现非法的 UTF-8
+		if msg.opCode == ws.OpText && !msg.compressed {
+			var ok bool
+			if msg.checked, ok = checkText(msg.payload, msg.checked, header.Fin); !ok {
+				p.fail(c, buffer, ws.StatusInvalidFramePayloadData, ws.ErrProtocolInvalidUTF8)
+				return
+			}
+		}
+
+		if header.Fin {
+			c.Delete(messageKey)
+			if msg.compressed {
+				if msg.payload, err = deflate.inflate(msg.payload, p.opts.MaxMessageSize); err != nil {
+					code := ws.StatusInvalidFramePayloadData
+					if err == ws.ErrProtocolMessageTooBig {
+						code = ws.StatusMessageTooBig
+					}
+					p.fail(c, buffer, code, err)
+					return
+				}
+				if msg.opCode == ws.OpText {
+					if _, ok := checkText(msg.payload, 0, true); !ok {
+						p.fail(c, buffer, ws.StatusInvalidFramePayloadData, ws.ErrProtocolInvalidUTF8)
+						return
+					}
+				}
+			}
+			return &ws.Header{
+				Fin:    true,
+				OpCode: msg.opCode,
+				Length: int64(len(msg.payload)),
+			}, msg.payload
 		}
 	}
-	return
 }
 
-// Packet：直接返回
+// getMessage：获取连接上正在重组的分片消息
+func getMessage(c *connection.Connection) *message {
+	v, ok := c.Get(messageKey)
+	if !ok {
+		return nil
+	}
+	return v.(*message)
+}
+
+// fail：发送 close frame 并在发送完之后关闭连接，之后收到的数据全部丢弃
+func (p *Protocol) fail(c *connection.Connection, buffer *ringbuffer.RingBuffer, code ws.StatusCode, err error) {
+	buffer.RetrieveAll()
+	log.Error("Websocket :", c.PeerAddr(), err)
+
+	c.Set(closingKey, true)
+	c.Delete(messageKey)
+	if frame, e := ws.FrameToBytes(ws.NewCloseFrame(ws.NewCloseFrameBody(code, err.Error()))); e == nil {
+		_ = c.Send(frame)
+	}
+	_ = c.CloseAfterFlush()
+}
+
+// Packet：服务端直接返回，客户端为数据帧加上掩码
 func (p *Protocol) Packet(c *connection.Connection, data []byte) []byte {
+	if p.dialer != nil {
+		return maskFrames(data)
+	}
 	return data
 }
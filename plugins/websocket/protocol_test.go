@@ -0,0 +1,116 @@
+package websocket
+
+import (
+	"testing"
+
+	"github.com/Dongxiem/fastnet/connection"
+	"github.com/Dongxiem/fastnet/eventloop"
+	"github.com/Dongxiem/fastnet/plugins/websocket/ws"
+	"github.com/Dongxiem/fastnet/plugins/websocket/ws/util"
+	"github.com/Dongxiem/fastnet/tool/ringbuffer"
+)
+
+// maskedFrame：构造客户端发送的带掩码数据帧
+func maskedFrame(op ws.OpCode, fin bool, payload string) []byte {
+	h := ws.Header{Fin: fin, OpCode: op, Masked: true, Mask: [4]byte{1, 2, 3, 4}, Length: int64(len(payload))}
+	ret, _ := ws.WriteHeader(&h)
+	p := []byte(payload)
+	ws.Cipher(p, h.Mask, 0)
+	return append(ret, p...)
+}
+
+func newUpgradedConn(t *testing.T, p *Protocol) *connection.Connection {
+	loop, err := eventloop.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := connection.New(-1, loop, nil, p, nil, 0, nil)
+	c.Set(upgradedKey, true)
+	return c
+}
+
+func TestProtocol_Fragments(t *testing.T) {
+	p := New(&ws.Upgrader{})
+	c := newUpgradedConn(t, p)
+
+	var in []byte
+	in = append(in, maskedFrame(ws.OpText, false, "hel")...)
+	in = append(in, maskedFrame(ws.OpPing, true, "p")...)
+	in = append(in, maskedFrame(ws.OpContinuation, false, "lo ")...)
+	in = append(in, maskedFrame(ws.OpContinuation, true, "world")...)
+	in = append(in, maskedFrame(ws.OpBinary, true, "bin")...)
+
+	// 逐字节写入，模拟数据分多次到达
+	buffer := ringbuffer.New(64)
+	type result struct {
+		op      ws.OpCode
+		payload string
+	}
+	var got []result
+	for _, b := range in {
+		_ = buffer.WriteByte(b)
+		ctx, out := p.UnPacket(c, buffer)
+		if ctx != nil {
+			got = append(got, result{ctx.(*ws.Header).OpCode, string(out)})
+		}
+	}
+
+	want := []result{{ws.OpPing, "p"}, {ws.OpText, "hello world"}, {ws.OpBinary, "bin"}}
+	if len(got) != len(want) || buffer.Length() != 0 {
+		t.Fatalf("got %v, left %d", got, buffer.Length())
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+}
+
+func TestProtocol_FragmentsError(t *testing.T) {
+	tests := []struct {
+		name string
+		in   []byte
+	}{
+		{"unexpected continuation", maskedFrame(ws.OpContinuation, true, "a")},
+		{"continuation expected", append(maskedFrame(ws.OpText, false, "a"), maskedFrame(ws.OpText, true, "b")...)},
+		{"fragmented control", maskedFrame(ws.OpPing, false, "")},
+		{"message too big", append(maskedFrame(ws.OpText, false, "abcde"), maskedFrame(ws.OpContinuation, true, "fghij")...)},
+	}
+	for _, tt := range tests {
+		p := New(&ws.Upgrader{}, MaxMessageSize(8))
+		c := newUpgradedConn(t, p)
+		buffer := ringbuffer.New(64)
+		_, _ = buffer.Write(tt.in)
+
+		for {
+			if ctx, _ := p.UnPacket(c, buffer); ctx == nil {
+				break
+			}
+		}
+		if _, ok := c.Get(closingKey); !ok || buffer.Length() != 0 {
+			t.Fatalf("%s: connection should be closing", tt.name)
+		}
+	}
+}
+
+func TestPackFragments(t *testing.T) {
+	p := New(&ws.Upgrader{})
+	c := newUpgradedConn(t, p)
+
+	data, err := util.PackFragments(ws.MessageText, []byte("hello world"), 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buffer := ringbuffer.New(64)
+	// 客户端发送给服务端的数据帧必须带掩码
+	_, _ = buffer.Write(maskFrames(data))
+	// 第一个分片为 text frame，其余为 continuation frame
+	if first, _ := buffer.Peek(1); first[0] != 0x01 {
+		t.Fatalf("first frame should be non-final text frame, got %x", first[0])
+	}
+
+	ctx, out := p.UnPacket(c, buffer)
+	if h := ctx.(*ws.Header); h.OpCode != ws.OpText || string(out) != "hello world" {
+		t.Fatalf("got %v %q", h.OpCode, out)
+	}
+}
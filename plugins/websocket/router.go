@@ -0,0 +1,228 @@
+package websocket
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/Dongxiem/fastnet/connection"
+	"github.com/Dongxiem/fastnet/plugins/websocket/ws"
+)
+
+const (
+	requestKey = "fastnet_ws_request"
+	routeKey   = "fastnet_ws_route"
+)
+
+var (
+	// ErrRouteNotFound：请求的 path 没有注册 handler
+	ErrRouteNotFound = ws.RejectConnectionError(
+		ws.RejectionStatus(http.StatusNotFound),
+		ws.RejectionReason("websocket route not found"),
+	)
+	// ErrRouteBadSubProtocol：path 对应的 handler 都不支持客户端请求的 subprotocol
+	ErrRouteBadSubProtocol = ws.RejectConnectionError(
+		ws.RejectionStatus(http.StatusBadRequest),
+		ws.RejectionReason("websocket subprotocol not supported"),
+	)
+	// ErrRouteBadURI：无法解析请求的 URI
+	ErrRouteBadURI = ws.RejectConnectionError(
+		ws.RejectionStatus(http.StatusBadRequest),
+		ws.RejectionReason("malformed request uri"),
+	)
+)
+
+// Request：握手请求中的信息，握手时记录在连接上
+type Request struct {
+	Path      string
+	Query     url.Values
+	Host      string
+	Header    http.Header // 不包含 websocket 握手使用的 header
+	Protocols []string    // 客户端请求的 subprotocol
+	Protocol  string      // 协商的 subprotocol，没有协商时为空
+}
+
+// GetRequest：获取连接的握手请求，没有使用 Router 或者还没有收到握手请求时返回 nil
+func GetRequest(c *connection.Connection) *Request {
+	v, ok := c.Get(requestKey)
+	if !ok {
+		return nil
+	}
+	return v.(*Request)
+}
+
+type route struct {
+	protocols []string
+	handler   WSHandler
+}
+
+// Router：按照请求的 path 与 subprotocol 选择 WSHandler，本身实现了 WSHandler
+// 握手完成之后回调所选 handler 的 OnConnect，没有匹配的 handler 时拒绝握手
+type Router struct {
+	routes map[string][]*route
+}
+
+// NewRouter：创建 Router，包装 u 的 OnRequest、OnHost、OnHeader 与 OnBeforeUpgrade 记录握手请求，
+// subprotocol 由 Router 协商，u 原有的 Protocol 与 ProtocolCustom 不再生效
+func NewRouter(u *ws.Upgrader) *Router {
+	r := &Router{routes: make(map[string][]*route)}
+
+	onRequest := u.OnRequest
+	u.OnRequest = func(c *connection.Connection, uri []byte) error {
+		req, err := r.parseURI(uri)
+		if err != nil {
+			return err
+		}
+		c.Set(requestKey, req)
+		if onRequest != nil {
+			return onRequest(c, uri)
+		}
+		return nil
+	}
+
+	onHost := u.OnHost
+	u.OnHost = func(c *connection.Connection, host []byte) error {
+		if req := GetRequest(c); req != nil {
+			req.Host = string(host)
+		}
+		if onHost != nil {
+			return onHost(c, host)
+		}
+		return nil
+	}
+
+	onHeader := u.OnHeader
+	u.OnHeader = func(c *connection.Connection, key, value []byte) error {
+		if req := GetRequest(c); req != nil {
+			req.Header.Add(string(key), string(value))
+		}
+		if onHeader != nil {
+			return onHeader(c, key, value)
+		}
+		return nil
+	}
+
+	u.Protocol = nil
+	u.ProtocolCustom = r.selectProtocol
+
+	onBeforeUpgrade := u.OnBeforeUpgrade
+	u.OnBeforeUpgrade = func(c *connection.Connection) (ws.HandshakeHeader, error) {
+		if err := r.selectRoute(c); err != nil {
+			return nil, err
+		}
+		if onBeforeUpgrade != nil {
+			return onBeforeUpgrade(c)
+		}
+		return nil, nil
+	}
+	return r
+}
+
+// Handle：为 path 注册 handler，path 需要完全匹配
+// protocols 为 handler 支持的 subprotocol，为空时作为该 path 的默认 handler，
+// 客户端没有请求 subprotocol 或者请求的 subprotocol 都不支持时使用
+func (r *Router) Handle(path string, handler WSHandler, protocols ...string) {
+	r.routes[path] = append(r.routes[path], &route{protocols: protocols, handler: handler})
+}
+
+// OnConnect：此时还没有收到握手请求，所选 handler 的 OnConnect 在握手完成之后回调
+func (r *Router) OnConnect(c *connection.Connection) {}
+
+// OnMessage：交给所选的 handler 处理
+func (r *Router) OnMessage(c *connection.Connection, msg []byte) (ws.MessageType, []byte) {
+	if rt := getRoute(c); rt != nil {
+		return rt.handler.OnMessage(c, msg)
+	}
+	return ws.MessageText, nil
+}
+
+// OnClose：握手完成的连接回调所选 handler 的 OnClose
+func (r *Router) OnClose(c *connection.Connection) {
+	if _, ok := c.Get(wsConnKey); !ok {
+		return
+	}
+	if rt := getRoute(c); rt != nil {
+		rt.handler.OnClose(c)
+	}
+}
+
+// connect：握手完成，回调所选 handler 的 OnConnect
+func (r *Router) connect(c *connection.Connection) {
+	if rt := getRoute(c); rt != nil {
+		rt.handler.OnConnect(c)
+	}
+}
+
+func (r *Router) parseURI(uri []byte) (*Request, error) {
+	u, err := url.ParseRequestURI(string(uri))
+	if err != nil {
+		return nil, ErrRouteBadURI
+	}
+	if _, ok := r.routes[u.Path]; !ok {
+		return nil, ErrRouteNotFound
+	}
+	return &Request{
+		Path:   u.Path,
+		Query:  u.Query(),
+		Header: make(http.Header),
+	}, nil
+}
+
+// selectProtocol：按照客户端请求的顺序选择 path 对应的 handler 支持的第一个 subprotocol
+func (r *Router) selectProtocol(c *connection.Connection, value []byte) (string, bool) {
+	req := GetRequest(c)
+	if req == nil {
+		return "", true
+	}
+	for _, p := range strings.Split(string(value), ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			req.Protocols = append(req.Protocols, p)
+		}
+	}
+
+	for _, p := range req.Protocols {
+		for _, rt := range r.routes[req.Path] {
+			if containsProtocol(rt.protocols, p) {
+				req.Protocol = p
+				c.Set(routeKey, rt)
+				return p, true
+			}
+		}
+	}
+	return "", true
+}
+
+// selectRoute：没有协商 subprotocol 时使用 path 的默认 handler
+func (r *Router) selectRoute(c *connection.Connection) error {
+	req := GetRequest(c)
+	if req == nil {
+		return ErrRouteNotFound
+	}
+	if req.Protocol != "" {
+		return nil
+	}
+	for _, rt := range r.routes[req.Path] {
+		if len(rt.protocols) == 0 {
+			c.Set(routeKey, rt)
+			return nil
+		}
+	}
+	return ErrRouteBadSubProtocol
+}
+
+func getRoute(c *connection.Connection) *route {
+	v, ok := c.Get(routeKey)
+	if !ok {
+		return nil
+	}
+	return v.(*route)
+}
+
+func containsProtocol(protocols []string, p string) bool {
+	for _, v := range protocols {
+		if v == p {
+			return true
+		}
+	}
+	return false
+}
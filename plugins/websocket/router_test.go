@@ -0,0 +1,104 @@
+package websocket
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Dongxiem/fastnet/connection"
+	"github.com/Dongxiem/fastnet/eventloop"
+	"github.com/Dongxiem/fastnet/plugins/websocket/ws"
+	"github.com/Dongxiem/fastnet/tool/ringbuffer"
+)
+
+func upgradeRequest(uri, protocols string) string {
+	req := "GET " + uri + " HTTP/1.1\r\n" +
+		"Host: localhost:1833\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Version: 13\r\n" +
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n" +
+		"X-Token: abc\r\n"
+	if protocols != "" {
+		req += "Sec-WebSocket-Protocol: " + protocols + "\r\n"
+	}
+	return req + "\r\n"
+}
+
+func TestRouter(t *testing.T) {
+	chatV1, chatV2, chat, feed := &stubHandler{}, &stubHandler{}, &stubHandler{}, &stubHandler{}
+	u := &ws.Upgrader{}
+	r := NewRouter(u)
+	r.Handle("/chat", chatV1, "chat.v1")
+	r.Handle("/chat", chatV2, "chat.v2", "chat.v3")
+	r.Handle("/chat", chat)
+	r.Handle("/feed", feed, "feed.v1")
+
+	tests := []struct {
+		name      string
+		req       string
+		status    string
+		handler   *stubHandler
+		protocol  string
+		protocols []string
+	}{
+		{"client preference", upgradeRequest("/chat?room=1", "chat.v3, chat.v1"), "101", chatV2, "chat.v3", []string{"chat.v3", "chat.v1"}},
+		{"unknown protocol", upgradeRequest("/chat?room=1", "chat.v9"), "101", chat, "", []string{"chat.v9"}},
+		{"no protocol", upgradeRequest("/chat?room=1", ""), "101", chat, "", nil},
+		{"protocol required", upgradeRequest("/feed", ""), "400", nil, "", nil},
+		{"not found", upgradeRequest("/admin", "chat.v1"), "404", nil, "", nil},
+		{"bad uri", upgradeRequest("chat", ""), "400", nil, "", nil},
+	}
+
+	for _, tt := range tests {
+		loop, err := eventloop.New()
+		if err != nil {
+			t.Fatal(err)
+		}
+		p := New(u)
+		wrap := NewHandlerWrap(u, r)
+		c := connection.New(-1, loop, nil, p, nil, 0, wrap)
+
+		var connected int
+		if tt.handler != nil {
+			connected = tt.handler.connected
+		}
+		buffer := ringbuffer.New(1024)
+		_, _ = buffer.WriteString(tt.req)
+		ctx, out := p.UnPacket(c, buffer)
+		resp := string(wrap.OnMessage(c, ctx, out))
+		if !strings.HasPrefix(resp, "HTTP/1.1 "+tt.status) {
+			t.Fatalf("%s: got %q", tt.name, resp)
+		}
+		if tt.handler == nil {
+			if _, ok := c.Get(closingKey); !ok {
+				t.Fatalf("%s: connection should be closing", tt.name)
+			}
+			continue
+		}
+
+		if tt.protocol != "" && !strings.Contains(resp, "Sec-WebSocket-Protocol: "+tt.protocol+"\r\n") {
+			t.Fatalf("%s: got %q", tt.name, resp)
+		}
+		req := GetRequest(c)
+		if req.Path != "/chat" || req.Query.Get("room") != "1" || req.Host != "localhost:1833" ||
+			req.Header.Get("X-Token") != "abc" || req.Protocol != tt.protocol ||
+			strings.Join(req.Protocols, ",") != strings.Join(tt.protocols, ",") {
+			t.Fatalf("%s: got %+v", tt.name, req)
+		}
+
+		// 握手完成之后回调所选 handler
+		if tt.handler.connected != connected+1 {
+			t.Fatalf("%s: handler should be connected", tt.name)
+		}
+		_, _ = buffer.Write(maskedFrame(ws.OpText, true, "hello"))
+		ctx, out = p.UnPacket(c, buffer)
+		if got := wrap.OnMessage(c, ctx, out); len(got) == 0 {
+			t.Fatalf("%s: message should be routed", tt.name)
+		}
+		wrap.OnClose(c)
+		if !tt.handler.closed.Get() {
+			t.Fatalf("%s: handler should be closed", tt.name)
+		}
+		_ = tt.handler.closed.Set(false)
+	}
+}
@@ -0,0 +1,86 @@
+package websocket
+
+import (
+	"unicode/utf8"
+
+	"github.com/Dongxiem/fastnet/plugins/websocket/ws"
+	"github.com/Dongxiem/fastnet/plugins/websocket/ws/util"
+)
+
+// RFC 6455 协议校验，违反规则时返回关闭连接使用的 status code 与错误
+// See https://tools.ietf.org/html/rfc6455#section-5
+
+// checkHeader：在接收 payload 之前校验数据帧头部
+func (p *Protocol) checkHeader(h *ws.Header, msg *message, deflate *deflateState) (ws.StatusCode, error) {
+	switch {
+	// 客户端发送给服务端的数据帧必须带掩码，服务端发送给客户端的数据帧不能带掩码
+	case p.dialer == nil && !h.Masked:
+		return ws.StatusProtocolError, ws.ErrProtocolMaskRequired
+	case p.dialer != nil && h.Masked:
+		return ws.StatusProtocolError, ws.ErrProtocolMaskUnexpected
+
+	case h.OpCode.IsReserved():
+		return ws.StatusProtocolError, ws.ErrProtocolOpCodeReserved
+
+	// RSV1 只能出现在协商了 permessage-deflate 之后的消息的第一个数据帧
+	case h.Rsv2() || h.Rsv3(),
+		h.Rsv1() && (deflate == nil || h.OpCode == ws.OpContinuation || h.OpCode.IsControl()):
+		return ws.StatusProtocolError, ws.ErrProtocolNonZeroRsv
+
+	case h.OpCode.IsControl() && !h.Fin:
+		return ws.StatusProtocolError, ws.ErrProtocolControlNotFinal
+	case h.OpCode.IsControl() && h.Length > ws.MaxControlFramePayloadSize:
+		return ws.StatusProtocolError, ws.ErrProtocolControlPayloadOverflow
+
+	case h.OpCode == ws.OpContinuation && msg == nil:
+		return ws.StatusProtocolError, ws.ErrProtocolContinuationUnexpected
+	case h.OpCode != ws.OpContinuation && h.OpCode.IsData() && msg != nil:
+		return ws.StatusProtocolError, ws.ErrProtocolContinuationExpected
+
+	// 在接收 payload 之前检查长度，避免缓存超大的数据帧
+	case h.Length > int64(p.opts.MaxFrameSize):
+		return ws.StatusMessageTooBig, ws.ErrProtocolFrameTooBig
+	case msg != nil && h.OpCode.IsData() && h.Length+int64(len(msg.payload)) > int64(p.opts.MaxMessageSize),
+		h.Length > int64(p.opts.MaxMessageSize):
+		return ws.StatusMessageTooBig, ws.ErrProtocolMessageTooBig
+	}
+	return 0, nil
+}
+
+// checkClose：校验 close frame 的 payload，payload 为空或者包含合法的 status code 与 UTF-8 的 reason
+func checkClose(payload []byte) (ws.StatusCode, error) {
+	switch len(payload) {
+	case 0:
+		return 0, nil
+	case 1:
+		return ws.StatusProtocolError, ws.ErrProtocolCloseTooShort
+	}
+
+	code, reason := ws.ParseCloseFrameData(payload)
+	if err := util.CheckCloseFrameData(code, reason); err != nil {
+		if err == ws.ErrProtocolInvalidUTF8 {
+			return ws.StatusInvalidFramePayloadData, err
+		}
+		return ws.StatusProtocolError, err
+	}
+	return 0, nil
+}
+
+// checkText：校验 text 消息中新收到的部分是否为合法的 UTF-8，
+// 返回已经校验过的长度，final 为 false 时末尾允许不完整的字符，等待下一个分片
+func checkText(data []byte, checked int, final bool) (int, bool) {
+	for checked < len(data) {
+		if data[checked] < utf8.RuneSelf {
+			checked++
+			continue
+		}
+
+		r, size := utf8.DecodeRune(data[checked:])
+		if r == utf8.RuneError && size == 1 {
+			// 不完整的字符只能出现在未结束的消息末尾
+			return checked, !final && !utf8.FullRune(data[checked:])
+		}
+		checked += size
+	}
+	return checked, true
+}
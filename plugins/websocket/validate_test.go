@@ -0,0 +1,172 @@
+package websocket
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Dongxiem/fastnet/connection"
+	"github.com/Dongxiem/fastnet/eventloop"
+	"github.com/Dongxiem/fastnet/plugins/websocket/ws"
+	"github.com/Dongxiem/fastnet/tool/ringbuffer"
+	"golang.org/x/sys/unix"
+)
+
+// frame：构造带掩码的数据帧
+func frame(op ws.OpCode, fin bool, rsv byte, payload string) []byte {
+	h := ws.Header{Fin: fin, Rsv: rsv, OpCode: op, Masked: true, Mask: [4]byte{0x37, 0xfa, 0x21, 0x3d}, Length: int64(len(payload))}
+	ret, _ := ws.WriteHeader(&h)
+	p := []byte(payload)
+	ws.Cipher(p, h.Mask, 0)
+	return append(ret, p...)
+}
+
+func frames(f ...[]byte) []byte {
+	var ret []byte
+	for _, b := range f {
+		ret = append(ret, b...)
+	}
+	return ret
+}
+
+func closeFrame(code ws.StatusCode, reason string) []byte {
+	return frame(ws.OpClose, true, 0, string(ws.NewCloseFrameBody(code, reason)))
+}
+
+// runFrames：在 socketpair 上解析 in，返回收到的数据消息，以及服务端发送的 close frame 的 status code
+func runFrames(t *testing.T, in []byte, opts ...Option) (msgs []string, code ws.StatusCode) {
+	fds, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_STREAM, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unix.Close(fds[1])
+	_ = unix.SetNonblock(fds[0], true)
+	_ = unix.SetsockoptTimeval(fds[1], unix.SOL_SOCKET, unix.SO_RCVTIMEO, &unix.Timeval{Sec: 2})
+
+	loop, err := eventloop.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	go loop.RunLoop()
+	defer loop.Stop()
+
+	u := &ws.Upgrader{}
+	p := New(u, opts...)
+	c := connection.New(fds[0], loop, nil, p, nil, 0, NewHandlerWrap(u, &stubHandler{}, opts...))
+	if err = loop.AddSocketAndEnableRead(fds[0], c); err != nil {
+		t.Fatal(err)
+	}
+	c.Set(upgradedKey, true)
+
+	buffer := ringbuffer.New(len(in))
+	_, _ = buffer.Write(in)
+	for {
+		ctx, out := p.UnPacket(c, buffer)
+		if ctx == nil {
+			break
+		}
+		if h := ctx.(*ws.Header); h.OpCode.IsData() {
+			msgs = append(msgs, string(out))
+		}
+	}
+	if _, ok := c.Get(closingKey); !ok {
+		return
+	}
+
+	// 连接关闭之前服务端发送的数据
+	var sent []byte
+	buf := make([]byte, 1024)
+	for {
+		n, err := unix.Read(fds[1], buf)
+		if n <= 0 || err != nil {
+			break
+		}
+		sent = append(sent, buf[:n]...)
+	}
+	out := ringbuffer.NewWithData(sent)
+	for out.Length() > 0 {
+		h, err := ws.VirtualReadHeader(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out.VirtualFlush()
+		payload := make([]byte, int(h.Length))
+		_, _ = out.Read(payload)
+		if h.OpCode == ws.OpClose {
+			code, _ = ws.ParseCloseFrameData(payload)
+		}
+	}
+	return
+}
+
+// 用例编号对应 Autobahn TestSuite 中的用例
+// See https://github.com/crossbario/autobahn-testsuite
+func TestProtocol_Validate(t *testing.T) {
+	long := strings.Repeat("*", 1025)
+	tests := []struct {
+		name string
+		in   []byte
+		opts []Option
+		msgs []string
+		code ws.StatusCode
+	}{
+		{"1.1.1 empty text", frame(ws.OpText, true, 0, ""), nil, []string{""}, 0},
+		{"1.1.2 text 125", frame(ws.OpText, true, 0, long[:125]), nil, []string{long[:125]}, 0},
+		{"1.2.1 empty binary", frame(ws.OpBinary, true, 0, ""), nil, []string{""}, 0},
+
+		{"2.1 empty ping", frame(ws.OpPing, true, 0, ""), nil, nil, 0},
+		{"2.5 ping 126", frame(ws.OpPing, true, 0, long[:126]), nil, nil, ws.StatusProtocolError},
+
+		{"3.1 rsv1 text", frame(ws.OpText, true, ws.Rsv1, "Hello"), nil, nil, ws.StatusProtocolError},
+		{"3.2 rsv2 after text", frames(frame(ws.OpText, true, 0, "Hello"), frame(ws.OpText, true, ws.Rsv2, "Hello")), nil, []string{"Hello"}, ws.StatusProtocolError},
+		{"3.6 rsv ping", frame(ws.OpPing, true, ws.Rsv2|ws.Rsv3, "Hello"), nil, nil, ws.StatusProtocolError},
+
+		{"4.1.1 opcode 3", frame(3, true, 0, ""), nil, nil, ws.StatusProtocolError},
+		{"4.1.3 opcode 5 between text and ping", frames(frame(ws.OpText, true, 0, "Hello"), frame(5, true, 0, ""), frame(ws.OpPing, true, 0, "")), nil, []string{"Hello"}, ws.StatusProtocolError},
+		{"4.2.1 opcode 11", frame(11, true, 0, ""), nil, nil, ws.StatusProtocolError},
+
+		{"5.1 fragmented ping", frames(frame(ws.OpPing, false, 0, "frag1"), frame(ws.OpContinuation, true, 0, "frag2")), nil, nil, ws.StatusProtocolError},
+		{"5.3 fragmented text", frames(frame(ws.OpText, false, 0, "frag1"), frame(ws.OpContinuation, true, 0, "frag2")), nil, []string{"frag1frag2"}, 0},
+		{"5.6 ping between fragments", frames(frame(ws.OpText, false, 0, "frag1"), frame(ws.OpPing, true, 0, "ping"), frame(ws.OpContinuation, true, 0, "frag2")), nil, []string{"frag1frag2"}, 0},
+		{"5.9 continuation without start", frame(ws.OpContinuation, true, 0, "frag"), nil, nil, ws.StatusProtocolError},
+		{"5.15 continuation after message", frames(frame(ws.OpText, false, 0, "frag1"), frame(ws.OpContinuation, true, 0, "frag2"), frame(ws.OpContinuation, false, 0, "frag3")), nil, []string{"frag1frag2"}, ws.StatusProtocolError},
+		{"5.18 text instead of continuation", frames(frame(ws.OpText, false, 0, "frag1"), frame(ws.OpText, true, 0, "frag2")), nil, nil, ws.StatusProtocolError},
+
+		{"6.2.3 utf8 split by byte", frames(frame(ws.OpText, false, 0, "Hello-\xc2"), frame(ws.OpContinuation, false, 0, "\xb5@\xc3"), frame(ws.OpContinuation, false, 0, "\x9f\xc3\xa4\xc3\xbc\xc3\xa0\xc3\xa1-UTF-8!!")), nil, nil, 0},
+		{"6.2.3 utf8 split by byte fin", frames(frame(ws.OpText, false, 0, "\xce"), frame(ws.OpContinuation, false, 0, "\xba"), frame(ws.OpContinuation, true, 0, "\xe1\xbd\xb9")), nil, []string{"\xce\xba\xe1\xbd\xb9"}, 0},
+		{"6.3.1 invalid utf8", frame(ws.OpText, true, 0, "\xce\xba\xe1\xbd\xb9\xcf\x83\xce\xbc\xce\xb5\xed\xa0\x80edited"), nil, nil, ws.StatusInvalidFramePayloadData},
+		{"6.4.1 fail fast on fragment", frames(frame(ws.OpText, false, 0, "\xce\xba\xe1\xbd\xb9\xcf\x83\xce\xbc\xce\xb5"), frame(ws.OpContinuation, false, 0, "\xf4\x90\x80\x80")), nil, nil, ws.StatusInvalidFramePayloadData},
+		{"6.6.1 incomplete rune at end", frame(ws.OpText, true, 0, "\xce"), nil, nil, ws.StatusInvalidFramePayloadData},
+		{"6.x binary is not checked", frame(ws.OpBinary, true, 0, "\xed\xa0\x80"), nil, []string{"\xed\xa0\x80"}, 0},
+
+		{"7.3.1 empty close", frame(ws.OpClose, true, 0, ""), nil, nil, 0},
+		{"7.3.2 close 1 byte", frame(ws.OpClose, true, 0, "a"), nil, nil, ws.StatusProtocolError},
+		{"7.3.6 close reason 124", frame(ws.OpClose, true, 0, "\x03\xe8"+long[:124]), nil, nil, ws.StatusProtocolError},
+		{"7.5.1 close invalid utf8", closeFrame(ws.StatusNormalClosure, "\xce\xba\xe1\xbd\xb9\xcf\x83\xce\xbc\xce\xb5\xed\xa0\x80"), nil, nil, ws.StatusInvalidFramePayloadData},
+		{"7.7.1 close 1000", closeFrame(ws.StatusNormalClosure, ""), nil, nil, 0},
+		{"7.7.12 close 3000", closeFrame(3000, ""), nil, nil, 0},
+		{"7.7.13 close 4999", closeFrame(4999, ""), nil, nil, 0},
+		{"7.9.1 close 0", closeFrame(0, ""), nil, nil, ws.StatusProtocolError},
+		{"7.9.2 close 999", closeFrame(999, ""), nil, nil, ws.StatusProtocolError},
+		{"7.9.3 close 1004", closeFrame(1004, ""), nil, nil, ws.StatusProtocolError},
+		{"7.9.4 close 1005", closeFrame(1005, ""), nil, nil, ws.StatusProtocolError},
+		{"7.9.5 close 1006", closeFrame(1006, ""), nil, nil, ws.StatusProtocolError},
+		{"7.9.6 close 1016", closeFrame(1016, ""), nil, nil, ws.StatusProtocolError},
+		{"7.9.8 close 2000", closeFrame(2000, ""), nil, nil, ws.StatusProtocolError},
+
+		{"9.1 text over MaxMessageSize", frame(ws.OpText, true, 0, long), []Option{MaxMessageSize(1024)}, nil, ws.StatusMessageTooBig},
+		{"9.1 fragments over MaxMessageSize", frames(frame(ws.OpText, false, 0, long[:1000]), frame(ws.OpContinuation, true, 0, long[:25])), []Option{MaxMessageSize(1024)}, nil, ws.StatusMessageTooBig},
+		{"9.1 frame over MaxFrameSize", frames(frame(ws.OpText, false, 0, long[:64]), frame(ws.OpContinuation, true, 0, long[:65])), []Option{MaxFrameSize(64)}, nil, ws.StatusMessageTooBig},
+		{"9.1 fragments within limits", frames(frame(ws.OpText, false, 0, long[:64]), frame(ws.OpContinuation, true, 0, long[:64])), []Option{MaxMessageSize(128), MaxFrameSize(64)}, []string{long[:128]}, 0},
+
+		{"unmasked frame", append([]byte{0x81, 0x02}, "hi"...), nil, nil, ws.StatusProtocolError},
+		{"length with msb set", []byte{0x82, 0xff, 0x80, 0, 0, 0, 0, 0, 0, 0, 1, 2, 3, 4}, nil, nil, ws.StatusProtocolError},
+		{"length over limit", []byte{0x82, 0xff, 0x7f, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 1, 2, 3, 4}, nil, nil, ws.StatusMessageTooBig},
+	}
+
+	for _, tt := range tests {
+		msgs, code := runFrames(t, tt.in, tt.opts...)
+		if code != tt.code || strings.Join(msgs, "|") != strings.Join(tt.msgs, "|") || len(msgs) != len(tt.msgs) {
+			t.Errorf("%s: got %q %d, want %q %d", tt.name, msgs, code, tt.msgs, tt.code)
+		}
+	}
+}
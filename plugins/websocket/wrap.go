@@ -1,10 +1,11 @@
 package websocket
 
 import (
-	"github.com/Dongxiem/gfaio/connection"
-	"github.com/Dongxiem/gfaio/log"
-	"github.com/Dongxiem/gfaio/plugins/websocket/ws"
-	"github.com/Dongxiem/gfaio/plugins/websocket/ws/util"
+	"github.com/Dongxiem/fastnet/connection"
+	"github.com/Dongxiem/fastnet/log"
+	"github.com/Dongxiem/fastnet/plugins/http"
+	"github.com/Dongxiem/fastnet/plugins/websocket/ws"
+	"github.com/Dongxiem/fastnet/plugins/websocket/ws/util"
 )
 
 // WSHandler WebSocket Server 注册接口
@@ -18,13 +19,18 @@ type WSHandler interface {
 type HandlerWrap struct {
 	wsHandler WSHandler
 	Upgrade   *ws.Upgrader
+	http      *http.HandlerWrap // 配置了 HTTPHandler 时不为 nil
+	opts      *Options
 }
 
-// NewHandlerWrap websocket handler wrap
-func NewHandlerWrap(u *ws.Upgrader, wsHandler WSHandler) *HandlerWrap {
+// NewHandlerWrap websocket handler wrap，opts 需要与 Protocol 使用的配置一致
+func NewHandlerWrap(u *ws.Upgrader, wsHandler WSHandler, opts ...Option) *HandlerWrap {
+	options := newOptions(opts...)
 	return &HandlerWrap{
 		wsHandler: wsHandler,
 		Upgrade:   u,
+		http:      newHTTPWrap(options),
+		opts:      options,
 	}
 }
 
@@ -35,9 +41,17 @@ func (s *HandlerWrap) OnConnect(c *connection.Connection) {
 
 // OnMessage wrap
 func (s *HandlerWrap) OnMessage(c *connection.Connection, ctx interface{}, payload []byte) []byte {
+	// 普通 HTTP 请求
+	if req, ok := ctx.(*http.Request); ok {
+		return s.http.OnMessage(c, req, payload)
+	}
+
 	header, ok := ctx.(*ws.Header)
 	// 升级协议 握手
 	if !ok && len(payload) != 0 {
+		if _, ok := c.Get(upgradedKey); ok {
+			s.upgraded(c)
+		}
 		return payload
 	}
 
@@ -49,36 +63,25 @@ func (s *HandlerWrap) OnMessage(c *connection.Connection, ctx interface{}, paylo
 			)
 			switch header.OpCode {
 			case ws.OpClose:
-				out, err = util.HandleClose(header, payload)
+				out, err = s.handleClose(c, header, payload)
 				if err != nil {
 					log.Error(err)
 				}
-				_ = c.ShutdownWrite()
 			case ws.OpPing:
 				out, err = util.HandlePing(payload)
 				if err != nil {
 					log.Error(err)
 				}
 			case ws.OpPong:
-				out, err = util.HandlePong(payload)
-				if err != nil {
-					log.Error(err)
-				}
+				s.handlePong(c, payload)
 			}
 			return out
 		}
 
 		messageType, out := s.wsHandler.OnMessage(c, payload)
 		if len(out) > 0 {
-			var frame *ws.Frame
-			switch messageType {
-			case ws.MessageBinary:
-				frame = ws.NewBinaryFrame(out)
-			case ws.MessageText:
-				frame = ws.NewTextFrame(out)
-			}
 			var err error
-			out, err = ws.FrameToBytes(frame)
+			out, err = s.pack(c, messageType, out)
 			if err != nil {
 				log.Error(err)
 			}
@@ -89,6 +92,39 @@ func (s *HandlerWrap) OnMessage(c *connection.Connection, ctx interface{}, paylo
 	return nil
 }
 
+// Send：发送消息，可以在任意协程中调用
+// 协商了 permessage-deflate 时，消息会在 loop 中压缩，保证压缩上下文的顺序与发送顺序一致
+func (s *HandlerWrap) Send(c *connection.Connection, messageType ws.MessageType, data []byte) error {
+	if getDeflateState(c) == nil {
+		out, err := util.PackFragments(messageType, data, s.opts.FragmentSize)
+		if err != nil {
+			return err
+		}
+		return c.Send(out)
+	}
+
+	if !c.Connected() {
+		return connection.ErrConnectionClosed
+	}
+	c.QueueInLoop(func() {
+		out, err := s.pack(c, messageType, data)
+		if err != nil {
+			log.Error(err)
+			return
+		}
+		c.SendInLoop(out)
+	})
+	return nil
+}
+
+// pack：封装消息，超过 CompressionThreshold 的消息压缩，超过 FragmentSize 的消息自动分片，必须在 loop 中调用
+func (s *HandlerWrap) pack(c *connection.Connection, messageType ws.MessageType, data []byte) ([]byte, error) {
+	if d := getDeflateState(c); d != nil && d.shouldCompress(data) {
+		return d.pack(messageType, data, s.opts.FragmentSize)
+	}
+	return util.PackFragments(messageType, data, s.opts.FragmentSize)
+}
+
 // OnClose wrap
 func (s *HandlerWrap) OnClose(c *connection.Connection) {
 	s.wsHandler.OnClose(c)
@@ -0,0 +1,260 @@
+package ws
+
+import (
+	"bufio"
+	"bytes"
+	"net/http"
+
+	"github.com/Dongxiem/fastnet/tool/ringbuffer"
+	"github.com/gobwas/httphead"
+)
+
+// MaxResponseHeaderSize is the maximum size of server handshake response
+// headers that Dialer is ready to buffer.
+const MaxResponseHeaderSize = 8 * 1024
+
+var headerSeparator = []byte("\r\n\r\n")
+
+// Dialer contains options for establishing websocket connection to an url.
+type Dialer struct {
+	// Protocols is the list of subprotocols that the client wants to speak,
+	// ordered by preference.
+	//
+	// See https://tools.ietf.org/html/rfc6455#section-4.1
+	Protocols []string
+
+	// Extensions is the list of extensions that client wants to speak.
+	//
+	// Note that if server decides to use some of this extensions, Dialer will
+	// return them in Handshake. The server must not respond with extensions
+	// that were not requested.
+	//
+	// See https://tools.ietf.org/html/rfc6455#section-4.1
+	// See https://tools.ietf.org/html/rfc6455#section-9.1
+	Extensions []httphead.Option
+
+	// Header is an optional HandshakeHeader instance that could be used to
+	// write additional headers to the handshake request.
+	Header HandshakeHeader
+}
+
+// Request returns handshake request for given host and uri together with the
+// nonce that must be passed to Response to check server handshake response.
+func (d *Dialer) Request(host, uri string) (req, nonce []byte, err error) {
+	nonce = make([]byte, nonceSize)
+	if err = initNonce(nonce); err != nil {
+		return
+	}
+	if uri == "" {
+		uri = "/"
+	}
+
+	var buf bytes.Buffer
+	bw := bufio.NewWriter(&buf)
+
+	_, _ = bw.WriteString(http.MethodGet)
+	_, _ = bw.WriteString(" ")
+	_, _ = bw.WriteString(uri)
+	_, _ = bw.WriteString(" HTTP/1.1\r\n")
+
+	httpWriteHeader(bw, headerHost, host)
+	httpWriteHeader(bw, headerUpgrade, string(specHeaderValueUpgrade))
+	httpWriteHeader(bw, headerConnection, string(specHeaderValueConnection))
+	httpWriteHeader(bw, headerSecVersion, string(specHeaderValueSecVersion))
+	httpWriteHeader(bw, headerSecKey, string(nonce))
+
+	if len(d.Protocols) > 0 {
+		httpWriteHeaderKey(bw, headerSecProtocol)
+		for i, p := range d.Protocols {
+			if i > 0 {
+				_, _ = bw.WriteString(", ")
+			}
+			_, _ = bw.WriteString(p)
+		}
+		_, _ = bw.WriteString(crlf)
+	}
+	if len(d.Extensions) > 0 {
+		httpWriteHeaderKey(bw, headerSecExtensions)
+		_, _ = httphead.WriteOptions(bw, d.Extensions)
+		_, _ = bw.WriteString(crlf)
+	}
+	if d.Header != nil {
+		_, _ = d.Header.WriteTo(bw)
+	}
+
+	_, _ = bw.WriteString(crlf)
+	_ = bw.Flush()
+	return buf.Bytes(), nonce, nil
+}
+
+// Response reads server handshake response from in and checks it against the
+// nonce returned by Request.
+//
+// If the response is not complete yet, ErrHeaderNotReady is returned and in is
+// left untouched. Otherwise response bytes are retrieved from in, so the data
+// left in the buffer are the first websocket frames sent by the server.
+//
+// Non-nil error other than ErrHeaderNotReady means that the handshake failed
+// and connection should be closed. If server responded with status other than
+// 101, StatusError is returned.
+func (d *Dialer) Response(in *ringbuffer.RingBuffer, nonce []byte) (hs Handshake, err error) {
+	// headerSeen constants helps to report whether or not some header was seen
+	// during reading response bytes.
+	const (
+		headerSeenUpgrade = 1 << iota
+		headerSeenConnection
+		headerSeenSecAccept
+
+		// headerSeenAll is the value that we expect to receive at the end of
+		// headers read/parse loop.
+		headerSeenAll = 0 |
+			headerSeenUpgrade |
+			headerSeenConnection |
+			headerSeenSecAccept
+	)
+
+	index := in.Index(headerSeparator)
+	if index == -1 {
+		if in.Length() > MaxResponseHeaderSize {
+			err = ErrMalformedResponse
+			return
+		}
+		err = ErrHeaderNotReady
+		return
+	}
+	data := make([]byte, index+len(headerSeparator))
+	if _, err = in.Read(data); err != nil {
+		return
+	}
+
+	lines := bytes.Split(data[:index], []byte(crlf))
+	resp, err := httpParseResponseLine(lines[0])
+	if err != nil {
+		return
+	}
+	if resp.status != http.StatusSwitchingProtocols {
+		err = StatusError(resp.status)
+		return
+	}
+
+	var headerSeen byte
+	for i := 1; i < len(lines) && err == nil; i++ {
+		k, v, ok := httpParseHeaderLine(lines[i])
+		if !ok {
+			err = ErrMalformedResponse
+			break
+		}
+
+		switch string(k) {
+		case headerUpgradeCanonical:
+			headerSeen |= headerSeenUpgrade
+			if !bytes.EqualFold(v, specHeaderValueUpgrade) {
+				err = ErrHandshakeBadUpgrade
+			}
+		case headerConnectionCanonical:
+			headerSeen |= headerSeenConnection
+			// Connection header is a list of tokens, and "Upgrade" is case
+			// insensitive.
+			ok := false
+			httphead.ScanTokens(v, func(token []byte) bool {
+				ok = bytes.EqualFold(token, specHeaderValueConnection)
+				return !ok
+			})
+			if !ok {
+				err = ErrHandshakeBadConnection
+			}
+		case headerSecAcceptCanonical:
+			headerSeen |= headerSeenSecAccept
+			if !checkAcceptFromNonce(v, nonce) {
+				err = ErrHandshakeBadSecAccept
+			}
+		case headerSecProtocolCanonical:
+			// RFC6455 1.3: The server selects one or none of the acceptable
+			// protocols and echoes that value in its handshake to indicate
+			// that it has selected that protocol.
+			if hs.Protocol != "" || !d.protocolRequested(v) {
+				err = ErrHandshakeBadSubProtocol
+				break
+			}
+			hs.Protocol = string(v)
+		case headerSecExtensionsCanonical:
+			var ok bool
+			hs.Extensions, ok = httphead.ParseOptions(v, hs.Extensions)
+			if !ok {
+				err = ErrMalformedResponse
+				break
+			}
+			if !d.extensionsRequested(hs.Extensions) {
+				err = ErrHandshakeBadExtensions
+			}
+		}
+	}
+	if err == nil && headerSeen != headerSeenAll {
+		switch {
+		case headerSeen&headerSeenUpgrade == 0:
+			err = ErrHandshakeBadUpgrade
+		case headerSeen&headerSeenConnection == 0:
+			err = ErrHandshakeBadConnection
+		default:
+			err = ErrHandshakeBadSecAccept
+		}
+	}
+	return
+}
+
+// protocolRequested reports whether the subprotocol selected by server was
+// requested by the client.
+func (d *Dialer) protocolRequested(p []byte) bool {
+	for _, want := range d.Protocols {
+		if string(p) == want {
+			return true
+		}
+	}
+	return false
+}
+
+// extensionsRequested reports whether all extensions selected by server were
+// requested by the client.
+func (d *Dialer) extensionsRequested(selected []httphead.Option) bool {
+	for _, opt := range selected {
+		ok := false
+		for _, want := range d.Extensions {
+			if bytes.Equal(opt.Name, want.Name) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+type httpResponseLine struct {
+	major, minor int
+	status       int
+	reason       []byte
+}
+
+// httpParseResponseLine parses http response line like "HTTP/1.1 101 Switching
+// Protocols".
+func httpParseResponseLine(line []byte) (resp httpResponseLine, err error) {
+	var (
+		proto  []byte
+		status []byte
+		ok     bool
+	)
+	proto, status, resp.reason = bsplit3(line, ' ')
+
+	resp.major, resp.minor, ok = httpParseVersion(proto)
+	if !ok || resp.major != 1 || resp.minor < 1 {
+		err = ErrMalformedResponse
+		return
+	}
+	if resp.status, err = asciiToInt(status); err != nil || len(status) != 3 {
+		err = ErrMalformedResponse
+		return
+	}
+	return
+}
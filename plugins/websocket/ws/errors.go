@@ -3,6 +3,7 @@ package ws
 import (
 	"fmt"
 	"net/http"
+	"strconv"
 )
 
 // ProtocolError describes error during checking/parsing websocket frames or
@@ -18,7 +19,18 @@ var (
 	ErrProtocolStatusCodeApplicationLevel = ProtocolError("status code is only application level")
 	ErrProtocolStatusCodeNoMeaning        = ProtocolError("status code has no meaning yet")
 	ErrProtocolStatusCodeUnknown          = ProtocolError("status code is not defined in spec")
-	ErrProtocolInvalidUTF8                = ProtocolError("invalid utf8 sequence in close reason")
+	ErrProtocolInvalidUTF8                = ProtocolError("invalid utf8 sequence")
+	ErrProtocolControlPayloadOverflow     = ProtocolError("control frame payload limit exceeded")
+	ErrProtocolControlNotFinal            = ProtocolError("control frame is not final")
+	ErrProtocolContinuationExpected       = ProtocolError("unexpected data frame, continuation expected")
+	ErrProtocolContinuationUnexpected     = ProtocolError("unexpected continuation frame")
+	ErrProtocolMessageTooBig              = ProtocolError("message size limit exceeded")
+	ErrProtocolNonZeroRsv                 = ProtocolError("non-zero rsv bits with no extension negotiated")
+	ErrProtocolMaskUnexpected             = ProtocolError("frames from server to client must be not masked")
+	ErrProtocolMaskRequired               = ProtocolError("frames from client to server must be masked")
+	ErrProtocolOpCodeReserved             = ProtocolError("use of reserved op code")
+	ErrProtocolFrameTooBig                = ProtocolError("frame size limit exceeded")
+	ErrProtocolCloseTooShort              = ProtocolError("close frame payload must be empty or at least 2 bytes")
 )
 
 // Errors used by both client and server when preparing WebSocket handshake.
@@ -57,6 +69,24 @@ var (
 	)
 )
 
+// Errors used by the client when checking server handshake response.
+var (
+	ErrHandshakeBadSubProtocol = ProtocolError(fmt.Sprintf("handshake error: unexpected protocol in %q header", headerSecProtocol))
+	ErrHandshakeBadExtensions  = ProtocolError(fmt.Sprintf("handshake error: unexpected extensions in %q header", headerSecExtensions))
+)
+
+// ErrMalformedResponse is returned by Dialer to indicate that server response
+// can not be parsed.
+var ErrMalformedResponse = ProtocolError("malformed HTTP response")
+
+// StatusError contains an unexpected status-line code from the server.
+type StatusError int
+
+// Error implements error interface.
+func (s StatusError) Error() string {
+	return "unexpected HTTP response status: " + strconv.Itoa(int(s))
+}
+
 // ErrMalformedRequest is returned when HTTP request can not be parsed.
 var ErrMalformedRequest = RejectConnectionError(
 	RejectionStatus(http.StatusBadRequest),
@@ -175,6 +175,13 @@ type Header struct {
 	Length int64
 }
 
+// Rsv bits used by Header.Rsv.
+const (
+	Rsv1 byte = bit5
+	Rsv2 byte = bit6
+	Rsv3 byte = bit7
+)
+
 // Rsv1 reports whether the header has first rsv bit set.
 func (h Header) Rsv1() bool { return h.Rsv&bit5 != 0 }
 
@@ -2,13 +2,20 @@ package ws
 
 import (
 	"bufio"
+	"bytes"
+	"crypto/rand"
 	"crypto/sha1"
 	"encoding/base64"
-	"github.com/Allenxuxu/toolkit/convert"
 )
 
 const (
-	nonceSize = 24 // base64.StdEncoding.EncodedLen(nonceKeySize)
+	// RFC6455: The request MUST include a header field with the name
+	// |Sec-WebSocket-Key|. The value of this header field MUST be a nonce
+	// consisting of a randomly selected 16-byte value that has been
+	// base64-encoded (see Section 4 of [RFC4648]). The nonce MUST be selected
+	// randomly for each connection.
+	nonceKeySize = 16
+	nonceSize    = 24 // base64.StdEncoding.EncodedLen(nonceKeySize)
 
 	// RFC6455: The value of this header field is constructed by concatenating
 	// /key/, defined above in step 4 in Section 4.2.2, with the string
@@ -38,6 +45,30 @@ func initAcceptFromNonce(accept, nonce []byte) {
 	base64.StdEncoding.Encode(accept, sum[:])
 }
 
+// initNonce fills given slice with random base64-encoded nonce bytes.
+func initNonce(dst []byte) error {
+	if len(dst) != nonceSize {
+		panic("nonce buffer is invalid")
+	}
+	key := make([]byte, nonceKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return err
+	}
+	base64.StdEncoding.Encode(dst, key)
+	return nil
+}
+
+// checkAcceptFromNonce reports whether given accept bytes are valid for given
+// nonce bytes.
+func checkAcceptFromNonce(accept, nonce []byte) bool {
+	if len(accept) != acceptSize {
+		return false
+	}
+	expect := make([]byte, acceptSize)
+	initAcceptFromNonce(expect, nonce)
+	return bytes.Equal(expect, accept)
+}
+
 func writeAccept(bw *bufio.Writer, nonce []byte) (int, error) {
 	accept := make([]byte, acceptSize)
 	initAcceptFromNonce(accept, nonce)
@@ -45,5 +76,5 @@ func writeAccept(bw *bufio.Writer, nonce []byte) (int, error) {
 	// WriteString() copy given string into its inner buffer, unlike Write()
 	// which may write p directly to the underlying io.Writer – which in turn
 	// will lead to p escape.
-	return bw.WriteString(convert.BytesToString(accept))
+	return bw.Write(accept)
 }
@@ -4,8 +4,7 @@ import (
 	"encoding/binary"
 	"fmt"
 
-	"github.com/Allenxuxu/ringbuffer"
-	"github.com/Allenxuxu/toolkit/convert"
+	"github.com/Dongxiem/fastnet/tool/ringbuffer"
 	"github.com/gobwas/pool/pbytes"
 )
 
@@ -17,8 +16,10 @@ var (
 )
 
 // VirtualReadHeader reads a frame header from r.
+// If the header is not complete, ErrHeaderNotReady is returned and the caller
+// should VirtualRevert the buffer.
 func VirtualReadHeader(in *ringbuffer.RingBuffer) (h Header, err error) {
-	if in.Length() < 6 {
+	if in.VirtualLength() < 2 {
 		err = ErrHeaderNotReady
 		return
 	}
@@ -59,6 +60,11 @@ func VirtualReadHeader(in *ringbuffer.RingBuffer) (h Header, err error) {
 		return
 	}
 
+	if in.VirtualLength() < extra {
+		err = ErrHeaderNotReady
+		return
+	}
+
 	// Increase len of bts to extra bytes need to read.
 	// Overwrite first 2 bytes that was read before.
 	bts = bts[:extra]
@@ -99,6 +105,6 @@ func ParseCloseFrameData(payload []byte) (code StatusCode, reason string) {
 		return
 	}
 	code = StatusCode(binary.BigEndian.Uint16(payload))
-	reason = convert.BytesToString(payload[2:])
+	reason = string(payload[2:])
 	return
 }
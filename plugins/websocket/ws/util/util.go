@@ -3,7 +3,7 @@ package util
 import (
 	"unicode/utf8"
 
-	"github.com/Allenxuxu/gev/plugins/websocket/ws"
+	"github.com/Dongxiem/fastnet/plugins/websocket/ws"
 )
 
 // PackData 封装 websocket message 数据包
@@ -18,6 +18,56 @@ func PackData(messageType ws.MessageType, data []byte) ([]byte, error) {
 	return ws.FrameToBytes(frame)
 }
 
+// PackFragments 封装 websocket message 数据包，data 超过 fragmentSize 时拆分为多个分片
+// fragmentSize 小于等于 0 时不分片
+func PackFragments(messageType ws.MessageType, data []byte, fragmentSize int) ([]byte, error) {
+	return PackMessage(messageType, data, fragmentSize, false)
+}
+
+// PackMessage 封装 websocket message 数据包，compressed 表示 data 已经经过 permessage-deflate 压缩，
+// 此时第一个分片会设置 RSV1
+func PackMessage(messageType ws.MessageType, data []byte, fragmentSize int, compressed bool) ([]byte, error) {
+	if fragmentSize <= 0 || len(data) <= fragmentSize {
+		fragmentSize = len(data)
+	}
+
+	op := ws.OpBinary
+	if messageType == ws.MessageText {
+		op = ws.OpText
+	}
+	var rsv byte
+	if compressed {
+		rsv = ws.Rsv1
+	}
+
+	ret := make([]byte, 0, len(data)+(len(data)/(fragmentSize+1)+1)*ws.MaxHeaderSize)
+	for {
+		n := fragmentSize
+		if n > len(data) {
+			n = len(data)
+		}
+		header, err := ws.WriteHeader(&ws.Header{
+			Fin:    n == len(data),
+			Rsv:    rsv,
+			OpCode: op,
+			Length: int64(n),
+		})
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, header...)
+		ret = append(ret, data[:n]...)
+
+		data = data[n:]
+		if len(data) == 0 {
+			return ret, nil
+		}
+		// 除第一个分片外，其余分片都是 continuation frame，并且不设置 RSV
+		op = ws.OpContinuation
+		rsv = 0
+	}
+}
+
 // PackCloseData 封装 websocket close 数据包
 func PackCloseData(reason string) ([]byte, error) {
 	return ws.FrameToBytes(ws.NewCloseFrame(ws.NewCloseFrameBody(ws.StatusNormalClosure, reason)))
@@ -50,9 +100,9 @@ func HandlePing(payload []byte) ([]byte, error) {
 	return ws.FrameToBytes(ws.NewPongFrame(payload))
 }
 
-// HandlePong 处理 pong 返回应答信息
+// HandlePong 处理 pong，pong 不需要应答，返回 nil
 func HandlePong(payload []byte) ([]byte, error) {
-	return ws.FrameToBytes(ws.NewPingFrame(payload))
+	return nil, nil
 }
 
 // CheckCloseFrameData checks received close information
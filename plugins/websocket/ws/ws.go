@@ -6,9 +6,8 @@ import (
 	"io"
 	"net/http"
 
-	"github.com/Allenxuxu/gev/connection"
-	"github.com/Allenxuxu/ringbuffer"
-	"github.com/Allenxuxu/toolkit/convert"
+	"github.com/Dongxiem/fastnet/connection"
+	"github.com/Dongxiem/fastnet/tool/ringbuffer"
 	"github.com/gobwas/httphead"
 )
 
@@ -217,7 +216,7 @@ func (u *Upgrader) Upgrade(c *connection.Connection, in *ringbuffer.RingBuffer)
 		// Abort processing the whole request because we do not even know how
 		// to actually parse it.
 		err = ErrHandshakeBadProtocol
-	case convert.BytesToString(req.method) != http.MethodGet:
+	case string(req.method) != http.MethodGet:
 		err = ErrHandshakeBadMethod
 	default:
 		if onRequest := u.OnRequest; onRequest != nil {
@@ -231,7 +230,7 @@ func (u *Upgrader) Upgrade(c *connection.Connection, in *ringbuffer.RingBuffer)
 		headerSeen byte
 		nonce      = make([]byte, nonceSize)
 	)
-	for i := 1; i < len(lines); i++ {
+	for i := 1; err == nil && i < len(lines); i++ {
 		if len(lines[i]) == 0 {
 			// Blank line, no more lines to read.
 			break
@@ -243,7 +242,7 @@ func (u *Upgrader) Upgrade(c *connection.Connection, in *ringbuffer.RingBuffer)
 			break
 		}
 
-		switch convert.BytesToString(k) {
+		switch string(k) {
 		case headerHostCanonical:
 			headerSeen |= headerSeenHost
 			if onHost := u.OnHost; onHost != nil {
@@ -0,0 +1,114 @@
+package websocket
+
+import (
+	"sync"
+
+	"github.com/Dongxiem/fastnet/connection"
+	"github.com/Dongxiem/fastnet/plugins/websocket/ws"
+	"github.com/Dongxiem/fastnet/plugins/websocket/ws/util"
+	"github.com/Dongxiem/fastnet/tool/sync/atomic"
+)
+
+const wsConnKey = "fastnet_ws_conn"
+
+// WSConn：websocket 连接，握手完成之后创建，所有方法都可以在任意协程中调用
+type WSConn struct {
+	*connection.Connection
+	wrap *HandlerWrap
+
+	closeOnce sync.Once
+	closeSent atomic.Bool // 已经发送了 close frame，等待对端的 close frame
+}
+
+// GetWSConn：获取连接对应的 WSConn，握手完成之前返回 nil
+func GetWSConn(c *connection.Connection) *WSConn {
+	v, ok := c.Get(wsConnKey)
+	if !ok {
+		return nil
+	}
+	return v.(*WSConn)
+}
+
+// WriteMessage：发送消息，消息会按照 Options 分片或压缩
+// 发送 close frame 之后或者连接正在关闭时返回 connection.ErrConnectionClosed
+func (w *WSConn) WriteMessage(messageType ws.MessageType, data []byte) error {
+	if w.closing() {
+		return connection.ErrConnectionClosed
+	}
+	return w.wrap.Send(w.Connection, messageType, data)
+}
+
+// WritePing：发送 ping，payload 不能超过 125 字节
+func (w *WSConn) WritePing(payload []byte) error {
+	if len(payload) > ws.MaxControlFramePayloadSize {
+		return ws.ErrProtocolControlPayloadOverflow
+	}
+	if w.closing() {
+		return connection.ErrConnectionClosed
+	}
+	frame, err := ws.FrameToBytes(ws.NewPingFrame(payload))
+	if err != nil {
+		return err
+	}
+	return w.Send(frame)
+}
+
+// CloseWithCode：发起关闭握手，发送 close frame 之后等待对端的 close frame，
+// 收到对端的 close frame 或者超过 CloseTimeout 之后关闭连接，重复调用只有第一次有效
+func (w *WSConn) CloseWithCode(code ws.StatusCode, reason string) error {
+	if err := util.CheckCloseFrameData(code, reason); err != nil {
+		return err
+	}
+	// status code 占 2 个字节
+	if len(reason)+2 > ws.MaxControlFramePayloadSize {
+		return ws.ErrProtocolControlPayloadOverflow
+	}
+	if !w.Connected() {
+		return connection.ErrConnectionClosed
+	}
+
+	var err error
+	w.closeOnce.Do(func() {
+		var frame []byte
+		if frame, err = ws.FrameToBytes(ws.NewCloseFrame(ws.NewCloseFrameBody(code, reason))); err != nil {
+			return
+		}
+		_ = w.closeSent.Set(true)
+		if err = w.Send(frame); err != nil {
+			return
+		}
+		w.RunAfter(w.wrap.opts.CloseTimeout, func() {
+			_ = w.Close()
+		})
+	})
+	return err
+}
+
+// closing：已经发送了 close frame 或者连接正在关闭
+func (w *WSConn) closing() bool {
+	if w.closeSent.Get() {
+		return true
+	}
+	_, ok := w.Get(closingKey)
+	return ok
+}
+
+// upgraded：握手完成，创建 WSConn 并启动 ping 定时器，使用 Router 时回调所选 handler 的 OnConnect
+func (s *HandlerWrap) upgraded(c *connection.Connection) {
+	c.Set(wsConnKey, &WSConn{Connection: c, wrap: s})
+	s.startKeepalive(c)
+	if r, ok := s.wsHandler.(*Router); ok {
+		r.connect(c)
+	}
+}
+
+// handleClose：处理对端的 close frame
+// 对端发起关闭时回复 close frame，我方发起关闭时关闭握手已经完成，都在发送完之后关闭连接
+func (s *HandlerWrap) handleClose(c *connection.Connection, header *ws.Header, payload []byte) (out []byte, err error) {
+	c.Set(closingKey, true)
+	if w := GetWSConn(c); w == nil || !w.closeSent.Get() {
+		out, err = util.HandleClose(header, payload)
+	}
+	_ = c.CloseAfterFlush()
+	return
+}
@@ -0,0 +1,150 @@
+package websocket
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Dongxiem/fastnet/connection"
+	"github.com/Dongxiem/fastnet/eventloop"
+	"github.com/Dongxiem/fastnet/plugins/websocket/ws"
+	"github.com/Dongxiem/fastnet/tool/sync/atomic"
+	"github.com/RussellLuo/timingwheel"
+	"golang.org/x/sys/unix"
+)
+
+type stubHandler struct {
+	connected int
+	closed    atomic.Bool
+}
+
+func (h *stubHandler) OnConnect(c *connection.Connection) {
+	h.connected++
+}
+
+func (h *stubHandler) OnMessage(c *connection.Connection, msg []byte) (ws.MessageType, []byte) {
+	return ws.MessageText, msg
+}
+
+func (h *stubHandler) OnClose(c *connection.Connection) {
+	_ = h.closed.Set(true)
+}
+
+func TestWSConn_CloseWithCode(t *testing.T) {
+	tw := timingwheel.NewTimingWheel(time.Millisecond, 20)
+	tw.Start()
+	defer tw.Stop()
+	loop, err := eventloop.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u := &ws.Upgrader{}
+	p := New(u)
+	wrap := NewHandlerWrap(u, &stubHandler{})
+	c := connection.New(-1, loop, nil, p, tw, 0, wrap)
+	c.Set(upgradedKey, true)
+	wrap.upgraded(c)
+	w := GetWSConn(c)
+
+	if err := w.CloseWithCode(ws.StatusNoStatusRcvd, ""); err == nil {
+		t.Fatal("reserved status code should be rejected")
+	}
+	if err := w.CloseWithCode(ws.StatusNormalClosure, strings.Repeat("a", 124)); err != ws.ErrProtocolControlPayloadOverflow {
+		t.Fatalf("got %v", err)
+	}
+	if err := w.WritePing(make([]byte, 126)); err != ws.ErrProtocolControlPayloadOverflow {
+		t.Fatalf("got %v", err)
+	}
+
+	if err := w.CloseWithCode(ws.StatusNormalClosure, "bye"); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteMessage(ws.MessageText, []byte("hello")); err != connection.ErrConnectionClosed {
+		t.Fatalf("got %v", err)
+	}
+	if err := w.WritePing(nil); err != connection.ErrConnectionClosed {
+		t.Fatalf("got %v", err)
+	}
+
+	// 对端回复 close frame，关闭握手完成，不再应答
+	payload := ws.NewCloseFrameBody(ws.StatusNormalClosure, "bye")
+	header := &ws.Header{Fin: true, OpCode: ws.OpClose, Length: int64(len(payload))}
+	if out := wrap.OnMessage(c, header, payload); out != nil {
+		t.Fatalf("close frame should not be answered, got % x", out)
+	}
+	if _, ok := c.Get(closingKey); !ok {
+		t.Fatal("connection should be closing")
+	}
+}
+
+func TestHandlerWrap_PeerClose(t *testing.T) {
+	u := &ws.Upgrader{}
+	p := New(u)
+	wrap := NewHandlerWrap(u, &stubHandler{})
+	c := newUpgradedConn(t, p)
+	wrap.upgraded(c)
+
+	payload := ws.NewCloseFrameBody(ws.StatusGoingAway, "")
+	header := &ws.Header{Fin: true, OpCode: ws.OpClose, Length: int64(len(payload))}
+	out := wrap.OnMessage(c, header, payload)
+	want, _ := ws.FrameToBytes(ws.NewCloseFrame(payload))
+	if string(out) != string(want) {
+		t.Fatalf("got % x, want % x", out, want)
+	}
+	if err := GetWSConn(c).WriteMessage(ws.MessageText, []byte("hello")); err != connection.ErrConnectionClosed {
+		t.Fatalf("got %v", err)
+	}
+}
+
+func TestWSConn_CloseTimeout(t *testing.T) {
+	fds, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_STREAM, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unix.Close(fds[1])
+	if err = unix.SetNonblock(fds[0], true); err != nil {
+		t.Fatal(err)
+	}
+	_ = unix.SetsockoptTimeval(fds[1], unix.SOL_SOCKET, unix.SO_RCVTIMEO, &unix.Timeval{Sec: 2})
+
+	tw := timingwheel.NewTimingWheel(time.Millisecond, 20)
+	tw.Start()
+	defer tw.Stop()
+	loop, err := eventloop.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	go loop.RunLoop()
+	defer loop.Stop()
+
+	u := &ws.Upgrader{}
+	h := &stubHandler{}
+	wrap := NewHandlerWrap(u, h, CloseTimeout(50*time.Millisecond))
+	c := connection.New(fds[0], loop, nil, New(u), tw, 0, wrap)
+	if err = loop.AddSocketAndEnableRead(fds[0], c); err != nil {
+		t.Fatal(err)
+	}
+	c.Set(upgradedKey, true)
+	wrap.upgraded(c)
+
+	start := time.Now()
+	if err = GetWSConn(c).CloseWithCode(ws.StatusCode(4000), "bye"); err != nil {
+		t.Fatal(err)
+	}
+
+	// 先收到 close frame，对端不回复时超时之后关闭连接
+	want, _ := ws.FrameToBytes(ws.NewCloseFrame(ws.NewCloseFrameBody(ws.StatusCode(4000), "bye")))
+	buf := make([]byte, 64)
+	n, err := unix.Read(fds[1], buf)
+	if err != nil || string(buf[:n]) != string(want) {
+		t.Fatalf("got % x, %v", buf[:n], err)
+	}
+	if n, err = unix.Read(fds[1], buf); n != 0 || err != nil {
+		t.Fatalf("connection should be closed, got %d %v", n, err)
+	}
+	// 时间轮把到期时间截断到 tick 的整数倍，定时任务最多会提前一个 tick 执行
+	if time.Since(start) < 50*time.Millisecond-time.Millisecond || !h.closed.Get() {
+		t.Fatal("connection should be closed after CloseTimeout")
+	}
+}
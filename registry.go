@@ -0,0 +1,165 @@
+package fastnet
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/Dongxiem/fastnet/connection"
+	"github.com/Dongxiem/fastnet/eventloop"
+)
+
+// ErrUnknownLoop：连接所属的 loop 不是 Server 的 work loop
+var ErrUnknownLoop = errors.New("connection loop is not a work loop")
+
+// connShard：单个 work loop 上的连接集合
+type connShard struct {
+	mu    sync.RWMutex
+	conns map[int64]*connection.Connection
+}
+
+// snapshot：获取当前所有连接的拷贝，避免遍历时持有锁
+func (s *connShard) snapshot() []*connection.Connection {
+	s.mu.RLock()
+	conns := make([]*connection.Connection, 0, len(s.conns))
+	for _, c := range s.conns {
+		conns = append(conns, c)
+	}
+	s.mu.RUnlock()
+	return conns
+}
+
+// delete：删除连接，返回连接是否存在
+func (s *connShard) delete(id int64) bool {
+	s.mu.Lock()
+	_, ok := s.conns[id]
+	delete(s.conns, id)
+	s.mu.Unlock()
+	return ok
+}
+
+// registry：连接注册表，按 work loop 分片
+type registry struct {
+	shards map[*eventloop.EventLoop]*connShard
+}
+
+// newRegistry：根据 work loops 创建连接注册表
+func newRegistry(loops []*eventloop.EventLoop) *registry {
+	r := &registry{shards: make(map[*eventloop.EventLoop]*connShard, len(loops))}
+	for _, l := range loops {
+		r.shards[l] = &connShard{conns: make(map[int64]*connection.Connection)}
+	}
+	return r
+}
+
+// add：注册连接，连接关闭时自动移除，迁移 loop 时自动移到对应的分片
+func (r *registry) add(c *connection.Connection) error {
+	if err := r.put(c); err != nil {
+		return err
+	}
+	c.AddCloseHook(r.remove)
+	c.AddMoveHook(r.move)
+	return nil
+}
+
+// put：注册连接，连接所属的 loop 不在注册表中时返回 ErrUnknownLoop
+func (r *registry) put(c *connection.Connection) error {
+	shard, ok := r.shards[c.Loop()]
+	if !ok {
+		return ErrUnknownLoop
+	}
+	shard.mu.Lock()
+	shard.conns[c.ID()] = c
+	shard.mu.Unlock()
+	return nil
+}
+
+// remove：移除连接
+// 迁移过程中加入的连接或者迁移到其他 loop 的连接不一定在 c.Loop() 对应的分片中，此时查找所有分片
+func (r *registry) remove(c *connection.Connection) {
+	if shard, ok := r.shards[c.Loop()]; ok && shard.delete(c.ID()) {
+		return
+	}
+	for _, shard := range r.shards {
+		if shard.delete(c.ID()) {
+			return
+		}
+	}
+}
+
+// move：连接迁移到 to 时移到对应的分片，to 不属于该注册表时保留在原分片中
+func (r *registry) move(c *connection.Connection, to *eventloop.EventLoop) {
+	dst, ok := r.shards[to]
+	if !ok {
+		return
+	}
+	if src, ok := r.shards[c.Loop()]; !ok || !src.delete(c.ID()) {
+		return
+	}
+	dst.mu.Lock()
+	dst.conns[c.ID()] = c
+	dst.mu.Unlock()
+}
+
+// get：根据 ID 查找连接
+func (r *registry) get(id int64) (*connection.Connection, bool) {
+	for _, shard := range r.shards {
+		shard.mu.RLock()
+		c, ok := shard.conns[id]
+		shard.mu.RUnlock()
+		if ok {
+			return c, true
+		}
+	}
+	return nil, false
+}
+
+// all：返回所有连接
+func (r *registry) all() []*connection.Connection {
+	var conns []*connection.Connection
+	for _, shard := range r.shards {
+		conns = append(conns, shard.snapshot()...)
+	}
+	return conns
+}
+
+// len：返回连接总数
+func (r *registry) len() int {
+	n := 0
+	for _, shard := range r.shards {
+		shard.mu.RLock()
+		n += len(shard.conns)
+		shard.mu.RUnlock()
+	}
+	return n
+}
+
+// rangeConns：遍历所有连接，f 返回 false 则停止遍历
+func (r *registry) rangeConns(f func(c *connection.Connection) bool) {
+	for _, shard := range r.shards {
+		for _, c := range shard.snapshot() {
+			if !f(c) {
+				return
+			}
+		}
+	}
+}
+
+// broadcast：在每个 loop 中发送一次已经封装好的数据
+func (r *registry) broadcast(packet []byte) {
+	for loop, shard := range r.shards {
+		loop, shard := loop, shard
+		loop.QueueInLoop(func() {
+			for _, c := range shard.snapshot() {
+				if c.Loop() == loop {
+					c.SendInLoop(packet)
+					continue
+				}
+				// 连接已经迁移到其他 loop
+				c := c
+				c.QueueInLoop(func() {
+					c.SendInLoop(packet)
+				})
+			}
+		})
+	}
+}
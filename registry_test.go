@@ -0,0 +1,264 @@
+package fastnet
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Dongxiem/fastnet/connection"
+	"github.com/Dongxiem/fastnet/eventloop"
+	"github.com/Dongxiem/fastnet/tool/sync/atomic"
+	"github.com/RussellLuo/timingwheel"
+	"golang.org/x/sys/unix"
+)
+
+func TestRegistry(t *testing.T) {
+	loops := make([]*eventloop.EventLoop, 2)
+	for i := range loops {
+		l, err := eventloop.New()
+		if err != nil {
+			t.Fatal(err)
+		}
+		loops[i] = l
+	}
+	r := newRegistry(loops)
+
+	conns := make([]*connection.Connection, 10)
+	for i := range conns {
+		conns[i] = connection.New(-1, loops[i%2], nil, &connection.DefaultProtocol{}, nil, 0, nil)
+		if err := r.add(conns[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if r.len() != 10 {
+		t.Fatalf("len should be 10, but %d", r.len())
+	}
+	for _, c := range conns {
+		if got, ok := r.get(c.ID()); !ok || got != c {
+			t.Fatalf("get %d fail", c.ID())
+		}
+	}
+
+	n := 0
+	r.rangeConns(func(c *connection.Connection) bool {
+		n++
+		return n < 3
+	})
+	if n != 3 {
+		t.Fatalf("range should stop at 3, but %d", n)
+	}
+
+	r.remove(conns[0])
+	if _, ok := r.get(conns[0].ID()); ok {
+		t.Fatal("conns[0] should be removed")
+	}
+	if r.len() != 9 {
+		t.Fatalf("len should be 9, but %d", r.len())
+	}
+
+	// 迁移之后在新的分片中，不在注册表中的 loop 保留在原分片中
+	r.move(conns[1], loops[0])
+	if len(r.shards[loops[1]].conns) != 4 || r.shards[loops[0]].conns[conns[1].ID()] != conns[1] {
+		t.Fatal("conns[1] should be moved to loops[0]")
+	}
+	other, err := eventloop.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.move(conns[2], other)
+	if r.shards[loops[0]].conns[conns[2].ID()] != conns[2] {
+		t.Fatal("conns[2] should stay in loops[0]")
+	}
+
+	// c.Loop() 对应的分片中没有时查找所有分片
+	r.remove(conns[1])
+	if _, ok := r.get(conns[1].ID()); ok || r.len() != 8 {
+		t.Fatal("conns[1] should be removed")
+	}
+
+	// 不属于注册表的 loop
+	c := connection.New(-1, other, nil, &connection.DefaultProtocol{}, nil, 0, nil)
+	if err := r.add(c); err != ErrUnknownLoop {
+		t.Fatalf("expect ErrUnknownLoop but got %v", err)
+	}
+	if _, ok := r.get(c.ID()); ok || r.len() != 8 {
+		t.Fatal("c should not be added")
+	}
+}
+
+// countProtocol：记录 Packet 调用次数
+type countProtocol struct {
+	connection.DefaultProtocol
+	packets atomic.Int64
+}
+
+func (p *countProtocol) Packet(c *connection.Connection, data []byte) []byte {
+	p.packets.Add(1)
+	return append([]byte("#"), data...)
+}
+
+type nopCallback struct{}
+
+func (nopCallback) OnMessage(c *connection.Connection, ctx interface{}, data []byte) []byte { return nil }
+
+func (nopCallback) OnClose(c *connection.Connection) {}
+
+// newPairConn：在 socketpair 上创建连接，返回连接与对端的 fd
+func newPairConn(t *testing.T, loop *eventloop.EventLoop, protocol connection.Protocol) (*connection.Connection, int) {
+	fds, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_STREAM, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = unix.SetNonblock(fds[0], true)
+	c := connection.New(fds[0], loop, nil, protocol, nil, 0, nopCallback{})
+	t.Cleanup(func() {
+		// 已经关闭的连接不能重复关闭 fd
+		if c.Connected() {
+			_ = unix.Close(fds[0])
+		}
+		_ = unix.Close(fds[1])
+	})
+	return c, fds[1]
+}
+
+// readPeer：读取对端收到的数据，超时返回空
+func readPeer(fd int, timeout time.Duration) string {
+	tv := unix.NsecToTimeval(timeout.Nanoseconds())
+	_ = unix.SetsockoptTimeval(fd, unix.SOL_SOCKET, unix.SO_RCVTIMEO, &tv)
+	buf := make([]byte, 64)
+	n, err := unix.Read(fd, buf)
+	if err != nil || n <= 0 {
+		return ""
+	}
+	return string(buf[:n])
+}
+
+func TestServer_Broadcast(t *testing.T) {
+	loops := make([]*eventloop.EventLoop, 2)
+	for i := range loops {
+		l, err := eventloop.New()
+		if err != nil {
+			t.Fatal(err)
+		}
+		loops[i] = l
+	}
+	t.Cleanup(func() {
+		for _, l := range loops {
+			_ = l.Stop()
+		}
+	})
+	protocol := &countProtocol{}
+	s := &Server{opts: &Options{Protocol: protocol}, conns: newRegistry(loops)}
+
+	peers := make([][]int, len(loops))
+	for i := 0; i < 6; i++ {
+		c, fd := newPairConn(t, loops[i%2], protocol)
+		if err := s.conns.add(c); err != nil {
+			t.Fatal(err)
+		}
+		peers[i%2] = append(peers[i%2], fd)
+	}
+
+	// 只封装一次，每个 loop 在自己的协程中发送，loop 运行之前不会发送
+	s.Broadcast([]byte("hi"))
+	if n := protocol.packets.Get(); n != 1 {
+		t.Fatalf("Packet should be called once, but %d", n)
+	}
+	for _, fd := range peers[0] {
+		if got := readPeer(fd, 20*time.Millisecond); got != "" {
+			t.Fatalf("loops[0] is not running, but got %q", got)
+		}
+	}
+
+	go loops[0].RunLoop()
+	for _, fd := range peers[0] {
+		if got := readPeer(fd, time.Second); got != "#hi" {
+			t.Fatalf("expect #hi but got %q", got)
+		}
+	}
+	for _, fd := range peers[1] {
+		if got := readPeer(fd, 20*time.Millisecond); got != "" {
+			t.Fatalf("loops[1] is not running, but got %q", got)
+		}
+	}
+
+	go loops[1].RunLoop()
+	for _, fd := range peers[1] {
+		if got := readPeer(fd, time.Second); got != "#hi" {
+			t.Fatalf("expect #hi but got %q", got)
+		}
+	}
+	for _, fds := range peers {
+		for _, fd := range fds {
+			if got := readPeer(fd, 20*time.Millisecond); got != "" {
+				t.Fatalf("data should be delivered once, but got %q", got)
+			}
+		}
+	}
+}
+
+type connectCounter struct {
+	nopCallback
+	connects atomic.Int64
+}
+
+func (h *connectCounter) OnConnect(c *connection.Connection) {
+	h.connects.Add(1)
+}
+
+func TestServer_ProxyProtocolRegister(t *testing.T) {
+	loop, err := eventloop.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	go loop.RunLoop()
+	tw := timingwheel.NewTimingWheel(time.Millisecond, 20)
+	tw.Start()
+	t.Cleanup(func() {
+		_ = loop.Stop()
+		tw.Stop()
+	})
+
+	protocol := &countProtocol{}
+	h := &connectCounter{}
+	s := &Server{
+		workLoops:   []*eventloop.EventLoop{loop},
+		callback:    h,
+		conns:       newRegistry([]*eventloop.EventLoop{loop}),
+		timingWheel: tw,
+		opts:        &Options{Protocol: protocol, ProxyProtocol: true, ProxyHeaderTimeout: 50 * time.Millisecond},
+	}
+	fds, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_STREAM, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = unix.SetNonblock(fds[0], true)
+	t.Cleanup(func() {
+		_ = unix.Close(fds[1])
+	})
+
+	// 没有收到 PROXY protocol 头部之前不注册，Broadcast 不会发送给该连接
+	s.handleNewConnection(fds[0], nil)
+	if s.NumConnections() != 0 || h.connects.Get() != 0 {
+		t.Fatalf("connection should not be registered, got %d", s.NumConnections())
+	}
+	s.Broadcast([]byte("hi"))
+	if got := readPeer(fds[1], 20*time.Millisecond); got != "" {
+		t.Fatalf("got %q", got)
+	}
+
+	// 超时关闭之后也不会注册
+	if got := readPeer(fds[1], time.Second); got != "" {
+		t.Fatalf("connection should be closed, got %q", got)
+	}
+	if s.NumConnections() != 0 || h.connects.Get() != 0 {
+		t.Fatalf("connection should not be registered, got %d", s.NumConnections())
+	}
+
+	// 头部解析之后注册并调用 OnConnect
+	c, _ := newPairConn(t, loop, protocol)
+	s.onConnect(c)
+	if got, ok := s.Connection(c.ID()); !ok || got != c || h.connects.Get() != 1 {
+		t.Fatal("connection should be registered after the header")
+	}
+}
@@ -26,6 +26,8 @@ type Server struct {
 	workLoops     []*eventloop.EventLoop 	// 其他负责处理已连接客户端的读写事件
 	nextLoopIndex int 						// 下一个循环索引
 	callback      Handler 					// 回调处理
+	conns         *registry					// 连接注册表
+	groups        *groups					// 连接分组
 
 	timingWheel *timingwheel.TimingWheel	// 定时器
 	opts        *Options 					// 配置选项
@@ -76,6 +78,8 @@ func NewServer(handler Handler, opts ...Option) (server *Server, err error) {
 		wloops[i] = l
 	}
 	server.workLoops = wloops
+	server.conns = newRegistry(wloops)
+	server.groups = newGroups(wloops)
 
 	return
 }
@@ -104,14 +108,52 @@ func (s *Server) handleNewConnection(fd int, sa unix.Sockaddr) {
 	loop := s.nextLoop()
 	// 生成新的 connection 连接
 	c := connection.New(fd, loop, sa, s.opts.Protocol, s.timingWheel, s.opts.IdleTime, s.callback)
-	// 调用回调函数中的 OnConnect 方法
-	s.callback.OnConnect(c)
+	if s.opts.ProxyProtocol {
+		// PROXY protocol 头部解析之后才注册连接并调用 OnConnect，Broadcast 等不会向没有完成握手的连接发送数据
+		c.ExpectProxyHeader(s.opts.ProxyHeaderTimeout, s.onConnect)
+	} else {
+		s.onConnect(c)
+	}
 	// 将该 socket 添加进监听循环，并且置为读监听事件
 	if err := loop.AddSocketAndEnableRead(fd, c); err != nil {
 		log.Error("[AddSocketAndEnableRead]", err)
 	}
 }
 
+// onConnect：将连接注册到连接注册表，连接关闭时自动移除，然后调用回调函数中的 OnConnect 方法
+func (s *Server) onConnect(c *connection.Connection) {
+	if err := s.conns.add(c); err != nil {
+		log.Error("[registry]", err)
+	}
+	s.callback.OnConnect(c)
+}
+
+// WorkLoops：返回所有 work loop，可以作为 Connection.MoveTo 的目标
+func (s *Server) WorkLoops() []*eventloop.EventLoop {
+	return append([]*eventloop.EventLoop(nil), s.workLoops...)
+}
+
+// Connection：根据 ID 查找连接
+func (s *Server) Connection(id int64) (*connection.Connection, bool) {
+	return s.conns.get(id)
+}
+
+// RangeConnections：遍历所有连接，f 返回 false 则停止遍历
+func (s *Server) RangeConnections(f func(c *connection.Connection) bool) {
+	s.conns.rangeConns(f)
+}
+
+// NumConnections：返回当前连接数
+func (s *Server) NumConnections() int {
+	return s.conns.len()
+}
+
+// Broadcast：向所有连接发送数据
+// data 只经过一次 Protocol.Packet 封装（Connection 参数为 nil），然后每个 loop 使用一次 QueueInLoop 进行发送
+func (s *Server) Broadcast(data []byte) {
+	s.conns.broadcast(s.opts.Protocol.Packet(nil, data))
+}
+
 // Start：启动 Server
 func (s *Server) Start() {
 	// 使用 WaitGroup 进行并发模型构建
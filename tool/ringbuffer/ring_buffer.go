@@ -1,6 +1,7 @@
 package ringbuffer
 
 import (
+	"bytes"
 	"encoding/binary"
 	"errors"
 	"fmt"
@@ -14,7 +15,8 @@ var ErrIsEmpty = errors.New("ring buffer is empty")
 type RingBuffer struct {
 	buf     []byte
 	size    int
-	vr      int
+	vr      int // next position to virtual read
+	vn      int // bytes virtual read since r
 	r       int // next position to read
 	w       int // next position to write
 	isEmpty bool
@@ -40,16 +42,21 @@ func NewWithData(data []byte) *RingBuffer {
 // VirtualFlush：刷新虚读指针
 // VirtualXXX 系列配合使用
 func (r *RingBuffer) VirtualFlush() {
-	r.r = r.vr
-	if r.r == r.w {
+	if r.vn == 0 {
+		return
+	}
+	if r.vn >= r.Length() {
 		r.isEmpty = true
 	}
+	r.r = r.vr
+	r.vn = 0
 }
 
 // VirtualRevert：还原虚读指针
 // VirtualXXX 系列配合使用
 func (r *RingBuffer) VirtualRevert() {
 	r.vr = r.r
+	r.vn = 0
 }
 
 // VirtualRead：虚读，不移动 read 指针，需要配合 VirtualFlush 和 VirtualRevert 使用
@@ -58,24 +65,13 @@ func (r *RingBuffer) VirtualRead(p []byte) (n int, err error) {
 	if len(p) == 0 {
 		return 0, nil
 	}
-	if r.isEmpty {
+	available := r.VirtualLength()
+	if available == 0 {
 		return 0, ErrIsEmpty
 	}
 	n = len(p)
-	if r.w > r.vr {
-		if n > r.w-r.vr {
-			n = r.w - r.vr
-		}
-		copy(p, r.buf[r.vr:r.vr+n])
-		// move vr
-		r.vr = (r.vr + n) % r.size
-		if r.vr == r.w {
-			r.isEmpty = true
-		}
-		return
-	}
-	if n > r.size-r.vr+r.w {
-		n = r.size - r.vr + r.w
+	if n > available {
+		n = available
 	}
 	if r.vr+n <= r.size {
 		copy(p, r.buf[r.vr:r.vr+n])
@@ -88,24 +84,36 @@ func (r *RingBuffer) VirtualRead(p []byte) (n int, err error) {
 
 	// move vr
 	r.vr = (r.vr + n) % r.size
+	r.vn += n
 	return
 }
 
-// VirtualLength：虚拟长度，虚读后剩余可读数据长度
-// VirtualXXX 系列配合使用
-func (r *RingBuffer) VirtualLength() int {
-	if r.w == r.vr {
-		if r.isEmpty {
-			return 0
-		}
-		return r.size
+// VirtualIndexByte：从虚读指针开始，在最多 limit 个字节中查找 c，返回相对虚读指针的位置，不存在则返回 -1
+// VirtualXXX 系列配合使用，不会移动虚读指针
+func (r *RingBuffer) VirtualIndexByte(c byte, limit int) int {
+	n := r.VirtualLength()
+	if limit < n {
+		n = limit
 	}
-
-	if r.w > r.vr {
-		return r.w - r.vr
+	if n <= 0 {
+		return -1
+	}
+	if r.vr+n <= r.size {
+		return bytes.IndexByte(r.buf[r.vr:r.vr+n], c)
+	}
+	if i := bytes.IndexByte(r.buf[r.vr:r.size], c); i >= 0 {
+		return i
+	}
+	if i := bytes.IndexByte(r.buf[:n-r.size+r.vr], c); i >= 0 {
+		return r.size - r.vr + i
 	}
+	return -1
+}
 
-	return r.size - r.vr + r.w
+// VirtualLength：虚拟长度，虚读后剩余可读数据长度
+// VirtualXXX 系列配合使用
+func (r *RingBuffer) VirtualLength() int {
+	return r.Length() - r.vn
 }
 
 // RetrieveAll：重置大小
@@ -113,6 +121,7 @@ func (r *RingBuffer) RetrieveAll() {
 	r.r = 0
 	r.w = 0
 	r.vr = 0
+	r.vn = 0
 	r.isEmpty = true
 }
 
@@ -125,6 +134,7 @@ func (r *RingBuffer) Retrieve(len int) {
 	if len < r.Length() {
 		r.r = (r.r + len) % r.size
 		r.vr = r.r
+		r.vn = 0
 
 		if r.w == r.r {
 			r.isEmpty = true
@@ -231,6 +241,41 @@ func (r *RingBuffer) PeekUint64() uint64 {
 	}
 }
 
+// Index：查找 sep 在可读数据中第一次出现的位置（相对读指针），不存在则返回 -1
+// 直接在 PeekAll 返回的两段数据上查找，不会拷贝数据
+func (r *RingBuffer) Index(sep []byte) int {
+	if len(sep) == 0 {
+		return 0
+	}
+	first, end := r.PeekAll()
+	if i := bytes.Index(first, sep); i >= 0 {
+		return i
+	}
+	if len(end) == 0 {
+		return -1
+	}
+
+	// sep 可能横跨 first 与 end 两段
+	start := len(first) - len(sep) + 1
+	if start < 0 {
+		start = 0
+	}
+	for i := start; i < len(first); i++ {
+		n := len(first) - i
+		if len(sep)-n > len(end) {
+			break
+		}
+		if bytes.Equal(first[i:], sep[:n]) && bytes.Equal(end[:len(sep)-n], sep[n:]) {
+			return i
+		}
+	}
+
+	if i := bytes.Index(end, sep); i >= 0 {
+		return len(first) + i
+	}
+	return -1
+}
+
 // Read：读数据
 func (r *RingBuffer) Read(p []byte) (n int, err error) {
 	if len(p) == 0 {
@@ -251,6 +296,7 @@ func (r *RingBuffer) Read(p []byte) (n int, err error) {
 			r.isEmpty = true
 		}
 		r.vr = r.r
+		r.vn = 0
 		return
 	}
 	if n > r.size-r.r+r.w {
@@ -271,6 +317,7 @@ func (r *RingBuffer) Read(p []byte) (n int, err error) {
 		r.isEmpty = true
 	}
 	r.vr = r.r
+	r.vn = 0
 	return
 }
 
@@ -289,6 +336,7 @@ func (r *RingBuffer) ReadByte() (b byte, err error) {
 		r.isEmpty = true
 	}
 	r.vr = r.r
+	r.vn = 0
 	return
 }
 
@@ -408,6 +456,8 @@ func (r *RingBuffer) IsEmpty() bool {
 func (r *RingBuffer) Reset() {
 	r.r = 0
 	r.w = 0
+	r.vr = 0
+	r.vn = 0
 	r.isEmpty = true
 }
 
@@ -421,10 +471,14 @@ func (r *RingBuffer) makeSpace(len int) {
 	newSize := r.size + len
 	newBuf := make([]byte, newSize)
 	oldLen := r.Length()
+	vn := r.vn
 	_, _ = r.Read(newBuf)
 
 	r.w = oldLen
 	r.r = 0
+	// 数据搬到新 buffer 的开头，已经虚读的部分保持不变
+	r.vr = vn
+	r.vn = vn
 	r.size = newSize
 	r.buf = newBuf
 }
@@ -581,7 +581,115 @@ func TestRingBuffer_VirtualXXX(t *testing.T) {
 	if rb.VirtualLength() != 2 {
 		t.Fatal()
 	}
+	// 虚读到末尾再还原，数据不能丢失
+	if first, _ := rb.PeekAll(); !bytes.Equal(first, []byte("34")) {
+		t.Fatalf("expect 34 but got %q", first)
+	}
+
+	// 虚读跨越尾部与头部
+	_, _ = rb.Write([]byte("567890"))
+	buf = make([]byte, 8)
+	n, err := rb.VirtualRead(buf)
+	if err != nil || n != 8 || !bytes.Equal(buf, []byte("34567890")) {
+		t.Fatalf("expect 34567890 but got %q", buf[:n])
+	}
+	if _, err = rb.VirtualRead(buf); err != ErrIsEmpty {
+		t.Fatalf("expect ErrIsEmpty but got %v", err)
+	}
+	rb.VirtualFlush()
+	if !rb.IsEmpty() || rb.Length() != 0 {
+		t.Fatal("expect empty after VirtualFlush")
+	}
+}
+
+func TestRingBuffer_VirtualFull(t *testing.T) {
+	// 写满时 r == w，VirtualLength 不能返回 0
+	rb := New(4)
+	_, _ = rb.Write([]byte("abcd"))
+	if !rb.IsFull() || rb.VirtualLength() != 4 {
+		t.Fatalf("expect 4 but got %d", rb.VirtualLength())
+	}
+
+	// 没有虚读时 VirtualFlush 不能清空数据
+	rb.VirtualFlush()
+	if rb.Length() != 4 || rb.IsEmpty() {
+		t.Fatalf("expect 4 but got %d", rb.Length())
+	}
+
+	// 虚读全部数据之后还原
+	buf := make([]byte, 4)
+	if n, err := rb.VirtualRead(buf); n != 4 || err != nil || !bytes.Equal(buf, []byte("abcd")) {
+		t.Fatalf("expect abcd but got %q %v", buf[:n], err)
+	}
+	if rb.VirtualLength() != 0 || rb.Length() != 4 {
+		t.Fatalf("expect 0 4 but got %d %d", rb.VirtualLength(), rb.Length())
+	}
+	rb.VirtualRevert()
+	if rb.VirtualLength() != 4 || rb.Length() != 4 {
+		t.Fatalf("expect 4 4 but got %d %d", rb.VirtualLength(), rb.Length())
+	}
+
+	// 部分虚读之后刷新
+	if n, _ := rb.VirtualRead(buf[:3]); n != 3 {
+		t.Fatalf("expect 3 but got %d", n)
+	}
+	rb.VirtualFlush()
+	if rb.Length() != 1 || rb.VirtualLength() != 1 || rb.IsEmpty() {
+		t.Fatalf("expect 1 1 but got %d %d", rb.Length(), rb.VirtualLength())
+	}
+	if b, _ := rb.ReadByte(); b != 'd' {
+		t.Fatalf("expect d but got %c", b)
+	}
+}
+
+func TestRingBuffer_VirtualReset(t *testing.T) {
+	// 真实读取之后虚读位置回到读指针
+	rb := New(8)
+	buf := make([]byte, 2)
+	reset := map[string]func(){
+		"Read":        func() { _, _ = rb.Read(buf[:1]) },
+		"ReadByte":    func() { _, _ = rb.ReadByte() },
+		"Retrieve":    func() { rb.Retrieve(1) },
+		"Reset":       func() { rb.Reset(); _, _ = rb.Write([]byte("bcdef")) },
+		"RetrieveAll": func() { rb.RetrieveAll(); _, _ = rb.Write([]byte("bcdef")) },
+	}
+	for name, f := range reset {
+		rb.RetrieveAll()
+		_, _ = rb.Write([]byte("abcdef"))
+		_, _ = rb.VirtualRead(buf)
+		f()
+		if rb.VirtualLength() != 5 {
+			t.Fatalf("%s: expect 5 but got %d", name, rb.VirtualLength())
+		}
+		if n, _ := rb.VirtualRead(buf); n != 2 || !bytes.Equal(buf, []byte("bc")) {
+			t.Fatalf("%s: expect bc but got %q", name, buf[:n])
+		}
+	}
+}
+
+func TestRingBuffer_VirtualGrow(t *testing.T) {
+	// 虚读过程中写入触发扩容，虚读位置与长度保持不变
+	rb := New(4)
+	_, _ = rb.Write([]byte("xxab"))
+	rb.Retrieve(2)
+	_, _ = rb.Write([]byte("cd"))
+	buf := make([]byte, 3)
+	if n, _ := rb.VirtualRead(buf); n != 3 || !bytes.Equal(buf, []byte("abc")) {
+		t.Fatalf("expect abc but got %q", buf[:n])
+	}
 
+	_, _ = rb.Write([]byte("efgh"))
+	if rb.Capacity() <= 4 || rb.Length() != 8 || rb.VirtualLength() != 5 {
+		t.Fatalf("expect 8 5 but got %d %d", rb.Length(), rb.VirtualLength())
+	}
+	buf = make([]byte, 8)
+	if n, _ := rb.VirtualRead(buf); n != 5 || !bytes.Equal(buf[:n], []byte("defgh")) {
+		t.Fatalf("expect defgh but got %q", buf[:n])
+	}
+	rb.VirtualFlush()
+	if !rb.IsEmpty() {
+		t.Fatal("expect empty after VirtualFlush")
+	}
 }
 
 func TestRingBuffer_PeekUintXX(t *testing.T) {
@@ -638,3 +746,85 @@ func TestCopyBytes(t *testing.T) {
 		t.Fatal(string(out))
 	}
 }
+
+func TestRingBuffer_Index(t *testing.T) {
+	rb := New(8)
+	if rb.Index([]byte("a")) != -1 {
+		t.Fatal("expect -1 on empty buffer")
+	}
+
+	// 使数据横跨 buffer 尾部与头部
+	_, _ = rb.Write([]byte("xxxxxx"))
+	_, _ = rb.Read(make([]byte, 6))
+	_, _ = rb.Write([]byte("ab\r\ncd\r\n"))
+	first, end := rb.PeekAll()
+	if len(first) != 2 || len(end) != 6 {
+		t.Fatalf("expect wrapped buffer, got %q %q", first, end)
+	}
+
+	tests := []struct {
+		sep  string
+		want int
+	}{
+		{"ab", 0},
+		{"b\r", 1},
+		{"\r\n", 2},
+		{"cd", 4},
+		{"d\r\n", 5},
+		{"ab\r\ncd\r\n", 0},
+		{"zz", -1},
+		{"\r\n\r\n", -1},
+	}
+	for _, tt := range tests {
+		if got := rb.Index([]byte(tt.sep)); got != tt.want {
+			t.Fatalf("Index(%q) expect %d but got %d", tt.sep, tt.want, got)
+		}
+	}
+
+	rb.Retrieve(1)
+	if got := rb.Index([]byte("b\r\nc")); got != 0 {
+		t.Fatalf("expect 0 but got %d", got)
+	}
+}
+
+func TestRingBuffer_VirtualIndexByte(t *testing.T) {
+	rb := New(8)
+	if rb.VirtualIndexByte('a', 8) != -1 {
+		t.Fatal("expect -1 on empty buffer")
+	}
+
+	// 使数据横跨 buffer 尾部与头部
+	_, _ = rb.Write([]byte("xxxxxx"))
+	_, _ = rb.Read(make([]byte, 6))
+	_, _ = rb.Write([]byte("ab\ncd\nef"))
+
+	tests := []struct {
+		c     byte
+		limit int
+		want  int
+	}{
+		{'a', 8, 0},
+		{'\n', 8, 2},
+		{'f', 8, 7},
+		{'f', 7, -1},
+		{'z', 100, -1},
+	}
+	for _, tt := range tests {
+		if got := rb.VirtualIndexByte(tt.c, tt.limit); got != tt.want {
+			t.Fatalf("VirtualIndexByte(%q, %d) expect %d but got %d", tt.c, tt.limit, tt.want, got)
+		}
+	}
+
+	// 相对虚读指针查找
+	_, _ = rb.VirtualRead(make([]byte, 3))
+	if got := rb.VirtualIndexByte('\n', 8); got != 2 {
+		t.Fatalf("expect 2 but got %d", got)
+	}
+	if got := rb.VirtualIndexByte('a', 8); got != -1 {
+		t.Fatalf("expect -1 but got %d", got)
+	}
+	rb.VirtualRevert()
+	if got := rb.VirtualIndexByte('a', 8); got != 0 {
+		t.Fatalf("expect 0 but got %d", got)
+	}
+}
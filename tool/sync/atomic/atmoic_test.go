@@ -83,3 +83,14 @@ func TestInt64(t *testing.T) {
 		t.Fatal("expect 0 but get ", count.Get())
 	}
 }
+
+// TestInt64_CompareAndSwap：测试 Int64 CompareAndSwap
+func TestInt64_CompareAndSwap(t *testing.T) {
+	var v Int64
+	if v.CompareAndSwap(1, 2) || v.Get() != 0 {
+		t.Fatal("expect swap fail, but get ", v.Get())
+	}
+	if !v.CompareAndSwap(0, 2) || v.Get() != 2 {
+		t.Fatal("expect 2, but get ", v.Get())
+	}
+}
@@ -41,3 +41,8 @@ func (a *Int64) Swap(i int64) int64 {
 func (a *Int64) Get() int64 {
 	return atomic.LoadInt64(&a.v)
 }
+
+// CompareAndSwap：值等于 old 时替换为 new，返回是否替换成功
+func (a *Int64) CompareAndSwap(old, new int64) bool {
+	return atomic.CompareAndSwapInt64(&a.v, old, new)
+}